@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/polonkoevv/ethcourse/internal/chain"
+	"github.com/polonkoevv/ethcourse/internal/contract"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/relayer"
+	"github.com/polonkoevv/ethcourse/internal/signer"
+)
+
+const usage = `Использование: ethcourse <команда> [флаги]
+
+Команды:
+  serve          запуск HTTP-сервера (по умолчанию)
+  deploy         развёртывание AudioChain из артефакта Truffle с записью адреса в конфигурацию сетей
+  fees           комиссия платформы на балансе контракта
+  withdraw-fees  вывод комиссии платформы на адрес
+  audios         список аудио контракта
+  access         доступ кошелька к аудио
+
+Сети настраиваются так же, как для сервера: CHAINS_CONFIG или RPC_URL, CHAIN_ID,
+CONTRACT_ADDRESS. Транзакции подписываются ключом из SIGNER_URL, SIGNER_KEYSTORE
+или RELAYER_PRIVATE_KEY. Флаги команды: ethcourse <команда> -h
+`
+
+// Время ожидания включения транзакции команды в блок
+const commandReceiptTimeout = 5 * time.Minute
+
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"deploy":        deployCommand,
+	"fees":          feesCommand,
+	"withdraw-fees": withdrawFeesCommand,
+	"audios":        audiosCommand,
+	"access":        accessCommand,
+}
+
+func runCommand(ctx context.Context, name string, args []string) error {
+	if name == "help" || name == "-h" || name == "--help" {
+		fmt.Print(usage)
+		return nil
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("неизвестная команда %s", name)
+	}
+	return cmd(ctx, args)
+}
+
+// openChain подключается к сети chainID из настроек сервера; 0 — сеть по умолчанию
+func openChain(ctx context.Context, configs []chain.Config, chainID uint64) (*chain.Registry, *chain.Chain, error) {
+	chains, err := chain.NewRegistry(ctx, configs)
+	if err != nil {
+		return nil, nil, err
+	}
+	if chainID == 0 {
+		return chains, chains.Default(), nil
+	}
+	c, ok := chains.Get(chainID)
+	if !ok {
+		chains.Close()
+		return nil, nil, fmt.Errorf("сеть %d не настроена", chainID)
+	}
+	return chains, c, nil
+}
+
+// openContractChain подключается к сети и проверяет, что для неё указан адрес AudioChain
+func openContractChain(ctx context.Context, chainID uint64) (*chain.Registry, *chain.Chain, error) {
+	configs, err := chain.LoadConfigs()
+	if err != nil {
+		return nil, nil, err
+	}
+	chains, c, err := openChain(ctx, configs, chainID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !c.HasContract() {
+		chains.Close()
+		return nil, nil, fmt.Errorf("для сети %d не указан адрес контракта, сначала выполните deploy", c.ID)
+	}
+	return chains, c, nil
+}
+
+// openRelayer создаёт отправителя транзакций с ключом платформы. Nonce выбирается под
+// блокировкой в Postgres, общей с сервером, и записывается в outgoing_transactions,
+// поэтому команды можно выполнять при работающем сервере с той же базой.
+func openRelayer(ctx context.Context) (*relayer.Relayer, error) {
+	txSigner, err := signer.FromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if txSigner == nil {
+		return nil, errors.New("не задан ключ для подписи: SIGNER_URL, SIGNER_KEYSTORE или RELAYER_PRIVATE_KEY")
+	}
+	pg, err := openPostgres()
+	if err != nil {
+		return nil, err
+	}
+	return relayer.New(txSigner, pg), nil
+}
+
+// waitCommandTx ожидает включения транзакции команды в блок
+func waitCommandTx(ctx context.Context, rel *relayer.Relayer, c *chain.Chain, tx *types.Transaction) (*types.Receipt, error) {
+	fmt.Printf("Транзакция %s отправлена, ожидание включения в блок...\n", tx.Hash().Hex())
+	waitCtx, cancel := context.WithTimeout(ctx, commandReceiptTimeout)
+	defer cancel()
+
+	receipt, err := rel.WaitReceipt(waitCtx, c, tx.Hash())
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("транзакция %s не попала в блок за %s; она отслеживается сервером, её можно ускорить через /admin/transactions", tx.Hash().Hex(), commandReceiptTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Транзакция %s включена в блок %d\n", receipt.TxHash.Hex(), receipt.BlockNumber.Uint64())
+	return receipt, nil
+}
+
+func deployCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("deploy", flag.ExitOnError)
+	chainID := fs.Uint64("chain", 0, "chain ID сети (по умолчанию первая настроенная)")
+	artifactPath := fs.String("artifact", "../frontend/build/contracts/AudioChain.json", "артефакт компиляции Truffle")
+	defaultConfig := os.Getenv("CHAINS_CONFIG")
+	if defaultConfig == "" {
+		defaultConfig = "chains.json"
+	}
+	configPath := fs.String("config", defaultConfig, "файл конфигурации сетей, в который записывается адрес")
+	force := fs.Bool("force", false, "развернуть новый контракт, даже если адрес уже указан")
+	fs.Parse(args)
+
+	configs, err := chain.LoadConfigs()
+	if err != nil {
+		return err
+	}
+	chains, c, err := openChain(ctx, configs, *chainID)
+	if err != nil {
+		return err
+	}
+	defer chains.Close()
+	if c.HasContract() && !*force {
+		return fmt.Errorf("для сети %d уже указан контракт %s; -force развернёт новый", c.ID, c.Contract.Hex())
+	}
+
+	code, err := contract.LoadBytecode(*artifactPath)
+	if err != nil {
+		return err
+	}
+	rel, err := openRelayer(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Развёртывание AudioChain в сети %d от имени %s\n", c.ID, rel.Address().Hex())
+	tx, err := rel.Deploy(ctx, c, code)
+	if err != nil {
+		return err
+	}
+	receipt, err := waitCommandTx(ctx, rel, c, tx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Контракт AudioChain развёрнут по адресу %s\n", receipt.ContractAddress.Hex())
+
+	// Индексатор начнёт с блока развёртывания: раньше событий контракта нет
+	for i := range configs {
+		if configs[i].ChainID == c.ID {
+			configs[i].ContractAddress = receipt.ContractAddress.Hex()
+			configs[i].StartBlock = receipt.BlockNumber.Uint64()
+		}
+	}
+	if err := chain.SaveConfigs(*configPath, configs); err != nil {
+		return err
+	}
+	fmt.Printf("Адрес записан в %s\n", *configPath)
+	if os.Getenv("CHAINS_CONFIG") != *configPath {
+		fmt.Printf("Чтобы сервер использовал его, запустите его с CHAINS_CONFIG=%s\n", *configPath)
+	}
+	return nil
+}
+
+func feesCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("fees", flag.ExitOnError)
+	chainID := fs.Uint64("chain", 0, "chain ID сети (по умолчанию первая настроенная)")
+	fs.Parse(args)
+
+	chains, c, err := openContractChain(ctx, *chainID)
+	if err != nil {
+		return err
+	}
+	defer chains.Close()
+
+	// Продавцу выплата переводится сразу, поэтому весь баланс контракта — комиссия
+	balance, err := c.Client.BalanceAt(ctx, c.Contract, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка получения баланса контракта: %w", err)
+	}
+	fmt.Printf("Комиссия платформы на контракте %s (сеть %d): %s wei (%s ETH)\n", c.Contract.Hex(), c.ID, balance, formatEther(balance))
+	return nil
+}
+
+func withdrawFeesCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("withdraw-fees", flag.ExitOnError)
+	chainID := fs.Uint64("chain", 0, "chain ID сети (по умолчанию первая настроенная)")
+	to := fs.String("to", "", "адрес получателя комиссии (обязательный)")
+	fs.Parse(args)
+
+	if !common.IsHexAddress(*to) {
+		return fmt.Errorf("некорректный адрес получателя: %q", *to)
+	}
+	recipient := common.HexToAddress(*to)
+
+	chains, c, err := openContractChain(ctx, *chainID)
+	if err != nil {
+		return err
+	}
+	defer chains.Close()
+
+	balance, err := c.Client.BalanceAt(ctx, c.Contract, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка получения баланса контракта: %w", err)
+	}
+	if balance.Sign() == 0 {
+		fmt.Println("На контракте нет комиссии для вывода")
+		return nil
+	}
+
+	data, err := contract.PackWithdrawPlatformFees(recipient)
+	if err != nil {
+		return err
+	}
+	rel, err := openRelayer(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Вывод %s ETH на %s\n", formatEther(balance), recipient.Hex())
+	tx, err := rel.Send(ctx, c, c.Contract, nil, data, model.TxPurposeWithdrawFees)
+	if err != nil {
+		return err
+	}
+	if _, err := waitCommandTx(ctx, rel, c, tx); err != nil {
+		return err
+	}
+	fmt.Printf("Комиссия выведена на %s\n", recipient.Hex())
+	return nil
+}
+
+func audiosCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("audios", flag.ExitOnError)
+	chainID := fs.Uint64("chain", 0, "chain ID сети (по умолчанию первая настроенная)")
+	owner := fs.String("owner", "", "показать только аудио владельца")
+	fs.Parse(args)
+
+	var ownerAddr common.Address
+	if *owner != "" {
+		if !common.IsHexAddress(*owner) {
+			return fmt.Errorf("некорректный адрес владельца: %q", *owner)
+		}
+		ownerAddr = common.HexToAddress(*owner)
+	}
+
+	chains, c, err := openContractChain(ctx, *chainID)
+	if err != nil {
+		return err
+	}
+	defer chains.Close()
+
+	count, err := audioCount(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tНазвание\tИсполнитель\tЦена, wei\tВладелец\tПродаётся\tIPFS")
+	for id := uint64(1); id <= count; id++ {
+		audio, err := getAudio(ctx, c, id)
+		if err != nil {
+			return err
+		}
+		if *owner != "" && audio.Owner != ownerAddr {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\t%s\n", audio.ID, audio.Title, audio.Artist, audio.Price, audio.Owner.Hex(), audio.IsForSale, audio.IpfsHash)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("Всего аудио в контракте: %d\n", count)
+	return nil
+}
+
+func accessCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("access", flag.ExitOnError)
+	chainID := fs.Uint64("chain", 0, "chain ID сети (по умолчанию первая настроенная)")
+	wallet := fs.String("wallet", "", "адрес кошелька (обязательный)")
+	audioID := fs.Uint64("audio", 0, "ID аудио; без него выводятся все аудио, доступные кошельку")
+	fs.Parse(args)
+
+	if !common.IsHexAddress(*wallet) {
+		return fmt.Errorf("некорректный адрес кошелька: %q", *wallet)
+	}
+	user := common.HexToAddress(*wallet)
+
+	chains, c, err := openContractChain(ctx, *chainID)
+	if err != nil {
+		return err
+	}
+	defer chains.Close()
+
+	if *audioID != 0 {
+		audio, err := getAudio(ctx, c, *audioID)
+		if err != nil {
+			return err
+		}
+		if audio.ID.Sign() == 0 {
+			return fmt.Errorf("аудио %d не найдено в контракте", *audioID)
+		}
+		access, err := hasAccess(ctx, c, user, *audioID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Аудио %d «%s» (%s), владелец %s, цена %s wei\n", *audioID, audio.Title, audio.Artist, audio.Owner.Hex(), audio.Price)
+		switch {
+		case audio.Owner == user:
+			fmt.Printf("Кошелёк %s — владелец аудио\n", user.Hex())
+		case access:
+			fmt.Printf("Кошелёк %s купил доступ к аудио\n", user.Hex())
+		default:
+			fmt.Printf("У кошелька %s нет доступа к аудио\n", user.Hex())
+		}
+		return nil
+	}
+
+	count, err := audioCount(ctx, c)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tНазвание\tИсполнитель\tДоступ")
+	found := 0
+	for id := uint64(1); id <= count; id++ {
+		access, err := hasAccess(ctx, c, user, id)
+		if err != nil {
+			return err
+		}
+		if !access {
+			continue
+		}
+		audio, err := getAudio(ctx, c, id)
+		if err != nil {
+			return err
+		}
+		kind := "покупка"
+		if audio.Owner == user {
+			kind = "владелец"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", id, audio.Title, audio.Artist, kind)
+		found++
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("Кошельку %s доступно аудио: %d из %d\n", user.Hex(), found, count)
+	return nil
+}
+
+func callContract(ctx context.Context, c *chain.Chain, data []byte) ([]byte, error) {
+	return c.Client.CallContract(ctx, ethereum.CallMsg{To: &c.Contract, Data: data}, nil)
+}
+
+func audioCount(ctx context.Context, c *chain.Chain) (uint64, error) {
+	data, err := contract.PackGetAudioCount()
+	if err != nil {
+		return 0, err
+	}
+	result, err := callContract(ctx, c, data)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка вызова getAudioCount: %w", err)
+	}
+	return contract.UnpackAudioCount(result)
+}
+
+func getAudio(ctx context.Context, c *chain.Chain, id uint64) (*contract.Audio, error) {
+	data, err := contract.PackGetAudio(new(big.Int).SetUint64(id))
+	if err != nil {
+		return nil, err
+	}
+	result, err := callContract(ctx, c, data)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения аудио %d: %w", id, err)
+	}
+	return contract.UnpackAudio(result)
+}
+
+func hasAccess(ctx context.Context, c *chain.Chain, user common.Address, id uint64) (bool, error) {
+	data, err := contract.PackHasAccess(user, new(big.Int).SetUint64(id))
+	if err != nil {
+		return false, err
+	}
+	result, err := callContract(ctx, c, data)
+	if err != nil {
+		return false, fmt.Errorf("ошибка вызова hasAccess: %w", err)
+	}
+	return contract.UnpackHasAccess(result)
+}
+
+// formatEther переводит сумму в wei в ETH с точностью до 18 знаков без лишних нулей
+func formatEther(wei *big.Int) string {
+	s := new(big.Rat).SetFrac(wei, big.NewInt(1e18)).FloatString(18)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
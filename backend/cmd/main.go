@@ -1,28 +1,108 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"math/big"
 	"net/http"
+	"os"
 
 	shell "github.com/ipfs/go-ipfs-api"
+	"github.com/polonkoevv/ethcourse/internal/chain"
 	"github.com/polonkoevv/ethcourse/internal/handler"
+	"github.com/polonkoevv/ethcourse/internal/indexer"
+	"github.com/polonkoevv/ethcourse/internal/relayer"
 	"github.com/polonkoevv/ethcourse/internal/service"
+	"github.com/polonkoevv/ethcourse/internal/signer"
 	"github.com/polonkoevv/ethcourse/internal/storage/postgres"
 )
 
+// Без аргументов или с serve запускается HTTP-сервер, остальные подкоманды —
+// административные операции с контрактом (см. usage)
 func main() {
+	if len(os.Args) < 2 || os.Args[1] == "serve" {
+		serve()
+		return
+	}
+	if err := runCommand(context.Background(), os.Args[1], os.Args[2:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func openPostgres() (*postgres.Postgres, error) {
+	return postgres.NewPostgres("0.0.0.0", "5432", "postgres", "postgres", "ipfs")
+}
+
+func serve() {
 	// Подключение к локальному узлу IPFS
 	sh := shell.NewShell("localhost:5001")
 
-	pg, err := postgres.NewPostgres("0.0.0.0", "5432", "postgres", "postgres", "ipfs")
+	pg, err := openPostgres()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	srv := service.NewService(sh, pg)
+	// Политика для загрузок, совпавших по звучанию с чужим треком: flag (по умолчанию) или reject
+	duplicatePolicy := service.DuplicatePolicyFlag
+	if os.Getenv("DUPLICATE_POLICY") == string(service.DuplicatePolicyReject) {
+		duplicatePolicy = service.DuplicatePolicyReject
+	}
+
+	// Сети задаются файлом CHAINS_CONFIG или переменными RPC_URL, CHAIN_ID, CONTRACT_ADDRESS,
+	// CONFIRMATIONS и START_BLOCK
+	chainConfigs, err := chain.LoadConfigs()
+	if err != nil {
+		log.Fatal(err)
+	}
+	chains, err := chain.NewRegistry(context.Background(), chainConfigs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer chains.Close()
+
+	// Ключ аккаунта, с которого бэкенд публикует треки и исполняет намерения пользователей:
+	// SIGNER_URL, SIGNER_KEYSTORE или RELAYER_PRIVATE_KEY (см. signer.FromEnv). Без него
+	// загрузка с ценой и намерения не принимаются.
+	txSigner, err := signer.FromEnv(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	var rel *relayer.Relayer
+	if txSigner != nil {
+		rel = relayer.New(txSigner, pg)
+		// Наибольшая цена покупки, которую ретранслятор оплачивает из депозита пользователя
+		if v := os.Getenv("RELAYER_MAX_VALUE_WEI"); v != "" {
+			maxValue, ok := new(big.Int).SetString(v, 10)
+			if !ok || maxValue.Sign() < 0 {
+				log.Fatalf("некорректный RELAYER_MAX_VALUE_WEI: %s", v)
+			}
+			rel.MaxValue = maxValue
+		}
+		fmt.Printf("Публикация в контракт от имени %s\n", rel.Address().Hex())
+
+		// Отслеживание отправленных транзакций, в том числе оставшихся с прошлого запуска
+		go rel.Track(context.Background(), chains.All())
+	}
+
+	srv := service.NewService(sh, pg, duplicatePolicy, chains, rel)
+	// Обложка по умолчанию в метаданных токенов: ipfs://<CID> или https-ссылка
+	srv.DefaultCoverImage = os.Getenv("METADATA_DEFAULT_IMAGE")
+
+	// Ретранслятор исполняет подписанные пользователями намерения
+	go srv.RunRelayer(context.Background())
+
+	// Индексатор событий AudioChain запускается для каждой сети с адресом контракта
+	for _, c := range chains.All() {
+		if !c.HasContract() {
+			continue
+		}
+		idx := indexer.NewIndexer(c, pg, srv.PublishBlocks)
+		go idx.Run(context.Background())
+	}
 
-	h := handler.NewHandler(srv)
+	// Токен для административных эндпоинтов; если не задан, они недоступны
+	h := handler.NewHandler(srv, os.Getenv("ADMIN_TOKEN"))
 
 	r := h.CreateRouter()
 
@@ -0,0 +1,81 @@
+// signer-stub — локальный сервис подписи с API account_* как у clef, чтобы проверять
+// бэкенд с SIGNER_URL без настоящего clef. Ключ берётся из STUB_PRIVATE_KEY или
+// SIGNER_KEYSTORE/SIGNER_PASSWORD, адрес прослушивания — STUB_ADDR (по умолчанию
+// 127.0.0.1:8550). Транзакции подписываются без подтверждения, только для разработки.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/polonkoevv/ethcourse/internal/signer"
+)
+
+// accountAPI реализует методы account_list, account_signTransaction и account_version
+type accountAPI struct {
+	signer *signer.Local
+}
+
+func (a *accountAPI) List() []common.Address {
+	return []common.Address{a.signer.Address()}
+}
+
+func (a *accountAPI) Version() string {
+	return "6.0.0"
+}
+
+func (a *accountAPI) SignTransaction(ctx context.Context, args apitypes.SendTxArgs, methodSelector *string) (*signer.SignTransactionResult, error) {
+	if args.From.Address() != a.signer.Address() {
+		return nil, fmt.Errorf("неизвестный аккаунт %s", args.From.Address().Hex())
+	}
+	if args.ChainID == nil {
+		return nil, fmt.Errorf("не указан chainId")
+	}
+	tx, err := args.ToTransaction()
+	if err != nil {
+		return nil, err
+	}
+	signed, err := a.signer.SignTx(ctx, tx, args.ChainID.ToInt())
+	if err != nil {
+		return nil, err
+	}
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Подписана транзакция %s, nonce %d\n", signed.Hash().Hex(), signed.Nonce())
+	return &signer.SignTransactionResult{Raw: raw, Tx: signed}, nil
+}
+
+func main() {
+	var (
+		local *signer.Local
+		err   error
+	)
+	if key := os.Getenv("STUB_PRIVATE_KEY"); key != "" {
+		local, err = signer.NewKey(key)
+	} else {
+		local, err = signer.NewKeystore(os.Getenv("SIGNER_KEYSTORE"), os.Getenv("SIGNER_PASSWORD"))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", &accountAPI{signer: local}); err != nil {
+		log.Fatal(err)
+	}
+
+	addr := os.Getenv("STUB_ADDR")
+	if addr == "" {
+		addr = "127.0.0.1:8550"
+	}
+	fmt.Printf("Сервис подписи для %s слушает %s\n", local.Address().Hex(), addr)
+	log.Fatal(http.ListenAndServe(addr, server))
+}
@@ -0,0 +1,135 @@
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"os/exec"
+)
+
+// Параметры отпечатка по схеме Haitsma–Kalker: каждый кадр даёт 32-битный суботпечаток
+// из знаков разностей энергий 33 логарифмических полос в диапазоне 300–2000 Гц.
+const (
+	fingerprintSampleRate = 5512
+	fingerprintFrameSize  = 2048
+	fingerprintHopSize    = 128
+	fingerprintBands      = 33
+	fingerprintMinFreq    = 300.0
+	fingerprintMaxFreq    = 2000.0
+	// Анализируется не более 10 минут аудио
+	fingerprintMaxSeconds = 600
+)
+
+// FingerprintLength возвращает количество суботпечатков, соответствующее seconds секундам аудио
+func FingerprintLength(seconds int) int {
+	return seconds * fingerprintSampleRate / fingerprintHopSize
+}
+
+// Fingerprint вычисляет перцептивный отпечаток аудиопотока, декодируя его через ffmpeg
+func Fingerprint(ctx context.Context, r io.Reader) ([]uint32, error) {
+	cmd := exec.CommandContext(ctx, FFmpegPath,
+		"-hide_banner", "-nostats", "-loglevel", "error",
+		"-i", "pipe:0",
+		"-t", fmt.Sprint(fingerprintMaxSeconds),
+		"-ac", "1",
+		"-ar", fmt.Sprint(fingerprintSampleRate),
+		"-f", "s16le", "-",
+	)
+	cmd.Stdin = r
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ошибка декодирования через ffmpeg: %w: %s", err, lastLine(stderr.String()))
+	}
+
+	raw := stdout.Bytes()
+	samples := make([]float64, len(raw)/2)
+	for i := range samples {
+		samples[i] = float64(int16(binary.LittleEndian.Uint16(raw[2*i:]))) / math.MaxInt16
+	}
+
+	fp := fingerprintPCM(samples)
+	if len(fp) == 0 {
+		return nil, fmt.Errorf("аудио слишком короткое для вычисления отпечатка")
+	}
+	return fp, nil
+}
+
+// fingerprintPCM вычисляет суботпечатки по моно-PCM с частотой fingerprintSampleRate
+func fingerprintPCM(samples []float64) []uint32 {
+	if len(samples) < fingerprintFrameSize {
+		return nil
+	}
+
+	window := hannWindow(fingerprintFrameSize)
+	edges := bandEdges()
+	frame := make([]complex128, fingerprintFrameSize)
+
+	var result []uint32
+	var prev []float64
+	for start := 0; start+fingerprintFrameSize <= len(samples); start += fingerprintHopSize {
+		for i := range frame {
+			frame[i] = complex(samples[start+i]*window[i], 0)
+		}
+		fft(frame)
+
+		energy := make([]float64, fingerprintBands)
+		for b := 0; b < fingerprintBands; b++ {
+			for k := edges[b]; k < edges[b+1]; k++ {
+				re, im := real(frame[k]), imag(frame[k])
+				energy[b] += re*re + im*im
+			}
+		}
+
+		if prev != nil {
+			var sub uint32
+			for m := 0; m < fingerprintBands-1; m++ {
+				diff := (energy[m] - energy[m+1]) - (prev[m] - prev[m+1])
+				if diff > 0 {
+					sub |= 1 << uint(m)
+				}
+			}
+			result = append(result, sub)
+		}
+		prev = energy
+	}
+	return result
+}
+
+// bandEdges возвращает границы полос в номерах бинов БПФ (логарифмическая шкала)
+func bandEdges() []int {
+	edges := make([]int, fingerprintBands+1)
+	ratio := math.Pow(fingerprintMaxFreq/fingerprintMinFreq, 1/float64(fingerprintBands))
+	for i := range edges {
+		freq := fingerprintMinFreq * math.Pow(ratio, float64(i))
+		edges[i] = int(math.Round(freq * fingerprintFrameSize / fingerprintSampleRate))
+	}
+	return edges
+}
+
+// BitErrorRate сравнивает отпечатки при сдвиге offset (позиция a[i] соответствует b[i+offset]).
+// Возвращает долю несовпадающих бит и число сравнённых суботпечатков.
+func BitErrorRate(a, b []uint32, offset int) (float64, int) {
+	var errs, n int
+	for i := range a {
+		j := i + offset
+		if j < 0 {
+			continue
+		}
+		if j >= len(b) {
+			break
+		}
+		errs += bits.OnesCount32(a[i] ^ b[j])
+		n++
+	}
+	if n == 0 {
+		return 1, 0
+	}
+	return float64(errs) / float64(n*32), n
+}
@@ -0,0 +1,178 @@
+package analysis
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestBitErrorRate(t *testing.T) {
+	tests := []struct {
+		name        string
+		a, b        []uint32
+		offset      int
+		wantRate    float64
+		wantOverlap int
+	}{
+		{
+			name:        "одинаковые отпечатки",
+			a:           []uint32{1, 2, 3, 4},
+			b:           []uint32{1, 2, 3, 4},
+			wantRate:    0,
+			wantOverlap: 4,
+		},
+		{
+			name:        "все биты различны",
+			a:           []uint32{0, 0},
+			b:           []uint32{math.MaxUint32, math.MaxUint32},
+			wantRate:    1,
+			wantOverlap: 2,
+		},
+		{
+			name:        "один бит из 64",
+			a:           []uint32{0xff, 0x0f},
+			b:           []uint32{0xff, 0x0e},
+			wantRate:    1.0 / 64,
+			wantOverlap: 2,
+		},
+		{
+			name:        "фрагмент из середины",
+			a:           []uint32{7, 8, 9},
+			b:           []uint32{5, 6, 7, 8, 9, 10},
+			offset:      2,
+			wantRate:    0,
+			wantOverlap: 3,
+		},
+		{
+			name:        "отрицательный сдвиг",
+			a:           []uint32{5, 6, 7, 8},
+			b:           []uint32{7, 8},
+			offset:      -2,
+			wantRate:    0,
+			wantOverlap: 2,
+		},
+		{
+			name:        "сдвиг за пределы отпечатка",
+			a:           []uint32{1, 2},
+			b:           []uint32{1, 2},
+			offset:      5,
+			wantRate:    1,
+			wantOverlap: 0,
+		},
+		{
+			name:        "пустой отпечаток",
+			a:           nil,
+			b:           []uint32{1},
+			wantRate:    1,
+			wantOverlap: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, overlap := BitErrorRate(tt.a, tt.b, tt.offset)
+			if rate != tt.wantRate || overlap != tt.wantOverlap {
+				t.Errorf("BitErrorRate() = (%v, %d), want (%v, %d)", rate, overlap, tt.wantRate, tt.wantOverlap)
+			}
+		})
+	}
+}
+
+func TestFingerprintLength(t *testing.T) {
+	tests := []struct {
+		seconds int
+		want    int
+	}{
+		{0, 0},
+		{1, 43},
+		{5, 215},
+		{60, 2583},
+	}
+	for _, tt := range tests {
+		if got := FingerprintLength(tt.seconds); got != tt.want {
+			t.Errorf("FingerprintLength(%d) = %d, want %d", tt.seconds, got, tt.want)
+		}
+	}
+}
+
+// testSignal — шум с медленно меняющейся громкостью: энергия есть во всех полосах,
+// как у музыки, и запись однозначно задаётся seed
+func testSignal(seed int64, seconds float64) []float64 {
+	rng := rand.New(rand.NewSource(seed))
+	samples := make([]float64, int(seconds*fingerprintSampleRate))
+	for n := range samples {
+		t := float64(n) / fingerprintSampleRate
+		samples[n] = (0.6 + 0.4*math.Sin(2*math.Pi*1.3*t)) * rng.NormFloat64() * 0.3
+	}
+	return samples
+}
+
+func TestFingerprintMatching(t *testing.T) {
+	original := fingerprintPCM(testSignal(1, 8))
+	if len(original) == 0 {
+		t.Fatal("пустой отпечаток")
+	}
+
+	noisy := testSignal(1, 8)
+	rng := rand.New(rand.NewSource(7))
+	for i := range noisy {
+		noisy[i] += 0.01 * rng.NormFloat64()
+	}
+
+	// Фрагмент, начинающийся ровно через 100 шагов окна, совпадает со сдвигом 100
+	fragment := testSignal(1, 8)[100*fingerprintHopSize:]
+
+	tests := []struct {
+		name     string
+		query    []uint32
+		offset   int
+		maxRate  float64
+		minRate  float64
+		minItems int
+	}{
+		{
+			name:     "та же запись",
+			query:    fingerprintPCM(testSignal(1, 8)),
+			maxRate:  0,
+			minItems: len(original),
+		},
+		{
+			name:     "запись с шумом",
+			query:    fingerprintPCM(noisy),
+			maxRate:  0.2,
+			minItems: len(original),
+		},
+		{
+			name:     "фрагмент со сдвигом",
+			query:    fingerprintPCM(fragment),
+			offset:   100,
+			maxRate:  0,
+			minItems: FingerprintLength(5),
+		},
+		{
+			name:     "другая запись",
+			query:    fingerprintPCM(testSignal(2, 8)),
+			maxRate:  1,
+			minRate:  0.35,
+			minItems: len(original),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, overlap := BitErrorRate(tt.query, original, tt.offset)
+			if overlap < tt.minItems {
+				t.Fatalf("сравнено %d суботпечатков, want не меньше %d", overlap, tt.minItems)
+			}
+			if rate > tt.maxRate || rate < tt.minRate {
+				t.Errorf("BitErrorRate() = %v, want в диапазоне [%v, %v]", rate, tt.minRate, tt.maxRate)
+			}
+		})
+	}
+}
+
+func TestFingerprintPCMShort(t *testing.T) {
+	if fp := fingerprintPCM(make([]float64, fingerprintFrameSize-1)); fp != nil {
+		t.Errorf("fingerprintPCM() для короткого аудио = %d суботпечатков, want nil", len(fp))
+	}
+}
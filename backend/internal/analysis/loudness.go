@@ -0,0 +1,103 @@
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// FFmpegPath — путь к исполняемому файлу ffmpeg
+var FFmpegPath = "ffmpeg"
+
+var (
+	integratedRe = regexp.MustCompile(`I:\s+(-?[\d.]+|-inf)\s+LUFS`)
+	rangeRe      = regexp.MustCompile(`LRA:\s+(-?[\d.]+)\s+LU`)
+	truePeakRe   = regexp.MustCompile(`Peak:\s+(-?[\d.]+|-inf)\s+dBFS`)
+	// Покадровый вывод ebur128: "t: 12.3  TARGET:-23 LUFS ..."
+	frameTimeRe = regexp.MustCompile(`\bt:\s*([\d.]+)\s+TARGET`)
+)
+
+// MeasureLoudness измеряет громкость аудиопотока фильтром ebur128 из ffmpeg и возвращает
+// длительность аудио в секундах по времени последнего кадра измерения
+func MeasureLoudness(ctx context.Context, r io.Reader) (*model.Loudness, float64, error) {
+	cmd := exec.CommandContext(ctx, FFmpegPath,
+		"-hide_banner", "-nostats",
+		"-i", "pipe:0",
+		"-filter_complex", "ebur128=peak=true",
+		"-f", "null", "-",
+	)
+	cmd.Stdin = r
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, 0, fmt.Errorf("ошибка запуска ffmpeg: %w: %s", err, lastLine(stderr.String()))
+	}
+
+	loudness, err := parseSummary(stderr.String())
+	if err != nil {
+		return nil, 0, err
+	}
+	return loudness, parseDuration(stderr.String()), nil
+}
+
+// parseDuration возвращает время последнего кадра ebur128; 0 — кадров в выводе нет
+func parseDuration(output string) float64 {
+	matches := frameTimeRe.FindAllStringSubmatch(output, -1)
+	if len(matches) == 0 {
+		return 0
+	}
+	duration, err := strconv.ParseFloat(matches[len(matches)-1][1], 64)
+	if err != nil {
+		return 0
+	}
+	return duration
+}
+
+// parseSummary разбирает итоговый блок "Summary:" из вывода ebur128
+func parseSummary(output string) (*model.Loudness, error) {
+	idx := strings.LastIndex(output, "Summary:")
+	if idx < 0 {
+		return nil, fmt.Errorf("в выводе ffmpeg нет итогов ebur128")
+	}
+	summary := output[idx:]
+
+	integrated, err := matchFloat(integratedRe, summary)
+	if err != nil {
+		return nil, fmt.Errorf("интегральная громкость: %w", err)
+	}
+	lra, err := matchFloat(rangeRe, summary)
+	if err != nil {
+		return nil, fmt.Errorf("диапазон громкости: %w", err)
+	}
+	truePeak, err := matchFloat(truePeakRe, summary)
+	if err != nil {
+		return nil, fmt.Errorf("истинный пик: %w", err)
+	}
+
+	return model.NewLoudness(integrated, lra, truePeak), nil
+}
+
+func matchFloat(re *regexp.Regexp, s string) (float64, error) {
+	m := re.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("значение не найдено")
+	}
+	// Для тишины ffmpeg выводит -inf; ограничиваем нижней границей гейта EBU R128
+	if m[1] == "-inf" {
+		return -70, nil
+	}
+	return strconv.ParseFloat(m[1], 64)
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return lines[len(lines)-1]
+}
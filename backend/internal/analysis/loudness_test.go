@@ -0,0 +1,117 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+const ebur128Frames = `[Parsed_ebur128_0 @ 0x5581] t: 0.499977   TARGET:-23 LUFS    M: -24.1 S:-120.7     I: -24.1 LUFS       LRA:   0.0 LU  FTPK:  -6.2 dBFS  TPK:  -6.2 dBFS
+[Parsed_ebur128_0 @ 0x5581] t: 0.999977   TARGET:-23 LUFS    M: -17.9 S:-120.7     I: -19.7 LUFS       LRA:   0.0 LU  FTPK:  -1.1 dBFS  TPK:  -1.1 dBFS
+`
+
+const ebur128Summary = `[Parsed_ebur128_0 @ 0x5581] Summary:
+
+  Integrated loudness:
+    I:         -16.2 LUFS
+    Threshold: -26.5 LUFS
+
+  Loudness range:
+    LRA:         6.3 LU
+    Threshold: -36.6 LUFS
+    LRA low:   -20.5 LUFS
+    LRA high:  -14.2 LUFS
+
+  True peak:
+    Peak:       -0.4 dBFS
+`
+
+const ebur128SilentSummary = `[Parsed_ebur128_0 @ 0x5581] Summary:
+
+  Integrated loudness:
+    I:         -70.0 LUFS
+    Threshold:   0.0 LUFS
+
+  Loudness range:
+    LRA:         0.0 LU
+    Threshold:   0.0 LUFS
+    LRA low:     0.0 LUFS
+    LRA high:    0.0 LUFS
+
+  True peak:
+    Peak:        -inf dBFS
+`
+
+func TestParseSummary(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    *model.Loudness
+		wantErr bool
+	}{
+		{
+			name:   "итоги после покадрового вывода",
+			output: ebur128Frames + ebur128Summary,
+			want:   model.NewLoudness(-16.2, 6.3, -0.4),
+		},
+		{
+			name:   "тишина",
+			output: ebur128SilentSummary,
+			want:   model.NewLoudness(-70, 0, -70),
+		},
+		{
+			name:   "берутся последние итоги",
+			output: ebur128SilentSummary + ebur128Frames + ebur128Summary,
+			want:   model.NewLoudness(-16.2, 6.3, -0.4),
+		},
+		{
+			name:    "нет итогов",
+			output:  ebur128Frames,
+			wantErr: true,
+		},
+		{
+			name:    "нет истинного пика",
+			output:  "Summary:\n    I:  -16.2 LUFS\n    LRA:  6.3 LU\n",
+			wantErr: true,
+		},
+		{
+			name:    "пустой вывод",
+			output:  "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSummary(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSummary() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSummary() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   float64
+	}{
+		{"время последнего кадра", ebur128Frames + ebur128Summary, 0.999977},
+		{"один кадр", "[Parsed_ebur128_0 @ 0x5581] t: 12.3   TARGET:-23 LUFS    M: -24.1\n", 12.3},
+		{"нет кадров", ebur128Summary, 0},
+		{"пустой вывод", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseDuration(tt.output); got != tt.want {
+				t.Errorf("parseDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
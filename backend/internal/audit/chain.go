@@ -0,0 +1,129 @@
+// Package audit описывает хеш-цепочку журнала аудита: как вычисляется хеш записи
+// и как проверяется выгрузка цепочки адреса или трека.
+//
+// Хеш записи — keccak256 от UTF-8 строки, в которой поля разделены переводом строки:
+//
+//	ethcourse-audit-v1
+//	<action>
+//	<music_id или пустая строка>
+//	<recovered_addr в нижнем регистре>
+//	<keccak256(message) в hex>
+//	<signature>
+//	<keccak256(details) в hex>
+//	<created_at в RFC 3339 с наносекундами, UTC>
+//	<prev_hash>
+//	<address_prev_hash>
+//	<music_prev_hash>
+//
+// Хеши записываются в hex с префиксом 0x. Первая запись каждой цепочки ссылается на GenesisHash.
+package audit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// Format — идентификатор формата хеширования записей
+const Format = "ethcourse-audit-v1"
+
+// Виды цепочек в выгрузке: весь журнал по prev_hash, записи адреса и записи трека
+const (
+	ChainGlobal  = "global"
+	ChainAddress = "address"
+	ChainMusic   = "music"
+)
+
+// GenesisHash — ссылка на предыдущую запись у первой записи цепочки
+var GenesisHash = common.Hash{}.Hex()
+
+// EntryHash вычисляет хеш записи по её содержимому и ссылкам на предыдущие записи
+func EntryHash(e model.AuditEntry) string {
+	musicID := ""
+	if e.MusicID != nil {
+		musicID = strconv.Itoa(*e.MusicID)
+	}
+
+	payload := strings.Join([]string{
+		Format,
+		e.Action,
+		musicID,
+		strings.ToLower(e.RecoveredAddr),
+		crypto.Keccak256Hash([]byte(e.Message)).Hex(),
+		e.Signature,
+		crypto.Keccak256Hash([]byte(e.Details)).Hex(),
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		e.PrevHash,
+		e.AddressPrevHash,
+		e.MusicPrevHash,
+	}, "\n")
+
+	return crypto.Keccak256Hash([]byte(payload)).Hex()
+}
+
+// SignatureVerifier восстанавливает адрес подписавшего сообщение
+type SignatureVerifier func(message, signature string) (bool, string, error)
+
+// Verify проверяет выгрузку: хеш каждой записи, непрерывность общей цепочки, цепочки
+// адреса или трека и соответствие подписей восстановленным адресам
+func Verify(export model.AuditExport, verifySignature SignatureVerifier) model.AuditVerification {
+	result := model.AuditVerification{Valid: true}
+	fail := func(format string, args ...interface{}) {
+		result.Valid = false
+		result.Errors = append(result.Errors, fmt.Sprintf(format, args...))
+	}
+
+	if export.Format != Format {
+		fail("неизвестный формат выгрузки: %s", export.Format)
+		return result
+	}
+
+	prev := GenesisHash
+	for i, e := range export.Entries {
+		if hash := EntryHash(e); hash != e.EntryHash {
+			fail("запись %d: хеш %s не совпадает с вычисленным %s", e.ID, e.EntryHash, hash)
+		}
+
+		var link string
+		switch export.Chain {
+		case ChainGlobal:
+			link = e.PrevHash
+		case ChainAddress:
+			link = e.AddressPrevHash
+			if !strings.EqualFold(e.RecoveredAddr, export.Address) {
+				fail("запись %d: адрес %s не относится к цепочке %s", e.ID, e.RecoveredAddr, export.Address)
+			}
+		case ChainMusic:
+			link = e.MusicPrevHash
+			if e.MusicID == nil || export.MusicID == nil || *e.MusicID != *export.MusicID {
+				fail("запись %d не относится к цепочке трека", e.ID)
+			}
+		default:
+			fail("неизвестный вид цепочки: %s", export.Chain)
+			return result
+		}
+		if link != prev {
+			fail("запись %d: ссылка на предыдущую запись цепочки не совпадает (позиция %d)", e.ID, i)
+		}
+		prev = e.EntryHash
+
+		if e.Signature != "" {
+			valid, recovered, err := verifySignature(e.Message, e.Signature)
+			if err != nil || !valid || !strings.EqualFold(recovered, e.RecoveredAddr) {
+				fail("запись %d: подпись не соответствует адресу %s", e.ID, e.RecoveredAddr)
+			}
+		} else if e.RecoveredAddr != model.AuditAdminAddress {
+			fail("запись %d: нет подписи", e.ID)
+		}
+	}
+
+	if len(export.Entries) > 0 {
+		result.HeadHash = prev
+	}
+	return result
+}
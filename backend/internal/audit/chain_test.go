@@ -0,0 +1,378 @@
+package audit
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+const (
+	testAddress = "0x5B38Da6a701c568545dCfcB03FcB875f56beddC4"
+	testOther   = "0xAb8483F64d9C6d1EcF9b849Ae677dD3315835cb2"
+)
+
+// testVerifier считает подпись вида "sig:<адрес>" подписью этого адреса
+func testVerifier(message, signature string) (bool, string, error) {
+	addr, ok := strings.CutPrefix(signature, "sig:")
+	if !ok {
+		return false, "", errors.New("некорректная подпись")
+	}
+	return true, addr, nil
+}
+
+// addressChain строит корректную выгрузку цепочки адреса из n записей
+func addressChain(n int) model.AuditExport {
+	musicID := 7
+	export := model.AuditExport{Format: Format, Chain: ChainAddress, Address: strings.ToLower(testAddress)}
+	prev := GenesisHash
+	for i := 0; i < n; i++ {
+		e := model.AuditEntry{
+			ID:              i + 1,
+			Action:          "set_price",
+			MusicID:         &musicID,
+			RecoveredAddr:   testAddress,
+			Message:         "Set price of track 7",
+			Signature:       "sig:" + testAddress,
+			Details:         `{"price_wei":"1000"}`,
+			CreatedAt:       time.Date(2024, 5, 1, 10, 0, i, 123456789, time.UTC),
+			PrevHash:        "0x" + strings.Repeat("ab", 32),
+			AddressPrevHash: prev,
+			MusicPrevHash:   GenesisHash,
+		}
+		e.EntryHash = EntryHash(e)
+		prev = e.EntryHash
+		export.Entries = append(export.Entries, e)
+	}
+	return export
+}
+
+// musicChain строит корректную выгрузку цепочки трека: запись владельца и запись администратора
+func musicChain() model.AuditExport {
+	musicID := 7
+	export := model.AuditExport{Format: Format, Chain: ChainMusic, MusicID: &musicID}
+	owner := model.AuditEntry{
+		ID:            1,
+		Action:        "upload",
+		MusicID:       &musicID,
+		RecoveredAddr: testAddress,
+		Message:       "Upload track",
+		Signature:     "sig:" + testAddress,
+		CreatedAt:     time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		PrevHash:      GenesisHash,
+		MusicPrevHash: GenesisHash,
+	}
+	owner.EntryHash = EntryHash(owner)
+	admin := model.AuditEntry{
+		ID:            2,
+		Action:        "resolve_duplicate",
+		MusicID:       &musicID,
+		RecoveredAddr: model.AuditAdminAddress,
+		CreatedAt:     time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC),
+		PrevHash:      owner.EntryHash,
+		MusicPrevHash: owner.EntryHash,
+	}
+	admin.EntryHash = EntryHash(admin)
+	export.Entries = []model.AuditEntry{owner, admin}
+	return export
+}
+
+// rehash пересчитывает хеш записи после изменения её полей
+func rehash(e *model.AuditEntry) {
+	e.EntryHash = EntryHash(*e)
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name       string
+		export     func() model.AuditExport
+		wantValid  bool
+		wantErrors int
+		wantHead   int // индекс записи, хеш которой должен стать HeadHash, или -1
+	}{
+		{
+			name:      "корректная цепочка адреса",
+			export:    func() model.AuditExport { return addressChain(3) },
+			wantValid: true,
+			wantHead:  2,
+		},
+		{
+			name:      "корректная цепочка трека с записью администратора",
+			export:    musicChain,
+			wantValid: true,
+			wantHead:  1,
+		},
+		{
+			name:      "пустая выгрузка",
+			export:    func() model.AuditExport { return addressChain(0) },
+			wantValid: true,
+			wantHead:  -1,
+		},
+		{
+			name: "изменено содержимое записи",
+			export: func() model.AuditExport {
+				ex := addressChain(3)
+				ex.Entries[1].Details = `{"price_wei":"1"}`
+				return ex
+			},
+			wantErrors: 1,
+			wantHead:   2,
+		},
+		{
+			name: "удалена запись из середины",
+			export: func() model.AuditExport {
+				ex := addressChain(3)
+				ex.Entries = append(ex.Entries[:1], ex.Entries[2])
+				return ex
+			},
+			wantErrors: 1,
+			wantHead:   1,
+		},
+		{
+			name: "запись другого адреса",
+			export: func() model.AuditExport {
+				ex := addressChain(2)
+				ex.Entries[1].RecoveredAddr = testOther
+				ex.Entries[1].Signature = "sig:" + testOther
+				rehash(&ex.Entries[1])
+				return ex
+			},
+			wantErrors: 1,
+			wantHead:   1,
+		},
+		{
+			name: "подпись другого адреса",
+			export: func() model.AuditExport {
+				ex := addressChain(2)
+				ex.Entries[0].Signature = "sig:" + testOther
+				rehash(&ex.Entries[0])
+				ex.Entries[1].AddressPrevHash = ex.Entries[0].EntryHash
+				rehash(&ex.Entries[1])
+				return ex
+			},
+			wantErrors: 1,
+			wantHead:   1,
+		},
+		{
+			name: "подпись не разбирается",
+			export: func() model.AuditExport {
+				ex := addressChain(1)
+				ex.Entries[0].Signature = "0xdeadbeef"
+				rehash(&ex.Entries[0])
+				return ex
+			},
+			wantErrors: 1,
+			wantHead:   0,
+		},
+		{
+			name: "нет подписи у пользователя",
+			export: func() model.AuditExport {
+				ex := addressChain(1)
+				ex.Entries[0].Signature = ""
+				rehash(&ex.Entries[0])
+				return ex
+			},
+			wantErrors: 1,
+			wantHead:   0,
+		},
+		{
+			name: "запись другого трека",
+			export: func() model.AuditExport {
+				ex := musicChain()
+				other := 8
+				ex.MusicID = &other
+				return ex
+			},
+			wantErrors: 2,
+			wantHead:   1,
+		},
+		{
+			name: "неизвестный формат",
+			export: func() model.AuditExport {
+				ex := addressChain(1)
+				ex.Format = "ethcourse-audit-v0"
+				return ex
+			},
+			wantErrors: 1,
+			wantHead:   -1,
+		},
+		{
+			name: "неизвестный вид цепочки",
+			export: func() model.AuditExport {
+				ex := addressChain(1)
+				ex.Chain = "track"
+				return ex
+			},
+			wantErrors: 1,
+			wantHead:   -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			export := tt.export()
+			got := Verify(export, testVerifier)
+			if got.Valid != tt.wantValid {
+				t.Errorf("Verify().Valid = %v, want %v (ошибки: %v)", got.Valid, tt.wantValid, got.Errors)
+			}
+			if len(got.Errors) != tt.wantErrors {
+				t.Errorf("Verify() вернул %d ошибок, want %d: %v", len(got.Errors), tt.wantErrors, got.Errors)
+			}
+			wantHead := ""
+			if tt.wantHead >= 0 {
+				wantHead = export.Entries[tt.wantHead].EntryHash
+			}
+			if got.HeadHash != wantHead {
+				t.Errorf("Verify().HeadHash = %q, want %q", got.HeadHash, wantHead)
+			}
+		})
+	}
+}
+
+// auditLog строит журнал с двумя адресами, администратором и двумя треками, связывая
+// записи тремя цепочками так же, как при записи в базу
+func auditLog() []model.AuditEntry {
+	rows := []struct {
+		action, addr string
+		musicID      int
+	}{
+		{"upload", testAddress, 7},
+		{"upload", testOther, 8},
+		{"set_price", testAddress, 7},
+		{"resolve_duplicate", model.AuditAdminAddress, 8},
+		{"update", testOther, 7},
+		{"update", testAddress, 8},
+	}
+
+	var log []model.AuditEntry
+	last := func(match func(e model.AuditEntry) bool) string {
+		for i := len(log) - 1; i >= 0; i-- {
+			if match(log[i]) {
+				return log[i].EntryHash
+			}
+		}
+		return GenesisHash
+	}
+	for i, row := range rows {
+		musicID := row.musicID
+		e := model.AuditEntry{
+			ID:            i + 1,
+			Action:        row.action,
+			MusicID:       &musicID,
+			RecoveredAddr: strings.ToLower(row.addr),
+			Message:       row.action + " track",
+			Details:       `{"n":` + strconv.Itoa(i) + `}`,
+			CreatedAt:     time.Date(2024, 5, 1, 10, i, 0, 0, time.UTC),
+		}
+		if row.addr != model.AuditAdminAddress {
+			e.Signature = "sig:" + e.RecoveredAddr
+		}
+		e.PrevHash = last(func(model.AuditEntry) bool { return true })
+		e.AddressPrevHash = last(func(p model.AuditEntry) bool { return p.RecoveredAddr == e.RecoveredAddr })
+		e.MusicPrevHash = last(func(p model.AuditEntry) bool { return *p.MusicID == musicID })
+		rehash(&e)
+		log = append(log, e)
+	}
+	return log
+}
+
+// exportOf выгружает из журнала цепочку вида chain: весь журнал, записи testAddress
+// или записи трека 7
+func exportOf(log []model.AuditEntry, chain string) model.AuditExport {
+	musicID := 7
+	export := model.AuditExport{Format: Format, Chain: chain}
+	switch chain {
+	case ChainAddress:
+		export.Address = strings.ToLower(testAddress)
+	case ChainMusic:
+		export.MusicID = &musicID
+	}
+	for _, e := range log {
+		if chain == ChainGlobal || (chain == ChainAddress && e.RecoveredAddr == export.Address) ||
+			(chain == ChainMusic && *e.MusicID == musicID) {
+			export.Entries = append(export.Entries, e)
+		}
+	}
+	return export
+}
+
+func TestVerifyTamperedLog(t *testing.T) {
+	// Запись 3 входит во все три цепочки; следующая за ней запись в общей цепочке — 4,
+	// в цепочке testAddress — 6, в цепочке трека 7 — 5
+	tests := []struct {
+		chain    string
+		nextID   int
+		wantSize int
+	}{
+		{ChainGlobal, 4, 6},
+		{ChainAddress, 6, 3},
+		{ChainMusic, 5, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.chain, func(t *testing.T) {
+			export := exportOf(auditLog(), tt.chain)
+			if len(export.Entries) != tt.wantSize {
+				t.Fatalf("в цепочке %d записей, want %d", len(export.Entries), tt.wantSize)
+			}
+			if got := Verify(export, testVerifier); !got.Valid {
+				t.Fatalf("исходная цепочка не прошла проверку: %v", got.Errors)
+			}
+
+			tampered := func(recompute bool) model.AuditVerification {
+				log := auditLog()
+				log[2].Details = `{"price_wei":"1"}`
+				if recompute {
+					rehash(&log[2])
+				}
+				return Verify(exportOf(log, tt.chain), testVerifier)
+			}
+
+			// изменённая запись не сходится со своим хешем
+			got := tampered(false)
+			if got.Valid || len(got.Errors) != 1 || !strings.HasPrefix(got.Errors[0], "запись 3: хеш") {
+				t.Errorf("изменена запись 3: Verify() = %v, %v", got.Valid, got.Errors)
+			}
+
+			// хеш пересчитан: разрыв обнаруживается по ссылке следующей записи цепочки
+			got = tampered(true)
+			wantErr := "запись " + strconv.Itoa(tt.nextID) + ": ссылка"
+			if got.Valid || len(got.Errors) != 1 || !strings.HasPrefix(got.Errors[0], wantErr) {
+				t.Errorf("изменена запись 3 с пересчётом хеша: Verify() = %v, %v, want ошибку %q", got.Valid, got.Errors, wantErr)
+			}
+		})
+	}
+}
+
+func TestEntryHash(t *testing.T) {
+	base := addressChain(1).Entries[0]
+
+	tests := []struct {
+		name   string
+		modify func(e *model.AuditEntry)
+		same   bool
+	}{
+		{"адрес в другом регистре", func(e *model.AuditEntry) { e.RecoveredAddr = strings.ToUpper(e.RecoveredAddr) }, true},
+		{"время в другом часовом поясе", func(e *model.AuditEntry) { e.CreatedAt = e.CreatedAt.In(time.FixedZone("MSK", 3*3600)) }, true},
+		{"идентификатор записи не хешируется", func(e *model.AuditEntry) { e.ID = 100 }, true},
+		{"другое действие", func(e *model.AuditEntry) { e.Action = "publish" }, false},
+		{"без трека", func(e *model.AuditEntry) { e.MusicID = nil }, false},
+		{"другое сообщение", func(e *model.AuditEntry) { e.Message += " " }, false},
+		{"другая наносекунда", func(e *model.AuditEntry) { e.CreatedAt = e.CreatedAt.Add(time.Nanosecond) }, false},
+		{"другая ссылка на общую цепочку", func(e *model.AuditEntry) { e.PrevHash = GenesisHash }, false},
+	}
+
+	want := EntryHash(base)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := base
+			tt.modify(&e)
+			if got := EntryHash(e); (got == want) != tt.same {
+				t.Errorf("EntryHash() = %s, исходный %s, want совпадение %v", got, want, tt.same)
+			}
+		})
+	}
+}
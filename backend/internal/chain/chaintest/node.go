@@ -0,0 +1,473 @@
+// Package chaintest запускает в процессе узел Ethereum с JSON-RPC API eth_* для тестов
+// индексатора, ретранслятора и сервиса. Блоки, балансы и пул транзакций задаёт тест;
+// узел ничего не исполняет.
+package chaintest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/polonkoevv/ethcourse/internal/chain"
+)
+
+// Газ, который узел возвращает на eth_estimateGas
+const EstimatedGas = 50000
+
+// Node — узел сети в памяти процесса
+type Node struct {
+	chainID *big.Int
+	url     string
+
+	mu       sync.Mutex
+	head     uint64
+	blocks   map[uint64]*block
+	included map[common.Hash]*included
+	pool     map[common.Hash]*types.Transaction
+	nonces   map[common.Address]uint64
+	balances map[common.Address][]balance
+	sent     []*types.Transaction
+	calls    map[string]int
+
+	baseFee, tip, gasPrice *big.Int
+	archiveDepth           uint64
+	rejectSend             func(tx *types.Transaction) error
+	estimateErr            error
+}
+
+type block struct {
+	number uint64
+	time   uint64
+	txs    []*types.Transaction
+}
+
+type included struct {
+	tx      *types.Transaction
+	block   uint64
+	index   uint
+	receipt *types.Receipt
+}
+
+// balance — баланс аккаунта начиная с блока from
+type balance struct {
+	from uint64
+	wei  *big.Int
+}
+
+// New запускает узел сети chainID; он останавливается по окончании теста
+func New(t *testing.T, chainID uint64) *Node {
+	t.Helper()
+	n := &Node{
+		chainID:  new(big.Int).SetUint64(chainID),
+		blocks:   make(map[uint64]*block),
+		included: make(map[common.Hash]*included),
+		pool:     make(map[common.Hash]*types.Transaction),
+		nonces:   make(map[common.Address]uint64),
+		balances: make(map[common.Address][]balance),
+		calls:    make(map[string]int),
+		baseFee:  big.NewInt(1_000_000_000),
+		tip:      big.NewInt(1_000_000_000),
+		gasPrice: big.NewInt(2_000_000_000),
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &ethAPI{n: n}); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(server)
+	t.Cleanup(func() {
+		ts.Close()
+		server.Stop()
+	})
+	n.url = ts.URL
+	return n
+}
+
+// URL возвращает адрес JSON-RPC узла
+func (n *Node) URL() string {
+	return n.url
+}
+
+// Chain подключается к узлу клиентом без повторов запросов и возвращает сеть
+// с контрактом contractAddr
+func (n *Node) Chain(t *testing.T, contractAddr common.Address) *chain.Chain {
+	t.Helper()
+	client, err := chain.Dial(context.Background(), n.chainID.Uint64(), []string{n.url}, 1000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return &chain.Chain{ID: n.chainID.Uint64(), Name: "test", Contract: contractAddr, Client: client}
+}
+
+// Signer возвращает подписанта транзакций сети узла
+func (n *Node) Signer() types.Signer {
+	return types.LatestSignerForChainID(n.chainID)
+}
+
+// SetFees задаёт базовую комиссию последнего блока (nil — сеть без EIP-1559),
+// рекомендуемые чаевые и цену газа
+func (n *Node) SetFees(baseFee, tip, gasPrice *big.Int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.baseFee, n.tip, n.gasPrice = baseFee, tip, gasPrice
+}
+
+// SetArchiveDepth делает узел неархивным: баланс блоков глубже depth от вершины
+// недоступен. 0 — архивный узел.
+func (n *Node) SetArchiveDepth(depth uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.archiveDepth = depth
+}
+
+// RejectSend задаёт ответ узла на eth_sendRawTransaction; nil — принимать все
+func (n *Node) RejectSend(reject func(tx *types.Transaction) error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.rejectSend = reject
+}
+
+// SetEstimateError задаёт ошибку eth_estimateGas, например откат вызова
+func (n *Node) SetEstimateError(err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.estimateErr = err
+}
+
+// SetHead задаёт номер последнего блока
+func (n *Node) SetHead(number uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.head = number
+}
+
+// SetBalance задаёт баланс аккаунта на конец блока number и следующих
+func (n *Node) SetBalance(account common.Address, number uint64, wei *big.Int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	list := append(n.balances[account], balance{from: number, wei: new(big.Int).Set(wei)})
+	sort.SliceStable(list, func(i, j int) bool { return list[i].from < list[j].from })
+	n.balances[account] = list
+}
+
+// SetNonce задаёт число подтверждённых транзакций аккаунта
+func (n *Node) SetNonce(account common.Address, nonce uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.nonces[account] = nonce
+}
+
+// AddBlock добавляет пустой блок со временем time
+func (n *Node) AddBlock(number, time uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.block(number).time = time
+}
+
+// Include включает подписанную транзакцию в блок number с квитанцией статуса status
+// и убирает из пула её и транзакции отправителя с тем же nonce
+func (n *Node) Include(number uint64, tx *types.Transaction, status uint64) *types.Receipt {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	from, err := types.Sender(n.Signer(), tx)
+	if err != nil {
+		panic(err)
+	}
+	b := n.block(number)
+	b.txs = append(b.txs, tx)
+	receipt := &types.Receipt{
+		Type:              tx.Type(),
+		Status:            status,
+		CumulativeGasUsed: tx.Gas(),
+		Logs:              []*types.Log{},
+		TxHash:            tx.Hash(),
+		GasUsed:           tx.Gas(),
+		EffectiveGasPrice: tx.GasFeeCap(),
+		BlockHash:         n.header(b).Hash(),
+		BlockNumber:       new(big.Int).SetUint64(number),
+		TransactionIndex:  uint(len(b.txs) - 1),
+	}
+	n.included[tx.Hash()] = &included{tx: tx, block: number, index: receipt.TransactionIndex, receipt: receipt}
+	for hash, pending := range n.pool {
+		if sender, _ := types.Sender(n.Signer(), pending); sender == from && pending.Nonce() == tx.Nonce() {
+			delete(n.pool, hash)
+		}
+	}
+	if tx.Nonce()+1 > n.nonces[from] {
+		n.nonces[from] = tx.Nonce() + 1
+	}
+	return receipt
+}
+
+// Drop убирает транзакцию из пула, как узел, вытеснивший её
+func (n *Node) Drop(hash common.Hash) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.pool, hash)
+}
+
+// Pending сообщает, есть ли транзакция в пуле
+func (n *Node) Pending(hash common.Hash) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, ok := n.pool[hash]
+	return ok
+}
+
+// Sent возвращает транзакции, принятые eth_sendRawTransaction, в порядке отправки
+func (n *Node) Sent() []*types.Transaction {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]*types.Transaction(nil), n.sent...)
+}
+
+// Calls возвращает число вызовов метода JSON-RPC, например "eth_getBalance"
+func (n *Node) Calls(method string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.calls[method]
+}
+
+func (n *Node) block(number uint64) *block {
+	b, ok := n.blocks[number]
+	if !ok {
+		b = &block{number: number, time: 1_700_000_000 + number*12}
+		n.blocks[number] = b
+	}
+	if number > n.head {
+		n.head = number
+	}
+	return b
+}
+
+func (n *Node) header(b *block) *types.Header {
+	h := &types.Header{
+		Number:     new(big.Int).SetUint64(b.number),
+		Time:       b.time,
+		Difficulty: new(big.Int),
+		GasLimit:   30_000_000,
+		Extra:      []byte{},
+	}
+	if n.baseFee != nil {
+		h.BaseFee = new(big.Int).Set(n.baseFee)
+	}
+	if b.number > 0 {
+		h.ParentHash = common.BigToHash(new(big.Int).SetUint64(b.number - 1))
+	}
+	return h
+}
+
+// blockNumber разбирает номер блока из параметра запроса
+func (n *Node) blockNumber(arg string) (uint64, error) {
+	switch arg {
+	case "", "latest", "pending", "safe", "finalized":
+		return n.head, nil
+	case "earliest":
+		return 0, nil
+	}
+	return hexutil.DecodeUint64(arg)
+}
+
+// txJSON кодирует транзакцию с отправителем и местом в цепочке, как eth_getTransactionByHash
+func (n *Node) txJSON(tx *types.Transaction, inc *included) (map[string]interface{}, error) {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	from, err := types.Sender(n.Signer(), tx)
+	if err != nil {
+		return nil, err
+	}
+	fields["from"] = from
+	fields["blockNumber"], fields["blockHash"], fields["transactionIndex"] = nil, nil, nil
+	if inc != nil {
+		fields["blockNumber"] = hexutil.Uint64(inc.block)
+		fields["blockHash"] = inc.receipt.BlockHash
+		fields["transactionIndex"] = hexutil.Uint64(inc.index)
+	}
+	return fields, nil
+}
+
+// ethAPI — методы eth_*, которые вызывают бэкенд и go-ethereum ethclient
+type ethAPI struct {
+	n *Node
+}
+
+func (a *ethAPI) count(method string) {
+	a.n.calls[method]++
+}
+
+func (a *ethAPI) ChainId() *hexutil.Big {
+	a.n.mu.Lock()
+	defer a.n.mu.Unlock()
+	a.count("eth_chainId")
+	return (*hexutil.Big)(a.n.chainID)
+}
+
+func (a *ethAPI) BlockNumber() hexutil.Uint64 {
+	a.n.mu.Lock()
+	defer a.n.mu.Unlock()
+	a.count("eth_blockNumber")
+	return hexutil.Uint64(a.n.head)
+}
+
+func (a *ethAPI) GetBalance(account common.Address, blockArg string) (*hexutil.Big, error) {
+	a.n.mu.Lock()
+	defer a.n.mu.Unlock()
+	a.count("eth_getBalance")
+	number, err := a.n.blockNumber(blockArg)
+	if err != nil {
+		return nil, err
+	}
+	if a.n.archiveDepth > 0 && number+a.n.archiveDepth < a.n.head {
+		return nil, fmt.Errorf("missing trie node for block %d", number)
+	}
+	wei := new(big.Int)
+	for _, b := range a.n.balances[account] {
+		if b.from <= number {
+			wei = b.wei
+		}
+	}
+	return (*hexutil.Big)(wei), nil
+}
+
+func (a *ethAPI) GetTransactionCount(account common.Address, blockArg string) hexutil.Uint64 {
+	a.n.mu.Lock()
+	defer a.n.mu.Unlock()
+	a.count("eth_getTransactionCount")
+	nonce := a.n.nonces[account]
+	if blockArg == "pending" {
+		for _, tx := range a.n.pool {
+			if from, _ := types.Sender(a.n.Signer(), tx); from == account && tx.Nonce()+1 > nonce {
+				nonce = tx.Nonce() + 1
+			}
+		}
+	}
+	return hexutil.Uint64(nonce)
+}
+
+func (a *ethAPI) GetBlockByNumber(blockArg string, full bool) (map[string]interface{}, error) {
+	a.n.mu.Lock()
+	defer a.n.mu.Unlock()
+	a.count("eth_getBlockByNumber")
+	number, err := a.n.blockNumber(blockArg)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := a.n.blocks[number]
+	if !ok {
+		if number > a.n.head {
+			return nil, nil
+		}
+		b = &block{number: number, time: 1_700_000_000 + number*12}
+	}
+
+	data, err := json.Marshal(a.n.header(b))
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	txs := []interface{}{}
+	for _, tx := range b.txs {
+		if !full {
+			txs = append(txs, tx.Hash())
+			continue
+		}
+		encoded, err := a.n.txJSON(tx, a.n.included[tx.Hash()])
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, encoded)
+	}
+	fields["transactions"] = txs
+	fields["uncles"] = []interface{}{}
+	return fields, nil
+}
+
+func (a *ethAPI) GetTransactionReceipt(hash common.Hash) *types.Receipt {
+	a.n.mu.Lock()
+	defer a.n.mu.Unlock()
+	a.count("eth_getTransactionReceipt")
+	if inc, ok := a.n.included[hash]; ok {
+		return inc.receipt
+	}
+	return nil
+}
+
+func (a *ethAPI) GetTransactionByHash(hash common.Hash) (map[string]interface{}, error) {
+	a.n.mu.Lock()
+	defer a.n.mu.Unlock()
+	a.count("eth_getTransactionByHash")
+	if inc, ok := a.n.included[hash]; ok {
+		return a.n.txJSON(inc.tx, inc)
+	}
+	if tx, ok := a.n.pool[hash]; ok {
+		return a.n.txJSON(tx, nil)
+	}
+	return nil, nil
+}
+
+func (a *ethAPI) SendRawTransaction(raw hexutil.Bytes) (common.Hash, error) {
+	a.n.mu.Lock()
+	defer a.n.mu.Unlock()
+	a.count("eth_sendRawTransaction")
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return common.Hash{}, err
+	}
+	if _, err := types.Sender(a.n.Signer(), tx); err != nil {
+		return common.Hash{}, err
+	}
+	if _, ok := a.n.pool[tx.Hash()]; ok {
+		return common.Hash{}, errors.New("already known")
+	}
+	if a.n.rejectSend != nil {
+		if err := a.n.rejectSend(tx); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	a.n.pool[tx.Hash()] = tx
+	a.n.sent = append(a.n.sent, tx)
+	return tx.Hash(), nil
+}
+
+func (a *ethAPI) GasPrice() *hexutil.Big {
+	a.n.mu.Lock()
+	defer a.n.mu.Unlock()
+	a.count("eth_gasPrice")
+	return (*hexutil.Big)(a.n.gasPrice)
+}
+
+func (a *ethAPI) MaxPriorityFeePerGas() *hexutil.Big {
+	a.n.mu.Lock()
+	defer a.n.mu.Unlock()
+	a.count("eth_maxPriorityFeePerGas")
+	return (*hexutil.Big)(a.n.tip)
+}
+
+func (a *ethAPI) EstimateGas(args map[string]interface{}, blockArg *string) (hexutil.Uint64, error) {
+	a.n.mu.Lock()
+	defer a.n.mu.Unlock()
+	a.count("eth_estimateGas")
+	if a.n.estimateErr != nil {
+		return 0, a.n.estimateErr
+	}
+	return EstimatedGas, nil
+}
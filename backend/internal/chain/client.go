@@ -0,0 +1,489 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// Таймаут одного запроса к узлу: зависший узел не должен блокировать API
+	requestTimeout = 15 * time.Second
+	// Задержка перед первым повтором, далее удваивается
+	retryBaseDelay = 250 * time.Millisecond
+	// Максимальная пауза, на которую узел исключается после ошибок
+	maxEndpointCooldown = 30 * time.Second
+	// Размер пакета eth_getBlockByNumber в одном batch-запросе
+	blockBatchSize = 20
+
+	defaultMaxRetries = 3
+	defaultRateLimit  = 25 // запросов в секунду к одному узлу
+)
+
+// Block — блок с транзакциями и их отправителями из ответа узла
+type Block struct {
+	Number       uint64
+	Hash         common.Hash
+	Time         uint64
+	Transactions []*types.Transaction
+	Senders      []common.Address
+}
+
+// endpoint — узел сети со своим лимитом запросов и состоянием здоровья
+type endpoint struct {
+	url     string
+	rpc     *rpc.Client
+	eth     *ethclient.Client
+	limiter *rateLimiter
+
+	mu        sync.Mutex
+	failures  int
+	downUntil time.Time
+}
+
+func (e *endpoint) available(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return !now.Before(e.downUntil)
+}
+
+func (e *endpoint) markSuccess() {
+	e.mu.Lock()
+	e.failures = 0
+	e.downUntil = time.Time{}
+	e.mu.Unlock()
+}
+
+func (e *endpoint) markFailure() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failures++
+	cooldown := retryBaseDelay << min(e.failures, 10)
+	if cooldown > maxEndpointCooldown {
+		cooldown = maxEndpointCooldown
+	}
+	e.downUntil = time.Now().Add(cooldown)
+}
+
+// Client — клиент сети поверх нескольких узлов: запрос уходит на первый исправный
+// узел в порядке конфигурации, при сетевой ошибке или перегрузке узел временно
+// исключается и запрос повторяется на следующем с экспоненциальной задержкой.
+// Ошибки самого запроса (откат вызова, отсутствующая транзакция, некорректный ответ)
+// не повторяются.
+type Client struct {
+	chainID        uint64
+	endpoints      []*endpoint
+	maxRetries     int
+	requestTimeout time.Duration
+}
+
+// Dial подключается ко всем узлам сети; rateLimit — ограничение запросов в секунду
+// на узел, maxRetries — число повторов после первой попытки (0 — без повторов,
+// отрицательное — значение по умолчанию)
+func Dial(ctx context.Context, chainID uint64, urls []string, rateLimit float64, maxRetries int) (*Client, error) {
+	if rateLimit <= 0 {
+		rateLimit = defaultRateLimit
+	}
+	if maxRetries < 0 {
+		maxRetries = defaultMaxRetries
+	}
+
+	c := &Client{chainID: chainID, maxRetries: maxRetries, requestTimeout: requestTimeout}
+	for _, url := range urls {
+		rpcClient, err := rpc.DialContext(ctx, url)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("ошибка подключения к узлу %s: %w", url, err)
+		}
+		c.endpoints = append(c.endpoints, &endpoint{
+			url:     url,
+			rpc:     rpcClient,
+			eth:     ethclient.NewClient(rpcClient),
+			limiter: newRateLimiter(rateLimit),
+		})
+	}
+	return c, nil
+}
+
+// checkChainID сверяет chain ID каждого узла с настройками
+func (c *Client) checkChainID(ctx context.Context) error {
+	for _, e := range c.endpoints {
+		checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		id, err := e.eth.ChainID(checkCtx)
+		cancel()
+		if err != nil {
+			fmt.Printf("Сеть %d: узел %s недоступен: %v\n", c.chainID, e.url, err)
+			continue
+		}
+		if id.Uint64() != c.chainID {
+			return fmt.Errorf("сеть %d: узел %s относится к сети %d", c.chainID, e.url, id.Uint64())
+		}
+	}
+	return nil
+}
+
+// Close закрывает соединения со всеми узлами
+func (c *Client) Close() {
+	for _, e := range c.endpoints {
+		e.rpc.Close()
+	}
+}
+
+// pick выбирает первый исправный узел; если исключены все — тот, что вернётся раньше других
+func (c *Client) pick() *endpoint {
+	now := time.Now()
+	var earliest *endpoint
+	for _, e := range c.endpoints {
+		if e.available(now) {
+			return e
+		}
+		e.mu.Lock()
+		if earliest == nil || e.downUntil.Before(earliest.downUntil) {
+			earliest = e
+		}
+		e.mu.Unlock()
+	}
+	return earliest
+}
+
+// Do выполняет запрос с повторами и переключением узлов
+func (c *Client) Do(ctx context.Context, call func(ctx context.Context, e *ethclient.Client, r *rpc.Client) error) error {
+	return c.do(ctx, 1, call)
+}
+
+// do выполняет запрос, расходуя cost токенов лимита узла на попытку: batch-запрос
+// из n вызовов узел считает как n запросов
+func (c *Client) do(ctx context.Context, cost int, call func(ctx context.Context, e *ethclient.Client, r *rpc.Client) error) error {
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			delay := retryBaseDelay << (attempt - 1)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		e := c.pick()
+		if err := e.limiter.wait(ctx, cost); err != nil {
+			return err
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+		err := call(callCtx, e.eth, e.rpc)
+		cancel()
+		if err == nil {
+			e.markSuccess()
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !retryable(err) {
+			e.markSuccess()
+			return err
+		}
+
+		e.markFailure()
+		lastErr = fmt.Errorf("узел %s: %w", e.url, err)
+		fmt.Printf("Сеть %d: ошибка запроса к узлу %s (попытка %d): %v\n", c.chainID, e.url, attempt+1, err)
+	}
+	return fmt.Errorf("сеть %d: узлы недоступны после %d попыток: %w", c.chainID, c.maxRetries+1, lastErr)
+}
+
+// retryable отличает сбои узла от ошибок самого запроса. Повторяются только сетевые
+// ошибки, таймаут запроса, ответы HTTP 429 и 5xx и ошибка лимита запросов узла;
+// ошибки JSON-RPC и разбора ответа повтор не исправит.
+func retryable(err error) bool {
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		// -32005 — превышен лимит запросов узла
+		return rpcErr.ErrorCode() == -32005
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+func (c *Client) ChainID(ctx context.Context) (*big.Int, error) {
+	var id *big.Int
+	err := c.Do(ctx, func(ctx context.Context, e *ethclient.Client, _ *rpc.Client) (err error) {
+		id, err = e.ChainID(ctx)
+		return err
+	})
+	return id, err
+}
+
+func (c *Client) BlockNumber(ctx context.Context) (uint64, error) {
+	var n uint64
+	err := c.Do(ctx, func(ctx context.Context, e *ethclient.Client, _ *rpc.Client) (err error) {
+		n, err = e.BlockNumber(ctx)
+		return err
+	})
+	return n, err
+}
+
+func (c *Client) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	var header *types.Header
+	err := c.Do(ctx, func(ctx context.Context, e *ethclient.Client, _ *rpc.Client) (err error) {
+		header, err = e.HeaderByNumber(ctx, number)
+		return err
+	})
+	return header, err
+}
+
+func (c *Client) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	var receipt *types.Receipt
+	err := c.Do(ctx, func(ctx context.Context, e *ethclient.Client, _ *rpc.Client) (err error) {
+		receipt, err = e.TransactionReceipt(ctx, hash)
+		return err
+	})
+	return receipt, err
+}
+
+func (c *Client) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	err := c.Do(ctx, func(ctx context.Context, e *ethclient.Client, _ *rpc.Client) (err error) {
+		logs, err = e.FilterLogs(ctx, q)
+		return err
+	})
+	return logs, err
+}
+
+// CallContract выполняет eth_call; откат вызова возвращается как есть, без повторов
+func (c *Client) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	var result []byte
+	err := c.Do(ctx, func(ctx context.Context, e *ethclient.Client, _ *rpc.Client) (err error) {
+		result, err = e.CallContract(ctx, msg, blockNumber)
+		return err
+	})
+	return result, err
+}
+
+// BalanceAt возвращает баланс аккаунта в wei на блоке blockNumber (nil — последний блок)
+func (c *Client) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	var balance *big.Int
+	err := c.Do(ctx, func(ctx context.Context, e *ethclient.Client, _ *rpc.Client) (err error) {
+		balance, err = e.BalanceAt(ctx, account, blockNumber)
+		return err
+	})
+	return balance, err
+}
+
+func (c *Client) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	var nonce uint64
+	err := c.Do(ctx, func(ctx context.Context, e *ethclient.Client, _ *rpc.Client) (err error) {
+		nonce, err = e.PendingNonceAt(ctx, account)
+		return err
+	})
+	return nonce, err
+}
+
+// NonceAt возвращает число транзакций аккаунта, включённых в блоки до blockNumber
+// включительно (nil — последний блок)
+func (c *Client) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	var nonce uint64
+	err := c.Do(ctx, func(ctx context.Context, e *ethclient.Client, _ *rpc.Client) (err error) {
+		nonce, err = e.NonceAt(ctx, account, blockNumber)
+		return err
+	})
+	return nonce, err
+}
+
+// TransactionByHash ищет транзакцию в блоках и пуле узла; ethereum.NotFound — узел
+// о ней не знает
+func (c *Client) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	var tx *types.Transaction
+	var isPending bool
+	err := c.Do(ctx, func(ctx context.Context, e *ethclient.Client, _ *rpc.Client) (err error) {
+		tx, isPending, err = e.TransactionByHash(ctx, hash)
+		return err
+	})
+	return tx, isPending, err
+}
+
+func (c *Client) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	var price *big.Int
+	err := c.Do(ctx, func(ctx context.Context, e *ethclient.Client, _ *rpc.Client) (err error) {
+		price, err = e.SuggestGasPrice(ctx)
+		return err
+	})
+	return price, err
+}
+
+func (c *Client) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	var tip *big.Int
+	err := c.Do(ctx, func(ctx context.Context, e *ethclient.Client, _ *rpc.Client) (err error) {
+		tip, err = e.SuggestGasTipCap(ctx)
+		return err
+	})
+	return tip, err
+}
+
+// EstimateGas оценивает газ вызова; откат вызова возвращается как есть, без повторов
+func (c *Client) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	var gas uint64
+	err := c.Do(ctx, func(ctx context.Context, e *ethclient.Client, _ *rpc.Client) (err error) {
+		gas, err = e.EstimateGas(ctx, msg)
+		return err
+	})
+	return gas, err
+}
+
+// SendTransaction отправляет подписанную транзакцию. При повторе на другом узле
+// транзакция может оказаться уже принятой сетью — это не считается ошибкой.
+func (c *Client) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	err := c.Do(ctx, func(ctx context.Context, e *ethclient.Client, _ *rpc.Client) error {
+		return e.SendTransaction(ctx, tx)
+	})
+	if err != nil && isKnownTransaction(err) {
+		return nil
+	}
+	return err
+}
+
+// isKnownTransaction распознаёт ответы узлов geth, Erigon и Ganache о том, что
+// транзакция с таким хешем уже в пуле
+func isKnownTransaction(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction") ||
+		strings.Contains(msg, "already imported")
+}
+
+// rpcBlock — блок в ответе eth_getBlockByNumber с полными транзакциями
+type rpcBlock struct {
+	Number       hexutil.Uint64   `json:"number"`
+	Hash         common.Hash      `json:"hash"`
+	Timestamp    hexutil.Uint64   `json:"timestamp"`
+	Transactions []rpcTransaction `json:"transactions"`
+}
+
+// rpcTransaction — транзакция с отправителем, который узел возвращает в поле from
+type rpcTransaction struct {
+	tx   *types.Transaction
+	from common.Address
+}
+
+func (t *rpcTransaction) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &t.tx); err != nil {
+		return err
+	}
+	var extra struct {
+		From common.Address `json:"from"`
+	}
+	if err := json.Unmarshal(data, &extra); err != nil {
+		return err
+	}
+	t.from = extra.From
+	return nil
+}
+
+// BlocksByNumber загружает блоки [from, to] пакетными запросами. Отсутствие любого
+// блока диапазона — ошибка, а не пропуск.
+func (c *Client) BlocksByNumber(ctx context.Context, from, to uint64) ([]*Block, error) {
+	var blocks []*Block
+	for start := from; start <= to; start += blockBatchSize {
+		end := min(start+blockBatchSize-1, to)
+
+		raw := make([]*rpcBlock, end-start+1)
+		batch := make([]rpc.BatchElem, len(raw))
+		for i := range batch {
+			batch[i] = rpc.BatchElem{
+				Method: "eth_getBlockByNumber",
+				Args:   []interface{}{hexutil.EncodeUint64(start + uint64(i)), true},
+				Result: &raw[i],
+			}
+		}
+
+		err := c.do(ctx, len(batch), func(ctx context.Context, _ *ethclient.Client, r *rpc.Client) error {
+			if err := r.BatchCallContext(ctx, batch); err != nil {
+				return err
+			}
+			for _, elem := range batch {
+				if elem.Error != nil {
+					return elem.Error
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения блоков %d–%d: %w", start, end, err)
+		}
+
+		for i, b := range raw {
+			if b == nil {
+				return nil, fmt.Errorf("узел не вернул блок %d", start+uint64(i))
+			}
+			block := &Block{Number: uint64(b.Number), Hash: b.Hash, Time: uint64(b.Timestamp)}
+			for _, tx := range b.Transactions {
+				block.Transactions = append(block.Transactions, tx.tx)
+				block.Senders = append(block.Senders, tx.from)
+			}
+			blocks = append(blocks, block)
+		}
+		if end == to {
+			break
+		}
+	}
+	return blocks, nil
+}
+
+// rateLimiter — ограничитель запросов по алгоритму token bucket
+type rateLimiter struct {
+	mu       sync.Mutex
+	rate     float64 // токенов в секунду
+	burst    float64
+	tokens   float64
+	lastFill time.Time
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: rate, tokens: rate, lastFill: time.Now()}
+}
+
+// wait ожидает n свободных токенов или отмену контекста. Запрос дороже ёмкости
+// ограничителя ждёт полного заполнения и уводит счёт в минус: следующие запросы
+// ждут, пока долг не погасится.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.lastFill).Seconds()*l.rate)
+		l.lastFill = now
+		need := min(float64(n), l.burst)
+		if l.tokens >= need {
+			l.tokens -= float64(n)
+			l.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((need - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
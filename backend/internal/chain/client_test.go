@@ -0,0 +1,404 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// rpcRequest — запрос JSON-RPC в теле HTTP-запроса
+type rpcRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// rpcReply — ответ тестового узла на один вызов: результат или ошибка JSON-RPC
+type rpcReply struct {
+	result any
+	code   int
+	msg    string
+}
+
+// testNode — узел JSON-RPC на httptest. status, если не 0, возвращается вместо
+// ответа; delay задерживает ответ; reply формирует ответ на каждый вызов пакета.
+type testNode struct {
+	srv      *httptest.Server
+	requests atomic.Int32
+	status   atomic.Int32
+	delay    atomic.Int64
+	reply    func(req rpcRequest) rpcReply
+}
+
+func newTestNode(t *testing.T, reply func(req rpcRequest) rpcReply) *testNode {
+	t.Helper()
+	n := &testNode{reply: reply}
+	n.srv = httptest.NewServer(http.HandlerFunc(n.serve))
+	t.Cleanup(n.srv.Close)
+	return n
+}
+
+func (n *testNode) serve(w http.ResponseWriter, r *http.Request) {
+	n.requests.Add(1)
+	if d := time.Duration(n.delay.Load()); d > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(d):
+		}
+	}
+	if status := int(n.status.Load()); status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	batch := strings.HasPrefix(strings.TrimSpace(string(body)), "[")
+	var reqs []rpcRequest
+	if batch {
+		_ = json.Unmarshal(body, &reqs)
+	} else {
+		var req rpcRequest
+		_ = json.Unmarshal(body, &req)
+		reqs = []rpcRequest{req}
+	}
+
+	resps := make([]map[string]any, len(reqs))
+	for i, req := range reqs {
+		reply := n.reply(req)
+		resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+		if reply.code != 0 {
+			resp["error"] = map[string]any{"code": reply.code, "message": reply.msg}
+		} else {
+			resp["result"] = reply.result
+		}
+		resps[i] = resp
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if batch {
+		_ = json.NewEncoder(w).Encode(resps)
+	} else {
+		_ = json.NewEncoder(w).Encode(resps[0])
+	}
+}
+
+// blockNumberReply отвечает на eth_blockNumber номером n
+func blockNumberReply(n uint64) func(req rpcRequest) rpcReply {
+	return func(req rpcRequest) rpcReply {
+		return rpcReply{result: hexutil.EncodeUint64(n)}
+	}
+}
+
+func dialTest(t *testing.T, maxRetries int, nodes ...*testNode) *Client {
+	t.Helper()
+	urls := make([]string, len(nodes))
+	for i, n := range nodes {
+		urls[i] = n.srv.URL
+	}
+	c, err := Dial(context.Background(), 1337, urls, 1000, maxRetries)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestClientFailover(t *testing.T) {
+	tests := []struct {
+		name string
+		fail func(n *testNode)
+	}{
+		{"HTTP 503", func(n *testNode) { n.status.Store(http.StatusServiceUnavailable) }},
+		{"HTTP 429", func(n *testNode) { n.status.Store(http.StatusTooManyRequests) }},
+		{"таймаут запроса", func(n *testNode) { n.delay.Store(int64(time.Second)) }},
+		{"лимит запросов узла", func(n *testNode) {
+			n.reply = func(rpcRequest) rpcReply { return rpcReply{code: -32005, msg: "limit exceeded"} }
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := newTestNode(t, blockNumberReply(1))
+			second := newTestNode(t, blockNumberReply(2))
+			tt.fail(first)
+			c := dialTest(t, 1, first, second)
+			c.requestTimeout = 100 * time.Millisecond
+
+			got, err := c.BlockNumber(context.Background())
+			if err != nil {
+				t.Fatalf("BlockNumber() error = %v", err)
+			}
+			if got != 2 {
+				t.Errorf("BlockNumber() = %d, want ответ второго узла 2", got)
+			}
+			if first.requests.Load() != 1 || second.requests.Load() != 1 {
+				t.Errorf("запросов к узлам: %d и %d, want 1 и 1", first.requests.Load(), second.requests.Load())
+			}
+
+			// отказавший узел исключён: следующий запрос сразу идёт на второй
+			if _, err := c.BlockNumber(context.Background()); err != nil {
+				t.Fatalf("BlockNumber() error = %v", err)
+			}
+			if first.requests.Load() != 1 || second.requests.Load() != 2 {
+				t.Errorf("после исключения узла запросов: %d и %d, want 1 и 2", first.requests.Load(), second.requests.Load())
+			}
+		})
+	}
+}
+
+func TestClientNoRetry(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply rpcReply
+		call  func(c *Client) error
+	}{
+		{
+			name:  "откат вызова",
+			reply: rpcReply{code: 3, msg: "execution reverted"},
+			call: func(c *Client) error {
+				_, err := c.CallContract(context.Background(), ethereum.CallMsg{To: &common.Address{}}, nil)
+				return err
+			},
+		},
+		{
+			name:  "откат при оценке газа",
+			reply: rpcReply{code: -32000, msg: "execution reverted: not owner"},
+			call: func(c *Client) error {
+				_, err := c.EstimateGas(context.Background(), ethereum.CallMsg{To: &common.Address{}})
+				return err
+			},
+		},
+		{
+			name:  "недостаточно средств",
+			reply: rpcReply{code: -32000, msg: "insufficient funds for gas * price + value"},
+			call: func(c *Client) error {
+				_, err := c.EstimateGas(context.Background(), ethereum.CallMsg{To: &common.Address{}})
+				return err
+			},
+		},
+		{
+			name:  "некорректный ответ",
+			reply: rpcReply{result: "не число"},
+			call: func(c *Client) error {
+				_, err := c.BlockNumber(context.Background())
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := func(rpcRequest) rpcReply { return tt.reply }
+			first := newTestNode(t, reply)
+			second := newTestNode(t, reply)
+			c := dialTest(t, 3, first, second)
+
+			err := tt.call(c)
+			if err == nil {
+				t.Fatal("ошибка запроса не возвращена")
+			}
+			if tt.reply.msg != "" && !strings.Contains(err.Error(), tt.reply.msg) {
+				t.Errorf("ошибка = %v, want %q", err, tt.reply.msg)
+			}
+			if first.requests.Load() != 1 || second.requests.Load() != 0 {
+				t.Errorf("запросов к узлам: %d и %d, want 1 и 0", first.requests.Load(), second.requests.Load())
+			}
+			// ошибка запроса не исключает узел
+			if e := c.pick(); e != c.endpoints[0] {
+				t.Errorf("pick() = %s, want %s", e.url, c.endpoints[0].url)
+			}
+		})
+	}
+}
+
+func TestClientBackoff(t *testing.T) {
+	node := newTestNode(t, blockNumberReply(1))
+	node.status.Store(http.StatusBadGateway)
+	c := dialTest(t, 2, node)
+
+	start := time.Now()
+	_, err := c.BlockNumber(context.Background())
+	elapsed := time.Since(start)
+
+	var httpErr rpc.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("BlockNumber() error = %v, want HTTP 502", err)
+	}
+	if got := node.requests.Load(); got != 3 {
+		t.Errorf("попыток: %d, want 3", got)
+	}
+	// задержки перед повторами: 250 мс и 500 мс
+	if want := 3 * retryBaseDelay; elapsed < want {
+		t.Errorf("повторы заняли %v, want не меньше %v", elapsed, want)
+	}
+
+	// отмена контекста прерывает ожидание повтора
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.BlockNumber(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("BlockNumber() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestClientPick(t *testing.T) {
+	c := &Client{endpoints: []*endpoint{{url: "a"}, {url: "b"}, {url: "c"}}}
+	a, b, cc := c.endpoints[0], c.endpoints[1], c.endpoints[2]
+
+	if e := c.pick(); e != a {
+		t.Fatalf("pick() = %s, want a", e.url)
+	}
+
+	a.markFailure()
+	if e := c.pick(); e != b {
+		t.Fatalf("pick() после сбоя a = %s, want b", e.url)
+	}
+
+	// все узлы исключены: выбирается тот, что вернётся раньше других
+	a.markFailure() // второй сбой подряд удваивает паузу
+	b.markFailure()
+	cc.markFailure()
+	if e := c.pick(); e != b {
+		t.Errorf("pick() при всех исключённых = %s, want b", e.url)
+	}
+
+	a.mu.Lock()
+	cooldown := time.Until(a.downUntil)
+	a.mu.Unlock()
+	if cooldown <= retryBaseDelay<<1 || cooldown > retryBaseDelay<<2 {
+		t.Errorf("пауза после двух сбоев = %v, want (%v, %v]", cooldown, retryBaseDelay<<1, retryBaseDelay<<2)
+	}
+
+	for range 20 {
+		a.markFailure()
+	}
+	a.mu.Lock()
+	cooldown = time.Until(a.downUntil)
+	a.mu.Unlock()
+	if cooldown > maxEndpointCooldown {
+		t.Errorf("пауза после многих сбоев = %v, want не больше %v", cooldown, maxEndpointCooldown)
+	}
+
+	a.markSuccess()
+	if e := c.pick(); e != a {
+		t.Errorf("pick() после восстановления a = %s, want a", e.url)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"HTTP 500", rpc.HTTPError{StatusCode: 500}, true},
+		{"HTTP 429", rpc.HTTPError{StatusCode: 429}, true},
+		{"HTTP 404", rpc.HTTPError{StatusCode: 404}, false},
+		{"таймаут", fmt.Errorf("запрос: %w", context.DeadlineExceeded), true},
+		{"обрыв соединения", io.ErrUnexpectedEOF, true},
+		{"отмена", context.Canceled, false},
+		{"ошибка разбора", errors.New("json: cannot unmarshal"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.err); got != tt.want {
+				t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     float64
+		requests []int
+		minWait  time.Duration // общее время всех запросов
+		maxWait  time.Duration
+	}{
+		{"в пределах ёмкости без ожидания", 100, []int{50, 50}, 0, 50 * time.Millisecond},
+		{"сверх ёмкости ждёт пополнения", 20, []int{20, 10}, 500 * time.Millisecond, 750 * time.Millisecond},
+		{"пакет больше ёмкости уходит в долг", 100, []int{150, 1}, 500 * time.Millisecond, 750 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(tt.rate)
+			start := time.Now()
+			for _, n := range tt.requests {
+				if err := l.wait(context.Background(), n); err != nil {
+					t.Fatalf("wait(%d) error = %v", n, err)
+				}
+			}
+			if elapsed := time.Since(start); elapsed < tt.minWait || elapsed > tt.maxWait {
+				t.Errorf("ожидание %v, want [%v, %v]", elapsed, tt.minWait, tt.maxWait)
+			}
+		})
+	}
+
+	t.Run("отмена контекста", func(t *testing.T) {
+		l := newRateLimiter(1)
+		if err := l.wait(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if err := l.wait(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("wait() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+func TestBlocksByNumber(t *testing.T) {
+	// узел знает блоки до head; на запрос более позднего возвращает null
+	const head = 45
+	node := newTestNode(t, func(req rpcRequest) rpcReply {
+		var number hexutil.Uint64
+		_ = json.Unmarshal(req.Params[0], &number)
+		if number > head {
+			return rpcReply{result: nil}
+		}
+		return rpcReply{result: map[string]any{
+			"number":       number.String(),
+			"hash":         common.BigToHash(common.Big1).Hex(),
+			"timestamp":    hexutil.EncodeUint64(1_700_000_000 + uint64(number)*12),
+			"transactions": []any{},
+		}}
+	})
+	c := dialTest(t, 0, node)
+
+	blocks, err := c.BlocksByNumber(context.Background(), 3, head)
+	if err != nil {
+		t.Fatalf("BlocksByNumber(3, %d) error = %v", head, err)
+	}
+	if len(blocks) != head-2 {
+		t.Fatalf("BlocksByNumber(3, %d) вернул %d блоков, want %d", head, len(blocks), head-2)
+	}
+	for i, b := range blocks {
+		if b.Number != uint64(3+i) || b.Time != 1_700_000_000+b.Number*12 {
+			t.Errorf("блок %d: номер %d, время %d", i, b.Number, b.Time)
+		}
+	}
+	// 43 блока — три пакета по blockBatchSize
+	if got := node.requests.Load(); got != 3 {
+		t.Errorf("пакетных запросов: %d, want 3", got)
+	}
+
+	_, err = c.BlocksByNumber(context.Background(), head-5, head+2)
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("узел не вернул блок %d", head+1)) {
+		t.Errorf("BlocksByNumber(%d, %d) error = %v, want ошибку об отсутствующем блоке %d", head-5, head+2, err, head+1)
+	}
+}
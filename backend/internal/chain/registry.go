@@ -0,0 +1,180 @@
+// Package chain описывает сети, с которыми работает бэкенд: узлы, адрес
+// контракта AudioChain и глубину подтверждений для каждой сети.
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Узел Ganache по умолчанию
+const (
+	defaultRPCURL  = "http://127.0.0.1:7545"
+	defaultChainID = 1337
+)
+
+// Config — настройки сети из файла конфигурации
+type Config struct {
+	ChainID         uint64   `json:"chain_id"`
+	Name            string   `json:"name"`
+	RPCURLs         []string `json:"rpc_urls"`
+	ContractAddress string   `json:"contract_address"` // пусто — индексатор сети не запускается
+	Confirmations   uint64   `json:"confirmations"`
+	StartBlock      uint64   `json:"start_block"`
+	RateLimit       float64  `json:"rate_limit"`            // запросов в секунду к одному узлу
+	MaxRetries      *int     `json:"max_retries,omitempty"` // повторов запроса после первой попытки; 0 — без повторов
+}
+
+// Chain — сеть с общим для всех запросов клиентом её узлов
+type Chain struct {
+	ID            uint64
+	Name          string
+	Contract      common.Address
+	Confirmations uint64
+	StartBlock    uint64
+	Client        *Client
+}
+
+// HasContract сообщает, указан ли для сети адрес AudioChain
+func (c *Chain) HasContract() bool {
+	return c.Contract != (common.Address{})
+}
+
+// IsAudioChain проверяет, что адрес — контракт AudioChain сети. Если адрес контракта
+// не настроен, по ABI декодируется любой контракт с подходящими селекторами.
+func (c *Chain) IsAudioChain(address common.Address) bool {
+	return !c.HasContract() || address == c.Contract
+}
+
+// Registry — набор настроенных сетей; первая сеть используется по умолчанию
+type Registry struct {
+	chains []*Chain
+	byID   map[uint64]*Chain
+}
+
+// LoadConfigs читает настройки сетей из JSON-файла CHAINS_CONFIG. Если файл не указан,
+// настраивается одна сеть из переменных RPC_URL, CHAIN_ID, CONTRACT_ADDRESS,
+// CONFIRMATIONS и START_BLOCK.
+func LoadConfigs() ([]Config, error) {
+	if path := os.Getenv("CHAINS_CONFIG"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения конфигурации сетей: %w", err)
+		}
+		var configs []Config
+		if err := json.Unmarshal(data, &configs); err != nil {
+			return nil, fmt.Errorf("ошибка разбора конфигурации сетей: %w", err)
+		}
+		return configs, nil
+	}
+
+	cfg := Config{
+		ChainID:         defaultChainID,
+		Name:            "ganache",
+		RPCURLs:         []string{defaultRPCURL},
+		ContractAddress: os.Getenv("CONTRACT_ADDRESS"),
+	}
+	if v := os.Getenv("RPC_URL"); v != "" {
+		cfg.RPCURLs = []string{v}
+	}
+	if v := os.Getenv("CHAIN_ID"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный CHAIN_ID: %s", v)
+		}
+		cfg.ChainID = id
+	}
+	cfg.Confirmations, _ = strconv.ParseUint(os.Getenv("CONFIRMATIONS"), 10, 64)
+	cfg.StartBlock, _ = strconv.ParseUint(os.Getenv("START_BLOCK"), 10, 64)
+	return []Config{cfg}, nil
+}
+
+// SaveConfigs записывает настройки сетей в JSON-файл в формате CHAINS_CONFIG
+func SaveConfigs(path string, configs []Config) error {
+	data, err := json.MarshalIndent(configs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("ошибка записи конфигурации сетей: %w", err)
+	}
+	return nil
+}
+
+// NewRegistry проверяет настройки и создаёт по одному клиенту на сеть. Несовпадение
+// chain ID любого узла с настройками считается ошибкой; недоступный узел — нет, чтобы
+// сервер запускался без работающей сети.
+func NewRegistry(ctx context.Context, configs []Config) (*Registry, error) {
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("не настроено ни одной сети")
+	}
+
+	r := &Registry{byID: make(map[uint64]*Chain)}
+	for _, cfg := range configs {
+		if cfg.ChainID == 0 {
+			return nil, fmt.Errorf("сеть %q: не указан chain_id", cfg.Name)
+		}
+		if _, ok := r.byID[cfg.ChainID]; ok {
+			return nil, fmt.Errorf("сеть %d указана дважды", cfg.ChainID)
+		}
+		if len(cfg.RPCURLs) == 0 {
+			return nil, fmt.Errorf("сеть %d: не указаны rpc_urls", cfg.ChainID)
+		}
+		if cfg.ContractAddress != "" && !common.IsHexAddress(cfg.ContractAddress) {
+			return nil, fmt.Errorf("сеть %d: некорректный адрес контракта %s", cfg.ChainID, cfg.ContractAddress)
+		}
+
+		maxRetries := -1
+		if cfg.MaxRetries != nil {
+			maxRetries = *cfg.MaxRetries
+		}
+		client, err := Dial(ctx, cfg.ChainID, cfg.RPCURLs, cfg.RateLimit, maxRetries)
+		if err != nil {
+			return nil, fmt.Errorf("сеть %d: %w", cfg.ChainID, err)
+		}
+		if err := client.checkChainID(ctx); err != nil {
+			client.Close()
+			return nil, err
+		}
+
+		c := &Chain{
+			ID:            cfg.ChainID,
+			Name:          cfg.Name,
+			Contract:      common.HexToAddress(cfg.ContractAddress),
+			Confirmations: cfg.Confirmations,
+			StartBlock:    cfg.StartBlock,
+			Client:        client,
+		}
+		r.chains = append(r.chains, c)
+		r.byID[c.ID] = c
+	}
+	return r, nil
+}
+
+// Get возвращает сеть по chain ID
+func (r *Registry) Get(chainID uint64) (*Chain, bool) {
+	c, ok := r.byID[chainID]
+	return c, ok
+}
+
+// Default возвращает сеть по умолчанию
+func (r *Registry) Default() *Chain {
+	return r.chains[0]
+}
+
+// All возвращает все сети в порядке конфигурации
+func (r *Registry) All() []*Chain {
+	return r.chains
+}
+
+// Close закрывает клиентов всех сетей
+func (r *Registry) Close() {
+	for _, c := range r.chains {
+		c.Client.Close()
+	}
+}
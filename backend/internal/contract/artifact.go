@@ -0,0 +1,52 @@
+package contract
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// artifact — нужные поля артефакта компиляции Truffle (build/contracts/AudioChain.json)
+type artifact struct {
+	ContractName string          `json:"contractName"`
+	ABI          json.RawMessage `json:"abi"`
+	Bytecode     string          `json:"bytecode"`
+}
+
+// LoadBytecode читает байткод развёртывания AudioChain из артефакта Truffle и проверяет,
+// что ABI артефакта совпадает с тем, с которым работает бэкенд
+func LoadBytecode(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения артефакта: %w", err)
+	}
+	var a artifact
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, fmt.Errorf("ошибка разбора артефакта: %w", err)
+	}
+
+	parsed, err := abi.JSON(bytes.NewReader(a.ABI))
+	if err != nil {
+		return nil, fmt.Errorf("некорректный ABI артефакта %s: %w", a.ContractName, err)
+	}
+	for name, method := range AudioChainABI.Methods {
+		if m, ok := parsed.Methods[name]; !ok || m.Sig != method.Sig {
+			return nil, fmt.Errorf("артефакт %s не совпадает с ABI AudioChain: нет метода %s", a.ContractName, method.Sig)
+		}
+	}
+	for name, event := range AudioChainABI.Events {
+		if e, ok := parsed.Events[name]; !ok || e.ID != event.ID {
+			return nil, fmt.Errorf("артефакт %s не совпадает с ABI AudioChain: нет события %s", a.ContractName, event.Sig)
+		}
+	}
+
+	code, err := hexutil.Decode(a.Bytecode)
+	if err != nil || len(code) == 0 {
+		return nil, fmt.Errorf("артефакт %s не содержит байткода", a.ContractName)
+	}
+	return code, nil
+}
@@ -0,0 +1,222 @@
+package contract
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ABI контракта AudioChain (frontend/contracts/contract.sol)
+//
+//go:embed AudioChain.abi.json
+var audioChainABI string
+
+// AudioChainABI — разобранный ABI контракта AudioChain
+var AudioChainABI = mustParseABI(audioChainABI)
+
+// Идентификаторы (topic0) событий контракта
+var (
+	AudioPublishedTopic = AudioChainABI.Events["AudioPublished"].ID
+	AudioPurchasedTopic = AudioChainABI.Events["AudioPurchased"].ID
+)
+
+func mustParseABI(s string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(s))
+	if err != nil {
+		panic(fmt.Sprintf("некорректный ABI AudioChain: %v", err))
+	}
+	return parsed
+}
+
+// AudioPublished — событие публикации аудио
+type AudioPublished struct {
+	ID       *big.Int
+	Owner    common.Address
+	IpfsHash string
+	Price    *big.Int
+}
+
+// AudioPurchased — событие покупки аудио; Amount — полная сумма платежа, включая комиссию
+type AudioPurchased struct {
+	ID     *big.Int
+	Buyer  common.Address
+	Seller common.Address
+	Amount *big.Int
+}
+
+// ParseAudioPublished декодирует лог события AudioPublished
+func ParseAudioPublished(log types.Log) (*AudioPublished, error) {
+	fields, err := unpackLog("AudioPublished", log)
+	if err != nil {
+		return nil, err
+	}
+	return &AudioPublished{
+		ID:       fields["id"].(*big.Int),
+		Owner:    fields["owner"].(common.Address),
+		IpfsHash: fields["ipfsHash"].(string),
+		Price:    fields["price"].(*big.Int),
+	}, nil
+}
+
+// ParseAudioPurchased декодирует лог события AudioPurchased
+func ParseAudioPurchased(log types.Log) (*AudioPurchased, error) {
+	fields, err := unpackLog("AudioPurchased", log)
+	if err != nil {
+		return nil, err
+	}
+	return &AudioPurchased{
+		ID:     fields["id"].(*big.Int),
+		Buyer:  fields["buyer"].(common.Address),
+		Seller: fields["seller"].(common.Address),
+		Amount: fields["amount"].(*big.Int),
+	}, nil
+}
+
+// PackPublishAudio кодирует вызов publishAudio(title, artist, ipfsHash, price)
+func PackPublishAudio(title, artist, ipfsHash string, price *big.Int) ([]byte, error) {
+	return AudioChainABI.Pack("publishAudio", title, artist, ipfsHash, price)
+}
+
+// FindAudioPublished ищет в логах квитанции событие AudioPublished контракта
+func FindAudioPublished(receipt *types.Receipt, contractAddr common.Address) (*AudioPublished, error) {
+	for _, log := range receipt.Logs {
+		if log.Address != contractAddr || len(log.Topics) == 0 || log.Topics[0] != AudioPublishedTopic {
+			continue
+		}
+		return ParseAudioPublished(*log)
+	}
+	return nil, fmt.Errorf("в транзакции %s нет события AudioPublished", receipt.TxHash.Hex())
+}
+
+// PackPurchaseAudio кодирует вызов purchaseAudio(audioId)
+func PackPurchaseAudio(audioID *big.Int) ([]byte, error) {
+	return AudioChainABI.Pack("purchaseAudio", audioID)
+}
+
+// Audio — запись аудио в контракте (mapping audios)
+type Audio struct {
+	ID        *big.Int
+	Title     string
+	Artist    string
+	IpfsHash  string
+	Price     *big.Int
+	Owner     common.Address
+	IsForSale bool
+}
+
+// PackGetAudio кодирует чтение audios(audioId)
+func PackGetAudio(audioID *big.Int) ([]byte, error) {
+	return AudioChainABI.Pack("audios", audioID)
+}
+
+// UnpackAudio декодирует результат audios(audioId). Для несуществующего аудио
+// контракт возвращает нулевую запись с ID = 0.
+func UnpackAudio(data []byte) (*Audio, error) {
+	values, err := AudioChainABI.Unpack("audios", data)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка декодирования audios: %w", err)
+	}
+	if len(values) != 7 {
+		return nil, fmt.Errorf("audios вернул %d значений вместо 7", len(values))
+	}
+	return &Audio{
+		ID:        values[0].(*big.Int),
+		Title:     values[1].(string),
+		Artist:    values[2].(string),
+		IpfsHash:  values[3].(string),
+		Price:     values[4].(*big.Int),
+		Owner:     values[5].(common.Address),
+		IsForSale: values[6].(bool),
+	}, nil
+}
+
+// PackGetAudioCount кодирует чтение getAudioCount()
+func PackGetAudioCount() ([]byte, error) {
+	return AudioChainABI.Pack("getAudioCount")
+}
+
+// UnpackAudioCount декодирует результат getAudioCount()
+func UnpackAudioCount(data []byte) (uint64, error) {
+	var count *big.Int
+	if err := AudioChainABI.UnpackIntoInterface(&count, "getAudioCount", data); err != nil {
+		return 0, fmt.Errorf("ошибка декодирования getAudioCount: %w", err)
+	}
+	return count.Uint64(), nil
+}
+
+// PackHasAccess кодирует чтение hasAccess(user, audioId)
+func PackHasAccess(user common.Address, audioID *big.Int) ([]byte, error) {
+	return AudioChainABI.Pack("hasAccess", user, audioID)
+}
+
+// UnpackHasAccess декодирует результат hasAccess(user, audioId)
+func UnpackHasAccess(data []byte) (bool, error) {
+	var access bool
+	if err := AudioChainABI.UnpackIntoInterface(&access, "hasAccess", data); err != nil {
+		return false, fmt.Errorf("ошибка декодирования hasAccess: %w", err)
+	}
+	return access, nil
+}
+
+// PackWithdrawPlatformFees кодирует вызов withdrawPlatformFees(recipient): весь баланс
+// контракта переводится получателю
+func PackWithdrawPlatformFees(recipient common.Address) ([]byte, error) {
+	return AudioChainABI.Pack("withdrawPlatformFees", recipient)
+}
+
+// ParseWithdrawPlatformFees распознаёт входные данные вызова withdrawPlatformFees
+// и возвращает получателя
+func ParseWithdrawPlatformFees(input []byte) (common.Address, bool) {
+	method := AudioChainABI.Methods["withdrawPlatformFees"]
+	if len(input) < 4 || !bytes.Equal(input[:4], method.ID) {
+		return common.Address{}, false
+	}
+	values, err := method.Inputs.Unpack(input[4:])
+	if err != nil || len(values) != 1 {
+		return common.Address{}, false
+	}
+	recipient, ok := values[0].(common.Address)
+	return recipient, ok
+}
+
+// unpackLog разбирает неиндексированные поля из data и индексированные из topics
+func unpackLog(name string, log types.Log) (map[string]interface{}, error) {
+	event := AudioChainABI.Events[name]
+	if len(log.Topics) == 0 || log.Topics[0] != event.ID {
+		return nil, fmt.Errorf("лог не является событием %s", name)
+	}
+
+	fields := make(map[string]interface{})
+	if err := event.Inputs.NonIndexed().UnpackIntoMap(fields, log.Data); err != nil {
+		return nil, fmt.Errorf("ошибка декодирования %s: %w", name, err)
+	}
+	var indexed abi.Arguments
+	for _, arg := range event.Inputs {
+		if arg.Indexed {
+			indexed = append(indexed, arg)
+		}
+	}
+	if err := abi.ParseTopicsIntoMap(fields, indexed, log.Topics[1:]); err != nil {
+		return nil, fmt.Errorf("ошибка декодирования топиков %s: %w", name, err)
+	}
+	return fields, nil
+}
+
+// PlatformFeePercent — комиссия платформы в процентах (platformFee в контракте).
+// Комиссия остаётся на балансе контракта, продавцу переводится остаток.
+const PlatformFeePercent = 10
+
+// SplitPayment делит сумму покупки на комиссию платформы и выплату продавцу так же,
+// как purchaseAudio: комиссия округляется вниз
+func SplitPayment(amount *big.Int) (fee, net *big.Int) {
+	fee = new(big.Int).Mul(amount, big.NewInt(PlatformFeePercent))
+	fee.Quo(fee, big.NewInt(100))
+	net = new(big.Int).Sub(amount, fee)
+	return fee, net
+}
@@ -0,0 +1,35 @@
+package contract
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestSplitPayment(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  string
+		wantFee string
+		wantNet string
+	}{
+		{"ноль", "0", "0", "0"},
+		{"делится без остатка", "1000", "100", "900"},
+		{"комиссия округляется вниз", "19", "1", "18"},
+		{"меньше минимальной комиссии", "9", "0", "9"},
+		{"один эфир", "1000000000000000000", "100000000000000000", "900000000000000000"},
+		{"больше uint64", "123456789012345678901234567", "12345678901234567890123456", "111111110111111111011111111"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, _ := new(big.Int).SetString(tt.amount, 10)
+			fee, net := SplitPayment(amount)
+			if fee.String() != tt.wantFee || net.String() != tt.wantNet {
+				t.Errorf("SplitPayment(%s) = (%s, %s), want (%s, %s)", tt.amount, fee, net, tt.wantFee, tt.wantNet)
+			}
+			if amount.String() != tt.amount {
+				t.Errorf("SplitPayment() изменил сумму: %s", amount)
+			}
+		})
+	}
+}
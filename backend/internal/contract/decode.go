@@ -0,0 +1,89 @@
+package contract
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// DecodeInput декодирует данные вызова метода AudioChain: имя метода и аргументы
+func DecodeInput(input []byte) (*model.DecodedCall, error) {
+	if len(input) < 4 {
+		return nil, fmt.Errorf("данные вызова короче селектора метода")
+	}
+	method, err := AudioChainABI.MethodById(input[:4])
+	if err != nil {
+		return nil, err
+	}
+	values, err := method.Inputs.Unpack(input[4:])
+	if err != nil {
+		return nil, fmt.Errorf("ошибка декодирования аргументов %s: %w", method.Name, err)
+	}
+
+	return &model.DecodedCall{
+		Method:    method.Name,
+		Signature: method.Sig,
+		Args:      decodedArgs(method.Inputs, values),
+	}, nil
+}
+
+// DecodeLog декодирует лог любого события AudioChain
+func DecodeLog(log types.Log) (*model.DecodedLog, error) {
+	if len(log.Topics) == 0 {
+		return nil, fmt.Errorf("лог без топиков")
+	}
+	event, err := AudioChainABI.EventByID(log.Topics[0])
+	if err != nil {
+		return nil, err
+	}
+	fields, err := unpackLog(event.Name, log)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(event.Inputs))
+	for i, arg := range event.Inputs {
+		values[i] = fields[arg.Name]
+	}
+	return &model.DecodedLog{
+		Address:  log.Address.Hex(),
+		LogIndex: log.Index,
+		Event:    event.Name,
+		Args:     decodedArgs(event.Inputs, values),
+	}, nil
+}
+
+// decodedArgs сопоставляет значения с аргументами ABI. Целые числа передаются
+// десятичной строкой, чтобы не терять точность uint256 в JSON.
+func decodedArgs(args abi.Arguments, values []interface{}) []model.DecodedArg {
+	result := make([]model.DecodedArg, len(args))
+	for i, arg := range args {
+		result[i] = model.DecodedArg{
+			Name:  strings.TrimPrefix(arg.Name, "_"),
+			Type:  arg.Type.String(),
+			Value: formatABIValue(values[i]),
+		}
+	}
+	return result
+}
+
+func formatABIValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *big.Int:
+		return v.String()
+	case common.Address:
+		return v.Hex()
+	case common.Hash:
+		return v.Hex()
+	case []byte:
+		return hexutil.Encode(v)
+	default:
+		return v
+	}
+}
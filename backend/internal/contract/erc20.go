@@ -0,0 +1,114 @@
+package contract
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Часть ABI ERC-20, нужная бэкенду: метаданные токена и событие Transfer
+const erc20ABI = `[
+	{"type":"function","name":"name","inputs":[],"outputs":[{"type":"string"}],"stateMutability":"view"},
+	{"type":"function","name":"symbol","inputs":[],"outputs":[{"type":"string"}],"stateMutability":"view"},
+	{"type":"function","name":"decimals","inputs":[],"outputs":[{"type":"uint8"}],"stateMutability":"view"},
+	{"type":"event","name":"Transfer","anonymous":false,"inputs":[
+		{"indexed":true,"name":"from","type":"address"},
+		{"indexed":true,"name":"to","type":"address"},
+		{"indexed":false,"name":"value","type":"uint256"}]}
+]`
+
+// ERC20ABI — разобранный ABI ERC-20
+var ERC20ABI = mustParseABI(erc20ABI)
+
+// ERC20TransferTopic — topic0 события Transfer(address,address,uint256)
+var ERC20TransferTopic = ERC20ABI.Events["Transfer"].ID
+
+// ERC20Transfer — событие Transfer токена ERC-20
+type ERC20Transfer struct {
+	From  common.Address
+	To    common.Address
+	Value *big.Int
+}
+
+// ParseERC20Transfer разбирает событие Transfer. ERC-721 использует тот же topic0,
+// но индексирует третий аргумент, поэтому такие логи отклоняются по числу топиков.
+func ParseERC20Transfer(log types.Log) (*ERC20Transfer, error) {
+	if len(log.Topics) != 3 || log.Topics[0] != ERC20TransferTopic {
+		return nil, fmt.Errorf("лог не является событием Transfer ERC-20")
+	}
+	value, err := ERC20ABI.Events["Transfer"].Inputs.NonIndexed().Unpack(log.Data)
+	if err != nil || len(value) != 1 {
+		return nil, fmt.Errorf("ошибка декодирования Transfer: %v", err)
+	}
+	return &ERC20Transfer{
+		From:  common.BytesToAddress(log.Topics[1].Bytes()),
+		To:    common.BytesToAddress(log.Topics[2].Bytes()),
+		Value: value[0].(*big.Int),
+	}, nil
+}
+
+// PackERC20Call кодирует вызов метода метаданных токена без аргументов: name, symbol или decimals
+func PackERC20Call(method string) ([]byte, error) {
+	return ERC20ABI.Pack(method)
+}
+
+// UnpackERC20Decimals декодирует результат decimals()
+func UnpackERC20Decimals(data []byte) (uint8, error) {
+	var decimals uint8
+	if err := ERC20ABI.UnpackIntoInterface(&decimals, "decimals", data); err != nil {
+		return 0, fmt.Errorf("ошибка декодирования decimals: %w", err)
+	}
+	return decimals, nil
+}
+
+// UnpackERC20String декодирует результат name() или symbol(). Ранние токены (MKR, SAI)
+// возвращают bytes32 вместо string — такой ответ тоже принимается.
+func UnpackERC20String(method string, data []byte) (string, error) {
+	var s string
+	if err := ERC20ABI.UnpackIntoInterface(&s, method, data); err == nil {
+		return s, nil
+	}
+	if len(data) == 32 {
+		return string(bytes.TrimRight(data, "\x00")), nil
+	}
+	return "", fmt.Errorf("ошибка декодирования %s", method)
+}
+
+// FormatUnits переводит сумму в минимальных единицах токена в десятичную запись
+// без лишних нулей: 1500000 при decimals = 6 — "1.5"
+func FormatUnits(amount *big.Int, decimals uint8) string {
+	if decimals == 0 {
+		return amount.String()
+	}
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	s := new(big.Rat).SetFrac(amount, unit).FloatString(int(decimals))
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+// ParseUnits переводит десятичную запись суммы в минимальные единицы токена;
+// знаков после точки не может быть больше decimals
+func ParseUnits(value string, decimals uint8) (*big.Int, error) {
+	whole, frac, _ := strings.Cut(strings.TrimSpace(value), ".")
+	if whole+frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return nil, fmt.Errorf("некорректная сумма %q", value)
+	}
+	if len(frac) > int(decimals) {
+		return nil, fmt.Errorf("у токена %d знаков после запятой", decimals)
+	}
+	amount, _ := new(big.Int).SetString("0"+whole+frac+strings.Repeat("0", int(decimals)-len(frac)), 10)
+	return amount, nil
+}
+
+// isDigits сообщает, состоит ли строка только из десятичных цифр
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package contract
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		decimals uint8
+		want     string
+		wantErr  bool
+	}{
+		{name: "целое", value: "3", decimals: 18, want: "3000000000000000000"},
+		{name: "дробное", value: "1.5", decimals: 6, want: "1500000"},
+		{name: "все знаки после точки", value: "0.000001", decimals: 6, want: "1"},
+		{name: "без целой части", value: ".25", decimals: 2, want: "25"},
+		{name: "точка в конце", value: "7.", decimals: 2, want: "700"},
+		{name: "пробелы по краям", value: " 2.5\n", decimals: 1, want: "25"},
+		{name: "ноль", value: "0", decimals: 18, want: "0"},
+		{name: "без знаков после точки у токена", value: "42", decimals: 0, want: "42"},
+		{name: "больше uint64", value: "123456789012.345678901234567", decimals: 18, want: "123456789012345678901234567000"},
+		{name: "лишние знаки после точки", value: "1.0000001", decimals: 6, wantErr: true},
+		{name: "дробь у токена без знаков", value: "1.5", decimals: 0, wantErr: true},
+		{name: "отрицательная сумма", value: "-1", decimals: 18, wantErr: true},
+		{name: "знак плюс", value: "+1", decimals: 18, wantErr: true},
+		{name: "экспонента", value: "1e18", decimals: 18, wantErr: true},
+		{name: "две точки", value: "1.2.3", decimals: 18, wantErr: true},
+		{name: "знак в дробной части", value: "1.-5", decimals: 18, wantErr: true},
+		{name: "только точка", value: ".", decimals: 18, wantErr: true},
+		{name: "пустая строка", value: "", decimals: 18, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseUnits(tt.value, tt.decimals)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseUnits(%q, %d) error = %v, wantErr %v", tt.value, tt.decimals, err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("ParseUnits(%q, %d) = %s, want %s", tt.value, tt.decimals, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatUnits(t *testing.T) {
+	tests := []struct {
+		amount   string
+		decimals uint8
+		want     string
+	}{
+		{"1500000", 6, "1.5"},
+		{"1", 6, "0.000001"},
+		{"3000000000000000000", 18, "3"},
+		{"0", 18, "0"},
+		{"42", 0, "42"},
+	}
+
+	for _, tt := range tests {
+		amount, _ := new(big.Int).SetString(tt.amount, 10)
+		got := FormatUnits(amount, tt.decimals)
+		if got != tt.want {
+			t.Errorf("FormatUnits(%s, %d) = %s, want %s", tt.amount, tt.decimals, got, tt.want)
+		}
+		if back, err := ParseUnits(got, tt.decimals); err != nil || back.Cmp(amount) != 0 {
+			t.Errorf("ParseUnits(FormatUnits(%s, %d)) = %v, %v", tt.amount, tt.decimals, back, err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/polonkoevv/ethcourse/internal/service"
+)
+
+// requireAdmin пропускает только запросы с заголовком "Authorization: Bearer <ADMIN_TOKEN>"
+func (h *Handler) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if h.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) != 1 {
+			http.Error(w, "Доступ запрещён", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (h *Handler) GetDuplicateFlags(w http.ResponseWriter, r *http.Request) {
+	flags, err := h.service.GetDuplicateFlags(context.Background(), r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(w, "Ошибка получения пометок: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, flags)
+}
+
+func (h *Handler) ResolveDuplicateFlag(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Некорректный идентификатор пометки", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Decision string `json:"decision"` // approved или rejected
+		Note     string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Ошибка парсинга запроса: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flag, err := h.service.ResolveDuplicateFlag(context.Background(), id, request.Decision, request.Note)
+	if errors.Is(err, service.ErrFlagNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.ErrInvalidDecision) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, service.ErrFlagResolved) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Ошибка обработки пометки: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, flag)
+}
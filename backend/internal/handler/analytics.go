@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// GetEarnings возвращает аналитику продаж по проиндексированным покупкам.
+// Параметры: owner=0x... (продавец), chain_id, music_id, group=day|week|month (по умолчанию month),
+// from/to (RFC3339 или YYYY-MM-DD), format=csv для выгрузки строк по трекам.
+func (h *Handler) GetEarnings(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := model.EarningsFilter{
+		OwnerAddr: q.Get("owner"),
+		GroupBy:   q.Get("group"),
+	}
+
+	if filter.OwnerAddr != "" && !common.IsHexAddress(filter.OwnerAddr) {
+		http.Error(w, "Некорректный адрес владельца: "+filter.OwnerAddr, http.StatusBadRequest)
+		return
+	}
+	switch filter.GroupBy {
+	case "":
+		filter.GroupBy = model.EarningsGroupMonth
+	case model.EarningsGroupDay, model.EarningsGroupWeek, model.EarningsGroupMonth:
+	default:
+		http.Error(w, "Неизвестная группировка: "+filter.GroupBy, http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("chain_id"); v != "" {
+		chainID, err := parseChainID(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.ChainID = &chainID
+	}
+	if v := q.Get("music_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Некорректный идентификатор трека", http.StatusBadRequest)
+			return
+		}
+		filter.MusicID = &id
+	}
+	var err error
+	if filter.From, err = parseTimeParam(q, "from"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.To, err = parseTimeParam(q, "to"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.service.GetEarnings(context.Background(), filter)
+	if err != nil {
+		http.Error(w, "Ошибка получения аналитики: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if q.Get("format") != "csv" {
+		writeJSON(w, http.StatusOK, report)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="earnings-`+filter.GroupBy+`.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"period", "owner", "chain_id", "audio_id", "music_id", "title", "artist",
+		"sales", "gross_wei", "platform_fee_wei", "net_wei",
+	})
+	for _, t := range report.Tracks {
+		musicID := ""
+		if t.MusicID != nil {
+			musicID = strconv.Itoa(*t.MusicID)
+		}
+		cw.Write([]string{
+			t.Period.Format("2006-01-02"),
+			t.OwnerAddr,
+			strconv.FormatUint(t.ChainID, 10),
+			strconv.FormatUint(t.AudioID, 10),
+			musicID,
+			t.Title,
+			t.Artist,
+			strconv.Itoa(t.Sales),
+			t.GrossWei,
+			t.PlatformFeeWei,
+			t.NetWei,
+		})
+	}
+	cw.Flush()
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// ExportAudit выгружает хеш-цепочку журнала аудита для адреса (?address=0x...),
+// трека (?music_id=1) или, без параметров, весь журнал вместе с результатом проверки
+func (h *Handler) ExportAudit(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	musicID := r.URL.Query().Get("music_id")
+
+	var export *model.AuditExport
+	var err error
+	switch {
+	case address != "" && musicID == "":
+		if !common.IsHexAddress(address) {
+			http.Error(w, "Некорректный адрес: "+address, http.StatusBadRequest)
+			return
+		}
+		export, err = h.service.ExportAddressAudit(context.Background(), address)
+	case musicID != "" && address == "":
+		id, convErr := strconv.Atoi(musicID)
+		if convErr != nil {
+			http.Error(w, "Некорректный идентификатор трека", http.StatusBadRequest)
+			return
+		}
+		export, err = h.service.ExportMusicAudit(context.Background(), id)
+	case address == "" && musicID == "":
+		export, err = h.service.ExportAuditLog(context.Background())
+	default:
+		http.Error(w, "Укажите либо address, либо music_id", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Ошибка получения журнала: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, export)
+}
+
+// VerifyAudit проверяет ранее выгруженную цепочку журнала, переданную в теле запроса
+func (h *Handler) VerifyAudit(w http.ResponseWriter, r *http.Request) {
+	var export model.AuditExport
+	if err := json.NewDecoder(r.Body).Decode(&export); err != nil {
+		http.Error(w, "Ошибка парсинга выгрузки: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.service.VerifyAuditExport(export))
+}
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// GetChains возвращает настроенные сети
+func (h *Handler) GetChains(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.service.Chains())
+}
+
+// parseChainID разбирает параметр chain_id; 0 означает сеть по умолчанию
+func parseChainID(q url.Values) (uint64, error) {
+	v := q.Get("chain_id")
+	if v == "" {
+		return 0, nil
+	}
+	chainID, err := strconv.ParseUint(v, 10, 64)
+	if err != nil || chainID == 0 {
+		return 0, fmt.Errorf("некорректный chain_id: %s", v)
+	}
+	return chainID, nil
+}
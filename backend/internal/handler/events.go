@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/service"
+	"github.com/polonkoevv/ethcourse/internal/stream"
+)
+
+// Интервал комментариев-пингов, чтобы прокси не закрывали простаивающее соединение
+const eventsHeartbeat = 15 * time.Second
+
+// StreamEvents отдаёт поток server-sent events для адреса (?address=0x...) и/или трека
+// (?music_id=1) в сети chain_id: новые транзакции адреса, AudioPublished и AudioPurchased по мере
+// индексации. Для продолжения после обрыва передаётся заголовок Last-Event-ID
+// (или параметр last_event_id).
+func (h *Handler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	chainID, err := parseChainID(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := model.StreamFilter{ChainID: chainID, Address: q.Get("address")}
+	if filter.Address != "" && !common.IsHexAddress(filter.Address) {
+		http.Error(w, "Некорректный адрес: "+filter.Address, http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("music_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Некорректный идентификатор трека", http.StatusBadRequest)
+			return
+		}
+		filter.MusicID = &id
+	}
+	if filter.Address == "" && filter.MusicID == nil {
+		http.Error(w, "Укажите address или music_id", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Потоковая передача не поддерживается", http.StatusInternalServerError)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = q.Get("last_event_id")
+	}
+
+	sub, replay, err := h.service.SubscribeEvents(context.Background(), filter, lastEventID)
+	if errors.Is(err, service.ErrInvalidEventID) || errors.Is(err, service.ErrUnknownChain) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, service.ErrStreamUnavailable) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Ошибка подписки на события: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer h.service.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var sent *stream.Position
+	if lastEventID != "" {
+		pos, _ := stream.ParseID(lastEventID)
+		sent = &pos
+	}
+	send := func(event model.StreamEvent) error {
+		pos, err := stream.ParseID(event.ID)
+		if err != nil {
+			return err
+		}
+		// Событие уже отправлено при догрузке пропущенных
+		if sent != nil && !sent.Less(pos) {
+			return nil
+		}
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		sent = &pos
+		return nil
+	}
+
+	for _, event := range replay {
+		if err := send(event); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events:
+			if !ok {
+				// Подписчик не успевал читать и был отключён; клиент переподключится с Last-Event-ID
+				return
+			}
+			if err := send(event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -3,8 +3,10 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -18,11 +20,12 @@ import (
 )
 
 type Handler struct {
-	service *service.Service
+	service    *service.Service
+	adminToken string
 }
 
-func NewHandler(service *service.Service) *Handler {
-	return &Handler{service: service}
+func NewHandler(service *service.Service, adminToken string) *Handler {
+	return &Handler{service: service, adminToken: adminToken}
 }
 
 func (h *Handler) CreateRouter() *chi.Mux {
@@ -31,15 +34,58 @@ func (h *Handler) CreateRouter() *chi.Mux {
 		// AllowedOrigins: []string{"https://foo.com"}, // Используйте это для продакшена
 		AllowedOrigins: []string{"http://localhost:5173"}, // Разрешаем запросы с вашего Vue-сервера
 		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		ExposedHeaders:   []string{"Link", "X-Total-Count", "X-Next-Cursor"},
 		AllowCredentials: true,
 		MaxAge:           300, // Максимальное время (в секундах) кеширования результатов preflight-запросов
 	}))
 	r.Post("/upload", h.UploadFile)
-	r.Get("/music", h.GetAllMusic)
+	r.Get("/music", h.ListMusic)
+	r.Get("/music/cid/{cid}", h.GetMusicByCID)
+	r.Get("/music/{id}", h.GetMusic)
+	r.Patch("/music/{id}", h.UpdateMusic)
+	r.Delete("/music/{id}", h.DeleteMusic)
+	r.Get("/music/{id}/audit", h.GetMusicAudit)
+	r.Get("/music/{id}/transfers", h.GetMusicTransfers)
+	r.Post("/music/{id}/transfers", h.OfferTransfer)
+	r.Get("/transfers", h.GetAddressTransfers)
+	r.Post("/transfers/{id}/accept", h.AcceptTransfer)
+	r.Post("/transfers/{id}/cancel", h.CancelTransfer)
+	r.Get("/music/{id}/splits", h.GetMusicSplits)
+	r.Post("/music/{id}/splits", h.ProposeSplit)
+	r.Post("/splits/{id}/approve", h.ApproveSplit)
+	r.Get("/music/{id}/royalties", h.GetMusicRoyalties)
+	r.Put("/music/{id}/token-price", h.SetTokenPrice)
+	r.Post("/music/{id}/token-purchases", h.ClaimTokenPurchase)
+	r.Get("/music/{id}/access", h.GetMusicAccess)
+	r.Get("/royalties", h.GetPayeeRoyalties)
+	r.Get("/analytics/earnings", h.GetEarnings)
+	r.Get("/audit", h.ExportAudit)
+	r.Post("/audit/verify", h.VerifyAudit)
+	r.Get("/search", h.SearchMusic)
 	r.Get("/transactions", h.GetTransactionHistoryFromChain)
+	r.Get("/events", h.StreamEvents)
+	r.Get("/chains", h.GetChains)
+	r.Get("/relay/typed-data", h.GetRelayTypedData)
+	r.Post("/relay/intents", h.SubmitIntent)
+	r.Get("/relay/intents", h.GetSignerIntents)
+	r.Get("/relay/intents/{id}", h.GetIntent)
+	r.Post("/relay/deposits", h.RegisterRelayDeposit)
+	r.Get("/relay/balance", h.GetRelayBalance)
+	r.Get("/payouts", h.GetOwnerPayouts)
+	r.Get("/metadata/{audioId}", h.GetTokenMetadata)
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(h.requireAdmin)
+		r.Get("/duplicates", h.GetDuplicateFlags)
+		r.Post("/duplicates/{id}/resolve", h.ResolveDuplicateFlag)
+		r.Get("/transactions", h.GetOutgoingTransactions)
+		r.Post("/transactions/{hash}/speed-up", h.SpeedUpTransaction)
+		r.Post("/transactions/{hash}/cancel", h.CancelTransaction)
+		r.Get("/treasury", h.GetTreasuryReport)
+		r.Post("/metadata/{audioId}/pin", h.PinTokenMetadata)
+	})
 	return r
 }
 
@@ -81,6 +127,9 @@ func (h *Handler) UploadFile(w http.ResponseWriter, r *http.Request) {
 		Filesize  int64  `json:"filesize"`
 		Timestamp int64  `json:"timestamp"`
 		Wallet    string `json:"wallet"`
+		// Цена в wei для публикации в контракт бэкендом; без неё трек только загружается
+		Price   string `json:"price,omitempty"`
+		ChainID uint64 `json:"chainId,omitempty"`
 	}
 
 	if err := json.Unmarshal([]byte(message), &messageData); err != nil {
@@ -94,6 +143,21 @@ func (h *Handler) UploadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Цена входит в подпись, поэтому публикация возможна только с согласия владельца
+	var price *big.Int
+	if messageData.Price != "" {
+		var ok bool
+		price, ok = new(big.Int).SetString(messageData.Price, 10)
+		if !ok || price.Sign() < 0 {
+			http.Error(w, "Некорректная цена: "+messageData.Price, http.StatusBadRequest)
+			return
+		}
+		if err := h.service.CanPublish(messageData.ChainID); err != nil {
+			writePublishError(w, err)
+			return
+		}
+	}
+
 	// Получение файла из формы
 	file, handler, err := r.FormFile("file")
 	if err != nil {
@@ -180,56 +244,70 @@ func (h *Handler) UploadFile(w http.ResponseWriter, r *http.Request) {
 
 	// 5. Добавление файла в IPFS
 	tempFile.Seek(0, 0)
-	cid, err := h.service.UploadFile(context.Background(), handler.Filename, tempFile, walletAddress, signature, time.Now())
-	if err != nil {
-		http.Error(w, "Ошибка добавления в IPFS: "+err.Error(), http.StatusInternalServerError)
-		return
+	trackTitle := title
+	if trackTitle == "" {
+		trackTitle = handler.Filename
 	}
-
-	// 6. Сохранение информации о файле в базе данных
-	audioID, err := h.service.SaveAudioMetadata(context.Background(), &model.Audio{
-		Title:      title,
+	music, created, err := h.service.UploadFile(context.Background(), tempFile, model.Music{
+		Title:      trackTitle,
 		Artist:     artist,
-		IPFSCID:    cid,
+		Genre:      r.FormValue("genre"),
+		Album:      r.FormValue("album"),
+		Tags:       parseTags(r.FormValue("tags")),
 		OwnerAddr:  walletAddress,
 		Signature:  signature,
 		UploadedAt: time.Now(),
-	})
-	if err != nil {
-		http.Error(w, "Ошибка сохранения метаданных: "+err.Error(), http.StatusInternalServerError)
+	}, message)
+	var conflictErr *service.CIDConflictError
+	if errors.As(err, &conflictErr) {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"success":          false,
+			"message":          "Этот файл уже загружен другим кошельком",
+			"cid":              conflictErr.Original.CID,
+			"originalId":       conflictErr.Original.ID,
+			"originalOwner":    conflictErr.Original.OwnerAddr,
+			"originalUploaded": conflictErr.Original.UploadedAt,
+		})
 		return
 	}
-
-	// 7. Возвращаем успешный ответ
-	response := map[string]interface{}{
-		"success": true,
-		"message": "Файл успешно загружен",
-		"cid":     cid,
-		"audioId": audioID,
+	var duplicateErr *service.AcousticDuplicateError
+	if errors.As(err, &duplicateErr) {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"success":          false,
+			"message":          "Аудио совпадает с треком другого владельца",
+			"originalId":       duplicateErr.Original.ID,
+			"originalOwner":    duplicateErr.Original.OwnerAddr,
+			"originalUploaded": duplicateErr.Original.UploadedAt,
+			"bitErrorRate":     duplicateErr.BitErrorRate,
+		})
+		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
-
-func (h *Handler) GetAllMusic(w http.ResponseWriter, r *http.Request) {
-	music, err := h.service.GetAllMusic(context.Background())
-	if err != nil {
-		http.Error(w, "Ошибка получения музыки: "+err.Error(), http.StatusInternalServerError)
+	if errors.Is(err, service.ErrStaleSignature) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
-
-	json.NewEncoder(w).Encode(music)
-}
-
-func (h *Handler) GetTransactionHistoryFromChain(w http.ResponseWriter, r *http.Request) {
-	address := r.URL.Query().Get("address")
-
-	transactions, err := h.service.GetTransactionHistoryFromChain(address, 0, 5, "http://127.0.0.1:7545")
 	if err != nil {
-		http.Error(w, "Ошибка получения транзакций: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Ошибка добавления в IPFS: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	// 6. Ответ одного вида для новой и повторной загрузки: при повторной загрузке тем же
+	// владельцем возвращается уже существующая запись
+	response := map[string]interface{}{
+		"success":  true,
+		"message":  "Файл успешно загружен",
+		"existing": !created,
+		"cid":      music.CID,
+		"audioId":  music.ID,
+		"music":    music,
+	}
+	if !created {
+		response["message"] = "Файл уже был загружен ранее"
+	}
+
+	// 7. Публикация в контракт бэкендом, если в сообщении указана цена и трек ещё не опубликован
+	if price != nil && music.AudioID == nil {
+		h.publishUploaded(response, music, messageData.ChainID, price)
+	}
 
-	json.NewEncoder(w).Encode(transactions)
+	writeJSON(w, http.StatusOK, response)
 }
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/polonkoevv/ethcourse/internal/service"
+)
+
+// tokenParams разбирает идентификатор аудио в контракте и необязательный chain_id
+func tokenParams(w http.ResponseWriter, r *http.Request) (chainID, audioID uint64, ok bool) {
+	chainID, err := parseChainID(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, 0, false
+	}
+	audioID, err = strconv.ParseUint(chi.URLParam(r, "audioId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Некорректный идентификатор аудио", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return chainID, audioID, true
+}
+
+func writeMetadataError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrMusicNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrUnknownChain):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Ошибка получения метаданных: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// GetTokenMetadata отдаёт метаданные токена в формате OpenSea по идентификатору аудио
+// в контракте AudioChain; baseURI контракта может указывать на /metadata/
+func (h *Handler) GetTokenMetadata(w http.ResponseWriter, r *http.Request) {
+	chainID, audioID, ok := tokenParams(w, r)
+	if !ok {
+		return
+	}
+
+	metadata, err := h.service.GetTokenMetadata(context.Background(), chainID, audioID)
+	if err != nil {
+		writeMetadataError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, metadata)
+}
+
+// PinTokenMetadata закрепляет текущие метаданные токена в IPFS и возвращает token URI
+func (h *Handler) PinTokenMetadata(w http.ResponseWriter, r *http.Request) {
+	chainID, audioID, ok := tokenParams(w, r)
+	if !ok {
+		return
+	}
+
+	pin, err := h.service.PinTokenMetadata(context.Background(), chainID, audioID)
+	if err != nil {
+		writeMetadataError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, pin)
+}
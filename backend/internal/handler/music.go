@@ -0,0 +1,312 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/go-chi/chi/v5"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/service"
+	"github.com/polonkoevv/ethcourse/internal/storage/postgres"
+)
+
+const (
+	defaultMusicLimit = 50
+	maxMusicLimit     = 200
+
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// ListMusic возвращает страницу каталога. Параметры запроса:
+// owner, artist, genre, uploaded_from, uploaded_to (RFC 3339 или ГГГГ-ММ-ДД),
+// for_sale (true/false), chain_id, sort (newest, title, price, popularity), cursor, limit.
+// Общее количество записей передаётся в X-Total-Count, курсор следующей страницы — в X-Next-Cursor.
+func (h *Handler) ListMusic(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseMusicFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.service.ListMusic(context.Background(), filter)
+	if errors.Is(err, postgres.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Ошибка получения музыки: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+		next := r.URL.Query()
+		next.Set("cursor", page.NextCursor)
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, next.Encode()))
+	}
+
+	music := page.Music
+	if music == nil {
+		music = []model.Music{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(music)
+}
+
+func parseMusicFilter(q url.Values) (model.MusicFilter, error) {
+	filter := model.MusicFilter{
+		OwnerAddr: q.Get("owner"),
+		Artist:    q.Get("artist"),
+		Genre:     q.Get("genre"),
+		Sort:      q.Get("sort"),
+		Cursor:    q.Get("cursor"),
+		Limit:     defaultMusicLimit,
+	}
+
+	if filter.OwnerAddr != "" && !common.IsHexAddress(filter.OwnerAddr) {
+		return filter, fmt.Errorf("некорректный адрес владельца: %s", filter.OwnerAddr)
+	}
+
+	switch filter.Sort {
+	case "":
+		filter.Sort = model.MusicSortNewest
+	case model.MusicSortNewest, model.MusicSortTitle, model.MusicSortPrice, model.MusicSortPopularity:
+	default:
+		return filter, fmt.Errorf("неизвестная сортировка: %s", filter.Sort)
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxMusicLimit {
+			return filter, fmt.Errorf("limit должен быть числом от 1 до %d", maxMusicLimit)
+		}
+		filter.Limit = limit
+	}
+
+	var err error
+	if filter.UploadedFrom, err = parseTimeParam(q, "uploaded_from"); err != nil {
+		return filter, err
+	}
+	if filter.UploadedTo, err = parseTimeParam(q, "uploaded_to"); err != nil {
+		return filter, err
+	}
+	// Дата без времени в uploaded_to включает весь день
+	if v := q.Get("uploaded_to"); filter.UploadedTo != nil && !strings.Contains(v, "T") {
+		end := filter.UploadedTo.AddDate(0, 0, 1)
+		filter.UploadedTo = &end
+	}
+
+	if v := q.Get("for_sale"); v != "" {
+		forSale, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("for_sale должен быть true или false")
+		}
+		filter.ForSale = &forSale
+	}
+
+	if v := q.Get("chain_id"); v != "" {
+		chainID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("некорректный chain_id: %s", v)
+		}
+		filter.ChainID = &chainID
+	}
+
+	return filter, nil
+}
+
+// parseTimeParam разбирает время в формате RFC 3339 или дату ГГГГ-ММ-ДД (UTC)
+func parseTimeParam(q url.Values, name string) (*time.Time, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return nil, fmt.Errorf("некорректное значение %s: %s", name, v)
+	}
+	return &t, nil
+}
+
+// SearchMusic ищет треки по запросу q (поиск по префиксам слов, с нечётким
+// поиском при опечатках); limit ограничивает число результатов.
+func (h *Handler) SearchMusic(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "Не указан поисковый запрос q", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultSearchLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxSearchLimit {
+			http.Error(w, fmt.Sprintf("limit должен быть числом от 1 до %d", maxSearchLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	results, err := h.service.SearchMusic(context.Background(), q, limit)
+	if err != nil {
+		http.Error(w, "Ошибка поиска: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if results == nil {
+		results = []model.SearchResult{}
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+// parseTags разбирает теги, перечисленные через запятую
+func parseTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// signedRequest — тело запросов на изменение трека: JSON-сообщение и подпись владельца
+type signedRequest struct {
+	Message   string `json:"message"`
+	Signature string `json:"signature"`
+}
+
+// writeMusicError переводит ошибки операций с треком в HTTP-статусы
+func writeMusicError(w http.ResponseWriter, err error) {
+	var messageErr *service.MessageError
+	switch {
+	case errors.Is(err, service.ErrMusicNotFound), errors.Is(err, service.ErrTransferNotFound),
+		errors.Is(err, service.ErrSplitNotFound), errors.Is(err, service.ErrTokenTransferNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrTransferNotPending), errors.Is(err, service.ErrShareNotPending),
+		errors.Is(err, service.ErrTransferAlreadyLinked), errors.Is(err, service.ErrTokenTransferPending),
+		errors.Is(err, service.ErrNoTokenPrice),
+		errors.Is(err, service.ErrTransferExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrUnknownChain):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrInvalidSignature), errors.Is(err, service.ErrStaleSignature):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, service.ErrNotOwner), errors.Is(err, service.ErrNotRecipient):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.As(err, &messageErr):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Ошибка обработки трека: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func musicIDParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Некорректный идентификатор трека", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *Handler) GetMusic(w http.ResponseWriter, r *http.Request) {
+	id, ok := musicIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	music, err := h.service.GetMusicByID(context.Background(), id)
+	if err != nil {
+		writeMusicError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, music)
+}
+
+func (h *Handler) GetMusicByCID(w http.ResponseWriter, r *http.Request) {
+	music, err := h.service.GetMusicByCID(context.Background(), chi.URLParam(r, "cid"))
+	if err != nil {
+		writeMusicError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, music)
+}
+
+// UpdateMusic изменяет метаданные трека. Сообщение подписывается владельцем:
+// {"action":"music_update","musicId":1,"timestamp":<мс>,"wallet":"0x...","title":"...",...};
+// изменяются только поля title, artist, genre, album, tags и coverCid, присутствующие в сообщении.
+func (h *Handler) UpdateMusic(w http.ResponseWriter, r *http.Request) {
+	id, ok := musicIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var request signedRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Ошибка парсинга запроса: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	music, err := h.service.UpdateMusic(context.Background(), id, request.Message, request.Signature)
+	if err != nil {
+		writeMusicError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, music)
+}
+
+// DeleteMusic удаляет трек; трек с историей передач, распределений доходов или выплат
+// скрывается из каталога с сохранением истории. Сообщение подписывается владельцем:
+// {"action":"music_delete","musicId":1,"timestamp":<мс>,"wallet":"0x...","unpin":true}
+func (h *Handler) DeleteMusic(w http.ResponseWriter, r *http.Request) {
+	id, ok := musicIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var request signedRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Ошибка парсинга запроса: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.DeleteMusic(context.Background(), id, request.Message, request.Signature); err != nil {
+		writeMusicError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetMusicAudit выгружает хеш-цепочку журнала аудита трека
+func (h *Handler) GetMusicAudit(w http.ResponseWriter, r *http.Request) {
+	id, ok := musicIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	export, err := h.service.ExportMusicAudit(context.Background(), id)
+	if err != nil {
+		http.Error(w, "Ошибка получения журнала: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, export)
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/go-chi/chi/v5"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/relayer"
+	"github.com/polonkoevv/ethcourse/internal/service"
+)
+
+// GetOutgoingTransactions возвращает транзакции, отправленные ключами бэкенда.
+// Параметры chain_id, from, status и limit необязательны.
+func (h *Handler) GetOutgoingTransactions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	chainID, err := parseChainID(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := model.OutgoingTxFilter{ChainID: chainID, Status: q.Get("status")}
+	if from := q.Get("from"); from != "" {
+		if !common.IsHexAddress(from) {
+			http.Error(w, "Некорректный адрес отправителя", http.StatusBadRequest)
+			return
+		}
+		filter.FromAddr = common.HexToAddress(from).Hex()
+	}
+	if v := q.Get("limit"); v != "" {
+		filter.Limit, err = strconv.Atoi(v)
+		if err != nil || filter.Limit <= 0 {
+			http.Error(w, "Некорректный limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	txs, err := h.service.ListOutgoingTransactions(context.Background(), filter)
+	if err != nil {
+		http.Error(w, "Ошибка получения транзакций: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, txs)
+}
+
+func (h *Handler) SpeedUpTransaction(w http.ResponseWriter, r *http.Request) {
+	h.replaceTransaction(w, r, h.service.SpeedUpTransaction)
+}
+
+func (h *Handler) CancelTransaction(w http.ResponseWriter, r *http.Request) {
+	h.replaceTransaction(w, r, h.service.CancelTransaction)
+}
+
+func (h *Handler) replaceTransaction(w http.ResponseWriter, r *http.Request, replace func(context.Context, string) (*types.Transaction, error)) {
+	hash := chi.URLParam(r, "hash")
+	if len(common.FromHex(hash)) != common.HashLength {
+		http.Error(w, "Некорректный хеш транзакции", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := replace(context.Background(), hash)
+	switch {
+	case errors.Is(err, relayer.ErrUnknownTransaction):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, relayer.ErrNotPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, service.ErrRelayerDisabled):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		http.Error(w, "Ошибка замены транзакции: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"replaced": common.HexToHash(hash).Hex(),
+		"txHash":   tx.Hash().Hex(),
+		"nonce":    tx.Nonce(),
+	})
+}
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// GetOwnerPayouts возвращает пересылки долей продаж треков, опубликованных бэкендом,
+// полученные адресом (?recipient=0x...)
+func (h *Handler) GetOwnerPayouts(w http.ResponseWriter, r *http.Request) {
+	recipient := r.URL.Query().Get("recipient")
+	if !common.IsHexAddress(recipient) {
+		http.Error(w, "Некорректный адрес: "+recipient, http.StatusBadRequest)
+		return
+	}
+
+	payouts, err := h.service.GetOwnerPayouts(context.Background(), recipient)
+	if err != nil {
+		http.Error(w, "Ошибка получения выплат: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if payouts == nil {
+		payouts = []model.OwnerPayout{}
+	}
+	writeJSON(w, http.StatusOK, payouts)
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/service"
+)
+
+// publishUploaded публикует загруженный трек в контракт и дописывает результат в ответ
+// загрузки. Ошибка публикации не отменяет загрузку: трек остаётся в каталоге,
+// а причина возвращается в поле publishError.
+func (h *Handler) publishUploaded(response map[string]interface{}, music *model.Music, chainID uint64, price *big.Int) {
+	published, err := h.service.PublishMusic(context.Background(), music.ID, chainID, price)
+	if err != nil {
+		response["published"] = false
+		response["publishError"] = err.Error()
+		var publishErr *service.PublishError
+		if errors.As(err, &publishErr) && publishErr.TxHash != "" {
+			response["txHash"] = publishErr.TxHash
+		}
+		return
+	}
+
+	response["published"] = true
+	response["music"] = published
+	response["chainId"] = published.ChainID
+	response["chainAudioId"] = published.AudioID
+	response["txHash"] = published.PublishTxHash
+	// Владелец аудио в контракте — ретранслятор; долю продавца он пересылает владельцу трека
+	response["contractOwner"] = published.PublisherAddr
+	response["payoutAddress"] = published.OwnerAddr
+	response["payouts"] = "/payouts?recipient=" + published.OwnerAddr
+}
+
+func writePublishError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrRelayerDisabled):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, service.ErrUnknownChain), errors.Is(err, service.ErrNoContract):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Ошибка публикации: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/go-chi/chi/v5"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/service"
+)
+
+// GetRelayTypedData возвращает домен и типы EIP-712 для подписи намерений (?chain_id=)
+func (h *Handler) GetRelayTypedData(w http.ResponseWriter, r *http.Request) {
+	chainID, err := parseChainID(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	typedData, err := h.service.RelayTypedData(chainID)
+	if err != nil {
+		writeRelayError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, typedData)
+}
+
+// SubmitIntent принимает подписанное через eth_signTypedData_v4 намерение:
+// {"type":"purchase","chainId":1337,"message":{"buyer":"0x...","audioId":"3","maxPrice":"1000","nonce":"1","deadline":"1700000000"},"signature":"0x..."}
+// {"type":"publish","chainId":1337,"message":{"owner":"0x...","cid":"Qm...","title":"...","artist":"...","price":"1000","nonce":"2","deadline":"1700000000"},"signature":"0x..."}
+func (h *Handler) SubmitIntent(w http.ResponseWriter, r *http.Request) {
+	var request model.RelayIntentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Ошибка парсинга запроса: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	intent, err := h.service.SubmitIntent(context.Background(), request)
+	if err != nil {
+		writeRelayError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, intent)
+}
+
+// GetIntent возвращает намерение и состояние его транзакции
+func (h *Handler) GetIntent(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Некорректный идентификатор намерения", http.StatusBadRequest)
+		return
+	}
+
+	intent, err := h.service.GetIntent(context.Background(), id)
+	if err != nil {
+		writeRelayError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, intent)
+}
+
+// GetSignerIntents возвращает намерения, подписанные кошельком (?signer=0x...)
+func (h *Handler) GetSignerIntents(w http.ResponseWriter, r *http.Request) {
+	signer := r.URL.Query().Get("signer")
+	if !common.IsHexAddress(signer) {
+		http.Error(w, "Некорректный адрес: "+signer, http.StatusBadRequest)
+		return
+	}
+
+	intents, err := h.service.GetIntentsBySigner(context.Background(), signer)
+	if err != nil {
+		http.Error(w, "Ошибка получения намерений: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if intents == nil {
+		intents = []model.RelayIntent{}
+	}
+	writeJSON(w, http.StatusOK, intents)
+}
+
+// RegisterRelayDeposit засчитывает перевод ETH на адрес ретранслятора как депозит
+// адреса из данных перевода или, без данных, отправителя: {"chainId":1337,"txHash":"0x..."}.
+// Из депозита оплачиваются цены покупок по намерениям; газ платит ретранслятор.
+func (h *Handler) RegisterRelayDeposit(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ChainID uint64 `json:"chainId"`
+		TxHash  string `json:"txHash"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Ошибка парсинга запроса: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	balance, err := h.service.RegisterRelayDeposit(context.Background(), request.ChainID, request.TxHash)
+	if err != nil {
+		writeRelayError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, balance)
+}
+
+// GetRelayBalance возвращает депозит адреса у ретранслятора (?address=0x...&chain_id=)
+func (h *Handler) GetRelayBalance(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	chainID, err := parseChainID(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	address := q.Get("address")
+	if !common.IsHexAddress(address) {
+		http.Error(w, "Некорректный адрес: "+address, http.StatusBadRequest)
+		return
+	}
+
+	balance, err := h.service.GetRelayBalance(context.Background(), chainID, address)
+	if err != nil {
+		writeRelayError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, balance)
+}
+
+func writeRelayError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrIntentNotFound), errors.Is(err, service.ErrDepositNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrIntentNonceUsed), errors.Is(err, service.ErrAlreadyPublished),
+		errors.Is(err, service.ErrDepositPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInsufficientDeposit):
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+	case errors.Is(err, service.ErrRelayLimit):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	case errors.Is(err, service.ErrRelayValueLimit):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrRelayerDisabled), errors.Is(err, service.ErrUnknownChain), errors.Is(err, service.ErrNoContract):
+		writePublishError(w, err)
+	default:
+		writeMusicError(w, err)
+	}
+}
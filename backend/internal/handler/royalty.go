@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/go-chi/chi/v5"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/service"
+)
+
+// ProposeSplit создаёт распределение доходов трека. Сообщение подписывается владельцем:
+// {"action":"split_propose","musicId":1,"timestamp":<мс>,"wallet":"0x...",
+// "shares":[{"address":"0x...","bps":7000,"role":"producer"},{"address":"0x...","bps":3000,"role":"vocalist"}]}
+func (h *Handler) ProposeSplit(w http.ResponseWriter, r *http.Request) {
+	id, ok := musicIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var request signedRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Ошибка парсинга запроса: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	split, err := h.service.ProposeSplit(context.Background(), id, request.Message, request.Signature)
+	if err != nil {
+		writeMusicError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, split)
+}
+
+// ApproveSplit подтверждает долю участника. Сообщение подписывается участником:
+// {"action":"split_approve","musicId":1,"splitId":3,"timestamp":<мс>,"wallet":"0x..."}
+func (h *Handler) ApproveSplit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Некорректный идентификатор распределения", http.StatusBadRequest)
+		return
+	}
+
+	var request signedRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Ошибка парсинга запроса: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	split, err := h.service.ApproveSplit(context.Background(), id, request.Message, request.Signature)
+	if err != nil {
+		writeMusicError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, split)
+}
+
+func (h *Handler) GetMusicSplits(w http.ResponseWriter, r *http.Request) {
+	id, ok := musicIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	splits, err := h.service.GetMusicSplits(context.Background(), id)
+	if err != nil {
+		http.Error(w, "Ошибка получения распределений: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if splits == nil {
+		splits = []model.RoyaltySplit{}
+	}
+
+	writeJSON(w, http.StatusOK, splits)
+}
+
+// GetMusicRoyalties возвращает разбивку покупок трека по участникам (?format=csv для выгрузки)
+func (h *Handler) GetMusicRoyalties(w http.ResponseWriter, r *http.Request) {
+	id, ok := musicIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	payouts, err := h.service.GetMusicRoyalties(context.Background(), id)
+	if errors.Is(err, service.ErrMusicNotFound) {
+		writeMusicError(w, err)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Ошибка расчёта выплат: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeRoyalties(w, r, payouts, "royalties-music-"+strconv.Itoa(id)+".csv")
+}
+
+// GetPayeeRoyalties возвращает выплаты, причитающиеся кошельку (?payee=0x...&format=csv)
+func (h *Handler) GetPayeeRoyalties(w http.ResponseWriter, r *http.Request) {
+	payee := r.URL.Query().Get("payee")
+	if !common.IsHexAddress(payee) {
+		http.Error(w, "Некорректный адрес: "+payee, http.StatusBadRequest)
+		return
+	}
+
+	payouts, err := h.service.GetPayeeRoyalties(context.Background(), payee)
+	if err != nil {
+		http.Error(w, "Ошибка расчёта выплат: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeRoyalties(w, r, payouts, "royalties-"+common.HexToAddress(payee).Hex()+".csv")
+}
+
+func writeRoyalties(w http.ResponseWriter, r *http.Request, payouts []model.RoyaltyPayout, filename string) {
+	if r.URL.Query().Get("format") != "csv" {
+		if payouts == nil {
+			payouts = []model.RoyaltyPayout{}
+		}
+		writeJSON(w, http.StatusOK, payouts)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"chain_id", "tx_hash", "log_index", "block_number", "block_time", "music_id", "audio_id", "buyer",
+		"amount_wei", "platform_fee_wei", "net_wei", "split_id", "payee", "role", "bps", "share_wei",
+	})
+	for _, p := range payouts {
+		splitID := ""
+		if p.SplitID != nil {
+			splitID = strconv.Itoa(*p.SplitID)
+		}
+		cw.Write([]string{
+			strconv.FormatUint(p.ChainID, 10),
+			p.TxHash,
+			strconv.FormatUint(uint64(p.LogIndex), 10),
+			strconv.FormatUint(p.BlockNumber, 10),
+			p.BlockTime.UTC().Format("2006-01-02T15:04:05Z"),
+			strconv.Itoa(p.MusicID),
+			strconv.FormatUint(p.AudioID, 10),
+			p.BuyerAddr,
+			p.AmountWei,
+			p.PlatformFeeWei,
+			p.NetWei,
+			splitID,
+			p.Payee,
+			p.Role,
+			strconv.Itoa(p.BPS),
+			p.ShareWei,
+		})
+	}
+	cw.Flush()
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SetTokenPrice назначает цену трека в ERC-20 токене. Сообщение подписывается владельцем:
+// {"action":"token_price","musicId":1,"chainId":1337,"token":"0x...","tokenPrice":"9.99","timestamp":<мс>,"wallet":"0x..."}
+// Пустой token снимает цену.
+func (h *Handler) SetTokenPrice(w http.ResponseWriter, r *http.Request) {
+	id, ok := musicIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var request signedRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Ошибка парсинга запроса: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	music, err := h.service.SetTokenPrice(context.Background(), id, request.Message, request.Signature)
+	if err != nil {
+		writeMusicError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, music)
+}
+
+// ClaimTokenPurchase засчитывает перевод токенов владельцу как покупку трека. Сообщение
+// подписывается покупателем:
+// {"action":"token_purchase","musicId":1,"txHash":"0x...","logIndex":3,"timestamp":<мс>,"wallet":"0x..."}
+func (h *Handler) ClaimTokenPurchase(w http.ResponseWriter, r *http.Request) {
+	id, ok := musicIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var request signedRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Ошибка парсинга запроса: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	access, err := h.service.ClaimTokenPurchase(context.Background(), id, request.Message, request.Signature)
+	if err != nil {
+		writeMusicError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, access)
+}
+
+// GetMusicAccess сообщает, есть ли у кошелька доступ к треку
+func (h *Handler) GetMusicAccess(w http.ResponseWriter, r *http.Request) {
+	id, ok := musicIDParam(w, r)
+	if !ok {
+		return
+	}
+	wallet := r.URL.Query().Get("wallet")
+	if !common.IsHexAddress(wallet) {
+		http.Error(w, "Некорректный адрес кошелька: "+wallet, http.StatusBadRequest)
+		return
+	}
+
+	access, err := h.service.GetMusicAccess(context.Background(), id, wallet)
+	if err != nil {
+		writeMusicError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, access)
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/service"
+)
+
+const (
+	defaultTransactionLimit = 20
+	maxTransactionLimit     = 100
+)
+
+// GetTransactionHistoryFromChain возвращает историю транзакций адреса. Параметры запроса:
+// address (обязателен), chain_id (по умолчанию — первая настроенная сеть), from_block, to_block, from, to (RFC 3339 или ГГГГ-ММ-ДД),
+// direction (incoming, outgoing, self), min_value (wei), cursor, limit.
+// Курсор следующей страницы передаётся в X-Next-Cursor.
+func (h *Handler) GetTransactionHistoryFromChain(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTransactionFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.service.GetTransactionHistoryFromChain(context.Background(), filter)
+	if errors.Is(err, service.ErrInvalidTransactionCursor) || errors.Is(err, service.ErrUnknownChain) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Ошибка получения транзакций: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+		next := r.URL.Query()
+		next.Set("cursor", page.NextCursor)
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, next.Encode()))
+	}
+
+	transactions := page.Transactions
+	if transactions == nil {
+		transactions = []model.BlockchainTransaction{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transactions)
+}
+
+func parseTransactionFilter(q url.Values) (model.TransactionFilter, error) {
+	filter := model.TransactionFilter{
+		Address:   q.Get("address"),
+		Direction: q.Get("direction"),
+		Cursor:    q.Get("cursor"),
+		Limit:     defaultTransactionLimit,
+	}
+
+	if !common.IsHexAddress(filter.Address) {
+		return filter, fmt.Errorf("некорректный адрес: %s", filter.Address)
+	}
+
+	var err error
+	if filter.ChainID, err = parseChainID(q); err != nil {
+		return filter, err
+	}
+
+	switch filter.Direction {
+	case "", model.TxDirectionIncoming, model.TxDirectionOutgoing, model.TxDirectionSelf:
+	default:
+		return filter, fmt.Errorf("неизвестное направление: %s", filter.Direction)
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxTransactionLimit {
+			return filter, fmt.Errorf("limit должен быть числом от 1 до %d", maxTransactionLimit)
+		}
+		filter.Limit = limit
+	}
+
+	if filter.FromBlock, err = parseBlockParam(q, "from_block"); err != nil {
+		return filter, err
+	}
+	if filter.ToBlock, err = parseBlockParam(q, "to_block"); err != nil {
+		return filter, err
+	}
+	if filter.FromBlock != nil && filter.ToBlock != nil && *filter.FromBlock > *filter.ToBlock {
+		return filter, fmt.Errorf("from_block больше to_block")
+	}
+
+	if filter.From, err = parseTimeParam(q, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTimeParam(q, "to"); err != nil {
+		return filter, err
+	}
+	// Дата без времени в to включает весь день
+	if v := q.Get("to"); filter.To != nil && !strings.Contains(v, "T") {
+		end := filter.To.AddDate(0, 0, 1)
+		filter.To = &end
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return filter, fmt.Errorf("from должен быть раньше to")
+	}
+
+	if v := q.Get("min_value"); v != "" {
+		minValue, ok := new(big.Int).SetString(v, 10)
+		if !ok || minValue.Sign() < 0 {
+			return filter, fmt.Errorf("min_value должен быть неотрицательным целым числом wei")
+		}
+		filter.MinValue = minValue
+	}
+
+	return filter, nil
+}
+
+// parseBlockParam разбирает номер блока
+func parseBlockParam(q url.Values, name string) (*uint64, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("некорректный номер блока %s: %s", name, v)
+	}
+	return &n, nil
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/go-chi/chi/v5"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// OfferTransfer создаёт предложение передачи трека. Сообщение подписывается владельцем:
+// {"action":"transfer_offer","musicId":1,"timestamp":<мс>,"wallet":"0x...","recipient":"0x..."}
+func (h *Handler) OfferTransfer(w http.ResponseWriter, r *http.Request) {
+	id, ok := musicIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var request signedRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Ошибка парсинга запроса: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	transfer, err := h.service.OfferTransfer(context.Background(), id, request.Message, request.Signature)
+	if err != nil {
+		writeMusicError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, transfer)
+}
+
+// AcceptTransfer завершает передачу. Сообщение подписывается получателем:
+// {"action":"transfer_accept","musicId":1,"transferId":5,"timestamp":<мс>,"wallet":"0x..."}
+func (h *Handler) AcceptTransfer(w http.ResponseWriter, r *http.Request) {
+	h.completeTransfer(w, r, h.service.AcceptTransfer)
+}
+
+// CancelTransfer отменяет передачу. Сообщение подписывается владельцем или получателем:
+// {"action":"transfer_cancel","musicId":1,"transferId":5,"timestamp":<мс>,"wallet":"0x..."}
+func (h *Handler) CancelTransfer(w http.ResponseWriter, r *http.Request) {
+	h.completeTransfer(w, r, h.service.CancelTransfer)
+}
+
+func (h *Handler) completeTransfer(w http.ResponseWriter, r *http.Request, action func(context.Context, int, string, string) (*model.OwnershipTransfer, error)) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Некорректный идентификатор передачи", http.StatusBadRequest)
+		return
+	}
+
+	var request signedRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Ошибка парсинга запроса: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	transfer, err := action(context.Background(), id, request.Message, request.Signature)
+	if err != nil {
+		writeMusicError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, transfer)
+}
+
+func (h *Handler) GetMusicTransfers(w http.ResponseWriter, r *http.Request) {
+	id, ok := musicIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	transfers, err := h.service.GetMusicTransfers(context.Background(), id)
+	if err != nil {
+		http.Error(w, "Ошибка получения передач: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if transfers == nil {
+		transfers = []model.OwnershipTransfer{}
+	}
+
+	writeJSON(w, http.StatusOK, transfers)
+}
+
+// GetAddressTransfers возвращает передачи, в которых участвует кошелёк (?address=0x...)
+func (h *Handler) GetAddressTransfers(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if !common.IsHexAddress(address) {
+		http.Error(w, "Некорректный адрес: "+address, http.StatusBadRequest)
+		return
+	}
+
+	transfers, err := h.service.GetAddressTransfers(context.Background(), address)
+	if err != nil {
+		http.Error(w, "Ошибка получения передач: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if transfers == nil {
+		transfers = []model.OwnershipTransfer{}
+	}
+
+	writeJSON(w, http.StatusOK, transfers)
+}
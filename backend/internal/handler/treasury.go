@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/service"
+)
+
+// GetTreasuryReport возвращает отчёт о комиссии платформы. Параметры: chain_id,
+// group=day|week|month (по умолчанию month), from/to (RFC3339 или YYYY-MM-DD).
+func (h *Handler) GetTreasuryReport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := model.TreasuryFilter{GroupBy: q.Get("group")}
+
+	switch filter.GroupBy {
+	case "":
+		filter.GroupBy = model.EarningsGroupMonth
+	case model.EarningsGroupDay, model.EarningsGroupWeek, model.EarningsGroupMonth:
+	default:
+		http.Error(w, "Неизвестная группировка: "+filter.GroupBy, http.StatusBadRequest)
+		return
+	}
+	if q.Get("chain_id") != "" {
+		chainID, err := parseChainID(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.ChainID = &chainID
+	}
+	var err error
+	if filter.From, err = parseTimeParam(q, "from"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.To, err = parseTimeParam(q, "to"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.service.GetTreasuryReport(context.Background(), filter)
+	if errors.Is(err, service.ErrUnknownChain) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Ошибка получения отчёта о комиссии: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
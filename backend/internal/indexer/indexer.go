@@ -0,0 +1,210 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/polonkoevv/ethcourse/internal/chain"
+	"github.com/polonkoevv/ethcourse/internal/contract"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/storage/postgres"
+)
+
+const (
+	// Максимальный диапазон блоков одного запроса eth_getLogs
+	batchSize = 2000
+	// Пауза между проверками новых блоков
+	pollInterval = 5 * time.Second
+)
+
+// Indexer сохраняет события AudioPublished и AudioPurchased и выводы комиссии
+// контракта AudioChain одной сети, а также переводы ERC-20 владельцам треков, в Postgres
+type Indexer struct {
+	client        *chain.Client
+	pg            *postgres.Postgres
+	chainID       uint64
+	contract      common.Address
+	confirmations uint64
+	startBlock    uint64
+	onIndexed     func(ctx context.Context, chainID, from, to uint64)
+}
+
+// NewIndexer создаёт индексатор контракта сети; события из блоков глубже
+// c.Confirmations от вершины цепочки считаются окончательными. onIndexed, если задан,
+// вызывается после сохранения каждого диапазона блоков.
+func NewIndexer(c *chain.Chain, pg *postgres.Postgres, onIndexed func(ctx context.Context, chainID, from, to uint64)) *Indexer {
+	return &Indexer{
+		client:        c.Client,
+		pg:            pg,
+		chainID:       c.ID,
+		contract:      c.Contract,
+		confirmations: c.Confirmations,
+		startBlock:    c.StartBlock,
+		onIndexed:     onIndexed,
+	}
+}
+
+// StateName — ключ позиции индексатора контракта сети в таблице indexer_state
+func StateName(chainID uint64, contractAddr common.Address) string {
+	return fmt.Sprintf("audiochain:%d:%s", chainID, strings.ToLower(contractAddr.Hex()))
+}
+
+func (i *Indexer) name() string {
+	return StateName(i.chainID, i.contract)
+}
+
+// Run обрабатывает новые блоки до отмены контекста
+func (i *Indexer) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := i.Sync(ctx); err != nil {
+			fmt.Printf("Ошибка индексации AudioChain в сети %d: %v\n", i.chainID, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync индексирует все подтверждённые блоки после последнего обработанного
+func (i *Indexer) Sync(ctx context.Context) error {
+	head, err := i.client.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка получения номера блока: %w", err)
+	}
+	if head < i.confirmations {
+		return nil
+	}
+	safe := head - i.confirmations
+
+	from := i.startBlock
+	last, ok, err := i.pg.GetLastIndexedBlock(ctx, i.name())
+	if err != nil {
+		return err
+	}
+	if ok {
+		from = last + 1
+	}
+
+	for from <= safe {
+		to := from + batchSize - 1
+		if to > safe {
+			to = safe
+		}
+		if err := i.indexRange(ctx, from, to); err != nil {
+			return err
+		}
+		from = to + 1
+	}
+	return nil
+}
+
+func (i *Indexer) indexRange(ctx context.Context, from, to uint64) error {
+	logs, err := i.client.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(from),
+		ToBlock:   new(big.Int).SetUint64(to),
+		Addresses: []common.Address{i.contract},
+		Topics:    [][]common.Hash{{contract.AudioPublishedTopic, contract.AudioPurchasedTopic}},
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка получения логов блоков %d–%d: %w", from, to, err)
+	}
+
+	var published []model.AudioPublishedEvent
+	var purchases []model.AudioPurchasedEvent
+	var accruals []accrual
+	blockTimes := make(map[uint64]time.Time)
+
+	for _, log := range logs {
+		if log.Removed {
+			continue
+		}
+		blockTime, err := i.blockTime(ctx, log, blockTimes)
+		if err != nil {
+			return err
+		}
+
+		switch log.Topics[0] {
+		case contract.AudioPublishedTopic:
+			event, err := contract.ParseAudioPublished(log)
+			if err != nil {
+				return err
+			}
+			published = append(published, model.AudioPublishedEvent{
+				ChainID:     i.chainID,
+				AudioID:     event.ID.Uint64(),
+				OwnerAddr:   event.Owner.Hex(),
+				IPFSHash:    event.IpfsHash,
+				PriceWei:    event.Price.String(),
+				BlockNumber: log.BlockNumber,
+				BlockTime:   blockTime,
+				TxHash:      log.TxHash.Hex(),
+				LogIndex:    log.Index,
+			})
+		case contract.AudioPurchasedTopic:
+			event, err := contract.ParseAudioPurchased(log)
+			if err != nil {
+				return err
+			}
+			purchases = append(purchases, model.AudioPurchasedEvent{
+				ChainID:     i.chainID,
+				AudioID:     event.ID.Uint64(),
+				BuyerAddr:   event.Buyer.Hex(),
+				SellerAddr:  event.Seller.Hex(),
+				AmountWei:   event.Amount.String(),
+				BlockNumber: log.BlockNumber,
+				BlockTime:   blockTime,
+				TxHash:      log.TxHash.Hex(),
+				LogIndex:    log.Index,
+			})
+			fee, _ := contract.SplitPayment(event.Amount)
+			accruals = append(accruals, accrual{block: log.BlockNumber, txIndex: log.TxIndex, fee: fee})
+		}
+	}
+
+	withdrawals, err := i.findWithdrawals(ctx, from, to, accruals)
+	if err != nil {
+		return err
+	}
+
+	transfers, err := i.findTokenTransfers(ctx, from, to, blockTimes)
+	if err != nil {
+		return err
+	}
+
+	if err := i.pg.SaveChainEvents(ctx, i.chainID, i.name(), published, purchases, withdrawals, transfers, to); err != nil {
+		return fmt.Errorf("ошибка сохранения событий: %w", err)
+	}
+	if len(published)+len(purchases)+len(withdrawals)+len(transfers) > 0 {
+		fmt.Printf("Сеть %d: проиндексированы блоки %d–%d: публикаций %d, покупок %d, выводов комиссии %d, переводов токенов %d\n",
+			i.chainID, from, to, len(published), len(purchases), len(withdrawals), len(transfers))
+	}
+	if i.onIndexed != nil {
+		i.onIndexed(ctx, i.chainID, from, to)
+	}
+	return nil
+}
+
+// blockTime возвращает время блока лога, кешируя заголовки в пределах диапазона
+func (i *Indexer) blockTime(ctx context.Context, log types.Log, cache map[uint64]time.Time) (time.Time, error) {
+	if t, ok := cache[log.BlockNumber]; ok {
+		return t, nil
+	}
+	header, err := i.client.HeaderByNumber(ctx, new(big.Int).SetUint64(log.BlockNumber))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ошибка получения блока %d: %w", log.BlockNumber, err)
+	}
+	t := time.Unix(int64(header.Time), 0)
+	cache[log.BlockNumber] = t
+	return t, nil
+}
@@ -0,0 +1,73 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/polonkoevv/ethcourse/internal/contract"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// findTokenTransfers возвращает переводы ERC-20 владельцам треков с ценой в токене.
+// Список токенов и получателей читается перед каждым диапазоном, поэтому переводы,
+// сделанные до назначения цены, засчитываются только через ClaimTokenPurchase.
+func (i *Indexer) findTokenTransfers(ctx context.Context, from, to uint64, blockTimes map[uint64]time.Time) ([]model.TokenTransfer, error) {
+	tokens, owners, err := i.pg.GetTokenWatch(ctx, i.chainID)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	addresses := make([]common.Address, len(tokens))
+	for n, token := range tokens {
+		addresses[n] = common.HexToAddress(token)
+	}
+	recipients := make([]common.Hash, len(owners))
+	for n, owner := range owners {
+		recipients[n] = common.BytesToHash(common.HexToAddress(owner).Bytes())
+	}
+
+	logs, err := i.client.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(from),
+		ToBlock:   new(big.Int).SetUint64(to),
+		Addresses: addresses,
+		Topics:    [][]common.Hash{{contract.ERC20TransferTopic}, nil, recipients},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения переводов токенов в блоках %d–%d: %w", from, to, err)
+	}
+
+	var transfers []model.TokenTransfer
+	for _, log := range logs {
+		if log.Removed {
+			continue
+		}
+		event, err := contract.ParseERC20Transfer(log)
+		if err != nil {
+			// Transfer ERC-721 с тем же topic0
+			continue
+		}
+		blockTime, err := i.blockTime(ctx, log, blockTimes)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, model.TokenTransfer{
+			ChainID:     i.chainID,
+			TxHash:      log.TxHash.Hex(),
+			LogIndex:    log.Index,
+			TokenAddr:   log.Address.Hex(),
+			FromAddr:    event.From.Hex(),
+			ToAddr:      event.To.Hex(),
+			Amount:      event.Value.String(),
+			BlockNumber: log.BlockNumber,
+			BlockTime:   blockTime,
+		})
+	}
+	return transfers, nil
+}
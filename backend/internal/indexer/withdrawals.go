@@ -0,0 +1,206 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/polonkoevv/ethcourse/internal/contract"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// ArchiveNodeNote объясняет, почему для учёта выводов комиссии нужен архивный узел
+const ArchiveNodeNote = "выводы комиссии находятся по падению баланса контракта (eth_getBalance на прошлых блоках): " +
+	"узел сети должен быть архивным, иначе индексация останавливается с ошибкой на блоках старше хранимого узлом состояния"
+
+// accrual — комиссия платформы с покупки и место покупки в цепочке
+type accrual struct {
+	block   uint64
+	txIndex uint
+	fee     *big.Int
+}
+
+// withdrawalScan ищет выводы комиссии в диапазоне блоков по балансу контракта.
+// Без выводов баланс растёт ровно на комиссию с покупок: других способов получить ETH
+// у контракта нет (принудительный перевод selfdestruct не в счёт). Поэтому остаток —
+// баланс за вычетом начального и комиссии покупок диапазона — не растёт, а падает
+// только в блоках с выводом.
+type withdrawalScan struct {
+	i        *Indexer
+	base     *big.Int // баланс на конец блока from-1
+	accruals []accrual
+}
+
+// findWithdrawals находит выводы комиссии в блоках [from, to]. Блоки с падением остатка
+// ищутся делением диапазона пополам, так что без выводов хватает двух запросов баланса,
+// а загружаются только блоки с выводом. В таком блоке вывод атрибутируется транзакции,
+// вызвавшей withdrawPlatformFees напрямую; сумму, которую не объясняют такие транзакции
+// (вызов из другого контракта), записывает неатрибутированный вывод. accruals —
+// комиссия с покупок диапазона в порядке цепочки. Нужен архивный узел (ArchiveNodeNote).
+func (i *Indexer) findWithdrawals(ctx context.Context, from, to uint64, accruals []accrual) ([]model.FeeWithdrawal, error) {
+	base, err := i.balanceBefore(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	scan := &withdrawalScan{i: i, base: base, accruals: accruals}
+	end, err := scan.surplus(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := scan.dropBlocks(ctx, from, to, new(big.Int), end)
+	if err != nil {
+		return nil, err
+	}
+
+	var withdrawals []model.FeeWithdrawal
+	for _, number := range blocks {
+		found, err := i.blockWithdrawals(ctx, number, accruals)
+		if err != nil {
+			return nil, err
+		}
+		withdrawals = append(withdrawals, found...)
+	}
+	return withdrawals, nil
+}
+
+// surplus возвращает остаток на конец блока n
+func (s *withdrawalScan) surplus(ctx context.Context, n uint64) (*big.Int, error) {
+	balance, err := s.i.balanceAt(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	rest := new(big.Int).Sub(balance, s.base)
+	for _, a := range s.accruals {
+		if a.block <= n {
+			rest.Sub(rest, a.fee)
+		}
+	}
+	return rest, nil
+}
+
+// dropBlocks возвращает блоки [lo, hi], в которых упал остаток; before — остаток
+// на конец блока lo-1, after — на конец hi
+func (s *withdrawalScan) dropBlocks(ctx context.Context, lo, hi uint64, before, after *big.Int) ([]uint64, error) {
+	if after.Cmp(before) >= 0 {
+		return nil, nil
+	}
+	if lo == hi {
+		return []uint64{lo}, nil
+	}
+	mid := lo + (hi-lo)/2
+	middle, err := s.surplus(ctx, mid)
+	if err != nil {
+		return nil, err
+	}
+	left, err := s.dropBlocks(ctx, lo, mid, before, middle)
+	if err != nil {
+		return nil, err
+	}
+	right, err := s.dropBlocks(ctx, mid+1, hi, middle, after)
+	if err != nil {
+		return nil, err
+	}
+	return append(left, right...), nil
+}
+
+// blockWithdrawals разбирает блок, в котором упал баланс контракта
+func (i *Indexer) blockWithdrawals(ctx context.Context, number uint64, accruals []accrual) ([]model.FeeWithdrawal, error) {
+	blocks, err := i.client.BlocksByNumber(ctx, number, number)
+	if err != nil {
+		return nil, err
+	}
+	block := blocks[0]
+	blockTime := time.Unix(int64(block.Time), 0)
+
+	var found []model.FeeWithdrawal
+	for txIndex, tx := range block.Transactions {
+		if tx.To() == nil || *tx.To() != i.contract {
+			continue
+		}
+		recipient, ok := contract.ParseWithdrawPlatformFees(tx.Data())
+		if !ok {
+			continue
+		}
+		receipt, err := i.client.TransactionReceipt(ctx, tx.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения квитанции %s: %w", tx.Hash().Hex(), err)
+		}
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			continue
+		}
+		index := uint(txIndex)
+		found = append(found, model.FeeWithdrawal{
+			ChainID:       i.chainID,
+			Attributed:    true,
+			TxHash:        tx.Hash().Hex(),
+			BlockNumber:   number,
+			TxIndex:       &index,
+			BlockTime:     blockTime,
+			CallerAddr:    block.Senders[txIndex].Hex(),
+			RecipientAddr: recipient.Hex(),
+		})
+	}
+
+	// Вывод переводит весь баланс контракта, поэтому его сумма — баланс перед
+	// транзакцией: на конец предыдущего блока плюс комиссия покупок блока до неё
+	before, err := i.balanceBefore(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	after, err := i.balanceAt(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	outflow := new(big.Int).Sub(before, after)
+	for _, a := range accruals {
+		if a.block == number {
+			outflow.Add(outflow, a.fee)
+		}
+	}
+
+	balance := before
+	var prev uint
+	for n := range found {
+		w := &found[n]
+		for _, a := range accruals {
+			if a.block == number && a.txIndex >= prev && a.txIndex < *w.TxIndex {
+				balance.Add(balance, a.fee)
+			}
+		}
+		w.AmountWei = balance.String()
+		outflow.Sub(outflow, balance)
+		balance = new(big.Int)
+		prev = *w.TxIndex
+	}
+
+	if outflow.Sign() > 0 {
+		found = append(found, model.FeeWithdrawal{
+			ChainID:     i.chainID,
+			BlockNumber: number,
+			BlockTime:   blockTime,
+			AmountWei:   outflow.String(),
+		})
+		fmt.Printf("Сеть %d: вывод комиссии %s wei в блоке %d без транзакции withdrawPlatformFees в контракт (вызов из другого контракта)\n",
+			i.chainID, outflow, number)
+	}
+	return found, nil
+}
+
+// balanceAt возвращает баланс контракта на конец блока
+func (i *Indexer) balanceAt(ctx context.Context, block uint64) (*big.Int, error) {
+	balance, err := i.client.BalanceAt(ctx, i.contract, new(big.Int).SetUint64(block))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения баланса контракта в блоке %d (для учёта выводов комиссии нужен архивный узел): %w", block, err)
+	}
+	return balance, nil
+}
+
+// balanceBefore возвращает баланс контракта на конец блока, предшествующего block
+func (i *Indexer) balanceBefore(ctx context.Context, block uint64) (*big.Int, error) {
+	if block == 0 {
+		return new(big.Int), nil
+	}
+	return i.balanceAt(ctx, block-1)
+}
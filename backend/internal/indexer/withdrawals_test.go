@@ -0,0 +1,183 @@
+package indexer
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/polonkoevv/ethcourse/internal/chain/chaintest"
+	"github.com/polonkoevv/ethcourse/internal/contract"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+var (
+	testContract  = common.HexToAddress("0x000000000000000000000000000000000000a0d1")
+	testMultisig  = common.HexToAddress("0x000000000000000000000000000000000000c0fe")
+	testRecipient = common.HexToAddress("0x000000000000000000000000000000000000beef")
+)
+
+// withdrawalChain — тестовый узел, в блоки которого включаются покупки и выводы комиссии
+type withdrawalChain struct {
+	t     *testing.T
+	node  *chaintest.Node
+	nonce uint64
+}
+
+func (w *withdrawalChain) sign(to common.Address, data []byte) *types.Transaction {
+	w.t.Helper()
+	key, _ := crypto.HexToECDSA("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80")
+	tx, err := types.SignNewTx(key, w.node.Signer(), &types.DynamicFeeTx{
+		ChainID:   big.NewInt(1337),
+		Nonce:     w.nonce,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(2),
+		Gas:       100000,
+		To:        &to,
+		Data:      data,
+	})
+	if err != nil {
+		w.t.Fatal(err)
+	}
+	w.nonce++
+	return tx
+}
+
+// purchase включает в блок покупку
+func (w *withdrawalChain) purchase(block uint64) {
+	data, _ := contract.PackPurchaseAudio(big.NewInt(1))
+	w.node.Include(block, w.sign(testContract, data), types.ReceiptStatusSuccessful)
+}
+
+// withdraw включает в блок вызов withdrawPlatformFees на адрес to (контракт или мультиподпись)
+func (w *withdrawalChain) withdraw(block uint64, to common.Address, status uint64) {
+	data, _ := contract.PackWithdrawPlatformFees(testRecipient)
+	if to != testContract {
+		data = append([]byte{0xc6, 0x42, 0x74, 0x74}, data...) // execTransaction мультиподписи
+	}
+	w.node.Include(block, w.sign(to, data), status)
+}
+
+func (w *withdrawalChain) balances(values map[uint64]int64) {
+	for block, wei := range values {
+		w.node.SetBalance(testContract, block, big.NewInt(wei))
+	}
+}
+
+func TestFindWithdrawals(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup заполняет блоки 100–199 и возвращает комиссию покупок диапазона
+		setup       func(w *withdrawalChain) []accrual
+		want        []model.FeeWithdrawal
+		wantFetched int // загружено блоков
+		wantErr     string
+	}{
+		{
+			name: "без выводов блоки не загружаются",
+			setup: func(w *withdrawalChain) []accrual {
+				w.balances(map[uint64]int64{99: 1000, 110: 1100, 150: 1180, 190: 1200})
+				return []accrual{{110, 0, big.NewInt(100)}, {150, 0, big.NewInt(50)}, {150, 2, big.NewInt(30)}, {190, 0, big.NewInt(20)}}
+			},
+		},
+		{
+			name: "отменённый вызов без падения баланса",
+			setup: func(w *withdrawalChain) []accrual {
+				w.withdraw(130, testContract, types.ReceiptStatusFailed)
+				w.balances(map[uint64]int64{99: 1000, 110: 1100})
+				return []accrual{{110, 0, big.NewInt(100)}}
+			},
+		},
+		{
+			name: "прямой вызов между покупками блока",
+			setup: func(w *withdrawalChain) []accrual {
+				w.purchase(150)
+				w.withdraw(150, testContract, types.ReceiptStatusSuccessful)
+				w.purchase(150)
+				w.balances(map[uint64]int64{99: 1000, 110: 1100, 150: 30, 190: 50})
+				return []accrual{{110, 0, big.NewInt(100)}, {150, 0, big.NewInt(50)}, {150, 2, big.NewInt(30)}, {190, 0, big.NewInt(20)}}
+			},
+			want:        []model.FeeWithdrawal{{Attributed: true, BlockNumber: 150, AmountWei: "1150"}},
+			wantFetched: 1,
+		},
+		{
+			name: "вызов из мультиподписи",
+			setup: func(w *withdrawalChain) []accrual {
+				w.purchase(150)
+				w.withdraw(150, testMultisig, types.ReceiptStatusSuccessful)
+				w.balances(map[uint64]int64{99: 1000, 110: 1100, 150: 0})
+				return []accrual{{110, 0, big.NewInt(100)}, {150, 0, big.NewInt(50)}}
+			},
+			want:        []model.FeeWithdrawal{{BlockNumber: 150, AmountWei: "1150"}},
+			wantFetched: 1,
+		},
+		{
+			name: "два вывода в диапазоне",
+			setup: func(w *withdrawalChain) []accrual {
+				w.withdraw(120, testContract, types.ReceiptStatusSuccessful)
+				w.withdraw(180, testMultisig, types.ReceiptStatusSuccessful)
+				w.balances(map[uint64]int64{99: 1000, 110: 1100, 120: 0, 150: 50, 180: 0})
+				return []accrual{{110, 0, big.NewInt(100)}, {150, 0, big.NewInt(50)}}
+			},
+			want: []model.FeeWithdrawal{
+				{Attributed: true, BlockNumber: 120, AmountWei: "1100"},
+				{BlockNumber: 180, AmountWei: "50"},
+			},
+			wantFetched: 2,
+		},
+		{
+			name: "неархивный узел",
+			setup: func(w *withdrawalChain) []accrual {
+				w.node.AddBlock(1000, 1_700_100_000)
+				w.node.SetArchiveDepth(128)
+				return nil
+			},
+			wantErr: "архивный узел",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := chaintest.New(t, 1337)
+			node.AddBlock(199, 1_700_000_000)
+			w := &withdrawalChain{t: t, node: node}
+			accruals := tt.setup(w)
+
+			c := node.Chain(t, testContract)
+			i := &Indexer{client: c.Client, chainID: c.ID, contract: c.Contract}
+			got, err := i.findWithdrawals(context.Background(), 100, 199, accruals)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("findWithdrawals() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("findWithdrawals() error = %v", err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("findWithdrawals() = %+v, want %d выводов", got, len(tt.want))
+			}
+			for n, want := range tt.want {
+				g := got[n]
+				if g.Attributed != want.Attributed || g.BlockNumber != want.BlockNumber || g.AmountWei != want.AmountWei {
+					t.Errorf("вывод %d = {attributed: %v, block: %d, amount: %s}, want {attributed: %v, block: %d, amount: %s}",
+						n, g.Attributed, g.BlockNumber, g.AmountWei, want.Attributed, want.BlockNumber, want.AmountWei)
+				}
+				if g.Attributed != (g.TxHash != "") || g.Attributed != (g.TxIndex != nil) {
+					t.Errorf("вывод %d: attributed = %v, tx_hash = %q, tx_index = %v", n, g.Attributed, g.TxHash, g.TxIndex)
+				}
+				if g.Attributed && g.RecipientAddr != testRecipient.Hex() {
+					t.Errorf("вывод %d: получатель %s, want %s", n, g.RecipientAddr, testRecipient.Hex())
+				}
+			}
+			if fetched := node.Calls("eth_getBlockByNumber"); fetched != tt.wantFetched {
+				t.Errorf("загружено блоков: %d, want %d", fetched, tt.wantFetched)
+			}
+		})
+	}
+}
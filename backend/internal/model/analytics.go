@@ -0,0 +1,57 @@
+package model
+
+import "time"
+
+// Периоды группировки аналитики продаж
+const (
+	EarningsGroupDay   = "day"
+	EarningsGroupWeek  = "week"
+	EarningsGroupMonth = "month"
+)
+
+// EarningsFilter — параметры отчёта о продажах
+type EarningsFilter struct {
+	ChainID   *uint64
+	OwnerAddr string // продавец на момент покупки
+	MusicID   *int
+	GroupBy   string
+	From      *time.Time
+	To        *time.Time
+}
+
+// TrackEarnings — продажи одного трека за период. Покупки аудио, не связанного
+// с записью каталога, попадают в отчёт с пустым MusicID.
+type TrackEarnings struct {
+	Period         time.Time `json:"period"`
+	ChainID        uint64    `json:"chain_id"`
+	OwnerAddr      string    `json:"owner_addr"`
+	AudioID        uint64    `json:"audio_id"`
+	MusicID        *int      `json:"music_id,omitempty"`
+	Title          string    `json:"title"`
+	Artist         string    `json:"artist"`
+	Sales          int       `json:"sales"`
+	GrossWei       string    `json:"gross_wei"`
+	PlatformFeeWei string    `json:"platform_fee_wei"`
+	NetWei         string    `json:"net_wei"`
+}
+
+// OwnerEarnings — продажи всех треков владельца за период
+type OwnerEarnings struct {
+	Period         time.Time `json:"period"`
+	OwnerAddr      string    `json:"owner_addr"`
+	Sales          int       `json:"sales"`
+	GrossWei       string    `json:"gross_wei"`
+	PlatformFeeWei string    `json:"platform_fee_wei"`
+	NetWei         string    `json:"net_wei"`
+}
+
+// EarningsReport — отчёт о продажах по трекам и владельцам
+type EarningsReport struct {
+	GroupBy        string          `json:"group_by"`
+	Tracks         []TrackEarnings `json:"tracks"`
+	Owners         []OwnerEarnings `json:"owners"`
+	Sales          int             `json:"sales"`
+	GrossWei       string          `json:"gross_wei"`
+	PlatformFeeWei string          `json:"platform_fee_wei"`
+	NetWei         string          `json:"net_wei"`
+}
@@ -0,0 +1,58 @@
+package model
+
+import "time"
+
+// Действия, записываемые в журнал аудита
+const (
+	AuditActionUpload      = "audio_upload"
+	AuditActionMusicUpdate = "music_update"
+	AuditActionMusicDelete = "music_delete"
+	AuditActionAdminReject = "admin_reject" // удаление трека администратором по пометке о дубликате
+
+	AuditActionTransferOffer  = "transfer_offer"
+	AuditActionTransferAccept = "transfer_accept"
+	AuditActionTransferCancel = "transfer_cancel"
+
+	AuditActionSplitPropose = "split_propose"
+	AuditActionSplitApprove = "split_approve"
+
+	AuditActionTokenPrice    = "token_price"    // назначение или снятие цены в ERC-20
+	AuditActionTokenPurchase = "token_purchase" // покупатель засчитывает перевод токенов
+)
+
+// AuditAdminAddress записывается вместо адреса для действий администратора без подписи
+const AuditAdminAddress = "admin"
+
+// AuditEntry — запись журнала аудита. Каждая запись входит в три хеш-цепочки:
+// общую, цепочку адреса подписавшего и цепочку трека.
+type AuditEntry struct {
+	ID              int       `json:"id" db:"entry_id"`
+	Action          string    `json:"action" db:"action"`
+	MusicID         *int      `json:"music_id,omitempty" db:"music_id"`
+	RecoveredAddr   string    `json:"recovered_addr" db:"recovered_addr"`
+	Message         string    `json:"message" db:"message"`           // подписанное сообщение как есть
+	Signature       string    `json:"signature" db:"signature"`       // пусто для действий администратора
+	Details         string    `json:"details,omitempty" db:"details"` // JSON-снимок изменения, хешируется как есть
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	PrevHash        string    `json:"prev_hash" db:"prev_hash"`
+	AddressPrevHash string    `json:"address_prev_hash" db:"address_prev_hash"`
+	MusicPrevHash   string    `json:"music_prev_hash" db:"music_prev_hash"`
+	EntryHash       string    `json:"entry_hash" db:"entry_hash"`
+}
+
+// AuditExport — выгрузка цепочки записей одного адреса или трека для независимой проверки
+type AuditExport struct {
+	Format       string             `json:"format"`
+	Chain        string             `json:"chain"` // address или music
+	Address      string             `json:"address,omitempty"`
+	MusicID      *int               `json:"music_id,omitempty"`
+	Entries      []AuditEntry       `json:"entries"`
+	Verification *AuditVerification `json:"verification,omitempty"`
+}
+
+// AuditVerification — результат проверки выгрузки
+type AuditVerification struct {
+	Valid    bool     `json:"valid"`
+	HeadHash string   `json:"head_hash,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+}
@@ -1,6 +1,9 @@
 package model
 
-import "time"
+import (
+	"math/big"
+	"time"
+)
 
 type BlockchainTransaction struct {
 	Hash            string
@@ -12,5 +15,98 @@ type BlockchainTransaction struct {
 	GasPrice        string
 	Input           string
 	Timestamp       time.Time
-	TransactionType string // "incoming" или "outgoing"
+	TransactionType string // одно из направлений TxDirection*
+
+	// Параметры транзакции по типу (0 — legacy, 1 — EIP-2930, 2 — EIP-1559).
+	// Для EIP-1559 GasPrice — фактически уплаченная цена газа из квитанции.
+	Type                 uint8
+	Nonce                uint64
+	ChainID              string // пусто для legacy-транзакций без EIP-155
+	MaxFeePerGas         string
+	MaxPriorityFeePerGas string
+	AccessList           []AccessTuple
+	Category             string // одна из констант TxCategory*
+
+	// Данные квитанции; пусты, если квитанцию получить не удалось
+	Status            string // "success" или "failed"
+	GasUsed           uint64
+	EffectiveGasPrice string
+	Fee               string // GasUsed * EffectiveGasPrice, в wei
+	ContractAddress   string // адрес созданного контракта
+	RevertReason      string
+	Call              *DecodedCall
+	Logs              []DecodedLog
+}
+
+// Направления транзакции относительно адреса истории
+const (
+	TxDirectionIncoming = "incoming"
+	TxDirectionOutgoing = "outgoing"
+	TxDirectionSelf     = "self" // адрес отправил транзакцию самому себе
+)
+
+// TransactionFilter — параметры истории транзакций адреса; пустые поля не ограничивают выборку.
+// Временные границы переводятся в номера блоков, To не включается.
+type TransactionFilter struct {
+	ChainID   uint64
+	Address   string
+	FromBlock *uint64
+	ToBlock   *uint64
+	From      *time.Time
+	To        *time.Time
+	Direction string
+	MinValue  *big.Int // в wei
+	Cursor    string
+	Limit     int
+}
+
+// TransactionPage — страница истории; NextCursor пуст, если просмотрен весь диапазон блоков.
+// Страница может содержать меньше Limit транзакций, если исчерпан лимит блоков на запрос.
+type TransactionPage struct {
+	Transactions []BlockchainTransaction
+	NextCursor   string
+}
+
+// Категории транзакций в истории
+const (
+	TxCategoryPublish          = "publish"
+	TxCategoryPurchase         = "purchase"
+	TxCategoryFeeWithdrawal    = "fee_withdrawal"
+	TxCategoryTransfer         = "transfer"
+	TxCategoryContractCreation = "contract_creation"
+	TxCategoryContractCall     = "contract_call" // вызов другого метода или другого контракта
+)
+
+// Статусы транзакции по квитанции
+const (
+	TxStatusSuccess = "success"
+	TxStatusFailed  = "failed"
+)
+
+// AccessTuple — элемент списка доступа EIP-2930
+type AccessTuple struct {
+	Address     string   `json:"address"`
+	StorageKeys []string `json:"storage_keys"`
+}
+
+// DecodedCall — вызов метода контракта, декодированный по ABI
+type DecodedCall struct {
+	Method    string       `json:"method"`
+	Signature string       `json:"signature"`
+	Args      []DecodedArg `json:"args"`
+}
+
+// DecodedLog — событие из квитанции транзакции, декодированное по ABI
+type DecodedLog struct {
+	Address  string       `json:"address"`
+	LogIndex uint         `json:"log_index"`
+	Event    string       `json:"event"`
+	Args     []DecodedArg `json:"args"`
+}
+
+// DecodedArg — аргумент вызова или события; uint256 передаётся десятичной строкой
+type DecodedArg struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
 }
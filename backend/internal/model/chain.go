@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// AudioPublishedEvent — проиндексированное событие AudioPublished контракта AudioChain
+type AudioPublishedEvent struct {
+	ChainID     uint64    `json:"chain_id" db:"chain_id"`
+	AudioID     uint64    `json:"audio_id" db:"audio_id"`
+	OwnerAddr   string    `json:"owner_addr" db:"owner_addr"`
+	IPFSHash    string    `json:"ipfs_hash" db:"ipfs_hash"`
+	PriceWei    string    `json:"price_wei" db:"price_wei"`
+	BlockNumber uint64    `json:"block_number" db:"block_number"`
+	BlockTime   time.Time `json:"block_time" db:"block_time"`
+	TxHash      string    `json:"tx_hash" db:"tx_hash"`
+	LogIndex    uint      `json:"log_index" db:"log_index"`
+	MusicID     *int      `json:"music_id,omitempty" db:"music_id"` // трек каталога, если связан
+}
+
+// AudioPurchasedEvent — проиндексированное событие AudioPurchased контракта AudioChain
+type AudioPurchasedEvent struct {
+	ChainID     uint64    `json:"chain_id" db:"chain_id"`
+	AudioID     uint64    `json:"audio_id" db:"audio_id"`
+	BuyerAddr   string    `json:"buyer_addr" db:"buyer_addr"`
+	SellerAddr  string    `json:"seller_addr" db:"seller_addr"`
+	AmountWei   string    `json:"amount_wei" db:"amount_wei"`
+	BlockNumber uint64    `json:"block_number" db:"block_number"`
+	BlockTime   time.Time `json:"block_time" db:"block_time"`
+	TxHash      string    `json:"tx_hash" db:"tx_hash"`
+	LogIndex    uint      `json:"log_index" db:"log_index"`
+	MusicID     *int      `json:"music_id,omitempty" db:"music_id"` // трек каталога, если связан
+}
+
+// ChainInfo — описание настроенной сети для клиентов
+type ChainInfo struct {
+	ChainID         uint64 `json:"chain_id"`
+	Name            string `json:"name"`
+	ContractAddress string `json:"contract_address,omitempty"`
+	Confirmations   uint64 `json:"confirmations"`
+	Default         bool   `json:"default"`
+}
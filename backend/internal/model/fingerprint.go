@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// Статусы проверки подозрительных загрузок
+const (
+	DuplicateFlagPending  = "pending"
+	DuplicateFlagApproved = "approved"
+	DuplicateFlagRejected = "rejected"
+)
+
+// FingerprintCandidate — трек-кандидат, найденный по совпадающим хешам отпечатка
+type FingerprintCandidate struct {
+	MusicID int
+	Offset  int // сдвиг позиции в сохранённом отпечатке относительно нового
+	Hits    int
+}
+
+// DuplicateFlag — загрузка, совпавшая по отпечатку с треком другого владельца
+type DuplicateFlag struct {
+	ID                int        `json:"id" db:"flag_id"`
+	MusicID           int        `json:"music_id" db:"music_id"`
+	MatchedMusicID    int        `json:"matched_music_id" db:"matched_music_id"`
+	UploaderAddr      string     `json:"uploader_addr" db:"uploader_addr"`
+	OriginalOwnerAddr string     `json:"original_owner_addr" db:"original_owner_addr"`
+	BitErrorRate      float64    `json:"bit_error_rate" db:"bit_error_rate"`
+	Status            string     `json:"status" db:"status"`
+	ReviewNote        string     `json:"review_note,omitempty" db:"review_note"`
+	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
+	ReviewedAt        *time.Time `json:"reviewed_at,omitempty" db:"reviewed_at"`
+}
@@ -0,0 +1,26 @@
+package model
+
+import "math"
+
+// ReplayGainReference — опорный уровень ReplayGain 2.0 в LUFS
+const ReplayGainReference = -18.0
+
+// Loudness — результаты измерения громкости по EBU R128
+type Loudness struct {
+	Integrated float64 `json:"integrated_lufs"` // интегральная громкость, LUFS
+	Range      float64 `json:"range_lu"`        // диапазон громкости (LRA), LU
+	TruePeak   float64 `json:"true_peak_dbtp"`  // истинный пик, dBTP
+	TrackGain  float64 `json:"replaygain_track_gain"`
+	TrackPeak  float64 `json:"replaygain_track_peak"`
+}
+
+// NewLoudness заполняет значения ReplayGain по результатам измерения
+func NewLoudness(integrated, lra, truePeak float64) *Loudness {
+	return &Loudness{
+		Integrated: integrated,
+		Range:      lra,
+		TruePeak:   truePeak,
+		TrackGain:  math.Round((ReplayGainReference-integrated)*100) / 100,
+		TrackPeak:  math.Round(math.Pow(10, truePeak/20)*1e6) / 1e6,
+	}
+}
@@ -0,0 +1,27 @@
+package model
+
+// TokenMetadata — метаданные токена трека в формате OpenSea, общем для ERC-721 и ERC-1155
+type TokenMetadata struct {
+	Name         string              `json:"name"`
+	Description  string              `json:"description"`
+	Image        string              `json:"image,omitempty"`
+	AnimationURL string              `json:"animation_url"`
+	Attributes   []MetadataAttribute `json:"attributes"`
+}
+
+// MetadataAttribute — свойство токена; DisplayType "number" маркетплейсы показывают как число
+type MetadataAttribute struct {
+	TraitType   string      `json:"trait_type"`
+	Value       interface{} `json:"value"`
+	DisplayType string      `json:"display_type,omitempty"`
+}
+
+// MetadataPin — закреплённая в IPFS версия метаданных токена
+type MetadataPin struct {
+	MusicID  int           `json:"music_id"`
+	ChainID  uint64        `json:"chain_id"`
+	AudioID  uint64        `json:"audio_id"`
+	CID      string        `json:"cid"`
+	TokenURI string        `json:"token_uri"`
+	Metadata TokenMetadata `json:"metadata"`
+}
@@ -5,9 +5,91 @@ import "time"
 type Music struct {
 	ID         int       `json:"id" db:"music_id"`
 	Title      string    `json:"title" db:"title"`
+	Artist     string    `json:"artist" db:"artist"`
+	Genre      string    `json:"genre" db:"genre"`
+	Album      string    `json:"album" db:"album"`
+	Tags       []string  `json:"tags" db:"tags"`
 	CID        string    `json:"cid" db:"cid"`
 	Link       string    `json:"link" db:"link"`
 	OwnerAddr  string    `json:"owner_addr" db:"owner_addr"`
 	Signature  string    `json:"signature" db:"signature"`
 	UploadedAt time.Time `json:"uploaded_at" db:"uploaded_at"`
+	Loudness   *Loudness `json:"loudness,omitempty"`
+	Duration   *float64  `json:"duration_seconds,omitempty" db:"duration_seconds"`
+	CoverCID   string    `json:"cover_cid,omitempty" db:"cover_cid"`
+
+	// Состояние в контракте AudioChain, заполняется индексатором. Если трек опубликован
+	// в нескольких сетях, используется самая ранняя публикация.
+	ChainID       *int64  `json:"chain_id,omitempty" db:"chain_id"`
+	AudioID       *int64  `json:"audio_id,omitempty" db:"audio_id"`
+	PriceWei      *string `json:"price_wei,omitempty" db:"price_wei"`
+	ForSale       bool    `json:"for_sale" db:"for_sale"`
+	PurchaseCount int     `json:"purchase_count" db:"purchase_count"`
+
+	// Публикация в контракт бэкендом: в контракте владельцем записывается аккаунт
+	// ретранслятора PublisherAddr, доходы от продаж причитаются OwnerAddr
+	PublishStatus string  `json:"publish_status,omitempty" db:"publish_status"`
+	PublishTxHash *string `json:"publish_tx_hash,omitempty" db:"publish_tx_hash"`
+	PublisherAddr *string `json:"publisher_addr,omitempty" db:"publisher_addr"`
+
+	// Цена в ERC-20 токене, назначенная владельцем; nil — трек продаётся только за ETH
+	TokenPrice *TokenPrice `json:"token_price,omitempty"`
+
+	// CID закреплённых в IPFS метаданных токена, на который может указывать token URI
+	MetadataCID string `json:"metadata_cid,omitempty" db:"metadata_cid"`
+
+	// Время удаления трека с историей передач, распределений доходов или выплат: такой
+	// трек скрыт из каталога, но его строка остаётся для истории
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+}
+
+// Состояния публикации трека в контракт бэкендом; пустое — бэкенд трек не публиковал
+const (
+	PublishStatusPending   = "pending"
+	PublishStatusPublished = "published"
+	PublishStatusFailed    = "failed"
+)
+
+// Варианты сортировки каталога
+const (
+	MusicSortNewest     = "newest"
+	MusicSortTitle      = "title"
+	MusicSortPrice      = "price"
+	MusicSortPopularity = "popularity"
+)
+
+// MusicFilter — параметры выборки каталога; пустые поля не ограничивают выборку
+type MusicFilter struct {
+	OwnerAddr    string
+	Artist       string
+	Genre        string
+	UploadedFrom *time.Time
+	UploadedTo   *time.Time
+	ForSale      *bool
+	ChainID      *int64
+	Sort         string
+	Cursor       string
+	Limit        int
+}
+
+// MusicPage — страница каталога; NextCursor пуст, если страница последняя
+type MusicPage struct {
+	Music      []Music
+	Total      int
+	NextCursor string
+}
+
+// Способ, которым найден результат поиска
+const (
+	SearchMatchFullText = "fulltext"
+	SearchMatchFuzzy    = "fuzzy"
+)
+
+// SearchResult — трек, найденный поиском, с оценкой релевантности и подсвеченными фрагментами.
+// Highlights — HTML: текст полей экранирован, совпадения обрамлены тегами <mark></mark>.
+type SearchResult struct {
+	Music      Music             `json:"music"`
+	Score      float64           `json:"score"`
+	MatchType  string            `json:"match_type"`
+	Highlights map[string]string `json:"highlights,omitempty"`
 }
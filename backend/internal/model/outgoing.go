@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+// Назначение транзакций, отправленных с ключей бэкенда
+const (
+	TxPurposePublish       = "publish"        // публикация загруженного трека
+	TxPurposeRelayPurchase = "relay_purchase" // покупка по намерению пользователя
+	TxPurposeRelayPublish  = "relay_publish"  // публикация по намерению пользователя
+	TxPurposeCancel        = "cancel"         // пустая транзакция, занимающая nonce отменяемой
+	TxPurposeNonceGap      = "nonce_gap"      // пустая транзакция на месте потерянной
+	TxPurposeDeploy        = "deploy"         // развёртывание контракта AudioChain
+	TxPurposeWithdrawFees  = "withdraw_fees"  // вывод комиссии платформы
+	TxPurposeOwnerPayout   = "owner_payout"   // пересылка владельцу трека доли продажи
+)
+
+// Состояния отправленной транзакции
+const (
+	OutgoingTxPending   = "pending"
+	OutgoingTxConfirmed = "confirmed"
+	OutgoingTxFailed    = "failed"   // включена в блок, но откатилась
+	OutgoingTxReplaced  = "replaced" // nonce занят другой транзакцией
+	OutgoingTxDropped   = "dropped"  // узлы отклонили транзакцию, nonce свободен
+)
+
+// OutgoingTransaction — транзакция, подписанная ключом бэкенда
+type OutgoingTransaction struct {
+	TxHash      string    `json:"tx_hash" db:"tx_hash"`
+	ChainID     uint64    `json:"chain_id" db:"chain_id"`
+	FromAddr    string    `json:"from_addr" db:"from_addr"`
+	Nonce       uint64    `json:"nonce" db:"nonce"`
+	ToAddr      string    `json:"to_addr" db:"to_addr"` // пусто — создание контракта
+	ValueWei    string    `json:"value_wei" db:"value_wei"`
+	GasLimit    uint64    `json:"gas_limit" db:"gas_limit"`
+	GasFeeCap   string    `json:"gas_fee_cap" db:"gas_fee_cap"` // gasPrice для legacy-транзакций
+	GasTipCap   *string   `json:"gas_tip_cap,omitempty" db:"gas_tip_cap"`
+	RawTx       string    `json:"-" db:"raw_tx"`
+	Purpose     string    `json:"purpose" db:"purpose"`
+	Replaces    *string   `json:"replaces,omitempty" db:"replaces"`
+	Status      string    `json:"status" db:"status"`
+	ReplacedBy  *string   `json:"replaced_by,omitempty" db:"replaced_by"`
+	BlockNumber *uint64   `json:"block_number,omitempty" db:"block_number"`
+	Error       string    `json:"error,omitempty" db:"error"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// OutgoingTxFilter — параметры выборки отправленных транзакций; пустые поля не ограничивают
+type OutgoingTxFilter struct {
+	ChainID  uint64
+	FromAddr string
+	Status   string
+	Limit    int
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// Состояния пересылки владельцу доли продажи трека, опубликованного бэкендом
+const (
+	OwnerPayoutPending   = "pending"   // ждёт отправки транзакции
+	OwnerPayoutSent      = "sent"      // транзакция отправлена
+	OwnerPayoutConfirmed = "confirmed" // перевод в блоке
+	OwnerPayoutFailed    = "failed"    // перевод отменён сетью, нужна ручная проверка
+)
+
+// OwnerPayout — пересылка владельцу трека доли продажи. Владельцем трека, опубликованного
+// бэкендом, в контракте записан ретранслятор, и purchaseAudio переводит долю продавца ему;
+// ретранслятор пересылает её на OwnerAddr трека на момент продажи.
+type OwnerPayout struct {
+	ID             int       `json:"id" db:"payout_id"`
+	ChainID        uint64    `json:"chain_id" db:"chain_id"`
+	PurchaseTxHash string    `json:"purchase_tx_hash" db:"purchase_tx_hash"`
+	PurchaseLog    uint      `json:"purchase_log_index" db:"purchase_log_index"`
+	MusicID        int       `json:"music_id" db:"music_id"`
+	RecipientAddr  string    `json:"recipient_addr" db:"recipient_addr"`
+	AmountWei      string    `json:"amount_wei" db:"amount_wei"`
+	Status         string    `json:"status" db:"status"`
+	TxHash         *string   `json:"tx_hash,omitempty" db:"tx_hash"`
+	Error          string    `json:"error,omitempty" db:"error"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
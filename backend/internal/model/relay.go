@@ -0,0 +1,102 @@
+package model
+
+import "time"
+
+// Типы намерений, которые ретранслятор исполняет за пользователя
+const (
+	RelayIntentPurchase = "purchase"
+	RelayIntentPublish  = "publish"
+)
+
+// Состояния намерения
+const (
+	RelayStatusPending   = "pending"   // принято, транзакция ещё не отправлена
+	RelayStatusSubmitted = "submitted" // транзакция отправлена и ждёт включения в блок
+	RelayStatusConfirmed = "confirmed"
+	RelayStatusFailed    = "failed"
+	RelayStatusExpired   = "expired" // срок подписи истёк до отправки
+)
+
+// RelayIntentMessage — поля подписанного EIP-712 намерения. Числа передаются
+// десятичными строками, deadline — unix-время в секундах.
+type RelayIntentMessage struct {
+	// PurchaseIntent
+	Buyer    string `json:"buyer,omitempty"`
+	AudioID  string `json:"audioId,omitempty"`
+	MaxPrice string `json:"maxPrice,omitempty"`
+
+	// PublishIntent
+	Owner  string `json:"owner,omitempty"`
+	CID    string `json:"cid,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Artist string `json:"artist,omitempty"`
+	Price  string `json:"price,omitempty"`
+
+	Nonce    string `json:"nonce"`
+	Deadline string `json:"deadline"`
+}
+
+// RelayIntentRequest — запрос на исполнение намерения
+type RelayIntentRequest struct {
+	Type      string             `json:"type"`
+	ChainID   uint64             `json:"chainId"`
+	Message   RelayIntentMessage `json:"message"`
+	Signature string             `json:"signature"`
+}
+
+// RelayIntent — принятое намерение и состояние его транзакции
+type RelayIntent struct {
+	ID         int       `json:"id" db:"intent_id"`
+	ChainID    uint64    `json:"chain_id" db:"chain_id"`
+	Type       string    `json:"type" db:"intent_type"`
+	SignerAddr string    `json:"signer_addr" db:"signer_addr"`
+	Nonce      string    `json:"nonce" db:"nonce"`
+	Deadline   time.Time `json:"deadline" db:"deadline"`
+	AudioID    *uint64   `json:"audio_id,omitempty" db:"audio_id"` // покупаемое или опубликованное аудио
+	MusicID    *int      `json:"music_id,omitempty" db:"music_id"` // публикуемый трек каталога
+	ValueWei   string    `json:"value_wei" db:"value_wei"`         // сумма, которую ретранслятор платит из депозита подписавшего
+	Message    string    `json:"message" db:"message"`             // подписанные поля как есть
+	Signature  string    `json:"signature" db:"signature"`
+
+	Status      string     `json:"status" db:"status"`
+	TxHash      *string    `json:"tx_hash,omitempty" db:"tx_hash"` // последняя отправленная транзакция
+	Attempts    int        `json:"attempts" db:"attempts"`
+	SubmittedAt *time.Time `json:"submitted_at,omitempty" db:"submitted_at"`
+	BlockNumber *uint64    `json:"block_number,omitempty" db:"block_number"`
+	Error       string     `json:"error,omitempty" db:"error"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// RelayLimits — ограничения на намерения одного адреса в сети
+type RelayLimits struct {
+	MaxActive  int // намерений в очереди или ждущих включения в блок
+	MaxPerHour int // намерений, принятых за последний час
+}
+
+// RelayPurchaseAccessBackend — покупка через ретранслятор даёт доступ только в бэкенде:
+// purchaseAudio отмечает доступ для msg.sender, то есть для ретранслятора, а вызова
+// с покупателем из подписанного намерения в контракте нет
+const RelayPurchaseAccessBackend = "backend"
+
+// RelayDeposit — перевод ETH на адрес ретранслятора, из которого оплачиваются покупки
+// DepositorAddr. Перевести депозит может любой аккаунт: если в данных перевода указан
+// адрес, депозит засчитывается ему, иначе — отправителю FunderAddr.
+type RelayDeposit struct {
+	ChainID       uint64 `json:"chain_id" db:"chain_id"`
+	TxHash        string `json:"tx_hash" db:"tx_hash"`
+	DepositorAddr string `json:"depositor_addr" db:"depositor_addr"`
+	FunderAddr    string `json:"funder_addr" db:"funder_addr"`
+	RelayerAddr   string `json:"relayer_addr" db:"relayer_addr"`
+	AmountWei     string `json:"amount_wei" db:"amount_wei"`
+	BlockNumber   uint64 `json:"block_number" db:"block_number"`
+}
+
+// RelayBalance — депозит адреса у ретранслятора
+type RelayBalance struct {
+	ChainID      uint64 `json:"chain_id"`
+	Address      string `json:"address"`
+	DepositedWei string `json:"deposited_wei"`
+	ReservedWei  string `json:"reserved_wei"` // цена принятых и исполненных покупок
+	AvailableWei string `json:"available_wei"`
+}
@@ -0,0 +1,58 @@
+package model
+
+import "time"
+
+// TotalBasisPoints — сумма долей распределения (100%)
+const TotalBasisPoints = 10000
+
+// Статусы распределения доходов
+const (
+	SplitPending    = "pending"    // ожидает подписей всех участников
+	SplitActive     = "active"     // действует для новых покупок
+	SplitSuperseded = "superseded" // заменено более новым распределением
+)
+
+// RoyaltySplit — распределение доходов от трека между участниками. Распределение
+// действует с момента, когда его подписал последний участник.
+type RoyaltySplit struct {
+	ID                int            `json:"id" db:"split_id"`
+	MusicID           int            `json:"music_id" db:"music_id"`
+	ProposerAddr      string         `json:"proposer_addr" db:"proposer_addr"`
+	Status            string         `json:"status" db:"status"`
+	ProposalMessage   string         `json:"proposal_message" db:"proposal_message"`
+	ProposalSignature string         `json:"proposal_signature" db:"proposal_signature"`
+	CreatedAt         time.Time      `json:"created_at" db:"created_at"`
+	ActivatedAt       *time.Time     `json:"activated_at,omitempty" db:"activated_at"`
+	Shares            []RoyaltyShare `json:"shares"`
+}
+
+// RoyaltyShare — доля участника в базисных пунктах (1/100 процента)
+type RoyaltyShare struct {
+	Address           string     `json:"address" db:"address"`
+	BPS               int        `json:"bps" db:"bps"`
+	Role              string     `json:"role" db:"role"` // producer, vocalist, label и т.п.
+	ApprovalMessage   string     `json:"approval_message,omitempty" db:"approval_message"`
+	ApprovalSignature string     `json:"approval_signature,omitempty" db:"approval_signature"`
+	ApprovedAt        *time.Time `json:"approved_at,omitempty" db:"approved_at"`
+}
+
+// RoyaltyPayout — причитающаяся участнику часть одной покупки. Если на момент покупки
+// распределения не было, вся выплата относится к продавцу (SplitID пуст).
+type RoyaltyPayout struct {
+	ChainID        uint64    `json:"chain_id"`
+	TxHash         string    `json:"tx_hash"`
+	LogIndex       uint      `json:"log_index"`
+	BlockNumber    uint64    `json:"block_number"`
+	BlockTime      time.Time `json:"block_time"`
+	MusicID        int       `json:"music_id"`
+	AudioID        uint64    `json:"audio_id"`
+	BuyerAddr      string    `json:"buyer_addr"`
+	AmountWei      string    `json:"amount_wei"`
+	PlatformFeeWei string    `json:"platform_fee_wei"`
+	NetWei         string    `json:"net_wei"`
+	SplitID        *int      `json:"split_id,omitempty"`
+	Payee          string    `json:"payee"`
+	Role           string    `json:"role"`
+	BPS            int       `json:"bps"`
+	ShareWei       string    `json:"share_wei"`
+}
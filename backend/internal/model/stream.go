@@ -0,0 +1,27 @@
+package model
+
+// Типы событий потока /events
+const (
+	StreamEventTransaction    = "transaction"
+	StreamEventAudioPublished = "audio_published"
+	StreamEventAudioPurchased = "audio_purchased"
+)
+
+// StreamEvent — событие потока. ID упорядочены по положению в цепочке, клиент
+// передаёт последний полученный ID в Last-Event-ID для продолжения после переподключения.
+type StreamEvent struct {
+	ID        string      `json:"id"` // уникален в пределах сети
+	ChainID   uint64      `json:"chain_id"`
+	Type      string      `json:"type"`
+	Addresses []string    `json:"-"` // участники события для сопоставления с подпиской
+	MusicID   *int        `json:"-"`
+	Data      interface{} `json:"data"`
+}
+
+// StreamFilter — подписка на события адреса или трека в одной сети. Подписка на трек
+// получает только события контракта, подписка на адрес — также его транзакции.
+type StreamFilter struct {
+	ChainID uint64
+	Address string
+	MusicID *int
+}
@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+// ERC20Token — метаданные токена, прочитанные из его контракта
+type ERC20Token struct {
+	ChainID  uint64 `json:"chain_id" db:"chain_id"`
+	Address  string `json:"address" db:"token_addr"`
+	Symbol   string `json:"symbol" db:"symbol"`
+	Name     string `json:"name" db:"name"`
+	Decimals uint8  `json:"decimals" db:"decimals"`
+}
+
+// TokenPrice — цена трека в ERC-20 токене. Покупатель переводит токены владельцу
+// трека напрямую, контракт AudioChain в покупке не участвует.
+type TokenPrice struct {
+	ChainID  uint64 `json:"chain_id"`
+	Token    string `json:"token"`
+	Symbol   string `json:"symbol"`
+	Decimals uint8  `json:"decimals"`
+	Amount   string `json:"amount"`  // в минимальных единицах токена
+	Display  string `json:"display"` // например "9.99 USDC"
+}
+
+// TokenTransfer — перевод ERC-20 владельцу трека с ценой в этом токене
+type TokenTransfer struct {
+	ChainID     uint64    `json:"chain_id" db:"chain_id"`
+	TxHash      string    `json:"tx_hash" db:"tx_hash"`
+	LogIndex    uint      `json:"log_index" db:"log_index"`
+	TokenAddr   string    `json:"token_addr" db:"token_addr"`
+	FromAddr    string    `json:"from_addr" db:"from_addr"`
+	ToAddr      string    `json:"to_addr" db:"to_addr"`
+	Amount      string    `json:"amount" db:"amount"`
+	BlockNumber uint64    `json:"block_number" db:"block_number"`
+	BlockTime   time.Time `json:"block_time" db:"block_time"`
+	MusicID     *int      `json:"music_id,omitempty" db:"music_id"` // купленный трек, если перевод засчитан
+}
+
+// Способы, которыми кошелёк получил доступ к треку
+const (
+	AccessViaOwner         = "owner"
+	AccessViaPurchase      = "purchase"       // purchaseAudio в контракте
+	AccessViaRelayPurchase = "relay_purchase" // покупка ретранслятором по намерению
+	AccessViaTokenPurchase = "token_purchase" // перевод ERC-20 владельцу
+)
+
+// MusicAccess — результат проверки доступа кошелька к треку
+type MusicAccess struct {
+	MusicID   int    `json:"music_id"`
+	Wallet    string `json:"wallet"`
+	HasAccess bool   `json:"has_access"`
+	Via       string `json:"via,omitempty"`
+	ChainID   uint64 `json:"chain_id,omitempty"`
+	TxHash    string `json:"tx_hash,omitempty"`
+}
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// Статусы передачи трека
+const (
+	TransferPending   = "pending"
+	TransferAccepted  = "accepted"
+	TransferCancelled = "cancelled"
+)
+
+// OwnershipTransfer — предложение передать трек другому кошельку. Передача
+// завершается, когда получатель подписывает согласие.
+type OwnershipTransfer struct {
+	ID              int        `json:"id" db:"transfer_id"`
+	MusicID         int        `json:"music_id" db:"music_id"`
+	FromAddr        string     `json:"from_addr" db:"from_addr"`
+	ToAddr          string     `json:"to_addr" db:"to_addr"`
+	Status          string     `json:"status" db:"status"`
+	OfferMessage    string     `json:"offer_message" db:"offer_message"`
+	OfferSignature  string     `json:"offer_signature" db:"offer_signature"`
+	AcceptMessage   string     `json:"accept_message,omitempty" db:"accept_message"`
+	AcceptSignature string     `json:"accept_signature,omitempty" db:"accept_signature"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt       time.Time  `json:"expires_at" db:"expires_at"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+}
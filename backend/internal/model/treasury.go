@@ -0,0 +1,85 @@
+package model
+
+import "time"
+
+// FeeWithdrawal — успешный вызов withdrawPlatformFees. Контракт переводит получателю
+// весь свой баланс, то есть комиссию, накопленную с предыдущего вывода. Если вызов
+// сделан не транзакцией в контракт, а из другого контракта (мультиподпись), он
+// не атрибутирован: известны блок и сумма, а транзакция, вызвавший и получатель пусты.
+type FeeWithdrawal struct {
+	ChainID       uint64    `json:"chain_id" db:"chain_id"`
+	Attributed    bool      `json:"attributed"`
+	TxHash        string    `json:"tx_hash,omitempty" db:"tx_hash"`
+	BlockNumber   uint64    `json:"block_number" db:"block_number"`
+	TxIndex       *uint     `json:"tx_index,omitempty" db:"tx_index"`
+	BlockTime     time.Time `json:"block_time" db:"block_time"`
+	CallerAddr    string    `json:"caller_addr,omitempty" db:"caller_addr"`
+	RecipientAddr string    `json:"recipient_addr,omitempty" db:"recipient_addr"`
+	AmountWei     string    `json:"amount_wei" db:"amount_wei"`
+}
+
+// TreasuryFilter — параметры отчёта о комиссии платформы
+type TreasuryFilter struct {
+	ChainID *uint64
+	GroupBy string // EarningsGroup*
+	From    *time.Time
+	To      *time.Time
+}
+
+// TreasuryTotals — комиссия сети за всё время по проиндексированным событиям
+type TreasuryTotals struct {
+	Purchases     int
+	AccruedFeeWei string
+	Withdrawals   int
+	WithdrawnWei  string
+}
+
+// TreasuryPeriod — начисленная и выведенная комиссия сети за период
+type TreasuryPeriod struct {
+	Period        time.Time `json:"period"`
+	ChainID       uint64    `json:"chain_id"`
+	Purchases     int       `json:"purchases"`
+	GrossWei      string    `json:"gross_wei"`
+	AccruedFeeWei string    `json:"accrued_fee_wei"`
+	Withdrawals   int       `json:"withdrawals"`
+	WithdrawnWei  string    `json:"withdrawn_wei"`
+}
+
+// TreasuryOpeningBalance — баланс контракта на конец блока, предшествующего первому
+// индексируемому
+type TreasuryOpeningBalance struct {
+	ChainID      uint64
+	ContractAddr string
+	BlockNumber  uint64
+	BalanceWei   string
+}
+
+// TreasuryReconciliation — сверка комиссии сети с балансом контракта на последнем
+// проиндексированном блоке. Ожидаемый баланс — начальный плюс начисленная комиссия
+// минус выведенная.
+type TreasuryReconciliation struct {
+	ChainID            uint64 `json:"chain_id"`
+	ContractAddr       string `json:"contract_addr"`
+	IndexedBlock       uint64 `json:"indexed_block"`
+	OpeningBlock       uint64 `json:"opening_block"`
+	OpeningBalanceWei  string `json:"opening_balance_wei"` // баланс до начала индексации
+	AccruedFeeWei      string `json:"accrued_fee_wei"`
+	WithdrawnWei       string `json:"withdrawn_wei"`
+	ExpectedBalanceWei string `json:"expected_balance_wei"`
+	ContractBalanceWei string `json:"contract_balance_wei,omitempty"`
+	DiscrepancyWei     string `json:"discrepancy_wei,omitempty"` // баланс контракта минус ожидаемый
+	Reconciled         bool   `json:"reconciled"`
+	Error              string `json:"error,omitempty"`
+}
+
+// TreasuryReport — отчёт о комиссии платформы: суммы по периодам, выводы и сверка
+type TreasuryReport struct {
+	GroupBy        string                   `json:"group_by"`
+	Periods        []TreasuryPeriod         `json:"periods"`
+	Withdrawals    []FeeWithdrawal          `json:"withdrawals"`
+	AccruedFeeWei  string                   `json:"accrued_fee_wei"`
+	WithdrawnWei   string                   `json:"withdrawn_wei"`
+	NetFeeWei      string                   `json:"net_fee_wei"` // начислено минус выведено за период отчёта
+	Reconciliation []TreasuryReconciliation `json:"reconciliation"`
+	Notes          []string                 `json:"notes"` // как получены выводы и что для этого нужно от узла
+}
@@ -0,0 +1,96 @@
+package relayer
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// Домен EIP-712 намерений. Контракт подписи не проверяет, но chainId и адрес
+// контракта в домене не дают повторить намерение в другой сети.
+const (
+	domainName    = "AudioChain"
+	domainVersion = "1"
+)
+
+// Основные типы подписываемых намерений
+const (
+	PurchaseIntentType = "PurchaseIntent"
+	PublishIntentType  = "PublishIntent"
+)
+
+// IntentTypes — типы EIP-712 для eth_signTypedData_v4
+var IntentTypes = apitypes.Types{
+	"EIP712Domain": {
+		{Name: "name", Type: "string"},
+		{Name: "version", Type: "string"},
+		{Name: "chainId", Type: "uint256"},
+		{Name: "verifyingContract", Type: "address"},
+	},
+	PurchaseIntentType: {
+		{Name: "buyer", Type: "address"},
+		{Name: "audioId", Type: "uint256"},
+		{Name: "maxPrice", Type: "uint256"},
+		{Name: "nonce", Type: "uint256"},
+		{Name: "deadline", Type: "uint256"},
+	},
+	PublishIntentType: {
+		{Name: "owner", Type: "address"},
+		{Name: "cid", Type: "string"},
+		{Name: "title", Type: "string"},
+		{Name: "artist", Type: "string"},
+		{Name: "price", Type: "uint256"},
+		{Name: "nonce", Type: "uint256"},
+		{Name: "deadline", Type: "uint256"},
+	},
+}
+
+// ErrInvalidSignature возвращается, если подпись намерения не разбирается
+var ErrInvalidSignature = errors.New("некорректная подпись намерения")
+
+// Domain возвращает домен EIP-712 контракта AudioChain сети chainID
+func Domain(chainID uint64, contractAddr common.Address) apitypes.TypedDataDomain {
+	return apitypes.TypedDataDomain{
+		Name:              domainName,
+		Version:           domainVersion,
+		ChainId:           (*math.HexOrDecimal256)(new(big.Int).SetUint64(chainID)),
+		VerifyingContract: contractAddr.Hex(),
+	}
+}
+
+// RecoverIntentSigner восстанавливает адрес, подписавший намерение primaryType
+// с полями message через eth_signTypedData_v4
+func RecoverIntentSigner(chainID uint64, contractAddr common.Address, primaryType string, message map[string]interface{}, signature string) (common.Address, error) {
+	if _, ok := IntentTypes[primaryType]; !ok {
+		return common.Address{}, fmt.Errorf("неизвестный тип намерения %s", primaryType)
+	}
+	hash, _, err := apitypes.TypedDataAndHash(apitypes.TypedData{
+		Types:       IntentTypes,
+		PrimaryType: primaryType,
+		Domain:      Domain(chainID, contractAddr),
+		Message:     message,
+	})
+	if err != nil {
+		return common.Address{}, fmt.Errorf("некорректные поля намерения: %w", err)
+	}
+
+	sig, err := hexutil.Decode(signature)
+	if err != nil || len(sig) != crypto.SignatureLength {
+		return common.Address{}, ErrInvalidSignature
+	}
+	// Кошельки возвращают v = 27/28, crypto ожидает 0/1
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return common.Address{}, ErrInvalidSignature
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
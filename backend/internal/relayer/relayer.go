@@ -0,0 +1,399 @@
+// Package relayer отправляет транзакции в контракт AudioChain от имени платформы:
+// бэкенд подписывает их ключом своего аккаунта через signer.Signer и сам оплачивает газ.
+package relayer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/chain"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/signer"
+	"github.com/polonkoevv/ethcourse/internal/storage/postgres"
+)
+
+const (
+	// Запас к оценке газа: состояние контракта может измениться до включения в блок
+	gasLimitMarginPercent = 20
+	// Повышение комиссии при замене транзакции; узлы принимают замену
+	// не дешевле чем на 10% дороже
+	feeBumpPercent = 125
+)
+
+var (
+	// ErrTransactionFailed возвращается, если транзакция включена в блок, но откатилась
+	ErrTransactionFailed = errors.New("транзакция отменена контрактом")
+	// ErrExecutionReverted возвращается, если вызов откатывается уже при оценке газа
+	ErrExecutionReverted = errors.New("вызов контракта будет отменён")
+	// ErrTransactionReplaced возвращается, если nonce транзакции занят отменой или
+	// транзакцией, отправленной не бэкендом
+	ErrTransactionReplaced = errors.New("транзакция заменена другой")
+	// ErrTransactionDropped возвращается, если узлы отклонили транзакцию и её замены
+	ErrTransactionDropped = errors.New("транзакция отклонена узлами")
+	// ErrUnknownTransaction возвращается для транзакции, отправленной не этим ключом
+	ErrUnknownTransaction = errors.New("транзакция не найдена среди отправленных")
+	// ErrNotPending возвращается при попытке заменить транзакцию, которая уже в блоке
+	ErrNotPending = errors.New("транзакция уже не ожидает включения в блок")
+)
+
+// Relayer — аккаунт платформы, с которого отправляются транзакции. Каждая транзакция
+// записывается в outgoing_transactions до рассылки, поэтому номера транзакций
+// и их судьба восстанавливаются после перезапуска.
+type Relayer struct {
+	signer  signer.Signer
+	address common.Address
+	pg      store
+
+	// MaxValue — наибольшая сумма в wei, которую ретранслятор отправляет за покупку по
+	// подписанному намерению из депозита пользователя; nil — такие покупки не принимаются
+	MaxValue *big.Int
+
+	// Номера назначаются по одной транзакции: mu удерживается от выбора nonce
+	// до записи и рассылки транзакции. Между процессами с общей базой номера
+	// согласуются блокировкой postgres.NonceLock.
+	mu sync.Mutex
+}
+
+// store — журнал отправленных транзакций outgoing_transactions; в работе это
+// *postgres.Postgres через pgStore
+type store interface {
+	LockOutgoingNonce(ctx context.Context, chainID uint64, from string) (nonceLock, error)
+	SaveOutgoingTransaction(ctx context.Context, tx model.OutgoingTransaction) error
+	GetOutgoingTransaction(ctx context.Context, hash string) (*model.OutgoingTransaction, error)
+	GetOutgoingNonceGroup(ctx context.Context, chainID uint64, from string, nonce uint64) ([]model.OutgoingTransaction, error)
+	GetPendingOutgoingTransactions(ctx context.Context, chainID uint64, from string) ([]model.OutgoingTransaction, error)
+	ResolveOutgoingNonce(ctx context.Context, chainID uint64, from string, nonce uint64, minedHash, status string, blockNumber uint64) error
+	FinishOutgoingNonce(ctx context.Context, chainID uint64, from string, nonce uint64, status, reason string) error
+	DropOutgoingTransaction(ctx context.Context, hash, reason string) error
+}
+
+// nonceLock — блокировка выдачи nonce, см. postgres.NonceLock
+type nonceLock interface {
+	NextNonce(ctx context.Context) (uint64, bool, error)
+	Save(ctx context.Context, tx model.OutgoingTransaction) error
+	Release(ctx context.Context)
+}
+
+// pgStore возвращает блокировку *postgres.NonceLock как nonceLock
+type pgStore struct {
+	*postgres.Postgres
+}
+
+func (s pgStore) LockOutgoingNonce(ctx context.Context, chainID uint64, from string) (nonceLock, error) {
+	lock, err := s.Postgres.LockOutgoingNonce(ctx, chainID, from)
+	if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// New создаёт ретранслятор, подписывающий транзакции подписантом s
+func New(s signer.Signer, pg *postgres.Postgres) *Relayer {
+	return &Relayer{signer: s, address: s.Address(), pg: pgStore{pg}}
+}
+
+// Address возвращает адрес аккаунта ретранслятора
+func (r *Relayer) Address() common.Address {
+	return r.address
+}
+
+// Send подписывает и отправляет вызов контракта to с данными data; purpose — назначение
+// транзакции из model.TxPurpose*. В сетях с EIP-1559 отправляется транзакция типа 2,
+// иначе — legacy с ценой газа узла.
+func (r *Relayer) Send(ctx context.Context, c *chain.Chain, to common.Address, value *big.Int, data []byte, purpose string) (*types.Transaction, error) {
+	return r.send(ctx, c, &to, value, data, purpose)
+}
+
+// Deploy отправляет транзакцию создания контракта с кодом code (байткод и аргументы
+// конструктора); адрес контракта будет в квитанции
+func (r *Relayer) Deploy(ctx context.Context, c *chain.Chain, code []byte) (*types.Transaction, error) {
+	return r.send(ctx, c, nil, nil, code, model.TxPurposeDeploy)
+}
+
+// send отправляет транзакцию на адрес to; nil — создание контракта
+func (r *Relayer) send(ctx context.Context, c *chain.Chain, to *common.Address, value *big.Int, data []byte, purpose string) (*types.Transaction, error) {
+	if value == nil {
+		value = new(big.Int)
+	}
+
+	gas, err := c.Client.EstimateGas(ctx, ethereum.CallMsg{From: r.address, To: to, Value: value, Data: data})
+	if err != nil {
+		var rpcErr rpc.Error
+		if errors.As(err, &rpcErr) {
+			return nil, fmt.Errorf("%w: %v", ErrExecutionReverted, err)
+		}
+		return nil, fmt.Errorf("ошибка оценки газа: %w", err)
+	}
+	gas += gas * gasLimitMarginPercent / 100
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lock, err := r.pg.LockOutgoingNonce(ctx, c.ID, r.address.Hex())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка блокировки выдачи nonce: %w", err)
+	}
+	defer lock.Release(context.Background())
+
+	nonce, err := r.nextNonce(ctx, c, lock)
+	if err != nil {
+		return nil, err
+	}
+	fees, err := suggestFees(ctx, c.Client)
+	if err != nil {
+		return nil, err
+	}
+	return r.submitLocked(ctx, c, fees.txData(c.ID, nonce, gas, to, value, data), purpose, nil, lock)
+}
+
+// SpeedUp заменяет неподтверждённую транзакцию такой же с тем же nonce и комиссией
+// не ниже текущей рекомендуемой и на четверть выше последней замены
+func (r *Relayer) SpeedUp(ctx context.Context, c *chain.Chain, hash common.Hash) (*types.Transaction, error) {
+	return r.replace(ctx, c, hash, false)
+}
+
+// Cancel занимает nonce неподтверждённой транзакции пустым переводом самому себе
+// с повышенной комиссией
+func (r *Relayer) Cancel(ctx context.Context, c *chain.Chain, hash common.Hash) (*types.Transaction, error) {
+	return r.replace(ctx, c, hash, true)
+}
+
+func (r *Relayer) replace(ctx context.Context, c *chain.Chain, hash common.Hash, cancel bool) (*types.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tracked, err := r.pg.GetOutgoingTransaction(ctx, hash.Hex())
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && (tracked.ChainID != c.ID || !strings.EqualFold(tracked.FromAddr, r.address.Hex()))) {
+		return nil, ErrUnknownTransaction
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tracked.Status != model.OutgoingTxPending {
+		return nil, ErrNotPending
+	}
+
+	// Комиссия поднимается относительно последней замены: узлы сравнивают с ней
+	group, err := r.pg.GetOutgoingNonceGroup(ctx, c.ID, r.address.Hex(), tracked.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	latest := latestPending(tracked, group)
+	prev, err := decodeRawTx(latest.RawTx)
+	if err != nil {
+		return nil, err
+	}
+	fees, err := bumpedFees(ctx, c.Client, prev)
+	if err != nil {
+		return nil, err
+	}
+
+	purpose := tracked.Purpose
+	to, value, gas, data := prev.To(), prev.Value(), prev.Gas(), prev.Data()
+	if cancel {
+		purpose, to, value, gas, data = model.TxPurposeCancel, &r.address, new(big.Int), params.TxGas, nil
+	}
+	return r.submit(ctx, c, fees.txData(c.ID, prev.Nonce(), gas, to, value, data), purpose, &latest.TxHash)
+}
+
+// nextNonce выбирает номер следующей транзакции: больший из номера, ожидаемого узлом,
+// и следующего за неподтверждёнными транзакциями в базе. Второй учитывает транзакции,
+// которых ещё нет в пуле узла, например после перезапуска узла или отправленные другим
+// процессом. Вызывается под mu и блокировкой lock.
+func (r *Relayer) nextNonce(ctx context.Context, c *chain.Chain, lock nonceLock) (uint64, error) {
+	nonce, err := c.Client.PendingNonceAt(ctx, r.address)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения nonce: %w", err)
+	}
+	tracked, ok, err := lock.NextNonce(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return selectNonce(nonce, tracked, ok), nil
+}
+
+// selectNonce возвращает больший из номера node, ожидаемого узлом, и номера tracked,
+// следующего за записанными транзакциями; ok — есть ли такие записи
+func selectNonce(node, tracked uint64, ok bool) uint64 {
+	if ok && tracked > node {
+		return tracked
+	}
+	return node
+}
+
+// latestPending возвращает последнюю по времени отправки неподтверждённую транзакцию
+// группы с nonce транзакции tracked или саму tracked, если таких нет
+func latestPending(tracked *model.OutgoingTransaction, group []model.OutgoingTransaction) *model.OutgoingTransaction {
+	latest := tracked
+	for i := range group {
+		if group[i].Status == model.OutgoingTxPending {
+			latest = &group[i]
+		}
+	}
+	return latest
+}
+
+// submit подписывает транзакцию, записывает её и рассылает узлам. Если узел отклонил
+// транзакцию, она отмечается отклонённой; если узлы недоступны, она остаётся
+// неподтверждённой и будет разослана повторно при отслеживании.
+func (r *Relayer) submit(ctx context.Context, c *chain.Chain, txData types.TxData, purpose string, replaces *string) (*types.Transaction, error) {
+	return r.submitLocked(ctx, c, txData, purpose, replaces, nil)
+}
+
+// submitLocked — submit для транзакции с новым nonce: запись снимает блокировку lock,
+// под которой nonce выбран. Без lock транзакция записывается отдельно.
+func (r *Relayer) submitLocked(ctx context.Context, c *chain.Chain, txData types.TxData, purpose string, replaces *string, lock nonceLock) (*types.Transaction, error) {
+	tx, err := r.signer.SignTx(ctx, types.NewTx(txData), new(big.Int).SetUint64(c.ID))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подписи транзакции: %w", err)
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	record := model.OutgoingTransaction{
+		TxHash:    tx.Hash().Hex(),
+		ChainID:   c.ID,
+		FromAddr:  r.address.Hex(),
+		Nonce:     tx.Nonce(),
+		ValueWei:  tx.Value().String(),
+		GasLimit:  tx.Gas(),
+		GasFeeCap: tx.GasFeeCap().String(),
+		RawTx:     hexutil.Encode(raw),
+		Purpose:   purpose,
+		Replaces:  replaces,
+	}
+	if to := tx.To(); to != nil {
+		record.ToAddr = to.Hex()
+	}
+	if tx.Type() != types.LegacyTxType {
+		tip := tx.GasTipCap().String()
+		record.GasTipCap = &tip
+	}
+	save := r.pg.SaveOutgoingTransaction
+	if lock != nil {
+		save = lock.Save
+	}
+	if err := save(ctx, record); err != nil {
+		return nil, fmt.Errorf("ошибка сохранения транзакции: %w", err)
+	}
+
+	if err := c.Client.SendTransaction(ctx, tx); err != nil {
+		var rpcErr rpc.Error
+		if !errors.As(err, &rpcErr) {
+			fmt.Printf("Сеть %d: транзакция %s сохранена, но не разослана: %v\n", c.ID, record.TxHash, err)
+			return tx, nil
+		}
+		if dropErr := r.pg.DropOutgoingTransaction(context.Background(), record.TxHash, err.Error()); dropErr != nil {
+			fmt.Printf("Ошибка сохранения состояния транзакции %s: %v\n", record.TxHash, dropErr)
+		}
+		return nil, fmt.Errorf("ошибка отправки транзакции: %w", err)
+	}
+	return tx, nil
+}
+
+func decodeRawTx(raw string) (*types.Transaction, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(common.FromHex(raw)); err != nil {
+		return nil, fmt.Errorf("ошибка разбора сохранённой транзакции: %w", err)
+	}
+	return tx, nil
+}
+
+// gasFees — комиссия транзакции: gasPrice для сетей без EIP-1559, иначе tip и feeCap
+type gasFees struct {
+	gasPrice    *big.Int
+	tip, feeCap *big.Int
+}
+
+// suggestFees запрашивает комиссию у узла. Максимальная комиссия — удвоенная базовая
+// плюс чаевые: так транзакция выдерживает несколько полных блоков подряд.
+func suggestFees(ctx context.Context, client *chain.Client) (gasFees, error) {
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return gasFees{}, fmt.Errorf("ошибка получения последнего блока: %w", err)
+	}
+	if head.BaseFee == nil {
+		price, err := client.SuggestGasPrice(ctx)
+		if err != nil {
+			return gasFees{}, fmt.Errorf("ошибка получения цены газа: %w", err)
+		}
+		return gasFees{gasPrice: price}, nil
+	}
+
+	tip, err := client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return gasFees{}, fmt.Errorf("ошибка получения чаевых: %w", err)
+	}
+	feeCap := new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), tip)
+	return gasFees{tip: tip, feeCap: feeCap}, nil
+}
+
+// bumpedFees возвращает комиссию замены prev: не ниже рекомендуемой и на
+// feeBumpPercent выше прежней
+func bumpedFees(ctx context.Context, client *chain.Client, prev *types.Transaction) (gasFees, error) {
+	fees, err := suggestFees(ctx, client)
+	if err != nil {
+		return gasFees{}, err
+	}
+	return fees.bumped(prev), nil
+}
+
+// bumped возвращает комиссию замены prev при рекомендуемой комиссии f
+func (f gasFees) bumped(prev *types.Transaction) gasFees {
+	fees := f
+	switch {
+	case fees.gasPrice != nil:
+		return gasFees{gasPrice: maxBig(fees.gasPrice, bump(prev.GasPrice()))}
+	case prev.Type() == types.LegacyTxType:
+		// Замена legacy-транзакции остаётся legacy; её цена ограничивает и чаевые,
+		// и полную комиссию, поэтому она не ниже рекомендуемой feeCap
+		return gasFees{gasPrice: maxBig(fees.feeCap, bump(prev.GasPrice()))}
+	}
+	fees.tip = maxBig(fees.tip, bump(prev.GasTipCap()))
+	fees.feeCap = maxBig(fees.feeCap, bump(prev.GasFeeCap()))
+	if fees.feeCap.Cmp(fees.tip) < 0 {
+		fees.feeCap = fees.tip
+	}
+	return fees
+}
+
+func (f gasFees) txData(chainID, nonce, gas uint64, to *common.Address, value *big.Int, data []byte) types.TxData {
+	if f.gasPrice != nil {
+		return &types.LegacyTx{Nonce: nonce, GasPrice: f.gasPrice, Gas: gas, To: to, Value: value, Data: data}
+	}
+	return &types.DynamicFeeTx{
+		ChainID:   new(big.Int).SetUint64(chainID),
+		Nonce:     nonce,
+		GasTipCap: f.tip,
+		GasFeeCap: f.feeCap,
+		Gas:       gas,
+		To:        to,
+		Value:     value,
+		Data:      data,
+	}
+}
+
+func bump(v *big.Int) *big.Int {
+	b := new(big.Int).Mul(v, big.NewInt(feeBumpPercent))
+	return b.Quo(b, big.NewInt(100))
+}
+
+func maxBig(a, b *big.Int) *big.Int {
+	if a == nil || a.Cmp(b) < 0 {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,453 @@
+package relayer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/chain"
+	"github.com/polonkoevv/ethcourse/internal/chain/chaintest"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/signer"
+)
+
+// memStore — журнал отправленных транзакций в памяти с теми же переходами
+// состояний, что и outgoing_transactions в postgres
+type memStore struct {
+	mu  sync.Mutex
+	txs []model.OutgoingTransaction // в порядке записи
+}
+
+type memLock struct {
+	s       *memStore
+	chainID uint64
+	from    string
+}
+
+func (s *memStore) LockOutgoingNonce(_ context.Context, chainID uint64, from string) (nonceLock, error) {
+	return &memLock{s: s, chainID: chainID, from: from}, nil
+}
+
+func (l *memLock) NextNonce(ctx context.Context) (uint64, bool, error) {
+	pending, _ := l.s.GetPendingOutgoingTransactions(ctx, l.chainID, l.from)
+	if len(pending) == 0 {
+		return 0, false, nil
+	}
+	return pending[len(pending)-1].Nonce + 1, true, nil
+}
+
+func (l *memLock) Save(ctx context.Context, tx model.OutgoingTransaction) error {
+	return l.s.SaveOutgoingTransaction(ctx, tx)
+}
+
+func (l *memLock) Release(context.Context) {}
+
+func (s *memStore) SaveOutgoingTransaction(_ context.Context, tx model.OutgoingTransaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx.Status = model.OutgoingTxPending
+	s.txs = append(s.txs, tx)
+	return nil
+}
+
+func (s *memStore) GetOutgoingTransaction(_ context.Context, hash string) (*model.OutgoingTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tx := range s.txs {
+		if strings.EqualFold(tx.TxHash, hash) {
+			return &tx, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+// update применяет f к транзакциям адреса from с данным nonce
+func (s *memStore) update(chainID uint64, from string, nonce uint64, f func(tx *model.OutgoingTransaction)) {
+	for i := range s.txs {
+		if tx := &s.txs[i]; tx.ChainID == chainID && strings.EqualFold(tx.FromAddr, from) && tx.Nonce == nonce {
+			f(tx)
+		}
+	}
+}
+
+func (s *memStore) GetOutgoingNonceGroup(_ context.Context, chainID uint64, from string, nonce uint64) ([]model.OutgoingTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var group []model.OutgoingTransaction
+	s.update(chainID, from, nonce, func(tx *model.OutgoingTransaction) { group = append(group, *tx) })
+	return group, nil
+}
+
+func (s *memStore) GetPendingOutgoingTransactions(_ context.Context, chainID uint64, from string) ([]model.OutgoingTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pending []model.OutgoingTransaction
+	for _, tx := range s.txs {
+		if tx.ChainID == chainID && strings.EqualFold(tx.FromAddr, from) && tx.Status == model.OutgoingTxPending {
+			pending = append(pending, tx)
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].Nonce < pending[j].Nonce })
+	return pending, nil
+}
+
+func (s *memStore) ResolveOutgoingNonce(_ context.Context, chainID uint64, from string, nonce uint64, minedHash, status string, blockNumber uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.update(chainID, from, nonce, func(tx *model.OutgoingTransaction) {
+		switch {
+		case strings.EqualFold(tx.TxHash, minedHash):
+			tx.Status, tx.BlockNumber = status, &blockNumber
+		case tx.Status == model.OutgoingTxPending:
+			tx.Status, tx.ReplacedBy = model.OutgoingTxReplaced, &minedHash
+		}
+	})
+	return nil
+}
+
+func (s *memStore) FinishOutgoingNonce(_ context.Context, chainID uint64, from string, nonce uint64, status, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.update(chainID, from, nonce, func(tx *model.OutgoingTransaction) {
+		if tx.Status == model.OutgoingTxPending {
+			tx.Status, tx.Error = status, reason
+		}
+	})
+	return nil
+}
+
+func (s *memStore) DropOutgoingTransaction(_ context.Context, hash, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.txs {
+		if strings.EqualFold(s.txs[i].TxHash, hash) {
+			s.txs[i].Status, s.txs[i].Error = model.OutgoingTxDropped, reason
+		}
+	}
+	return nil
+}
+
+// status возвращает состояние записанной транзакции
+func (s *memStore) status(t *testing.T, hash common.Hash) model.OutgoingTransaction {
+	t.Helper()
+	tx, err := s.GetOutgoingTransaction(context.Background(), hash.Hex())
+	if err != nil {
+		t.Fatalf("транзакция %s не записана", hash.Hex())
+	}
+	return *tx
+}
+
+var testContract = common.HexToAddress("0x000000000000000000000000000000000000a0d1")
+
+// newTestRelayer создаёт ретранслятор с журналом в памяти, подключённый к тестовому узлу
+func newTestRelayer(t *testing.T) (*Relayer, *memStore, *chaintest.Node, *chain.Chain) {
+	t.Helper()
+	key, err := signer.NewKey("59c6995e998f97a5a0044966f0945389dc9e86dae88c7a8412f4603b6b78690d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := chaintest.New(t, 1337)
+	node.AddBlock(1, 1_700_000_012)
+	s := &memStore{}
+	return &Relayer{signer: key, address: key.Address(), pg: s}, s, node, node.Chain(t, testContract)
+}
+
+func TestReplace(t *testing.T) {
+	tests := []struct {
+		name    string
+		cancel  bool
+		purpose string
+	}{
+		{"ускорение", false, model.TxPurposePublish},
+		{"отмена", true, model.TxPurposeCancel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			r, s, node, c := newTestRelayer(t)
+			replace := r.SpeedUp
+			if tt.cancel {
+				replace = r.Cancel
+			}
+
+			orig, err := r.Send(ctx, c, testContract, nil, []byte{0x01, 0x02}, model.TxPurposePublish)
+			if err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			first, err := replace(ctx, c, orig.Hash())
+			if err != nil {
+				t.Fatalf("замена error = %v", err)
+			}
+			// повторная замена по исходному хешу поднимает комиссию относительно последней
+			second, err := replace(ctx, c, orig.Hash())
+			if err != nil {
+				t.Fatalf("вторая замена error = %v", err)
+			}
+
+			sent := node.Sent()
+			if len(sent) != 3 || sent[1].Hash() != first.Hash() || sent[2].Hash() != second.Hash() {
+				t.Fatalf("разослано %d транзакций, want исходную и две замены", len(sent))
+			}
+			prev := orig
+			for _, tx := range []*types.Transaction{first, second} {
+				if tx.Nonce() != orig.Nonce() {
+					t.Errorf("nonce замены = %d, want %d", tx.Nonce(), orig.Nonce())
+				}
+				if tx.GasTipCap().Cmp(bump(prev.GasTipCap())) < 0 || tx.GasFeeCap().Cmp(bump(prev.GasFeeCap())) < 0 {
+					t.Errorf("комиссия замены %v/%v не выше прежней %v/%v на %d%%",
+						tx.GasTipCap(), tx.GasFeeCap(), prev.GasTipCap(), prev.GasFeeCap(), feeBumpPercent-100)
+				}
+				wantTo, wantGas, wantData := testContract, orig.Gas(), orig.Data()
+				if tt.cancel {
+					wantTo, wantGas, wantData = r.Address(), params.TxGas, nil
+				}
+				if *tx.To() != wantTo || tx.Gas() != wantGas || !bytes.Equal(tx.Data(), wantData) {
+					t.Errorf("замена: to %s, газ %d, данные %x; want %s, %d, %x", tx.To().Hex(), tx.Gas(), tx.Data(), wantTo.Hex(), wantGas, wantData)
+				}
+				record := s.status(t, tx.Hash())
+				if record.Purpose != tt.purpose || record.Replaces == nil || *record.Replaces != prev.Hash().Hex() {
+					t.Errorf("запись замены: назначение %s, заменяет %v; want %s, %s", record.Purpose, record.Replaces, tt.purpose, prev.Hash().Hex())
+				}
+				prev = tx
+			}
+
+			// в блок попала первая замена: остальные отмечаются заменёнными, повторная замена невозможна
+			node.Include(2, first, types.ReceiptStatusSuccessful)
+			if err := r.trackChain(ctx, c); err != nil {
+				t.Fatalf("trackChain() error = %v", err)
+			}
+			if got := s.status(t, first.Hash()).Status; got != model.OutgoingTxConfirmed {
+				t.Errorf("состояние включённой замены = %s, want %s", got, model.OutgoingTxConfirmed)
+			}
+			for _, tx := range []*types.Transaction{orig, second} {
+				if got := s.status(t, tx.Hash()); got.Status != model.OutgoingTxReplaced || got.ReplacedBy == nil || *got.ReplacedBy != first.Hash().Hex() {
+					t.Errorf("состояние %s = %s, want %s заменой %s", tx.Hash().Hex(), got.Status, model.OutgoingTxReplaced, first.Hash().Hex())
+				}
+			}
+			if _, err := replace(ctx, c, orig.Hash()); !errors.Is(err, ErrNotPending) {
+				t.Errorf("замена после включения error = %v, want %v", err, ErrNotPending)
+			}
+
+			receipt, err := r.Receipt(ctx, c, orig.Hash())
+			if tt.cancel {
+				if !errors.Is(err, ErrTransactionReplaced) {
+					t.Errorf("Receipt() отменённой error = %v, want %v", err, ErrTransactionReplaced)
+				}
+			} else if err != nil || receipt.TxHash != first.Hash() {
+				t.Errorf("Receipt() ускоренной = %v, %v; want квитанцию замены %s", receipt, err, first.Hash().Hex())
+			}
+		})
+	}
+}
+
+func TestReplaceUnknown(t *testing.T) {
+	r, _, _, c := newTestRelayer(t)
+	if _, err := r.SpeedUp(context.Background(), c, common.HexToHash("0x01")); !errors.Is(err, ErrUnknownTransaction) {
+		t.Errorf("SpeedUp() error = %v, want %v", err, ErrUnknownTransaction)
+	}
+}
+
+func TestSelectNonce(t *testing.T) {
+	tests := []struct {
+		name    string
+		node    uint64
+		tracked uint64
+		ok      bool
+		want    uint64
+	}{
+		{"нет записанных транзакций", 5, 0, false, 5},
+		{"узел знает все транзакции", 5, 5, true, 5},
+		{"узел потерял транзакции из пула", 5, 8, true, 8},
+		{"транзакции отправлены не бэкендом", 9, 8, true, 9},
+		{"первая транзакция ключа", 0, 0, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectNonce(tt.node, tt.tracked, tt.ok); got != tt.want {
+				t.Errorf("selectNonce(%d, %d, %v) = %d, want %d", tt.node, tt.tracked, tt.ok, got, tt.want)
+			}
+		})
+	}
+}
+
+func outgoing(hash string, nonce uint64, status string) model.OutgoingTransaction {
+	return model.OutgoingTransaction{TxHash: hash, Nonce: nonce, Status: status}
+}
+
+func TestGroupByNonce(t *testing.T) {
+	tests := []struct {
+		name string
+		txs  []model.OutgoingTransaction
+		want [][]string
+	}{
+		{"пусто", nil, nil},
+		{
+			name: "без замен",
+			txs: []model.OutgoingTransaction{
+				outgoing("0x01", 1, model.OutgoingTxPending),
+				outgoing("0x02", 2, model.OutgoingTxPending),
+			},
+			want: [][]string{{"0x01"}, {"0x02"}},
+		},
+		{
+			name: "замены в своей группе",
+			txs: []model.OutgoingTransaction{
+				outgoing("0x01", 1, model.OutgoingTxPending),
+				outgoing("0x02", 1, model.OutgoingTxPending),
+				outgoing("0x03", 2, model.OutgoingTxPending),
+				outgoing("0x04", 3, model.OutgoingTxPending),
+				outgoing("0x05", 3, model.OutgoingTxPending),
+				outgoing("0x06", 3, model.OutgoingTxPending),
+			},
+			want: [][]string{{"0x01", "0x02"}, {"0x03"}, {"0x04", "0x05", "0x06"}},
+		},
+		{
+			name: "пропуск номера",
+			txs: []model.OutgoingTransaction{
+				outgoing("0x01", 4, model.OutgoingTxPending),
+				outgoing("0x02", 7, model.OutgoingTxPending),
+			},
+			want: [][]string{{"0x01"}, {"0x02"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]string
+			for _, group := range groupByNonce(tt.txs) {
+				var hashes []string
+				for _, tx := range group {
+					hashes = append(hashes, tx.TxHash)
+				}
+				got = append(got, hashes)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupByNonce() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatestPending(t *testing.T) {
+	tracked := outgoing("0x01", 3, model.OutgoingTxPending)
+
+	tests := []struct {
+		name  string
+		group []model.OutgoingTransaction
+		want  string
+	}{
+		{"группа не загружена", nil, "0x01"},
+		{"без замен", []model.OutgoingTransaction{tracked}, "0x01"},
+		{
+			name: "последняя замена",
+			group: []model.OutgoingTransaction{
+				tracked,
+				outgoing("0x02", 3, model.OutgoingTxPending),
+				outgoing("0x03", 3, model.OutgoingTxPending),
+			},
+			want: "0x03",
+		},
+		{
+			name: "отклонённая замена пропускается",
+			group: []model.OutgoingTransaction{
+				tracked,
+				outgoing("0x02", 3, model.OutgoingTxPending),
+				outgoing("0x03", 3, model.OutgoingTxDropped),
+			},
+			want: "0x02",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := latestPending(&tracked, tt.group); got.TxHash != tt.want {
+				t.Errorf("latestPending() = %s, want %s", got.TxHash, tt.want)
+			}
+		})
+	}
+}
+
+func TestBumpedFees(t *testing.T) {
+	gwei := func(n int64) *big.Int { return new(big.Int).Mul(big.NewInt(n), big.NewInt(1_000_000_000)) }
+	legacy := types.NewTx(&types.LegacyTx{GasPrice: gwei(20)})
+	dynamic := types.NewTx(&types.DynamicFeeTx{GasTipCap: gwei(2), GasFeeCap: gwei(40)})
+
+	tests := []struct {
+		name      string
+		suggested gasFees
+		prev      *types.Transaction
+		want      gasFees
+	}{
+		{
+			name:      "legacy: рекомендуемая цена ниже",
+			suggested: gasFees{gasPrice: gwei(10)},
+			prev:      legacy,
+			want:      gasFees{gasPrice: gwei(25)},
+		},
+		{
+			name:      "legacy: рекомендуемая цена выше",
+			suggested: gasFees{gasPrice: gwei(30)},
+			prev:      legacy,
+			want:      gasFees{gasPrice: gwei(30)},
+		},
+		{
+			name:      "EIP-1559: повышение обеих частей",
+			suggested: gasFees{tip: gwei(1), feeCap: gwei(30)},
+			prev:      dynamic,
+			want:      gasFees{tip: big.NewInt(2_500_000_000), feeCap: gwei(50)},
+		},
+		{
+			name:      "EIP-1559: рекомендуемые чаевые выше",
+			suggested: gasFees{tip: gwei(5), feeCap: gwei(60)},
+			prev:      dynamic,
+			want:      gasFees{tip: gwei(5), feeCap: gwei(60)},
+		},
+		{
+			name:      "EIP-1559: максимальная комиссия не ниже чаевых",
+			suggested: gasFees{tip: gwei(100), feeCap: gwei(45)},
+			prev:      dynamic,
+			want:      gasFees{tip: gwei(100), feeCap: gwei(100)},
+		},
+		{
+			name:      "legacy-транзакция в сети с EIP-1559",
+			suggested: gasFees{tip: gwei(1), feeCap: gwei(21)},
+			prev:      legacy,
+			want:      gasFees{gasPrice: gwei(25)},
+		},
+		{
+			name:      "legacy-транзакция в сети с EIP-1559: рекомендуемая комиссия выше",
+			suggested: gasFees{tip: gwei(1), feeCap: gwei(60)},
+			prev:      legacy,
+			want:      gasFees{gasPrice: gwei(60)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.suggested.bumped(tt.prev)
+			if !equalBig(got.gasPrice, tt.want.gasPrice) || !equalBig(got.tip, tt.want.tip) || !equalBig(got.feeCap, tt.want.feeCap) {
+				t.Errorf("bumped() = {gasPrice: %v, tip: %v, feeCap: %v}, want {gasPrice: %v, tip: %v, feeCap: %v}",
+					got.gasPrice, got.tip, got.feeCap, tt.want.gasPrice, tt.want.tip, tt.want.feeCap)
+			}
+		})
+	}
+}
+
+func equalBig(a, b *big.Int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Cmp(b) == 0
+}
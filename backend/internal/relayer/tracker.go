@@ -0,0 +1,236 @@
+package relayer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/chain"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+const (
+	// Интервал опроса квитанции отправленной транзакции
+	receiptPollInterval = 2 * time.Second
+	// Пауза между проверками неподтверждённых транзакций
+	trackInterval = 10 * time.Second
+)
+
+// Track следит за неподтверждёнными транзакциями ключа в сетях chains до отмены
+// контекста: отмечает попавшие в блок и заменённые, повторно рассылает пропавшие
+// из пула узла и занимает пустой транзакцией nonce отклонённой, чтобы следующие
+// за ней не зависли
+func (r *Relayer) Track(ctx context.Context, chains []*chain.Chain) {
+	ticker := time.NewTicker(trackInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, c := range chains {
+			if err := r.trackChain(ctx, c); err != nil {
+				fmt.Printf("Сеть %d: ошибка отслеживания транзакций %s: %v\n", c.ID, r.address.Hex(), err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Relayer) trackChain(ctx context.Context, c *chain.Chain) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pending, err := r.pg.GetPendingOutgoingTransactions(ctx, c.ID, r.address.Hex())
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+	// Номер запрашивается до квитанций: транзакция, попавшая в блок между запросами,
+	// найдётся по квитанции, а не будет принята за заменённую
+	confirmed, err := c.Client.NonceAt(ctx, r.address, nil)
+	if err != nil {
+		return err
+	}
+
+	groups := groupByNonce(pending)
+	for i, group := range groups {
+		nonce := group[0].Nonce
+		receipt, err := findReceipt(ctx, c.Client, group)
+		if err != nil {
+			return err
+		}
+		if receipt != nil {
+			status := model.OutgoingTxConfirmed
+			if receipt.Status != types.ReceiptStatusSuccessful {
+				status = model.OutgoingTxFailed
+			}
+			if err := r.pg.ResolveOutgoingNonce(ctx, c.ID, r.address.Hex(), nonce, receipt.TxHash.Hex(), status, receipt.BlockNumber.Uint64()); err != nil {
+				return err
+			}
+			continue
+		}
+		if nonce < confirmed {
+			if err := r.pg.FinishOutgoingNonce(ctx, c.ID, r.address.Hex(), nonce, model.OutgoingTxReplaced,
+				"nonce занят транзакцией, отправленной не бэкендом"); err != nil {
+				return err
+			}
+			fmt.Printf("Сеть %d: nonce %d занят неизвестной транзакцией\n", c.ID, nonce)
+			continue
+		}
+
+		// Nonce ещё свободен: последняя замена должна быть в пуле узла
+		latest := group[len(group)-1]
+		if _, _, err := c.Client.TransactionByHash(ctx, common.HexToHash(latest.TxHash)); err == nil {
+			continue
+		} else if !errors.Is(err, ethereum.NotFound) {
+			return err
+		}
+		tx, err := decodeRawTx(latest.RawTx)
+		if err != nil {
+			return err
+		}
+		sendErr := c.Client.SendTransaction(ctx, tx)
+		if sendErr == nil {
+			fmt.Printf("Сеть %d: транзакция %s повторно разослана\n", c.ID, latest.TxHash)
+			continue
+		}
+
+		if err := r.pg.FinishOutgoingNonce(ctx, c.ID, r.address.Hex(), nonce, model.OutgoingTxDropped, sendErr.Error()); err != nil {
+			return err
+		}
+		fmt.Printf("Сеть %d: транзакция %s отклонена узлом: %v\n", c.ID, latest.TxHash, sendErr)
+		if i < len(groups)-1 {
+			if err := r.fillNonceGap(ctx, c, nonce); err != nil {
+				return fmt.Errorf("ошибка заполнения nonce %d: %w", nonce, err)
+			}
+		}
+	}
+	return nil
+}
+
+// fillNonceGap отправляет пустую транзакцию на место отклонённой, без которой
+// транзакции с большими номерами не попадут в блок. Вызывается под mu.
+func (r *Relayer) fillNonceGap(ctx context.Context, c *chain.Chain, nonce uint64) error {
+	fees, err := suggestFees(ctx, c.Client)
+	if err != nil {
+		return err
+	}
+	_, err = r.submit(ctx, c, fees.txData(c.ID, nonce, params.TxGas, &r.address, nil, nil), model.TxPurposeNonceGap, nil)
+	return err
+}
+
+// groupByNonce группирует транзакции, упорядоченные по nonce, в исходные с заменами
+func groupByNonce(txs []model.OutgoingTransaction) [][]model.OutgoingTransaction {
+	var groups [][]model.OutgoingTransaction
+	for _, tx := range txs {
+		if n := len(groups); n > 0 && groups[n-1][0].Nonce == tx.Nonce {
+			groups[n-1] = append(groups[n-1], tx)
+			continue
+		}
+		groups = append(groups, []model.OutgoingTransaction{tx})
+	}
+	return groups
+}
+
+// findReceipt возвращает квитанцию транзакции группы, попавшей в блок, или nil
+func findReceipt(ctx context.Context, client *chain.Client, group []model.OutgoingTransaction) (*types.Receipt, error) {
+	for _, tx := range group {
+		receipt, err := client.TransactionReceipt(ctx, common.HexToHash(tx.TxHash))
+		if errors.Is(err, ethereum.NotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return receipt, nil
+	}
+	return nil, nil
+}
+
+// Receipt возвращает квитанцию транзакции с тем же nonce, что и hash, попавшей в блок:
+// исходной или её ускоренной замены. ethereum.NotFound — ни одна ещё не в блоке.
+// Если nonce занят отменой или чужой транзакцией, возвращается ErrTransactionReplaced,
+// если все транзакции группы отклонены — ErrTransactionDropped. Для отменённой
+// контрактом транзакции квитанция возвращается вместе с ErrTransactionFailed.
+func (r *Relayer) Receipt(ctx context.Context, c *chain.Chain, hash common.Hash) (*types.Receipt, error) {
+	tracked, err := r.pg.GetOutgoingTransaction(ctx, hash.Hex())
+	if errors.Is(err, pgx.ErrNoRows) {
+		return checkReceipt(c.Client.TransactionReceipt(ctx, hash))
+	}
+	if err != nil {
+		return nil, err
+	}
+	group, err := r.pg.GetOutgoingNonceGroup(ctx, tracked.ChainID, tracked.FromAddr, tracked.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	dropped, replaced := 0, false
+	var candidates []model.OutgoingTransaction
+	for _, tx := range group {
+		switch tx.Status {
+		case model.OutgoingTxDropped:
+			dropped++
+		case model.OutgoingTxReplaced:
+			replaced = replaced || tx.ReplacedBy == nil
+		default:
+			candidates = append(candidates, tx)
+		}
+	}
+
+	receipt, err := findReceipt(ctx, c.Client, candidates)
+	if err != nil {
+		return nil, err
+	}
+	if receipt != nil {
+		for _, tx := range candidates {
+			if common.HexToHash(tx.TxHash) == receipt.TxHash && (tx.Purpose == model.TxPurposeCancel || tx.Purpose == model.TxPurposeNonceGap) {
+				return nil, ErrTransactionReplaced
+			}
+		}
+		return checkReceipt(receipt, nil)
+	}
+	switch {
+	case replaced:
+		return nil, ErrTransactionReplaced
+	case dropped == len(group):
+		return nil, ErrTransactionDropped
+	}
+	return nil, ethereum.NotFound
+}
+
+func checkReceipt(receipt *types.Receipt, err error) (*types.Receipt, error) {
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return receipt, ErrTransactionFailed
+	}
+	return receipt, nil
+}
+
+// WaitReceipt ожидает включения в блок транзакции hash или её замены (см. Receipt)
+func (r *Relayer) WaitReceipt(ctx context.Context, c *chain.Chain, hash common.Hash) (*types.Receipt, error) {
+	ticker := time.NewTicker(receiptPollInterval)
+	defer ticker.Stop()
+
+	for {
+		receipt, err := r.Receipt(ctx, c, hash)
+		if !errors.Is(err, ethereum.NotFound) {
+			return receipt, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
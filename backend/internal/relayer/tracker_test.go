@@ -0,0 +1,155 @@
+package relayer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+func TestTrackChainResend(t *testing.T) {
+	ctx := context.Background()
+	r, s, node, c := newTestRelayer(t)
+
+	tx, err := r.Send(ctx, c, testContract, nil, []byte{0x01}, model.TxPurposePublish)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	// транзакция в пуле узла: повторно не рассылается
+	if err := r.trackChain(ctx, c); err != nil {
+		t.Fatalf("trackChain() error = %v", err)
+	}
+	if got := len(node.Sent()); got != 1 {
+		t.Fatalf("разослано %d транзакций, want 1", got)
+	}
+
+	// узел вытеснил транзакцию из пула: она рассылается снова и остаётся неподтверждённой
+	node.Drop(tx.Hash())
+	if err := r.trackChain(ctx, c); err != nil {
+		t.Fatalf("trackChain() error = %v", err)
+	}
+	sent := node.Sent()
+	if len(sent) != 2 || sent[1].Hash() != tx.Hash() {
+		t.Fatalf("после вытеснения разослано %d транзакций, want повтор %s", len(sent), tx.Hash().Hex())
+	}
+	if !node.Pending(tx.Hash()) {
+		t.Error("повторно разосланной транзакции нет в пуле узла")
+	}
+	if got := s.status(t, tx.Hash()).Status; got != model.OutgoingTxPending {
+		t.Errorf("состояние = %s, want %s", got, model.OutgoingTxPending)
+	}
+}
+
+func TestTrackChainNonceGap(t *testing.T) {
+	tests := []struct {
+		name     string
+		rejected int  // номер отклонённой узлом транзакции из трёх
+		wantGap  bool // nonce отклонённой занимается пустой транзакцией
+	}{
+		{"отклонена транзакция перед другими", 0, true},
+		{"отклонена транзакция в середине", 1, true},
+		{"отклонена последняя транзакция", 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			r, s, node, c := newTestRelayer(t)
+
+			var txs []*types.Transaction
+			for range 3 {
+				tx, err := r.Send(ctx, c, testContract, nil, []byte{0x01}, model.TxPurposePublish)
+				if err != nil {
+					t.Fatalf("Send() error = %v", err)
+				}
+				txs = append(txs, tx)
+			}
+			for i, tx := range txs {
+				if tx.Nonce() != uint64(i) {
+					t.Fatalf("nonce транзакции %d = %d", i, tx.Nonce())
+				}
+				node.Drop(tx.Hash())
+			}
+			rejected := txs[tt.rejected]
+			node.RejectSend(func(tx *types.Transaction) error {
+				if tx.Hash() == rejected.Hash() {
+					return errors.New("insufficient funds for gas * price + value")
+				}
+				return nil
+			})
+
+			if err := r.trackChain(ctx, c); err != nil {
+				t.Fatalf("trackChain() error = %v", err)
+			}
+
+			if got := s.status(t, rejected.Hash()).Status; got != model.OutgoingTxDropped {
+				t.Errorf("состояние отклонённой = %s, want %s", got, model.OutgoingTxDropped)
+			}
+			for i, tx := range txs {
+				if i != tt.rejected && !node.Pending(tx.Hash()) {
+					t.Errorf("транзакция %d не разослана повторно", i)
+				}
+			}
+
+			group, _ := s.GetOutgoingNonceGroup(ctx, c.ID, r.Address().Hex(), rejected.Nonce())
+			var gaps []model.OutgoingTransaction
+			for _, record := range group {
+				if record.Purpose == model.TxPurposeNonceGap {
+					gaps = append(gaps, record)
+				}
+			}
+			if !tt.wantGap {
+				if len(gaps) != 0 {
+					t.Errorf("записано %d пустых транзакций, want 0", len(gaps))
+				}
+				return
+			}
+			if len(gaps) != 1 {
+				t.Fatalf("записано %d пустых транзакций на nonce %d, want 1", len(gaps), rejected.Nonce())
+			}
+			gap, err := decodeRawTx(gaps[0].RawTx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *gap.To() != r.Address() || gap.Value().Sign() != 0 || gap.Gas() != params.TxGas || !node.Pending(gap.Hash()) {
+				t.Errorf("пустая транзакция: to %s, сумма %v, газ %d, в пуле %v", gap.To().Hex(), gap.Value(), gap.Gas(), node.Pending(gap.Hash()))
+			}
+
+			// пустая транзакция попала в блок: отклонённая считается заменённой
+			node.Include(2, gap, types.ReceiptStatusSuccessful)
+			if _, err := r.Receipt(ctx, c, rejected.Hash()); !errors.Is(err, ErrTransactionReplaced) {
+				t.Errorf("Receipt() отклонённой error = %v, want %v", err, ErrTransactionReplaced)
+			}
+		})
+	}
+}
+
+func TestTrackChainForeignNonce(t *testing.T) {
+	ctx := context.Background()
+	r, s, node, c := newTestRelayer(t)
+
+	tx, err := r.Send(ctx, c, testContract, nil, []byte{0x01}, model.TxPurposePublish)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	// nonce занят транзакцией, отправленной тем же ключом не бэкендом
+	node.Drop(tx.Hash())
+	node.SetNonce(r.Address(), tx.Nonce()+1)
+
+	if err := r.trackChain(ctx, c); err != nil {
+		t.Fatalf("trackChain() error = %v", err)
+	}
+	if got := s.status(t, tx.Hash()).Status; got != model.OutgoingTxReplaced {
+		t.Errorf("состояние = %s, want %s", got, model.OutgoingTxReplaced)
+	}
+	if got := len(node.Sent()); got != 1 {
+		t.Errorf("разослано %d транзакций, want 1", got)
+	}
+	if _, err := r.Receipt(ctx, c, tx.Hash()); !errors.Is(err, ErrTransactionReplaced) {
+		t.Errorf("Receipt() error = %v, want %v", err, ErrTransactionReplaced)
+	}
+}
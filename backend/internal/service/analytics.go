@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// GetEarnings строит отчёт о продажах: суммы по трекам, по владельцам и итог за весь период
+func (s *Service) GetEarnings(ctx context.Context, filter model.EarningsFilter) (*model.EarningsReport, error) {
+	tracks, err := s.pg.GetTrackEarnings(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.EarningsReport{
+		GroupBy: filter.GroupBy,
+		Tracks:  tracks,
+		Owners:  []model.OwnerEarnings{},
+	}
+	if report.Tracks == nil {
+		report.Tracks = []model.TrackEarnings{}
+	}
+
+	// Строки отсортированы по периоду и продавцу, поэтому строки одного владельца за период идут подряд
+	var gross, fee, net big.Int
+	var owner *model.OwnerEarnings
+	var ownerGross, ownerFee, ownerNet big.Int
+	flush := func() {
+		if owner == nil {
+			return
+		}
+		owner.GrossWei, owner.PlatformFeeWei, owner.NetWei = ownerGross.String(), ownerFee.String(), ownerNet.String()
+		report.Owners = append(report.Owners, *owner)
+	}
+	for _, t := range tracks {
+		if owner == nil || !owner.Period.Equal(t.Period) || owner.OwnerAddr != t.OwnerAddr {
+			flush()
+			owner = &model.OwnerEarnings{Period: t.Period, OwnerAddr: t.OwnerAddr}
+			ownerGross.SetInt64(0)
+			ownerFee.SetInt64(0)
+			ownerNet.SetInt64(0)
+		}
+		for _, v := range []struct {
+			value        string
+			owner, total *big.Int
+		}{
+			{t.GrossWei, &ownerGross, &gross},
+			{t.PlatformFeeWei, &ownerFee, &fee},
+			{t.NetWei, &ownerNet, &net},
+		} {
+			amount, ok := new(big.Int).SetString(v.value, 10)
+			if !ok {
+				return nil, fmt.Errorf("некорректная сумма продаж аудио %d: %s", t.AudioID, v.value)
+			}
+			v.owner.Add(v.owner, amount)
+			v.total.Add(v.total, amount)
+		}
+		owner.Sales += t.Sales
+		report.Sales += t.Sales
+	}
+	flush()
+
+	report.GrossWei, report.PlatformFeeWei, report.NetWei = gross.String(), fee.String(), net.String()
+	return report, nil
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/polonkoevv/ethcourse/internal/chain"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+var ErrUnknownChain = errors.New("сеть не настроена")
+
+// chain возвращает сеть по chain ID; 0 означает сеть по умолчанию
+func (s *Service) chain(chainID uint64) (*chain.Chain, error) {
+	if chainID == 0 {
+		return s.chains.Default(), nil
+	}
+	c, ok := s.chains.Get(chainID)
+	if !ok {
+		return nil, ErrUnknownChain
+	}
+	return c, nil
+}
+
+// Chains возвращает настроенные сети
+func (s *Service) Chains() []model.ChainInfo {
+	var result []model.ChainInfo
+	for i, c := range s.chains.All() {
+		info := model.ChainInfo{
+			ChainID:       c.ID,
+			Name:          c.Name,
+			Confirmations: c.Confirmations,
+			Default:       i == 0,
+		}
+		if c.HasContract() {
+			info.ContractAddress = c.Contract.Hex()
+		}
+		result = append(result, info)
+	}
+	return result
+}
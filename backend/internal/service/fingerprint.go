@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/analysis"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/storage/postgres"
+)
+
+// DuplicatePolicy определяет, что делать с загрузкой, совпавшей с чужим треком
+type DuplicatePolicy string
+
+const (
+	DuplicatePolicyFlag   DuplicatePolicy = "flag"   // сохранить и отправить на проверку
+	DuplicatePolicyReject DuplicatePolicy = "reject" // отклонить загрузку
+)
+
+const (
+	// Порог доли ошибочных бит, ниже которого отпечатки считаются одной записью
+	fingerprintMatchThreshold = 0.35
+	// Минимальная длина перекрытия отпечатков для сравнения, в секундах
+	fingerprintMinOverlap = 5
+	// Для поиска кандидатов используется начало отпечатка, в секундах
+	fingerprintQuerySeconds = 60
+	fingerprintCandidates   = 5
+)
+
+var (
+	// ErrFlagNotFound возвращается, если пометки с таким идентификатором нет
+	ErrFlagNotFound = errors.New("пометка не найдена")
+	// ErrInvalidDecision возвращается при неизвестном решении по пометке
+	ErrInvalidDecision = errors.New("решение должно быть approved или rejected")
+	// ErrFlagResolved возвращается, если по пометке уже принято решение
+	ErrFlagResolved = errors.New("пометка уже рассмотрена")
+)
+
+// AcousticDuplicateError возвращается при отклонении загрузки, совпавшей с чужим треком
+type AcousticDuplicateError struct {
+	Original     *model.Music
+	BitErrorRate float64
+}
+
+func (e *AcousticDuplicateError) Error() string {
+	return fmt.Sprintf("аудио совпадает с треком %d владельца %s", e.Original.ID, e.Original.OwnerAddr)
+}
+
+// acousticMatch — найденное совпадение по отпечатку
+type acousticMatch struct {
+	original     *model.Music
+	bitErrorRate float64
+}
+
+// findAcousticDuplicate ищет среди треков других владельцев запись с тем же звучанием
+func (s *Service) findAcousticDuplicate(ctx context.Context, fingerprint []uint32, uploader string) (*acousticMatch, error) {
+	query := fingerprint
+	if limit := analysis.FingerprintLength(fingerprintQuerySeconds); len(query) > limit {
+		query = query[:limit]
+	}
+
+	candidates, err := s.pg.FindFingerprintCandidates(ctx, query, fingerprintCandidates)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска по отпечатку: %w", err)
+	}
+
+	minOverlap := analysis.FingerprintLength(fingerprintMinOverlap)
+	var best *acousticMatch
+	for _, c := range candidates {
+		stored, err := s.pg.GetFingerprint(ctx, c.MusicID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения отпечатка трека %d: %w", c.MusicID, err)
+		}
+
+		ber, overlap := analysis.BitErrorRate(fingerprint, stored, c.Offset)
+		if overlap < minOverlap || ber >= fingerprintMatchThreshold {
+			continue
+		}
+		if best != nil && ber >= best.bitErrorRate {
+			continue
+		}
+
+		original, err := s.pg.GetMusicById(ctx, c.MusicID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения трека %d: %w", c.MusicID, err)
+		}
+		// Повторная загрузка собственного трека не считается присвоением чужого
+		if strings.EqualFold(original.OwnerAddr, uploader) {
+			continue
+		}
+		best = &acousticMatch{original: original, bitErrorRate: ber}
+	}
+	return best, nil
+}
+
+// GetDuplicateFlags возвращает пометки о подозрительных загрузках
+func (s *Service) GetDuplicateFlags(ctx context.Context, status string) ([]model.DuplicateFlag, error) {
+	return s.pg.GetDuplicateFlags(ctx, status)
+}
+
+// ResolveDuplicateFlag применяет решение администратора: approved оставляет трек,
+// rejected удаляет его из каталога и снимает закрепление в IPFS
+func (s *Service) ResolveDuplicateFlag(ctx context.Context, id int, status, note string) (*model.DuplicateFlag, error) {
+	if status != model.DuplicateFlagApproved && status != model.DuplicateFlagRejected {
+		return nil, ErrInvalidDecision
+	}
+
+	flag, err := s.pg.GetDuplicateFlag(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrFlagNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if flag.Status != model.DuplicateFlagPending {
+		return nil, ErrFlagResolved
+	}
+
+	// Решение и удаление трека записываются одной транзакцией, чтобы одновременные
+	// решения по пометке не удалили трек, который другой администратор одобрил
+	var reject *model.AuditEntry
+	var music *model.Music
+	if status == model.DuplicateFlagRejected {
+		music, err = s.pg.GetMusicById(ctx, flag.MusicID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		if music != nil {
+			details, err := json.Marshal(map[string]interface{}{"before": music, "flag_id": id, "note": note})
+			if err != nil {
+				return nil, err
+			}
+			reject = &model.AuditEntry{
+				Action:        model.AuditActionAdminReject,
+				RecoveredAddr: model.AuditAdminAddress,
+				Details:       string(details),
+			}
+		}
+	}
+
+	err = s.pg.ResolveDuplicateFlag(ctx, id, status, note, reject)
+	if errors.Is(err, postgres.ErrFlagResolved) {
+		return nil, ErrFlagResolved
+	}
+	if err != nil {
+		return nil, err
+	}
+	if music != nil {
+		if err := s.sh.Unpin(music.CID); err != nil {
+			fmt.Printf("Ошибка снятия закрепления %s: %v\n", music.CID, err)
+		}
+	}
+	return s.pg.GetDuplicateFlag(ctx, id)
+}
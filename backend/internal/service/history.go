@@ -0,0 +1,368 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/polonkoevv/ethcourse/internal/chain"
+	"github.com/polonkoevv/ethcourse/internal/contract"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+const (
+	// Максимальное число блоков, просматриваемых за один запрос истории
+	maxHistoryScanBlocks = 5000
+	// Число блоков, загружаемых за один проход сканирования
+	historyFetchBlocks = 100
+)
+
+// ErrInvalidTransactionCursor возвращается, если курсор истории не удалось разобрать
+var ErrInvalidTransactionCursor = errors.New("некорректный курсор истории транзакций")
+
+// transactionCursor — позиция следующей непросмотренной транзакции
+type transactionCursor struct {
+	Block uint64 `json:"b"`
+	Index int    `json:"i"`
+}
+
+func encodeTransactionCursor(c transactionCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeTransactionCursor(s string) (*transactionCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidTransactionCursor
+	}
+	var c transactionCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidTransactionCursor
+	}
+	return &c, nil
+}
+
+// GetTransactionHistoryFromChain сканирует блоки и возвращает страницу транзакций, в которых
+// адрес является отправителем или получателем. За один запрос просматривается не больше
+// maxHistoryScanBlocks блоков; продолжение передаётся курсором.
+func (s *Service) GetTransactionHistoryFromChain(ctx context.Context, filter model.TransactionFilter) (*model.TransactionPage, error) {
+	c, err := s.chain(filter.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	client := c.Client
+
+	startBlock, endBlock, err := historyBlockRange(ctx, client, filter)
+	if err != nil {
+		return nil, err
+	}
+	startIndex := 0
+	if filter.Cursor != "" {
+		cursor, err := decodeTransactionCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Block >= startBlock {
+			startBlock, startIndex = cursor.Block, cursor.Index
+		}
+	}
+
+	// Просматривается не больше maxHistoryScanBlocks блоков, остаток — на следующей странице
+	scanEnd := endBlock
+	if startBlock <= endBlock && endBlock-startBlock >= maxHistoryScanBlocks {
+		scanEnd = startBlock + maxHistoryScanBlocks - 1
+	}
+
+	targetAddress := common.HexToAddress(filter.Address)
+	page := &model.TransactionPage{}
+	for chunkStart := startBlock; chunkStart <= scanEnd; chunkStart += historyFetchBlocks {
+		blocks, err := client.BlocksByNumber(ctx, chunkStart, min(chunkStart+historyFetchBlocks-1, scanEnd))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, block := range blocks {
+			blockTime := time.Unix(int64(block.Time), 0)
+
+			for i := startIndex; i < len(block.Transactions); i++ {
+				tx := block.Transactions[i]
+				// Отправитель берётся из ответа узла, поэтому работает для любого типа транзакции
+				from := block.Senders[i]
+
+				direction := transactionDirection(tx, from, targetAddress)
+				if direction == "" || (filter.Direction != "" && filter.Direction != direction) {
+					continue
+				}
+				if filter.MinValue != nil && tx.Value().Cmp(filter.MinValue) < 0 {
+					continue
+				}
+
+				transaction := newBlockchainTransaction(tx, from, block.Number, blockTime)
+				transaction.TransactionType = direction
+				if err := s.enrichTransaction(ctx, c, tx, from, &transaction); err != nil {
+					return nil, err
+				}
+				page.Transactions = append(page.Transactions, transaction)
+
+				if len(page.Transactions) == filter.Limit {
+					next := transactionCursor{Block: block.Number, Index: i + 1}
+					if next.Index == len(block.Transactions) {
+						next = transactionCursor{Block: block.Number + 1}
+					}
+					if next.Block <= endBlock {
+						page.NextCursor = encodeTransactionCursor(next)
+					}
+					return page, nil
+				}
+			}
+			startIndex = 0
+		}
+	}
+
+	if scanEnd < endBlock {
+		page.NextCursor = encodeTransactionCursor(transactionCursor{Block: scanEnd + 1})
+	}
+	return page, nil
+}
+
+// transactionDirection определяет направление транзакции относительно адреса
+// или возвращает пустую строку, если адрес в ней не участвует
+func transactionDirection(tx *types.Transaction, from, address common.Address) string {
+	isIncoming := tx.To() != nil && *tx.To() == address
+	isOutgoing := from == address
+	switch {
+	case isIncoming && isOutgoing:
+		return model.TxDirectionSelf
+	case isIncoming:
+		return model.TxDirectionIncoming
+	case isOutgoing:
+		return model.TxDirectionOutgoing
+	}
+	return ""
+}
+
+// historyBlockRange переводит границы фильтра в диапазон блоков [start, end]. Временные
+// границы ищутся двоичным поиском по времени блоков и сужают диапазон номеров блоков.
+func historyBlockRange(ctx context.Context, client *chain.Client, filter model.TransactionFilter) (start, end uint64, err error) {
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("ошибка получения текущего блока: %v", err)
+	}
+	latest := header.Number.Uint64()
+
+	end = latest
+	if filter.ToBlock != nil && *filter.ToBlock < end {
+		end = *filter.ToBlock
+	}
+	if filter.FromBlock != nil {
+		start = *filter.FromBlock
+	}
+
+	if filter.From != nil {
+		first, err := firstBlockAt(ctx, client, latest, *filter.From)
+		if err != nil {
+			return 0, 0, err
+		}
+		if first > start {
+			start = first
+		}
+	}
+	if filter.To != nil {
+		first, err := firstBlockAt(ctx, client, latest, *filter.To)
+		if err != nil {
+			return 0, 0, err
+		}
+		if first == 0 {
+			// Все блоки не раньше границы — диапазон пуст
+			return 1, 0, nil
+		}
+		if first-1 < end {
+			end = first - 1
+		}
+	}
+	return start, end, nil
+}
+
+// firstBlockAt возвращает номер первого блока со временем не раньше t или latest+1,
+// если такого блока нет
+func firstBlockAt(ctx context.Context, client *chain.Client, latest uint64, t time.Time) (uint64, error) {
+	var searchErr error
+	n := sort.Search(int(latest)+1, func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+		header, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(uint64(i)))
+		if err != nil {
+			searchErr = fmt.Errorf("ошибка получения блока %d: %w", i, err)
+			return true
+		}
+		return !time.Unix(int64(header.Time), 0).Before(t)
+	})
+	return uint64(n), searchErr
+}
+
+// newBlockchainTransaction переносит поля транзакции с учётом её типа
+func newBlockchainTransaction(tx *types.Transaction, from common.Address, blockNumber uint64, blockTime time.Time) model.BlockchainTransaction {
+	result := model.BlockchainTransaction{
+		Hash:        tx.Hash().Hex(),
+		BlockNumber: blockNumber,
+		From:        from.Hex(),
+		Value:       tx.Value().String(),
+		Gas:         tx.Gas(),
+		Input:       hex.EncodeToString(tx.Data()),
+		Timestamp:   blockTime,
+		Type:        tx.Type(),
+		Nonce:       tx.Nonce(),
+	}
+	if to := tx.To(); to != nil {
+		result.To = to.Hex()
+	}
+	if chainID := tx.ChainId(); chainID != nil && chainID.Sign() > 0 {
+		result.ChainID = chainID.String()
+	}
+
+	switch tx.Type() {
+	case types.LegacyTxType, types.AccessListTxType:
+		result.GasPrice = tx.GasPrice().String()
+	default:
+		// Цена газа EIP-1559 известна только после включения в блок и берётся из квитанции
+		result.MaxFeePerGas = tx.GasFeeCap().String()
+		result.MaxPriorityFeePerGas = tx.GasTipCap().String()
+	}
+
+	for _, tuple := range tx.AccessList() {
+		keys := make([]string, len(tuple.StorageKeys))
+		for i, key := range tuple.StorageKeys {
+			keys[i] = key.Hex()
+		}
+		result.AccessList = append(result.AccessList, model.AccessTuple{Address: tuple.Address.Hex(), StorageKeys: keys})
+	}
+	return result
+}
+
+// enrichTransaction декодирует вызов AudioChain, события из квитанции и определяет
+// категорию транзакции. Если квитанцию получить не удалось, поля квитанции остаются
+// пустыми, а ошибка возвращается только при отмене контекста.
+func (s *Service) enrichTransaction(ctx context.Context, c *chain.Chain, tx *types.Transaction, from common.Address, out *model.BlockchainTransaction) error {
+	switch {
+	case tx.To() == nil:
+		out.Category = model.TxCategoryContractCreation
+	case len(tx.Data()) == 0:
+		out.Category = model.TxCategoryTransfer
+	default:
+		out.Category = model.TxCategoryContractCall
+		if !c.IsAudioChain(*tx.To()) {
+			break
+		}
+		call, err := contract.DecodeInput(tx.Data())
+		if err != nil {
+			break
+		}
+		out.Call = call
+		switch call.Method {
+		case "publishAudio":
+			out.Category = model.TxCategoryPublish
+		case "purchaseAudio":
+			out.Category = model.TxCategoryPurchase
+		case "withdrawPlatformFees":
+			out.Category = model.TxCategoryFeeWithdrawal
+		}
+	}
+
+	receipt, err := c.Client.TransactionReceipt(ctx, tx.Hash())
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		fmt.Printf("Сеть %d: ошибка получения квитанции %s: %v\n", c.ID, out.Hash, err)
+		return nil
+	}
+	s.applyReceipt(ctx, c, tx, from, receipt, out)
+	return nil
+}
+
+// applyReceipt дополняет транзакцию статусом, фактической стоимостью газа и событиями
+func (s *Service) applyReceipt(ctx context.Context, c *chain.Chain, tx *types.Transaction, from common.Address, receipt *types.Receipt, out *model.BlockchainTransaction) {
+	out.GasUsed = receipt.GasUsed
+
+	// Узлы до London не возвращают effectiveGasPrice — используется gasPrice транзакции
+	gasPrice := receipt.EffectiveGasPrice
+	if gasPrice == nil {
+		gasPrice = tx.GasPrice()
+	}
+	out.EffectiveGasPrice = gasPrice.String()
+	out.Fee = new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(receipt.GasUsed)).String()
+	if out.GasPrice == "" {
+		out.GasPrice = out.EffectiveGasPrice
+	}
+	if receipt.ContractAddress != (common.Address{}) {
+		out.ContractAddress = receipt.ContractAddress.Hex()
+	}
+
+	if receipt.Status == types.ReceiptStatusFailed {
+		out.Status = model.TxStatusFailed
+		out.RevertReason = revertReason(ctx, c.Client, tx, from, receipt.BlockNumber)
+		return
+	}
+	out.Status = model.TxStatusSuccess
+
+	for _, log := range receipt.Logs {
+		if !c.IsAudioChain(log.Address) {
+			continue
+		}
+		decoded, err := contract.DecodeLog(*log)
+		if err != nil {
+			continue
+		}
+		out.Logs = append(out.Logs, *decoded)
+	}
+}
+
+// revertReason повторяет вызов на состоянии предыдущего блока и извлекает причину отката
+// из Error(string). Если транзакция откатилась из-за состояния, изменённого другой
+// транзакцией того же блока, повтор может пройти успешно — тогда причина пуста.
+func revertReason(ctx context.Context, client *chain.Client, tx *types.Transaction, from common.Address, blockNumber *big.Int) string {
+	msg := ethereum.CallMsg{
+		From:       from,
+		To:         tx.To(),
+		Gas:        tx.Gas(),
+		Value:      tx.Value(),
+		Data:       tx.Data(),
+		AccessList: tx.AccessList(),
+	}
+
+	var atBlock *big.Int
+	if blockNumber != nil && blockNumber.Sign() > 0 {
+		atBlock = new(big.Int).Sub(blockNumber, big.NewInt(1))
+	}
+	_, err := client.CallContract(ctx, msg, atBlock)
+	if err == nil {
+		return ""
+	}
+
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		if data, ok := dataErr.ErrorData().(string); ok {
+			if raw, decodeErr := hexutil.Decode(data); decodeErr == nil {
+				if reason, unpackErr := abi.UnpackRevert(raw); unpackErr == nil {
+					return reason
+				}
+			}
+		}
+	}
+	return strings.TrimPrefix(err.Error(), "execution reverted: ")
+}
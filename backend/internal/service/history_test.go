@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/polonkoevv/ethcourse/internal/chain"
+	"github.com/polonkoevv/ethcourse/internal/chain/chaintest"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+func TestTransactionCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor transactionCursor
+	}{
+		{"начало блока", transactionCursor{Block: 18_000_000}},
+		{"середина блока", transactionCursor{Block: 42, Index: 17}},
+		{"генезис", transactionCursor{}},
+		{"максимальный номер блока", transactionCursor{Block: math.MaxUint64, Index: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encodeTransactionCursor(tt.cursor)
+			got, err := decodeTransactionCursor(encoded)
+			if err != nil {
+				t.Fatalf("decodeTransactionCursor(%q) error = %v", encoded, err)
+			}
+			if *got != tt.cursor {
+				t.Errorf("decodeTransactionCursor(encodeTransactionCursor(%+v)) = %+v", tt.cursor, *got)
+			}
+		})
+	}
+}
+
+func TestDecodeTransactionCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"не base64", "!!"},
+		{"стандартный base64 с дополнением", base64.StdEncoding.EncodeToString([]byte(`{"b":1}`))},
+		{"не JSON", base64.RawURLEncoding.EncodeToString([]byte("1:2"))},
+		{"отрицательный номер блока", base64.RawURLEncoding.EncodeToString([]byte(`{"b":-1,"i":0}`))},
+		{"номер блока строкой", base64.RawURLEncoding.EncodeToString([]byte(`{"b":"1","i":0}`))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeTransactionCursor(tt.cursor); !errors.Is(err, ErrInvalidTransactionCursor) {
+				t.Errorf("decodeTransactionCursor(%q) error = %v, want %v", tt.cursor, err, ErrInvalidTransactionCursor)
+			}
+		})
+	}
+}
+
+func TestGetTransactionHistoryFromChainPaging(t *testing.T) {
+	const head = 12_000
+	node := chaintest.New(t, 1337)
+	node.AddBlock(head, 1_700_000_000+head*12)
+
+	account, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+	address := crypto.PubkeyToAddress(account.PublicKey)
+	stranger := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	nonces := map[common.Address]uint64{}
+	include := func(block uint64, key *ecdsa.PrivateKey, to common.Address) {
+		from := crypto.PubkeyToAddress(key.PublicKey)
+		tx, err := types.SignNewTx(key, node.Signer(), &types.DynamicFeeTx{
+			ChainID: big.NewInt(1337), Nonce: nonces[from], GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2), Gas: 21000, To: &to, Value: big.NewInt(1),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonces[from]++
+		node.Include(block, tx, types.ReceiptStatusSuccessful)
+	}
+
+	// Транзакции адреса по обе стороны границ окон сканирования 0–4999 и 5000–9999;
+	// в блоке 10 за двумя транзакциями адреса идёт чужая
+	include(10, account, stranger)
+	include(10, other, address)
+	include(10, other, stranger)
+	include(maxHistoryScanBlocks-1, account, stranger)
+	include(maxHistoryScanBlocks, other, address)
+	include(maxHistoryScanBlocks+1, account, stranger)
+	include(2*maxHistoryScanBlocks-1, other, address)
+	include(11_000, account, stranger)
+
+	registry, err := chain.NewRegistry(context.Background(), []chain.Config{{ChainID: 1337, RPCURLs: []string{node.URL()}, RateLimit: 1e6}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(registry.Close)
+	s := &Service{chains: registry}
+
+	tests := []struct {
+		name  string
+		limit int
+		want  [][]string // позиции транзакций страниц в виде "блок/индекс"
+	}{
+		{
+			name:  "страницы обрезаются лимитом блоков",
+			limit: 10,
+			want:  [][]string{{"10/0", "10/1", "4999/0"}, {"5000/0", "5001/0", "9999/0"}, {"11000/0"}},
+		},
+		{
+			name:  "курсор внутри блока и на границе окна",
+			limit: 2,
+			want:  [][]string{{"10/0", "10/1"}, {"4999/0", "5000/0"}, {"5001/0", "9999/0"}, {"11000/0"}},
+		},
+		{
+			name:  "страница ровно до конца окна",
+			limit: 3,
+			want:  [][]string{{"10/0", "10/1", "4999/0"}, {"5000/0", "5001/0", "9999/0"}, {"11000/0"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]string
+			cursor := ""
+			for page := 0; ; page++ {
+				if page > len(tt.want) {
+					t.Fatalf("больше %d страниц: %v", len(tt.want), got)
+				}
+				fetched := node.Calls("eth_getBlockByNumber")
+				result, err := s.GetTransactionHistoryFromChain(context.Background(), model.TransactionFilter{
+					Address: address.Hex(), Cursor: cursor, Limit: tt.limit,
+				})
+				if err != nil {
+					t.Fatalf("страница %d: error = %v", page, err)
+				}
+				// последний блок для диапазона и не больше окна сканирования
+				if n := node.Calls("eth_getBlockByNumber") - fetched; n > maxHistoryScanBlocks+1 {
+					t.Errorf("страница %d: загружено %d блоков", page, n)
+				}
+
+				var positions []string
+				for _, tx := range result.Transactions {
+					receipt, err := s.chains.Default().Client.TransactionReceipt(context.Background(), common.HexToHash(tx.Hash))
+					if err != nil {
+						t.Fatal(err)
+					}
+					positions = append(positions, fmt.Sprintf("%d/%d", tx.BlockNumber, receipt.TransactionIndex))
+				}
+				got = append(got, positions)
+				if result.NextCursor == "" {
+					break
+				}
+				cursor = result.NextCursor
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("страницы = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
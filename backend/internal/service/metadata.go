@@ -0,0 +1,112 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// Ссылки на файлы в метаданных имеют вид ipfs://<CID>: маркетплейсы открывают их
+// через свои шлюзы, и ссылка не зависит от адреса нашего узла
+const ipfsScheme = "ipfs://"
+
+// GetTokenMetadata строит метаданные токена audioID контракта сети из данных трека
+func (s *Service) GetTokenMetadata(ctx context.Context, chainID, audioID uint64) (*model.TokenMetadata, error) {
+	music, err := s.tokenMusic(ctx, chainID, audioID)
+	if err != nil {
+		return nil, err
+	}
+	metadata := s.newTokenMetadata(*music)
+	return &metadata, nil
+}
+
+// PinTokenMetadata добавляет текущие метаданные токена в IPFS и закрепляет их, чтобы
+// token URI мог указывать на неизменяемый CID. Предыдущие версии остаются закреплёнными:
+// на них могут ссылаться уже выпущенные токены.
+func (s *Service) PinTokenMetadata(ctx context.Context, chainID, audioID uint64) (*model.MetadataPin, error) {
+	music, err := s.tokenMusic(ctx, chainID, audioID)
+	if err != nil {
+		return nil, err
+	}
+	metadata := s.newTokenMetadata(*music)
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	cid, err := s.sh.Add(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка добавления метаданных в IPFS: %w", err)
+	}
+	if err := s.pg.SetMusicMetadataCID(ctx, music.ID, cid); err != nil {
+		return nil, err
+	}
+
+	return &model.MetadataPin{
+		MusicID:  music.ID,
+		ChainID:  uint64(*music.ChainID),
+		AudioID:  audioID,
+		CID:      cid,
+		TokenURI: ipfsScheme + cid,
+		Metadata: metadata,
+	}, nil
+}
+
+// tokenMusic возвращает трек, опубликованный под audioID; chainID 0 — сеть по умолчанию
+func (s *Service) tokenMusic(ctx context.Context, chainID, audioID uint64) (*model.Music, error) {
+	c, err := s.chain(chainID)
+	if err != nil {
+		return nil, err
+	}
+	music, err := s.pg.GetMusicByAudioID(ctx, c.ID, audioID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrMusicNotFound
+	}
+	return music, err
+}
+
+func (s *Service) newTokenMetadata(music model.Music) model.TokenMetadata {
+	metadata := model.TokenMetadata{
+		Name:         music.Title,
+		Description:  music.Title,
+		Image:        s.DefaultCoverImage,
+		AnimationURL: ipfsScheme + music.CID,
+		Attributes:   []model.MetadataAttribute{},
+	}
+	if music.Artist != "" {
+		metadata.Description = music.Artist + " — " + music.Title
+	}
+	if music.Album != "" {
+		metadata.Description += fmt.Sprintf(" (альбом «%s»)", music.Album)
+	}
+	if music.CoverCID != "" {
+		metadata.Image = ipfsScheme + music.CoverCID
+	}
+
+	for _, attr := range []struct{ trait, value string }{
+		{"Artist", music.Artist},
+		{"Genre", music.Genre},
+		{"Album", music.Album},
+	} {
+		if attr.value != "" {
+			metadata.Attributes = append(metadata.Attributes, model.MetadataAttribute{TraitType: attr.trait, Value: attr.value})
+		}
+	}
+	if music.Duration != nil {
+		metadata.Attributes = append(metadata.Attributes, model.MetadataAttribute{
+			TraitType:   "Duration",
+			Value:       int(math.Round(*music.Duration)),
+			DisplayType: "number",
+		})
+	}
+	for _, tag := range music.Tags {
+		metadata.Attributes = append(metadata.Attributes, model.MetadataAttribute{TraitType: "Tag", Value: tag})
+	}
+	return metadata
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/audit"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/storage/postgres"
+)
+
+// Подпись действия действительна в течение этого времени после метки timestamp в сообщении
+const signatureMaxAge = 5 * time.Minute
+
+var (
+	ErrMusicNotFound    = errors.New("трек не найден")
+	ErrInvalidSignature = errors.New("недействительная подпись или адрес не совпадает")
+	ErrStaleSignature   = errors.New("подпись устарела, подпишите сообщение заново")
+	ErrNotOwner         = errors.New("действие может выполнить только владелец трека")
+)
+
+// MessageError — ошибка содержимого подписанного сообщения
+type MessageError struct {
+	Reason string
+}
+
+func (e *MessageError) Error() string {
+	return "некорректное сообщение: " + e.Reason
+}
+
+// musicActionMessage — подписанное владельцем сообщение об изменении трека.
+// Поля изменений входят в подпись, поэтому берутся только из сообщения.
+type musicActionMessage struct {
+	Action    string    `json:"action"`
+	MusicID   int       `json:"musicId"`
+	Timestamp int64     `json:"timestamp"` // миллисекунды, как Date.now() во фронтенде
+	Wallet    string    `json:"wallet"`
+	Title     *string   `json:"title,omitempty"`
+	Artist    *string   `json:"artist,omitempty"`
+	Genre     *string   `json:"genre,omitempty"`
+	Album     *string   `json:"album,omitempty"`
+	Tags      *[]string `json:"tags,omitempty"`
+	CoverCID  *string   `json:"coverCid,omitempty"` // изображение обложки, уже добавленное в IPFS
+	Unpin     bool      `json:"unpin,omitempty"`
+
+	// Поля передачи трека
+	Recipient  string `json:"recipient,omitempty"`
+	TransferID int    `json:"transferId,omitempty"`
+
+	// Поля распределения доходов
+	Shares  []splitShareMessage `json:"shares,omitempty"`
+	SplitID int                 `json:"splitId,omitempty"`
+
+	// Поля цены в ERC-20 токене и покупки за токены
+	ChainID    uint64 `json:"chainId,omitempty"`
+	Token      string `json:"token,omitempty"`
+	TokenPrice string `json:"tokenPrice,omitempty"` // в единицах токена, например "9.99"
+	TxHash     string `json:"txHash,omitempty"`
+	LogIndex   *uint  `json:"logIndex,omitempty"`
+}
+
+// splitShareMessage — доля участника в подписанном предложении распределения
+type splitShareMessage struct {
+	Address string `json:"address"`
+	BPS     int    `json:"bps"`
+	Role    string `json:"role"`
+}
+
+// verifyMusicAction проверяет подпись, свежесть и назначение сообщения и возвращает
+// его содержимое вместе с адресом подписавшего
+func (s *Service) verifyMusicAction(message, signature, action string, musicID int) (*musicActionMessage, string, error) {
+	valid, recoveredAddress, err := s.VerifySignature(message, signature)
+	if err != nil || !valid {
+		return nil, "", ErrInvalidSignature
+	}
+
+	var msg musicActionMessage
+	if err := json.Unmarshal([]byte(message), &msg); err != nil {
+		return nil, "", &MessageError{Reason: err.Error()}
+	}
+	if msg.Action != action {
+		return nil, "", &MessageError{Reason: fmt.Sprintf("ожидалось действие %s", action)}
+	}
+	if msg.MusicID != musicID {
+		return nil, "", &MessageError{Reason: "сообщение подписано для другого трека"}
+	}
+	if !strings.EqualFold(msg.Wallet, recoveredAddress) {
+		return nil, "", ErrInvalidSignature
+	}
+
+	signedAt := time.UnixMilli(msg.Timestamp)
+	if age := time.Since(signedAt); age > signatureMaxAge || age < -time.Minute {
+		return nil, "", ErrStaleSignature
+	}
+
+	return &msg, recoveredAddress, nil
+}
+
+// GetMusicByID возвращает трек по идентификатору; удалённый трек не находится
+func (s *Service) GetMusicByID(ctx context.Context, id int) (*model.Music, error) {
+	return visibleMusic(s.pg.GetMusicById(ctx, id))
+}
+
+// GetMusicByCID возвращает трек по CID; удалённый трек не находится
+func (s *Service) GetMusicByCID(ctx context.Context, cid string) (*model.Music, error) {
+	return visibleMusic(s.pg.GetMusicByCID(ctx, cid))
+}
+
+func visibleMusic(music *model.Music, err error) (*model.Music, error) {
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && music.DeletedAt != nil) {
+		return nil, ErrMusicNotFound
+	}
+	return music, err
+}
+
+// UpdateMusic изменяет метаданные трека по подписанному владельцем сообщению
+// с действием music_update
+func (s *Service) UpdateMusic(ctx context.Context, id int, message, signature string) (*model.Music, error) {
+	msg, signer, err := s.verifyMusicAction(message, signature, model.AuditActionMusicUpdate, id)
+	if err != nil {
+		return nil, err
+	}
+
+	music, err := s.GetMusicByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(music.OwnerAddr, signer) {
+		return nil, ErrNotOwner
+	}
+
+	before := *music
+	if msg.Title != nil {
+		if strings.TrimSpace(*msg.Title) == "" {
+			return nil, &MessageError{Reason: "название не может быть пустым"}
+		}
+		music.Title = *msg.Title
+	}
+	if msg.Artist != nil {
+		music.Artist = *msg.Artist
+	}
+	if msg.Genre != nil {
+		music.Genre = *msg.Genre
+	}
+	if msg.Album != nil {
+		music.Album = *msg.Album
+	}
+	if msg.Tags != nil {
+		music.Tags = *msg.Tags
+	}
+	if msg.CoverCID != nil && *msg.CoverCID != music.CoverCID {
+		// Закрепление заодно проверяет, что обложка доступна в IPFS
+		if *msg.CoverCID != "" {
+			if err := s.sh.Pin(*msg.CoverCID); err != nil {
+				return nil, &MessageError{Reason: "не удалось закрепить обложку в IPFS: " + err.Error()}
+			}
+		}
+		music.CoverCID = *msg.CoverCID
+	}
+
+	details, err := json.Marshal(map[string]interface{}{"before": before, "after": music})
+	if err != nil {
+		return nil, err
+	}
+	err = s.pg.UpdateMusicAudited(ctx, *music, model.AuditEntry{
+		Action:        model.AuditActionMusicUpdate,
+		MusicID:       &id,
+		RecoveredAddr: signer,
+		Message:       message,
+		Signature:     signature,
+		Details:       string(details),
+	})
+	if errors.Is(err, postgres.ErrSignatureReused) {
+		return nil, ErrStaleSignature
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetMusicByID(ctx, id)
+}
+
+// DeleteMusic удаляет трек по подписанному владельцем сообщению с действием music_delete.
+// Трек с передачами владения, распределениями доходов или выплатами скрывается из каталога
+// и поиска, а его история и журнал аудита остаются. Если в сообщении указано unpin, CID
+// также открепляется в IPFS.
+func (s *Service) DeleteMusic(ctx context.Context, id int, message, signature string) error {
+	msg, signer, err := s.verifyMusicAction(message, signature, model.AuditActionMusicDelete, id)
+	if err != nil {
+		return err
+	}
+
+	music, err := s.GetMusicByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(music.OwnerAddr, signer) {
+		return ErrNotOwner
+	}
+
+	details, err := json.Marshal(map[string]interface{}{"before": music, "unpin": msg.Unpin})
+	if err != nil {
+		return err
+	}
+	err = s.pg.DeleteMusicAudited(ctx, id, model.AuditEntry{
+		Action:        model.AuditActionMusicDelete,
+		MusicID:       &id,
+		RecoveredAddr: signer,
+		Message:       message,
+		Signature:     signature,
+		Details:       string(details),
+	})
+	if errors.Is(err, postgres.ErrSignatureReused) {
+		return ErrStaleSignature
+	}
+	if err != nil {
+		return err
+	}
+
+	if msg.Unpin {
+		if err := s.sh.Unpin(music.CID); err != nil {
+			fmt.Printf("Ошибка снятия закрепления %s: %v\n", music.CID, err)
+		}
+	}
+	return nil
+}
+
+// ExportAuditLog выгружает общую цепочку всех записей журнала с результатом проверки
+func (s *Service) ExportAuditLog(ctx context.Context) (*model.AuditExport, error) {
+	entries, err := s.pg.GetAuditLog(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.newAuditExport(model.AuditExport{Chain: audit.ChainGlobal, Entries: entries}), nil
+}
+
+// ExportMusicAudit выгружает цепочку записей журнала по треку с результатом проверки
+func (s *Service) ExportMusicAudit(ctx context.Context, id int) (*model.AuditExport, error) {
+	entries, err := s.pg.GetAuditEntries(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.newAuditExport(model.AuditExport{Chain: audit.ChainMusic, MusicID: &id, Entries: entries}), nil
+}
+
+// ExportAddressAudit выгружает цепочку записей журнала, подписанных адресом, с результатом проверки
+func (s *Service) ExportAddressAudit(ctx context.Context, address string) (*model.AuditExport, error) {
+	entries, err := s.pg.GetAuditEntriesByAddress(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return s.newAuditExport(model.AuditExport{Chain: audit.ChainAddress, Address: strings.ToLower(address), Entries: entries}), nil
+}
+
+func (s *Service) newAuditExport(export model.AuditExport) *model.AuditExport {
+	export.Format = audit.Format
+	if export.Entries == nil {
+		export.Entries = []model.AuditEntry{}
+	}
+	verification := s.VerifyAuditExport(export)
+	export.Verification = &verification
+	return &export
+}
+
+// VerifyAuditExport проверяет ранее сохранённую выгрузку журнала
+func (s *Service) VerifyAuditExport(export model.AuditExport) model.AuditVerification {
+	export.Verification = nil
+	return audit.Verify(export, s.VerifySignature)
+}
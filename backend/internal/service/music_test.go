@@ -0,0 +1,39 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+func TestVisibleMusic(t *testing.T) {
+	deletedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	dbErr := errors.New("соединение закрыто")
+
+	tests := []struct {
+		name    string
+		music   *model.Music
+		err     error
+		wantErr error
+	}{
+		{"трек в каталоге", &model.Music{ID: 1}, nil, nil},
+		{"трек скрыт при удалении", &model.Music{ID: 1, DeletedAt: &deletedAt}, nil, ErrMusicNotFound},
+		{"трека нет", nil, pgx.ErrNoRows, ErrMusicNotFound},
+		{"ошибка базы", nil, dbErr, dbErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := visibleMusic(tt.music, tt.err)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("visibleMusic() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && got != tt.music {
+				t.Errorf("visibleMusic() = %v, want %v", got, tt.music)
+			}
+		})
+	}
+}
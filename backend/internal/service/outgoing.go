@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/chain"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/relayer"
+)
+
+// ListOutgoingTransactions возвращает транзакции, отправленные ключами бэкенда
+func (s *Service) ListOutgoingTransactions(ctx context.Context, filter model.OutgoingTxFilter) ([]model.OutgoingTransaction, error) {
+	return s.pg.ListOutgoingTransactions(ctx, filter)
+}
+
+// SpeedUpTransaction заменяет неподтверждённую транзакцию такой же с большей комиссией
+func (s *Service) SpeedUpTransaction(ctx context.Context, hash string) (*types.Transaction, error) {
+	c, err := s.outgoingChain(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	return s.relayer.SpeedUp(ctx, c, common.HexToHash(hash))
+}
+
+// CancelTransaction отменяет неподтверждённую транзакцию, занимая её nonce пустым переводом
+func (s *Service) CancelTransaction(ctx context.Context, hash string) (*types.Transaction, error) {
+	c, err := s.outgoingChain(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	return s.relayer.Cancel(ctx, c, common.HexToHash(hash))
+}
+
+// outgoingChain находит сеть, в которую отправлена транзакция hash
+func (s *Service) outgoingChain(ctx context.Context, hash string) (*chain.Chain, error) {
+	if s.relayer == nil {
+		return nil, ErrRelayerDisabled
+	}
+	tracked, err := s.pg.GetOutgoingTransaction(ctx, common.HexToHash(hash).Hex())
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, relayer.ErrUnknownTransaction
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.chain(tracked.ChainID)
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/polonkoevv/ethcourse/internal/chain"
+	"github.com/polonkoevv/ethcourse/internal/contract"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/relayer"
+)
+
+// processOwnerPayouts пересылает владельцам доли продаж треков, опубликованных бэкендом.
+// publishAudio записывает владельцем аудио отправителя транзакции, поэтому выплату
+// продавцу по таким трекам контракт переводит ретранслятору.
+func (s *Service) processOwnerPayouts(ctx context.Context) error {
+	for _, c := range s.chains.All() {
+		if !c.HasContract() {
+			continue
+		}
+		payouts, err := s.pg.QueueOwnerPayouts(ctx, c.ID, s.relayer.Address().Hex(), contract.PlatformFeePercent)
+		if err != nil {
+			return err
+		}
+		for _, payout := range payouts {
+			if payout.Status == model.OwnerPayoutPending {
+				err = s.sendOwnerPayout(ctx, c, payout)
+			} else {
+				err = s.checkOwnerPayout(ctx, c, payout)
+			}
+			if err != nil {
+				fmt.Printf("Пересылка %d владельцу %s: %v\n", payout.ID, payout.RecipientAddr, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Service) sendOwnerPayout(ctx context.Context, c *chain.Chain, payout model.OwnerPayout) error {
+	amount, ok := new(big.Int).SetString(payout.AmountWei, 10)
+	if !ok || amount.Sign() <= 0 {
+		return s.pg.SetOwnerPayoutStatus(ctx, payout.ID, model.OwnerPayoutFailed, nil, "некорректная сумма "+payout.AmountWei)
+	}
+	// Ошибка до рассылки оставляет пересылку в очереди: она повторится на следующем проходе
+	tx, err := s.relayer.Send(ctx, c, common.HexToAddress(payout.RecipientAddr), amount, nil, model.TxPurposeOwnerPayout)
+	if err != nil {
+		return err
+	}
+	txHash := tx.Hash().Hex()
+	return s.pg.SetOwnerPayoutStatus(ctx, payout.ID, model.OwnerPayoutSent, &txHash, "")
+}
+
+func (s *Service) checkOwnerPayout(ctx context.Context, c *chain.Chain, payout model.OwnerPayout) error {
+	receipt, err := s.relayer.Receipt(ctx, c, common.HexToHash(*payout.TxHash))
+	switch {
+	case errors.Is(err, ethereum.NotFound):
+		return nil
+	case err == nil:
+		txHash := receipt.TxHash.Hex()
+		return s.pg.SetOwnerPayoutStatus(ctx, payout.ID, model.OwnerPayoutConfirmed, &txHash, "")
+	case errors.Is(err, relayer.ErrTransactionDropped), errors.Is(err, relayer.ErrTransactionReplaced):
+		// ETH не отправлен: пересылка возвращается в очередь
+		return s.pg.SetOwnerPayoutStatus(ctx, payout.ID, model.OwnerPayoutPending, nil, err.Error())
+	case errors.Is(err, relayer.ErrTransactionFailed):
+		return s.pg.SetOwnerPayoutStatus(ctx, payout.ID, model.OwnerPayoutFailed, payout.TxHash, err.Error())
+	}
+	return err
+}
+
+// GetOwnerPayouts возвращает пересылки долей продаж, полученные адресом
+func (s *Service) GetOwnerPayouts(ctx context.Context, recipient string) ([]model.OwnerPayout, error) {
+	return s.pg.GetOwnerPayouts(ctx, recipient)
+}
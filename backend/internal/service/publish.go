@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/polonkoevv/ethcourse/internal/contract"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/relayer"
+)
+
+// Сколько ждать включения транзакции публикации в блок. Если квитанция не дождалась,
+// трек свяжет с публикацией индексатор по хешу транзакции.
+const publishReceiptTimeout = 2 * time.Minute
+
+var (
+	ErrRelayerDisabled  = errors.New("ретранслятор не настроен")
+	ErrNoContract       = errors.New("для сети не указан адрес контракта")
+	ErrAlreadyPublished = errors.New("трек уже опубликован или публикуется")
+)
+
+// PublishError — ошибка отправки или исполнения транзакции публикации
+type PublishError struct {
+	TxHash string
+	Err    error
+}
+
+func (e *PublishError) Error() string {
+	if e.TxHash == "" {
+		return "ошибка публикации в контракт: " + e.Err.Error()
+	}
+	return fmt.Sprintf("ошибка публикации в контракт (транзакция %s): %s", e.TxHash, e.Err)
+}
+
+func (e *PublishError) Unwrap() error {
+	return e.Err
+}
+
+// CanPublish проверяет, что бэкенд может опубликовать трек в сети chainID
+// (0 — сеть по умолчанию)
+func (s *Service) CanPublish(chainID uint64) error {
+	if s.relayer == nil {
+		return ErrRelayerDisabled
+	}
+	c, err := s.chain(chainID)
+	if err != nil {
+		return err
+	}
+	if !c.HasContract() {
+		return ErrNoContract
+	}
+	return nil
+}
+
+// PublishMusic вызывает publishAudio с CID трека от имени ретранслятора, ждёт квитанцию
+// и сохраняет идентификатор аудио в контракте. Владельцем аудио в контракте становится
+// ретранслятор: publishAudio записывает владельцем отправителя транзакции. Долю продавца
+// по каждой покупке ретранслятор пересылает владельцу трека (см. processOwnerPayouts).
+func (s *Service) PublishMusic(ctx context.Context, musicID int, chainID uint64, price *big.Int) (*model.Music, error) {
+	if err := s.CanPublish(chainID); err != nil {
+		return nil, err
+	}
+	c, _ := s.chain(chainID)
+
+	music, err := s.GetMusicByID(ctx, musicID)
+	if err != nil {
+		return nil, err
+	}
+	claimed, err := s.pg.ClaimMusicPublish(ctx, musicID, s.relayer.Address().Hex())
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, ErrAlreadyPublished
+	}
+
+	data, err := contract.PackPublishAudio(music.Title, music.Artist, music.CID, price)
+	if err != nil {
+		return nil, s.failPublish(musicID, "", err)
+	}
+	tx, err := s.relayer.Send(ctx, c, c.Contract, nil, data, model.TxPurposePublish)
+	if err != nil {
+		return nil, s.failPublish(musicID, "", err)
+	}
+	txHash := tx.Hash().Hex()
+	if err := s.pg.SetMusicPublishTx(ctx, musicID, txHash); err != nil {
+		return nil, err
+	}
+	fmt.Printf("Трек %d: отправлена транзакция публикации %s в сеть %d\n", musicID, txHash, c.ID)
+
+	waitCtx, cancel := context.WithTimeout(ctx, publishReceiptTimeout)
+	defer cancel()
+	receipt, err := s.relayer.WaitReceipt(waitCtx, c, tx.Hash())
+	if errors.Is(err, relayer.ErrTransactionFailed) || errors.Is(err, relayer.ErrTransactionReplaced) ||
+		errors.Is(err, relayer.ErrTransactionDropped) {
+		return nil, s.failPublish(musicID, txHash, err)
+	}
+	if err != nil {
+		// Транзакция может быть ещё в пуле: трек остаётся в состоянии pending
+		return nil, &PublishError{TxHash: txHash, Err: err}
+	}
+
+	event, err := contract.FindAudioPublished(receipt, c.Contract)
+	if err != nil {
+		return nil, s.failPublish(musicID, txHash, err)
+	}
+	// Если транзакцию ускорили, в блок попала её замена с другим хешем
+	if err := s.pg.CompleteMusicPublish(ctx, musicID, c.ID, event.ID.Uint64(), event.Price.String(), receipt.TxHash.Hex()); err != nil {
+		return nil, err
+	}
+	fmt.Printf("Трек %d опубликован в сети %d с идентификатором %d\n", musicID, c.ID, event.ID.Uint64())
+
+	return s.GetMusicByID(ctx, musicID)
+}
+
+// failPublish отмечает публикацию неудачной и возвращает PublishError
+func (s *Service) failPublish(musicID int, txHash string, cause error) error {
+	if err := s.pg.FailMusicPublish(context.Background(), musicID); err != nil {
+		fmt.Printf("Ошибка сохранения состояния публикации трека %d: %v\n", musicID, err)
+	}
+	return &PublishError{TxHash: txHash, Err: cause}
+}
@@ -0,0 +1,535 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/chain"
+	"github.com/polonkoevv/ethcourse/internal/contract"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/relayer"
+	"github.com/polonkoevv/ethcourse/internal/storage/postgres"
+)
+
+const (
+	// Пауза между проходами по активным намерениям
+	relayPollInterval = 5 * time.Second
+	// Транзакция, не попавшая в блок за это время, заменяется более дорогой
+	relayResubmitAfter = 2 * time.Minute
+	// Сколько раз отправляется транзакция намерения, включая замены
+	relayMaxAttempts = 5
+	// Наибольший срок действия подписи намерения
+	maxIntentLifetime = 24 * time.Hour
+)
+
+// relayLimits ограничивают намерения одного адреса: газ ретранслятор оплачивает сам
+var relayLimits = model.RelayLimits{MaxActive: 3, MaxPerHour: 20}
+
+var (
+	ErrIntentNotFound  = errors.New("намерение не найдено")
+	ErrIntentNonceUsed = errors.New("nonce намерения уже использован")
+	ErrRelayValueLimit = errors.New("цена аудио превышает сумму, которую оплачивает ретранслятор")
+	ErrRelayLimit      = errors.New("слишком много намерений с этого адреса, повторите позже")
+	// ErrInsufficientDeposit — депозита подписавшего не хватает на оплату покупки
+	ErrInsufficientDeposit = errors.New("депозита не хватает для оплаты покупки, пополните его переводом ETH на адрес ретранслятора")
+	ErrDepositNotFound     = errors.New("транзакция не является переводом ETH на адрес ретранслятора")
+	ErrDepositPending      = errors.New("транзакция депозита ещё не подтверждена")
+)
+
+// RelayTypedData — домен и типы EIP-712, по которым клиент подписывает намерения.
+// PurchaseAccess сообщает клиенту, где фиксируется доступ к аудио, купленному через
+// ретранслятор (model.RelayPurchaseAccessBackend).
+type RelayTypedData struct {
+	Domain         interface{} `json:"domain"`
+	Types          interface{} `json:"types"`
+	Relayer        string      `json:"relayer"`
+	PurchaseAccess string      `json:"purchase_access"`
+}
+
+// RelayTypedData возвращает параметры подписи намерений для сети chainID
+func (s *Service) RelayTypedData(chainID uint64) (*RelayTypedData, error) {
+	if err := s.CanPublish(chainID); err != nil {
+		return nil, err
+	}
+	c, _ := s.chain(chainID)
+	return &RelayTypedData{
+		Domain:         relayer.Domain(c.ID, c.Contract),
+		Types:          relayer.IntentTypes,
+		Relayer:        s.relayer.Address().Hex(),
+		PurchaseAccess: model.RelayPurchaseAccessBackend,
+	}, nil
+}
+
+// SubmitIntent проверяет подписанное намерение и ставит его в очередь ретранслятора.
+// Подписавшему не нужен ETH на газ: газ платит ретранслятор. Цену покупки, которую
+// purchaseAudio переводит продавцу, ретранслятор берёт из депозита покупателя
+// (см. RegisterRelayDeposit); бесплатное аудио депозита не требует. Пополнить депозит
+// может любой аккаунт, поэтому сам покупатель может не держать ETH вовсе.
+//
+// Покупка через ретранслятор — право доступа только в бэкенде: в контракте доступ
+// получает msg.sender, то есть ретранслятор, и вызова в пользу подписавшего намерение
+// у AudioChain нет. Доступ покупателя подтверждает GetMusicAccess (via relay_purchase),
+// а hasAccess контракта для него остаётся false. Число намерений адреса ограничено
+// relayLimits.
+func (s *Service) SubmitIntent(ctx context.Context, req model.RelayIntentRequest) (*model.RelayIntent, error) {
+	if err := s.CanPublish(req.ChainID); err != nil {
+		return nil, err
+	}
+	c, _ := s.chain(req.ChainID)
+	msg := req.Message
+
+	var primaryType, claimed string
+	var fields map[string]interface{}
+	switch req.Type {
+	case model.RelayIntentPurchase:
+		primaryType, claimed = relayer.PurchaseIntentType, msg.Buyer
+		fields = map[string]interface{}{
+			"buyer":    msg.Buyer,
+			"audioId":  msg.AudioID,
+			"maxPrice": msg.MaxPrice,
+			"nonce":    msg.Nonce,
+			"deadline": msg.Deadline,
+		}
+	case model.RelayIntentPublish:
+		primaryType, claimed = relayer.PublishIntentType, msg.Owner
+		fields = map[string]interface{}{
+			"owner":    msg.Owner,
+			"cid":      msg.CID,
+			"title":    msg.Title,
+			"artist":   msg.Artist,
+			"price":    msg.Price,
+			"nonce":    msg.Nonce,
+			"deadline": msg.Deadline,
+		}
+	default:
+		return nil, &MessageError{Reason: "неизвестный тип намерения " + req.Type}
+	}
+
+	nonce, ok := new(big.Int).SetString(msg.Nonce, 10)
+	if !ok || nonce.Sign() < 0 {
+		return nil, &MessageError{Reason: "некорректный nonce"}
+	}
+	deadlineUnix, err := strconv.ParseInt(msg.Deadline, 10, 64)
+	if err != nil {
+		return nil, &MessageError{Reason: "некорректный deadline"}
+	}
+	deadline := time.Unix(deadlineUnix, 0)
+	if !deadline.After(time.Now()) {
+		return nil, ErrStaleSignature
+	}
+	if deadline.After(time.Now().Add(maxIntentLifetime)) {
+		return nil, &MessageError{Reason: "срок действия намерения больше суток"}
+	}
+
+	signer, err := relayer.RecoverIntentSigner(c.ID, c.Contract, primaryType, fields, req.Signature)
+	if errors.Is(err, relayer.ErrInvalidSignature) {
+		return nil, ErrInvalidSignature
+	}
+	if err != nil {
+		return nil, &MessageError{Reason: err.Error()}
+	}
+	if !strings.EqualFold(signer.Hex(), claimed) {
+		return nil, ErrInvalidSignature
+	}
+
+	message, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	intent := model.RelayIntent{
+		ChainID:    c.ID,
+		Type:       req.Type,
+		SignerAddr: signer.Hex(),
+		Nonce:      nonce.String(),
+		Deadline:   deadline,
+		Message:    string(message),
+		Signature:  req.Signature,
+	}
+
+	switch req.Type {
+	case model.RelayIntentPurchase:
+		err = s.validatePurchaseIntent(ctx, c, msg, &intent)
+	case model.RelayIntentPublish:
+		err = s.validatePublishIntent(ctx, msg, signer, &intent)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := s.pg.CreateRelayIntent(ctx, intent, s.relayer.Address().Hex(), relayLimits)
+	if errors.Is(err, postgres.ErrIntentNonceUsed) {
+		return nil, ErrIntentNonceUsed
+	}
+	if errors.Is(err, postgres.ErrRelayLimit) {
+		return nil, ErrRelayLimit
+	}
+	if errors.Is(err, postgres.ErrInsufficientDeposit) {
+		return nil, ErrInsufficientDeposit
+	}
+	if errors.Is(err, postgres.ErrMusicNotPublishable) {
+		return nil, ErrAlreadyPublished
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetIntent(ctx, id)
+}
+
+// validatePurchaseIntent сверяет покупку с состоянием аудио в контракте и лимитом оплаты;
+// депозит покупателя проверяется при сохранении намерения
+func (s *Service) validatePurchaseIntent(ctx context.Context, c *chain.Chain, msg model.RelayIntentMessage, intent *model.RelayIntent) error {
+	audioID, err := strconv.ParseUint(msg.AudioID, 10, 64)
+	if err != nil || audioID == 0 {
+		return &MessageError{Reason: "некорректный audioId"}
+	}
+	maxPrice, ok := new(big.Int).SetString(msg.MaxPrice, 10)
+	if !ok || maxPrice.Sign() < 0 {
+		return &MessageError{Reason: "некорректный maxPrice"}
+	}
+
+	audio, err := s.onChainAudio(ctx, c, audioID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case audio.ID.Sign() == 0:
+		return &MessageError{Reason: fmt.Sprintf("аудио %d не найдено в контракте", audioID)}
+	case !audio.IsForSale:
+		return &MessageError{Reason: "аудио не продаётся"}
+	case audio.Owner == s.relayer.Address():
+		// purchaseAudio запрещает владельцу покупать своё аудио
+		return &MessageError{Reason: "аудио опубликовано ретранслятором и не может быть куплено через него"}
+	case audio.Price.Cmp(maxPrice) > 0:
+		return &MessageError{Reason: fmt.Sprintf("цена аудио %s wei выше maxPrice", audio.Price)}
+	case s.relayer.MaxValue == nil || audio.Price.Cmp(s.relayer.MaxValue) > 0:
+		return ErrRelayValueLimit
+	}
+
+	intent.AudioID = &audioID
+	intent.ValueWei = audio.Price.String()
+	return nil
+}
+
+// validatePublishIntent проверяет, что публикуемый CID — трек каталога подписавшего
+func (s *Service) validatePublishIntent(ctx context.Context, msg model.RelayIntentMessage, signer common.Address, intent *model.RelayIntent) error {
+	price, ok := new(big.Int).SetString(msg.Price, 10)
+	if !ok || price.Sign() < 0 {
+		return &MessageError{Reason: "некорректная цена"}
+	}
+	if strings.TrimSpace(msg.Title) == "" {
+		return &MessageError{Reason: "название не может быть пустым"}
+	}
+
+	music, err := s.GetMusicByCID(ctx, msg.CID)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(music.OwnerAddr, signer.Hex()) {
+		return ErrNotOwner
+	}
+	if music.AudioID != nil {
+		return ErrAlreadyPublished
+	}
+
+	intent.MusicID = &music.ID
+	intent.ValueWei = "0"
+	return nil
+}
+
+// RegisterRelayDeposit засчитывает подтверждённый перевод ETH на адрес ретранслятора
+// как депозит и возвращает баланс получателя депозита. Получатель — адрес из данных
+// перевода (20 байт или слово ABI с адресом), а без данных — отправитель. Адрес
+// выбирает тот, кто подписал перевод, поэтому отдельная подпись запроса не нужна,
+// а пополнить депозит слушателя без ETH может кто угодно.
+func (s *Service) RegisterRelayDeposit(ctx context.Context, chainID uint64, txHash string) (*model.RelayBalance, error) {
+	if err := s.CanPublish(chainID); err != nil {
+		return nil, err
+	}
+	c, _ := s.chain(chainID)
+	if len(common.FromHex(txHash)) != common.HashLength {
+		return nil, &MessageError{Reason: "некорректный хеш транзакции"}
+	}
+	hash := common.HexToHash(txHash)
+
+	tx, pending, err := c.Client.TransactionByHash(ctx, hash)
+	if errors.Is(err, ethereum.NotFound) {
+		return nil, ErrDepositNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения транзакции %s: %w", hash.Hex(), err)
+	}
+	if pending {
+		return nil, ErrDepositPending
+	}
+	if tx.To() == nil || *tx.To() != s.relayer.Address() || tx.Value().Sign() <= 0 {
+		return nil, ErrDepositNotFound
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(new(big.Int).SetUint64(c.ID)), tx)
+	if err != nil {
+		return nil, &MessageError{Reason: "не удалось определить отправителя: " + err.Error()}
+	}
+	beneficiary, ok := depositBeneficiary(tx.Data(), from)
+	if !ok {
+		return nil, &MessageError{Reason: "данные перевода должны быть пустыми или содержать адрес получателя депозита"}
+	}
+
+	receipt, err := c.Client.TransactionReceipt(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения квитанции %s: %w", hash.Hex(), err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return nil, ErrDepositNotFound
+	}
+	head, err := c.Client.BlockNumber(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения номера блока: %w", err)
+	}
+	if receipt.BlockNumber.Uint64()+c.Confirmations > head {
+		return nil, ErrDepositPending
+	}
+
+	err = s.pg.SaveRelayDeposit(ctx, model.RelayDeposit{
+		ChainID:       c.ID,
+		TxHash:        hash.Hex(),
+		DepositorAddr: beneficiary.Hex(),
+		FunderAddr:    from.Hex(),
+		RelayerAddr:   s.relayer.Address().Hex(),
+		AmountWei:     tx.Value().String(),
+		BlockNumber:   receipt.BlockNumber.Uint64(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.pg.GetRelayBalance(ctx, c.ID, beneficiary.Hex())
+}
+
+// depositBeneficiary возвращает адрес, которому засчитывается перевод с данными data
+// от from: адрес из данных (20 байт или слово ABI с нулями слева) или сам from
+func depositBeneficiary(data []byte, from common.Address) (common.Address, bool) {
+	switch {
+	case len(data) == 0:
+		return from, true
+	case len(data) == common.AddressLength:
+		return common.BytesToAddress(data), true
+	case len(data) == 32 && new(big.Int).SetBytes(data[:32-common.AddressLength]).Sign() == 0:
+		return common.BytesToAddress(data), true
+	}
+	return common.Address{}, false
+}
+
+// GetRelayBalance возвращает депозит адреса у ретранслятора сети
+func (s *Service) GetRelayBalance(ctx context.Context, chainID uint64, address string) (*model.RelayBalance, error) {
+	if err := s.CanPublish(chainID); err != nil {
+		return nil, err
+	}
+	c, _ := s.chain(chainID)
+	return s.pg.GetRelayBalance(ctx, c.ID, common.HexToAddress(address).Hex())
+}
+
+// onChainAudio читает запись аудио из контракта сети
+func (s *Service) onChainAudio(ctx context.Context, c *chain.Chain, audioID uint64) (*contract.Audio, error) {
+	data, err := contract.PackGetAudio(new(big.Int).SetUint64(audioID))
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.Client.CallContract(ctx, ethereum.CallMsg{To: &c.Contract, Data: data}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения аудио %d из контракта: %w", audioID, err)
+	}
+	return contract.UnpackAudio(result)
+}
+
+// GetIntent возвращает намерение по идентификатору
+func (s *Service) GetIntent(ctx context.Context, id int) (*model.RelayIntent, error) {
+	intent, err := s.pg.GetRelayIntent(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrIntentNotFound
+	}
+	return intent, err
+}
+
+// GetIntentsBySigner возвращает намерения, подписанные адресом
+func (s *Service) GetIntentsBySigner(ctx context.Context, signer string) ([]model.RelayIntent, error) {
+	return s.pg.GetRelayIntentsBySigner(ctx, signer)
+}
+
+// RunRelayer отправляет принятые намерения и следит за их транзакциями, а также
+// пересылает владельцам доли продаж треков, опубликованных бэкендом, до отмены
+// контекста. Без настроенного ретранслятора сразу возвращается.
+func (s *Service) RunRelayer(ctx context.Context) {
+	if s.relayer == nil {
+		return
+	}
+	ticker := time.NewTicker(relayPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.processIntents(ctx); err != nil {
+			fmt.Printf("Ошибка обработки намерений: %v\n", err)
+		}
+		if err := s.processOwnerPayouts(ctx); err != nil {
+			fmt.Printf("Ошибка пересылки долей продаж владельцам: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processIntents проходит по активным намерениям в порядке поступления; ошибка одного
+// намерения не останавливает обработку остальных
+func (s *Service) processIntents(ctx context.Context) error {
+	intents, err := s.pg.GetActiveRelayIntents(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, intent := range intents {
+		c, err := s.chain(intent.ChainID)
+		if err != nil {
+			err = s.pg.FinishRelayIntent(ctx, intent, model.RelayStatusFailed, err.Error())
+		} else if intent.Status == model.RelayStatusPending {
+			err = s.sendIntent(ctx, c, intent)
+		} else {
+			err = s.checkIntent(ctx, c, intent)
+		}
+		if err != nil {
+			fmt.Printf("Намерение %d: %v\n", intent.ID, err)
+		}
+	}
+	return nil
+}
+
+// intentCall восстанавливает вызов контракта из подписанных полей намерения
+func intentCall(intent model.RelayIntent) (data []byte, value *big.Int, err error) {
+	var msg model.RelayIntentMessage
+	if err := json.Unmarshal([]byte(intent.Message), &msg); err != nil {
+		return nil, nil, err
+	}
+	value, ok := new(big.Int).SetString(intent.ValueWei, 10)
+	if !ok {
+		return nil, nil, fmt.Errorf("некорректная сумма %s", intent.ValueWei)
+	}
+
+	switch intent.Type {
+	case model.RelayIntentPurchase:
+		data, err = contract.PackPurchaseAudio(new(big.Int).SetUint64(*intent.AudioID))
+	case model.RelayIntentPublish:
+		price, _ := new(big.Int).SetString(msg.Price, 10)
+		data, err = contract.PackPublishAudio(msg.Title, msg.Artist, msg.CID, price)
+	default:
+		err = fmt.Errorf("неизвестный тип намерения %s", intent.Type)
+	}
+	return data, value, err
+}
+
+// sendIntent отправляет первую транзакцию намерения. Вызов, который откатится,
+// завершает намерение; сетевые ошибки повторяются на следующем проходе.
+func (s *Service) sendIntent(ctx context.Context, c *chain.Chain, intent model.RelayIntent) error {
+	if time.Now().After(intent.Deadline) {
+		return s.pg.FinishRelayIntent(ctx, intent, model.RelayStatusExpired, "срок действия подписи истёк до отправки")
+	}
+
+	data, value, err := intentCall(intent)
+	if err != nil {
+		return s.pg.FinishRelayIntent(ctx, intent, model.RelayStatusFailed, err.Error())
+	}
+	purpose := model.TxPurposeRelayPurchase
+	if intent.Type == model.RelayIntentPublish {
+		purpose = model.TxPurposeRelayPublish
+	}
+	tx, err := s.relayer.Send(ctx, c, c.Contract, value, data, purpose)
+	if errors.Is(err, relayer.ErrExecutionReverted) {
+		return s.pg.FinishRelayIntent(ctx, intent, model.RelayStatusFailed, err.Error())
+	}
+	if err != nil {
+		if saveErr := s.pg.SetRelayIntentError(ctx, intent.ID, err.Error()); saveErr != nil {
+			return saveErr
+		}
+		return err
+	}
+
+	fmt.Printf("Намерение %d: отправлена транзакция %s в сеть %d\n", intent.ID, tx.Hash().Hex(), c.ID)
+	return s.pg.SaveRelayIntentTx(ctx, intent.ID, tx.Hash().Hex())
+}
+
+// checkIntent проверяет транзакцию намерения с учётом её замен. Если она не попала
+// в блок за relayResubmitAfter, она ускоряется; отклонённая узлами транзакция
+// отправляется заново с новым nonce, а занятый другой транзакцией nonce завершает
+// намерение.
+func (s *Service) checkIntent(ctx context.Context, c *chain.Chain, intent model.RelayIntent) error {
+	if intent.TxHash == nil {
+		return s.pg.RequeueRelayIntent(ctx, intent.ID, "нет отправленной транзакции")
+	}
+	hash := common.HexToHash(*intent.TxHash)
+
+	receipt, err := s.relayer.Receipt(ctx, c, hash)
+	switch {
+	case err == nil, errors.Is(err, relayer.ErrTransactionFailed):
+		return s.completeIntent(ctx, c, intent, receipt)
+	case errors.Is(err, relayer.ErrTransactionReplaced):
+		return s.pg.FinishRelayIntent(ctx, intent, model.RelayStatusFailed, "транзакция отменена или заменена другой")
+	case errors.Is(err, relayer.ErrTransactionDropped):
+		return s.pg.RequeueRelayIntent(ctx, intent.ID, err.Error())
+	case !errors.Is(err, ethereum.NotFound):
+		return err
+	}
+
+	if intent.SubmittedAt == nil || time.Since(*intent.SubmittedAt) < relayResubmitAfter || intent.Attempts >= relayMaxAttempts {
+		return nil
+	}
+	tx, err := s.relayer.SpeedUp(ctx, c, hash)
+	if errors.Is(err, relayer.ErrNotPending) {
+		// Транзакция уже в блоке или заменена: итог найдётся на следующем проходе
+		return nil
+	}
+	if err != nil {
+		if saveErr := s.pg.SetRelayIntentError(ctx, intent.ID, err.Error()); saveErr != nil {
+			return saveErr
+		}
+		return err
+	}
+
+	fmt.Printf("Намерение %d: транзакция %s ускорена заменой %s\n", intent.ID, hash.Hex(), tx.Hash().Hex())
+	return s.pg.SaveRelayIntentTx(ctx, intent.ID, tx.Hash().Hex())
+}
+
+// completeIntent завершает намерение по квитанции его транзакции
+func (s *Service) completeIntent(ctx context.Context, c *chain.Chain, intent model.RelayIntent, receipt *types.Receipt) error {
+	txHash := receipt.TxHash.Hex()
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return s.pg.FinishRelayIntent(ctx, intent, model.RelayStatusFailed,
+			fmt.Sprintf("%s: %s", relayer.ErrTransactionFailed, txHash))
+	}
+
+	var audioID uint64
+	var priceWei string
+	switch intent.Type {
+	case model.RelayIntentPurchase:
+		audioID = *intent.AudioID
+	case model.RelayIntentPublish:
+		event, err := contract.FindAudioPublished(receipt, c.Contract)
+		if err != nil {
+			return s.pg.FinishRelayIntent(ctx, intent, model.RelayStatusFailed, err.Error())
+		}
+		audioID, priceWei = event.ID.Uint64(), event.Price.String()
+	}
+
+	if err := s.pg.ConfirmRelayIntent(ctx, intent, txHash, receipt.BlockNumber.Uint64(), audioID, priceWei); err != nil {
+		return err
+	}
+	fmt.Printf("Намерение %d исполнено транзакцией %s в блоке %d\n", intent.ID, txHash, receipt.BlockNumber.Uint64())
+	return nil
+}
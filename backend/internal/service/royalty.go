@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/contract"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/storage/postgres"
+)
+
+// Максимальное количество участников распределения
+const maxSplitShares = 20
+
+var (
+	ErrSplitNotFound   = errors.New("распределение не найдено")
+	ErrShareNotPending = errors.New("доля уже подписана или адрес не участвует в распределении")
+)
+
+// Распределение доходов создаётся владельцем трека сообщением
+// {"action":"split_propose","musicId":1,"shares":[{"address":"0x...","bps":6000,"role":"producer"},...],...}
+// и вступает в силу, когда каждый участник подпишет
+// {"action":"split_approve","musicId":1,"splitId":3,...}. Доли задаются в базисных пунктах
+// и в сумме должны составлять 10000 (100%). Распределение — внутренний учёт: контракт
+// по-прежнему переводит выплату продавцу, который рассчитывается с участниками.
+
+// ProposeSplit создаёт распределение доходов трека по подписанному владельцем сообщению
+func (s *Service) ProposeSplit(ctx context.Context, musicID int, message, signature string) (*model.RoyaltySplit, error) {
+	msg, signer, err := s.verifyMusicAction(message, signature, model.AuditActionSplitPropose, musicID)
+	if err != nil {
+		return nil, err
+	}
+
+	music, err := s.GetMusicByID(ctx, musicID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(music.OwnerAddr, signer) {
+		return nil, ErrNotOwner
+	}
+
+	shares, err := validateSplitShares(msg.Shares)
+	if err != nil {
+		return nil, err
+	}
+	// Подпись предложения одновременно подтверждает долю предложившего
+	now := time.Now()
+	for i := range shares {
+		if strings.EqualFold(shares[i].Address, signer) {
+			shares[i].ApprovalMessage = message
+			shares[i].ApprovalSignature = signature
+			shares[i].ApprovedAt = &now
+		}
+	}
+
+	details, err := json.Marshal(map[string]interface{}{"shares": shares})
+	if err != nil {
+		return nil, err
+	}
+	id, err := s.pg.CreateSplit(ctx, model.RoyaltySplit{
+		MusicID:           musicID,
+		ProposerAddr:      signer,
+		ProposalMessage:   message,
+		ProposalSignature: signature,
+		Shares:            shares,
+	}, model.AuditEntry{
+		Action:        model.AuditActionSplitPropose,
+		MusicID:       &musicID,
+		RecoveredAddr: signer,
+		Message:       message,
+		Signature:     signature,
+		Details:       string(details),
+	})
+	if errors.Is(err, postgres.ErrSignatureReused) {
+		return nil, ErrStaleSignature
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.pg.GetSplit(ctx, id)
+}
+
+// validateSplitShares проверяет адреса и доли и приводит адреса к виду с контрольной суммой
+func validateSplitShares(input []splitShareMessage) ([]model.RoyaltyShare, error) {
+	if len(input) == 0 {
+		return nil, &MessageError{Reason: "не указаны доли участников"}
+	}
+	if len(input) > maxSplitShares {
+		return nil, &MessageError{Reason: fmt.Sprintf("участников не может быть больше %d", maxSplitShares)}
+	}
+
+	seen := make(map[common.Address]bool)
+	var total int
+	shares := make([]model.RoyaltyShare, 0, len(input))
+	for _, sh := range input {
+		if !common.IsHexAddress(sh.Address) {
+			return nil, &MessageError{Reason: "некорректный адрес участника: " + sh.Address}
+		}
+		addr := common.HexToAddress(sh.Address)
+		if seen[addr] {
+			return nil, &MessageError{Reason: "адрес указан дважды: " + addr.Hex()}
+		}
+		seen[addr] = true
+		if sh.BPS <= 0 || sh.BPS > model.TotalBasisPoints {
+			return nil, &MessageError{Reason: fmt.Sprintf("доля %s должна быть от 1 до %d б.п.", addr.Hex(), model.TotalBasisPoints)}
+		}
+		total += sh.BPS
+		shares = append(shares, model.RoyaltyShare{Address: addr.Hex(), BPS: sh.BPS, Role: sh.Role})
+	}
+	if total != model.TotalBasisPoints {
+		return nil, &MessageError{Reason: fmt.Sprintf("сумма долей %d б.п., должна быть %d (100%%)", total, model.TotalBasisPoints)}
+	}
+	return shares, nil
+}
+
+// ApproveSplit записывает подпись участника под распределением
+func (s *Service) ApproveSplit(ctx context.Context, splitID int, message, signature string) (*model.RoyaltySplit, error) {
+	split, err := s.pg.GetSplit(ctx, splitID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSplitNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	msg, signer, err := s.verifyMusicAction(message, signature, model.AuditActionSplitApprove, split.MusicID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.SplitID != splitID {
+		return nil, &MessageError{Reason: "сообщение подписано для другого распределения"}
+	}
+
+	details, err := json.Marshal(map[string]interface{}{"split_id": splitID})
+	if err != nil {
+		return nil, err
+	}
+	err = s.pg.ApproveSplitShare(ctx, splitID, signer, message, signature, model.AuditEntry{
+		Action:        model.AuditActionSplitApprove,
+		MusicID:       &split.MusicID,
+		RecoveredAddr: signer,
+		Message:       message,
+		Signature:     signature,
+		Details:       string(details),
+	})
+	if errors.Is(err, postgres.ErrShareNotPending) {
+		return nil, ErrShareNotPending
+	}
+	if errors.Is(err, postgres.ErrSignatureReused) {
+		return nil, ErrStaleSignature
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.pg.GetSplit(ctx, splitID)
+}
+
+// GetMusicSplits возвращает все распределения трека
+func (s *Service) GetMusicSplits(ctx context.Context, musicID int) ([]model.RoyaltySplit, error) {
+	return s.pg.GetSplitsByMusic(ctx, musicID)
+}
+
+// GetMusicRoyalties рассчитывает, как каждая проиндексированная покупка трека делится
+// между участниками
+func (s *Service) GetMusicRoyalties(ctx context.Context, musicID int) ([]model.RoyaltyPayout, error) {
+	purchases, err := s.pg.GetPurchasesByMusic(ctx, musicID)
+	if err != nil {
+		return nil, err
+	}
+	splits, err := s.pg.GetSplitsByMusic(ctx, musicID)
+	if err != nil {
+		return nil, err
+	}
+	music, err := s.GetMusicByID(ctx, musicID)
+	if err != nil {
+		return nil, err
+	}
+	// Продавец трека, опубликованного бэкендом, — ретранслятор; доход он пересылает
+	// владельцу (owner_payouts), поэтому распределяется как доход владельца
+	owner := ""
+	if music.PublisherAddr != nil {
+		owner = music.OwnerAddr
+	}
+	return distributePurchases(musicID, owner, purchases, splits)
+}
+
+// GetPayeeRoyalties возвращает выплаты, причитающиеся адресу, по всем трекам
+func (s *Service) GetPayeeRoyalties(ctx context.Context, payee string) ([]model.RoyaltyPayout, error) {
+	musicIDs, err := s.pg.GetPayeeMusicIDs(ctx, payee)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []model.RoyaltyPayout
+	for _, id := range musicIDs {
+		payouts, err := s.GetMusicRoyalties(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range payouts {
+			if strings.EqualFold(p.Payee, payee) {
+				result = append(result, p)
+			}
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].BlockNumber != result[j].BlockNumber {
+			return result[i].BlockNumber < result[j].BlockNumber
+		}
+		return result[i].LogIndex < result[j].LogIndex
+	})
+	return result, nil
+}
+
+// distributePurchases делит выплату продавцу по распределению, действовавшему в момент
+// покупки. Доли округляются вниз, остаток от округления достаётся наибольшей доле.
+// Без распределения выплата причитается owner, а если он пуст — продавцу из события.
+func distributePurchases(musicID int, owner string, purchases []model.AudioPurchasedEvent, splits []model.RoyaltySplit) ([]model.RoyaltyPayout, error) {
+	var active []model.RoyaltySplit
+	for _, split := range splits {
+		if split.ActivatedAt != nil {
+			active = append(active, split)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].ActivatedAt.Before(*active[j].ActivatedAt) })
+
+	var payouts []model.RoyaltyPayout
+	for _, purchase := range purchases {
+		amount, ok := new(big.Int).SetString(purchase.AmountWei, 10)
+		if !ok {
+			return nil, fmt.Errorf("некорректная сумма покупки %s: %s", purchase.TxHash, purchase.AmountWei)
+		}
+		fee, net := contract.SplitPayment(amount)
+
+		base := model.RoyaltyPayout{
+			ChainID:        purchase.ChainID,
+			TxHash:         purchase.TxHash,
+			LogIndex:       purchase.LogIndex,
+			BlockNumber:    purchase.BlockNumber,
+			BlockTime:      purchase.BlockTime,
+			MusicID:        musicID,
+			AudioID:        purchase.AudioID,
+			BuyerAddr:      purchase.BuyerAddr,
+			AmountWei:      amount.String(),
+			PlatformFeeWei: fee.String(),
+			NetWei:         net.String(),
+		}
+
+		var split *model.RoyaltySplit
+		for i := range active {
+			if !active[i].ActivatedAt.After(purchase.BlockTime) {
+				split = &active[i]
+			}
+		}
+		if split == nil {
+			p := base
+			p.Payee, p.Role, p.BPS, p.ShareWei = purchase.SellerAddr, "owner", model.TotalBasisPoints, net.String()
+			if owner != "" {
+				p.Payee = owner
+			}
+			payouts = append(payouts, p)
+			continue
+		}
+
+		shares := make([]*big.Int, len(split.Shares))
+		distributed := new(big.Int)
+		largest := 0
+		for i, sh := range split.Shares {
+			shares[i] = new(big.Int).Mul(net, big.NewInt(int64(sh.BPS)))
+			shares[i].Quo(shares[i], big.NewInt(model.TotalBasisPoints))
+			distributed.Add(distributed, shares[i])
+			if sh.BPS > split.Shares[largest].BPS {
+				largest = i
+			}
+		}
+		shares[largest].Add(shares[largest], new(big.Int).Sub(net, distributed))
+
+		for i, sh := range split.Shares {
+			p := base
+			p.SplitID = &split.ID
+			p.Payee, p.Role, p.BPS, p.ShareWei = sh.Address, sh.Role, sh.BPS, shares[i].String()
+			payouts = append(payouts, p)
+		}
+	}
+	return payouts, nil
+}
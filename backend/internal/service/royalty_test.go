@@ -0,0 +1,180 @@
+package service
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+const (
+	testSeller   = "0x5B38Da6a701c568545dCfcB03FcB875f56beddC4"
+	testOwner    = "0xAb8483F64d9C6d1EcF9b849Ae677dD3315835cb2"
+	testVocalist = "0x4B20993Bc481177ec7E8f571ceCaE8A9e22C02db"
+	testLabel    = "0x78731D3Ca6b7E34aC0F824c42a7cC18A495cabaB"
+)
+
+// payoutShare — поля выплаты, которые задаёт распределение
+type payoutShare struct {
+	TxHash   string
+	SplitID  int
+	Payee    string
+	Role     string
+	BPS      int
+	ShareWei string
+}
+
+func testPurchase(txHash, amount string, at time.Time) model.AudioPurchasedEvent {
+	return model.AudioPurchasedEvent{
+		ChainID:    1337,
+		AudioID:    3,
+		BuyerAddr:  testLabel,
+		SellerAddr: testSeller,
+		AmountWei:  amount,
+		BlockTime:  at,
+		TxHash:     txHash,
+	}
+}
+
+func testSplit(id int, activatedAt *time.Time, shares ...model.RoyaltyShare) model.RoyaltySplit {
+	return model.RoyaltySplit{ID: id, MusicID: 1, ActivatedAt: activatedAt, Shares: shares}
+}
+
+func parseWei(t *testing.T, s string) *big.Int {
+	t.Helper()
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		t.Fatalf("некорректная сумма %q", s)
+	}
+	return v
+}
+
+func TestDistributePurchases(t *testing.T) {
+	day1 := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	day3 := day2.Add(24 * time.Hour)
+
+	halves := testSplit(1, &day2,
+		model.RoyaltyShare{Address: testOwner, BPS: 5000, Role: "producer"},
+		model.RoyaltyShare{Address: testVocalist, BPS: 5000, Role: "vocalist"},
+	)
+	thirds := testSplit(2, &day3,
+		model.RoyaltyShare{Address: testOwner, BPS: 3333, Role: "producer"},
+		model.RoyaltyShare{Address: testVocalist, BPS: 3334, Role: "vocalist"},
+		model.RoyaltyShare{Address: testLabel, BPS: 3333, Role: "label"},
+	)
+	pending := testSplit(3, nil, model.RoyaltyShare{Address: testLabel, BPS: 10000, Role: "label"})
+
+	tests := []struct {
+		name      string
+		owner     string
+		purchases []model.AudioPurchasedEvent
+		splits    []model.RoyaltySplit
+		want      []payoutShare
+		wantErr   bool
+	}{
+		{
+			name:      "без распределения выплата владельцу",
+			owner:     testOwner,
+			purchases: []model.AudioPurchasedEvent{testPurchase("0x01", "1000", day1)},
+			want:      []payoutShare{{"0x01", 0, testOwner, "owner", 10000, "900"}},
+		},
+		{
+			name:      "без владельца выплата продавцу из события",
+			purchases: []model.AudioPurchasedEvent{testPurchase("0x01", "1000", day1)},
+			want:      []payoutShare{{"0x01", 0, testSeller, "owner", 10000, "900"}},
+		},
+		{
+			name:      "покупка до активации распределения",
+			owner:     testOwner,
+			purchases: []model.AudioPurchasedEvent{testPurchase("0x01", "1000", day1)},
+			splits:    []model.RoyaltySplit{halves},
+			want:      []payoutShare{{"0x01", 0, testOwner, "owner", 10000, "900"}},
+		},
+		{
+			name:      "покупка в момент активации",
+			owner:     testOwner,
+			purchases: []model.AudioPurchasedEvent{testPurchase("0x01", "1000", day2)},
+			splits:    []model.RoyaltySplit{halves},
+			want: []payoutShare{
+				{"0x01", 1, testOwner, "producer", 5000, "450"},
+				{"0x01", 1, testVocalist, "vocalist", 5000, "450"},
+			},
+		},
+		{
+			name:  "каждая покупка по своему распределению",
+			owner: testOwner,
+			purchases: []model.AudioPurchasedEvent{
+				testPurchase("0x01", "1000", day1),
+				testPurchase("0x02", "1000", day2.Add(time.Hour)),
+				testPurchase("0x03", "1000", day3.Add(time.Hour)),
+			},
+			splits: []model.RoyaltySplit{thirds, halves, pending},
+			want: []payoutShare{
+				{"0x01", 0, testOwner, "owner", 10000, "900"},
+				{"0x02", 1, testOwner, "producer", 5000, "450"},
+				{"0x02", 1, testVocalist, "vocalist", 5000, "450"},
+				{"0x03", 2, testOwner, "producer", 3333, "299"},
+				{"0x03", 2, testVocalist, "vocalist", 3334, "302"},
+				{"0x03", 2, testLabel, "label", 3333, "299"},
+			},
+		},
+		{
+			name:      "неактивное распределение не учитывается",
+			owner:     testOwner,
+			purchases: []model.AudioPurchasedEvent{testPurchase("0x01", "1000", day3)},
+			splits:    []model.RoyaltySplit{pending},
+			want:      []payoutShare{{"0x01", 0, testOwner, "owner", 10000, "900"}},
+		},
+		{
+			name:      "остаток при равных долях достаётся первой",
+			owner:     testOwner,
+			purchases: []model.AudioPurchasedEvent{testPurchase("0x01", "12", day2)},
+			splits:    []model.RoyaltySplit{halves},
+			want: []payoutShare{
+				{"0x01", 1, testOwner, "producer", 5000, "6"},
+				{"0x01", 1, testVocalist, "vocalist", 5000, "5"},
+			},
+		},
+		{
+			name:      "некорректная сумма покупки",
+			purchases: []model.AudioPurchasedEvent{testPurchase("0x01", "1e18", day1)},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payouts, err := distributePurchases(1, tt.owner, tt.purchases, tt.splits)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("distributePurchases() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var got []payoutShare
+			distributed, net := map[string]*big.Int{}, map[string]*big.Int{}
+			for _, p := range payouts {
+				s := payoutShare{TxHash: p.TxHash, Payee: p.Payee, Role: p.Role, BPS: p.BPS, ShareWei: p.ShareWei}
+				if p.SplitID != nil {
+					s.SplitID = *p.SplitID
+				}
+				got = append(got, s)
+
+				if distributed[p.TxHash] == nil {
+					distributed[p.TxHash] = new(big.Int)
+				}
+				distributed[p.TxHash].Add(distributed[p.TxHash], parseWei(t, p.ShareWei))
+				net[p.TxHash] = parseWei(t, p.NetWei)
+			}
+			for tx, sum := range distributed {
+				if sum.Cmp(net[tx]) != 0 {
+					t.Errorf("покупка %s: распределено %s из %s", tx, sum, net[tx])
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("distributePurchases() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
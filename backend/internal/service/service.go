@@ -3,224 +3,236 @@ package service
 import (
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"math/big"
+	"io"
 	"os"
-	"strconv"
 	"strings"
-	"time"
 
-	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 	shell "github.com/ipfs/go-ipfs-api"
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/analysis"
+	"github.com/polonkoevv/ethcourse/internal/chain"
 	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/relayer"
 	"github.com/polonkoevv/ethcourse/internal/storage/postgres"
+	"github.com/polonkoevv/ethcourse/internal/stream"
 )
 
+// CIDConflictError возвращается, если те же байты уже загружены другим кошельком
+type CIDConflictError struct {
+	Original *model.Music
+}
+
+func (e *CIDConflictError) Error() string {
+	return fmt.Sprintf("файл %s уже загружен владельцем %s", e.Original.CID, e.Original.OwnerAddr)
+}
+
 type Service struct {
-	sh *shell.Shell
-	pg *postgres.Postgres
+	sh              *shell.Shell
+	pg              *postgres.Postgres
+	duplicatePolicy DuplicatePolicy
+	chains          *chain.Registry
+	events          *stream.Hub
+	relayer         *relayer.Relayer // nil — публикация бэкендом отключена
+
+	// Изображение для метаданных токенов треков без обложки (URI, например ipfs://<CID>)
+	DefaultCoverImage string
 }
 
-func NewService(sh *shell.Shell, pg *postgres.Postgres) *Service {
-	return &Service{sh: sh, pg: pg}
+func NewService(sh *shell.Shell, pg *postgres.Postgres, duplicatePolicy DuplicatePolicy, chains *chain.Registry, relayer *relayer.Relayer) *Service {
+	return &Service{
+		sh:              sh,
+		pg:              pg,
+		duplicatePolicy: duplicatePolicy,
+		chains:          chains,
+		events:          stream.NewHub(),
+		relayer:         relayer,
+	}
 }
 
-func (s *Service) UploadFile(ctx context.Context, name string, file *os.File, walletAddress, signature string, uploadedAt time.Time) (string, error) {
-	cid, err := s.sh.Add(file)
+// UploadFile добавляет аудио в IPFS и каталог. Повторная загрузка тех же байт тем же
+// владельцем идемпотентна: возвращается существующая запись и created = false; трек,
+// скрытый при удалении, возвращается в каталог.
+// Метаданные трека (название, исполнитель, жанр, владелец, подпись) передаются в meta,
+// подписанное сообщение сохраняется в журнале аудита.
+func (s *Service) UploadFile(ctx context.Context, file *os.File, meta model.Music, message string) (music *model.Music, created bool, err error) {
+	walletAddress := meta.OwnerAddr
+
+	// Повтор подписи отклоняется до работы с IPFS, чтобы не добавлять файл по чужому запросу
+	used, err := s.pg.IsSignatureUsed(ctx, meta.Signature)
 	if err != nil {
-		return "", err
+		return nil, false, err
+	}
+	if used {
+		return nil, false, ErrStaleSignature
 	}
 
-	err = s.sh.Pin(cid)
+	// CID вычисляется без записи в IPFS, чтобы сначала проверить точные дубликаты
+	cid, err := s.sh.Add(file, shell.OnlyHash(true))
 	if err != nil {
-		return "", err
+		return nil, false, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, false, err
 	}
 
-	music := model.Music{
-		Title:      name,
-		CID:        cid,
-		OwnerAddr:  walletAddress,
-		Signature:  signature,
-		UploadedAt: uploadedAt,
+	existing, err := s.checkExistingCID(ctx, cid, walletAddress)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil && existing.DeletedAt != nil {
+		return s.restoreMusic(ctx, file, existing, message, meta.Signature)
+	}
+	if existing != nil {
+		return existing, false, nil
 	}
 
-	_, err = s.pg.CreateMusic(ctx, music)
+	// Отпечаток вычисляется до добавления в IPFS, чтобы можно было отклонить чужой трек
+	var match *acousticMatch
+	fingerprint, err := analysis.Fingerprint(ctx, file)
 	if err != nil {
-		return "", err
+		fmt.Printf("Ошибка вычисления отпечатка %s: %v\n", meta.Title, err)
+	} else {
+		match, err = s.findAcousticDuplicate(ctx, fingerprint, walletAddress)
+		if err != nil {
+			return nil, false, err
+		}
+		if match != nil && s.duplicatePolicy == DuplicatePolicyReject {
+			return nil, false, &AcousticDuplicateError{Original: match.original, BitErrorRate: match.bitErrorRate}
+		}
 	}
-	return cid, nil
-}
 
-func (s *Service) GetAllMusic(ctx context.Context) ([]model.Music, error) {
-	return s.pg.GetAllMusic(ctx)
-}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, false, err
+	}
 
-func (s *Service) GetTransactionHistoryFromChain(address string, startBlock, endBlock uint64, rpcURL string) ([]model.BlockchainTransaction, error) {
-	client, err := ethclient.Dial(rpcURL)
+	cid, err = s.sh.Add(file)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка подключения к ноде: %v", err)
+		return nil, false, err
 	}
 
-	ctx := context.Background()
-	targetAddress := common.HexToAddress(address)
-	fmt.Printf("Ищем транзакции для адреса: %s\n", targetAddress.Hex())
-	var transactions []model.BlockchainTransaction
+	err = s.sh.Pin(cid)
+	if err != nil {
+		return nil, false, err
+	}
 
-	// Если конечный блок не указан, используем текущий блок
-	if endBlock == 0 {
-		header, err := client.HeaderByNumber(ctx, nil)
-		if err != nil {
-			return nil, fmt.Errorf("ошибка получения текущего блока: %v", err)
+	meta.CID = cid
+	var flag *model.DuplicateFlag
+	if match != nil {
+		flag = &model.DuplicateFlag{
+			MatchedMusicID:    match.original.ID,
+			UploaderAddr:      walletAddress,
+			OriginalOwnerAddr: match.original.OwnerAddr,
+			BitErrorRate:      match.bitErrorRate,
 		}
-		endBlock = header.Number.Uint64()
+	}
+	id, err := s.pg.CreateMusic(ctx, meta, fingerprint, flag, model.AuditEntry{
+		Action:        model.AuditActionUpload,
+		RecoveredAddr: walletAddress,
+		Message:       message,
+		Signature:     meta.Signature,
+	})
+	if errors.Is(err, postgres.ErrDuplicateCID) {
+		// Параллельная загрузка тех же байт успела сохраниться раньше
+		existing, err := s.checkExistingCID(ctx, cid, walletAddress)
+		return existing, false, err
+	}
+	if errors.Is(err, postgres.ErrSignatureReused) {
+		return nil, false, ErrStaleSignature
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if match != nil {
+		fmt.Printf("Трек %d совпадает с треком %d владельца %s, отправлен на проверку\n", id, match.original.ID, match.original.OwnerAddr)
+	}
+	music, err = s.pg.GetMusicById(ctx, id)
+	if err != nil {
+		return nil, false, err
 	}
 
-	startBlock = 0
+	// Измерение громкости занимает время, поэтому выполняется в фоне
+	go s.AnalyzeLoudness(context.Background(), id, cid)
 
-	fmt.Printf("Сканирование всех блоков с %d по %d...\n", startBlock, endBlock)
+	return music, true, nil
+}
 
-	type rpcTransaction struct {
-		Hash        string `json:"hash"`
-		From        string `json:"from"`
-		To          string `json:"to"`
-		Value       string `json:"value"`
-		Gas         string `json:"gas"`
-		GasPrice    string `json:"gasPrice"`
-		Input       string `json:"input"`
-		BlockNumber string `json:"blockNumber"`
+// restoreMusic возвращает в каталог трек владельца, скрытый при удалении из-за истории:
+// файл снова добавляется и закрепляется в IPFS, загрузка записывается в журнал аудита
+func (s *Service) restoreMusic(ctx context.Context, file *os.File, music *model.Music, message, signature string) (*model.Music, bool, error) {
+	if _, err := s.sh.Add(file); err != nil {
+		return nil, false, err
+	}
+	if err := s.sh.Pin(music.CID); err != nil {
+		return nil, false, err
 	}
 
-	for blockNum := startBlock; blockNum <= endBlock; blockNum++ {
-		fmt.Printf("Сканирование блока %d...\n", blockNum)
-
-		block, err := client.BlockByNumber(ctx, big.NewInt(int64(blockNum)))
-		if err != nil {
-			fmt.Printf("Ошибка получения блока %d: %v\n", blockNum, err)
-			continue
-		}
+	err := s.pg.RestoreMusicAudited(ctx, music.ID, model.AuditEntry{
+		Action:        model.AuditActionUpload,
+		RecoveredAddr: music.OwnerAddr,
+		Message:       message,
+		Signature:     signature,
+	})
+	if errors.Is(err, postgres.ErrSignatureReused) {
+		return nil, false, ErrStaleSignature
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	restored, err := s.pg.GetMusicById(ctx, music.ID)
+	return restored, true, err
+}
 
-		blockTime := time.Unix(int64(block.Time()), 0)
-
-		for _, tx := range block.Transactions() {
-			txHash := tx.Hash().Hex()
-
-			var result rpcTransaction
-			err := client.Client().Call(&result, "eth_getTransactionByHash", txHash)
-			if err != nil {
-				fmt.Printf("Ошибка получения транзакции %s: %v\n", txHash, err)
-				continue
-			}
-
-			fromAddrLower := strings.ToLower(result.From)
-			targetAddrLower := strings.ToLower(targetAddress.Hex())
-			var toAddrLower string
-			if result.To != "" {
-				toAddrLower = strings.ToLower(result.To)
-			}
-
-			isIncoming := toAddrLower == targetAddrLower
-			isOutgoing := fromAddrLower == targetAddrLower
-
-			if isIncoming || isOutgoing {
-				txType := "incoming"
-				if isOutgoing {
-					txType = "outgoing"
-				}
-
-				valueInt, _ := new(big.Int).SetString(result.Value[2:], 16)
-				gasInt, _ := strconv.ParseUint(result.Gas[2:], 16, 64)
-				gasPriceInt, _ := new(big.Int).SetString(result.GasPrice[2:], 16)
-
-				transaction := model.BlockchainTransaction{
-					Hash:            txHash,
-					BlockNumber:     blockNum,
-					From:            result.From,
-					To:              result.To,
-					Value:           valueInt.String(),
-					Gas:             gasInt,
-					GasPrice:        gasPriceInt.String(),
-					Input:           result.Input[2:], // Убираем "0x" префикс
-					Timestamp:       blockTime,
-					TransactionType: txType,
-				}
-
-				transactions = append(transactions, transaction)
-				fmt.Printf("НАЙДЕНА %s транзакция в блоке %d: %s\n", txType, blockNum, txHash)
-			}
-		}
+// checkExistingCID ищет трек с тем же CID. Для того же владельца возвращает его запись,
+// для другого — CIDConflictError, если трека нет — nil.
+func (s *Service) checkExistingCID(ctx context.Context, cid, walletAddress string) (*model.Music, error) {
+	existing, err := s.pg.GetMusicByCID(ctx, cid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(existing.OwnerAddr, walletAddress) {
+		return nil, &CIDConflictError{Original: existing}
 	}
+	return existing, nil
+}
 
-	// Альтернативный метод: получаем все транзакции через eth_getBlockByNumber с полными деталями
-	if len(transactions) == 0 {
-		fmt.Println("Стандартный метод не нашел транзакций. Пробуем альтернативный метод...")
+// AnalyzeLoudness измеряет громкость трека из IPFS и сохраняет значения ReplayGain
+// и длительность
+func (s *Service) AnalyzeLoudness(ctx context.Context, id int, cid string) {
+	reader, err := s.sh.Cat(cid)
+	if err != nil {
+		fmt.Printf("Ошибка чтения %s из IPFS для анализа громкости: %v\n", cid, err)
+		return
+	}
+	defer reader.Close()
 
-		type rpcBlock struct {
-			Transactions []rpcTransaction `json:"transactions"`
-			Timestamp    string           `json:"timestamp"`
-		}
+	loudness, duration, err := analysis.MeasureLoudness(ctx, reader)
+	if err != nil {
+		fmt.Printf("Ошибка анализа громкости трека %d: %v\n", id, err)
+		return
+	}
 
-		for blockNum := startBlock; blockNum <= endBlock; blockNum++ {
-			blockNumHex := fmt.Sprintf("0x%x", blockNum)
-
-			var block rpcBlock
-			err := client.Client().Call(&block, "eth_getBlockByNumber", blockNumHex, true)
-			if err != nil {
-				fmt.Printf("Ошибка получения блока %d: %v\n", blockNum, err)
-				continue
-			}
-
-			// Преобразуем timestamp из hex в int
-			timestampHex := block.Timestamp[2:] // убираем "0x" префикс
-			timestamp, _ := strconv.ParseInt(timestampHex, 16, 64)
-			blockTime := time.Unix(timestamp, 0)
-
-			for _, tx := range block.Transactions {
-				fromAddrLower := strings.ToLower(tx.From)
-				targetAddrLower := strings.ToLower(targetAddress.Hex())
-				var toAddrLower string
-				if tx.To != "" {
-					toAddrLower = strings.ToLower(tx.To)
-				}
-
-				isIncoming := toAddrLower == targetAddrLower
-				isOutgoing := fromAddrLower == targetAddrLower
-
-				if isIncoming || isOutgoing {
-					txType := "incoming"
-					if isOutgoing {
-						txType = "outgoing"
-					}
-
-					// Конвертируем hex в int для значений
-					valueInt, _ := new(big.Int).SetString(tx.Value[2:], 16)
-					gasInt, _ := strconv.ParseUint(tx.Gas[2:], 16, 64)
-					gasPriceInt, _ := new(big.Int).SetString(tx.GasPrice[2:], 16)
-
-					transaction := model.BlockchainTransaction{
-						Hash:            tx.Hash,
-						BlockNumber:     blockNum,
-						From:            tx.From,
-						To:              tx.To,
-						Value:           valueInt.String(),
-						Gas:             gasInt,
-						GasPrice:        gasPriceInt.String(),
-						Input:           tx.Input[2:], // Убираем "0x" префикс
-						Timestamp:       blockTime,
-						TransactionType: txType,
-					}
-
-					transactions = append(transactions, transaction)
-					fmt.Printf("НАЙДЕНА %s транзакция в блоке %d: %s\n", txType, tx.Hash, transaction.Value)
-				}
-			}
-		}
+	if err := s.pg.UpdateMusicLoudness(ctx, id, *loudness, duration); err != nil {
+		fmt.Printf("Ошибка сохранения громкости трека %d: %v\n", id, err)
+		return
 	}
+	fmt.Printf("Громкость трека %d: %.1f LUFS, усиление %.2f дБ\n", id, loudness.Integrated, loudness.TrackGain)
+}
+
+// SearchMusic выполняет поиск по каталогу
+func (s *Service) SearchMusic(ctx context.Context, q string, limit int) ([]model.SearchResult, error) {
+	return s.pg.SearchMusic(ctx, q, limit)
+}
 
-	fmt.Printf("Сканирование завершено. Найдено транзакций: %d\n", len(transactions))
-	return transactions, nil
+// ListMusic возвращает страницу каталога по фильтру
+func (s *Service) ListMusic(ctx context.Context, filter model.MusicFilter) (*model.MusicPage, error) {
+	return s.pg.ListMusic(ctx, filter)
 }
 
 // Вывод транзакций
@@ -237,6 +249,12 @@ func (s *Service) PrintBlockchainTransactions(transactions []model.BlockchainTra
 		fmt.Printf("  Кому: %s\n", tx.To)
 		fmt.Printf("  Сумма (Wei): %s\n", tx.Value)
 		fmt.Printf("  Газ: %d, Цена газа: %s Wei\n", tx.Gas, tx.GasPrice)
+		if tx.Status != "" {
+			fmt.Printf("  Статус: %s, израсходовано газа: %d, комиссия: %s Wei\n", tx.Status, tx.GasUsed, tx.Fee)
+		}
+		if tx.RevertReason != "" {
+			fmt.Printf("  Причина отката: %s\n", tx.RevertReason)
+		}
 		if len(tx.Input) > 10 {
 			fmt.Printf("  Данные: 0x%s...\n", tx.Input[:10])
 		} else {
@@ -316,10 +334,3 @@ func (s *Service) VerifySignature(message, signature string) (bool, string, erro
 	recoveredAddress := crypto.PubkeyToAddress(*pubKeyBytes).Hex()
 	return true, recoveredAddress, nil
 }
-
-// SaveAudioMetadata сохраняет метаданные аудио в базу данных
-func (s *Service) SaveAudioMetadata(ctx context.Context, audio *model.Audio) (int64, error) {
-	// Здесь должен быть код для сохранения в базу данных
-	// В простом случае можно использовать Repository для сохранения
-	return 0, nil
-}
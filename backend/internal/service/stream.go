@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/polonkoevv/ethcourse/internal/chain"
+	"github.com/polonkoevv/ethcourse/internal/indexer"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/stream"
+)
+
+// Транзакции адресов ищутся не больше чем в стольких последних блоках диапазона:
+// более старая история доступна через /transactions
+const maxStreamScanBlocks = 1000
+
+var (
+	ErrStreamUnavailable = errors.New("поток событий недоступен: для сети не настроен контракт AudioChain")
+	ErrInvalidEventID    = errors.New("некорректный Last-Event-ID")
+)
+
+// SubscribeEvents подписывает на события адреса или трека. Если передан lastEventID,
+// возвращаются также пропущенные события из уже проиндексированных блоков. Подписка
+// регистрируется до чтения пропущенных событий, поэтому часть событий может прийти
+// дважды — повторы отсекаются по ID.
+func (s *Service) SubscribeEvents(ctx context.Context, filter model.StreamFilter, lastEventID string) (*stream.Subscription, []model.StreamEvent, error) {
+	c, err := s.chain(filter.ChainID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !c.HasContract() {
+		return nil, nil, ErrStreamUnavailable
+	}
+	filter.ChainID = c.ID
+
+	var after *stream.Position
+	if lastEventID != "" {
+		pos, err := stream.ParseID(lastEventID)
+		if err != nil {
+			return nil, nil, ErrInvalidEventID
+		}
+		after = &pos
+	}
+
+	sub := s.events.Subscribe(filter)
+	if after == nil {
+		return sub, nil, nil
+	}
+
+	replay, err := s.replayEvents(ctx, c, filter, *after)
+	if err != nil {
+		s.events.Unsubscribe(sub)
+		return nil, nil, err
+	}
+	return sub, replay, nil
+}
+
+// Unsubscribe отменяет подписку на события
+func (s *Service) Unsubscribe(sub *stream.Subscription) {
+	s.events.Unsubscribe(sub)
+}
+
+// replayEvents возвращает события подписки после позиции after
+func (s *Service) replayEvents(ctx context.Context, c *chain.Chain, filter model.StreamFilter, after stream.Position) ([]model.StreamEvent, error) {
+	last, ok, err := s.pg.GetLastIndexedBlock(ctx, indexer.StateName(c.ID, c.Contract))
+	if err != nil || !ok || last < after.Block {
+		return nil, err
+	}
+
+	var addresses map[string]bool
+	if filter.Address != "" {
+		addresses = map[string]bool{strings.ToLower(filter.Address): true}
+	}
+	events, err := s.chainEvents(ctx, c, after.Block, last, addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []model.StreamEvent
+	for _, event := range events {
+		pos, _ := stream.ParseID(event.ID)
+		if after.Less(pos) && stream.Match(filter, event) {
+			result = append(result, stream.ForSubscriber(filter, event))
+		}
+	}
+	return result, nil
+}
+
+// PublishBlocks рассылает подписчикам события проиндексированных блоков [from, to]
+// сети; вызывается индексатором
+func (s *Service) PublishBlocks(ctx context.Context, chainID, from, to uint64) {
+	if s.events.Len() == 0 {
+		return
+	}
+	c, ok := s.chains.Get(chainID)
+	if !ok {
+		return
+	}
+	events, err := s.chainEvents(ctx, c, from, to, s.events.Addresses(chainID))
+	if err != nil {
+		fmt.Printf("Ошибка подготовки событий блоков %d–%d сети %d: %v\n", from, to, chainID, err)
+		return
+	}
+	s.events.Publish(events)
+}
+
+// chainEvents собирает события контракта из проиндексированных таблиц и транзакции
+// адресов из addresses (в нижнем регистре) в порядке их положения в цепочке
+func (s *Service) chainEvents(ctx context.Context, c *chain.Chain, from, to uint64, addresses map[string]bool) ([]model.StreamEvent, error) {
+	published, purchases, err := s.pg.GetChainEvents(ctx, c.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []model.StreamEvent
+	for _, e := range published {
+		events = append(events, model.StreamEvent{
+			ID:        stream.LogID(e.BlockNumber, e.LogIndex),
+			ChainID:   c.ID,
+			Type:      model.StreamEventAudioPublished,
+			Addresses: []string{e.OwnerAddr},
+			MusicID:   e.MusicID,
+			Data:      e,
+		})
+	}
+	for _, e := range purchases {
+		events = append(events, model.StreamEvent{
+			ID:        stream.LogID(e.BlockNumber, e.LogIndex),
+			ChainID:   c.ID,
+			Type:      model.StreamEventAudioPurchased,
+			Addresses: []string{e.BuyerAddr, e.SellerAddr},
+			MusicID:   e.MusicID,
+			Data:      e,
+		})
+	}
+
+	if len(addresses) > 0 {
+		if to-from+1 > maxStreamScanBlocks {
+			from = to - maxStreamScanBlocks + 1
+		}
+		transactions, err := s.transactionEvents(ctx, c, from, to, addresses)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, transactions...)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		a, _ := stream.ParseID(events[i].ID)
+		b, _ := stream.ParseID(events[j].ID)
+		return a.Less(b)
+	})
+	return events, nil
+}
+
+// transactionEvents ищет в блоках [from, to] транзакции, отправленные адресами или им
+func (s *Service) transactionEvents(ctx context.Context, c *chain.Chain, from, to uint64, addresses map[string]bool) ([]model.StreamEvent, error) {
+	blocks, err := c.Client.BlocksByNumber(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []model.StreamEvent
+	for _, block := range blocks {
+		blockTime := time.Unix(int64(block.Time), 0)
+
+		for i, tx := range block.Transactions {
+			sender := block.Senders[i]
+			var recipient string
+			if tx.To() != nil {
+				recipient = tx.To().Hex()
+			}
+			if !addresses[strings.ToLower(sender.Hex())] && !addresses[strings.ToLower(recipient)] {
+				continue
+			}
+
+			transaction := newBlockchainTransaction(tx, sender, block.Number, blockTime)
+			if err := s.enrichTransaction(ctx, c, tx, sender, &transaction); err != nil {
+				return nil, err
+			}
+			events = append(events, model.StreamEvent{
+				ID:        stream.TransactionID(block.Number, uint(i)),
+				ChainID:   c.ID,
+				Type:      model.StreamEventTransaction,
+				Addresses: []string{sender.Hex(), recipient},
+				Data:      transaction,
+			})
+		}
+	}
+	return events, nil
+}
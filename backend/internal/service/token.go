@@ -0,0 +1,374 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/chain"
+	"github.com/polonkoevv/ethcourse/internal/contract"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/storage/postgres"
+)
+
+var (
+	ErrNoTokenPrice          = errors.New("у трека нет цены в токене")
+	ErrTokenTransferNotFound = errors.New("в транзакции нет подходящего перевода токенов владельцу трека")
+	ErrTokenTransferPending  = errors.New("транзакция ещё не подтверждена")
+	ErrTransferAlreadyLinked = errors.New("перевод уже засчитан как покупка")
+)
+
+// Цена в токене назначается владельцем:
+//
+//	{"action":"token_price","musicId":1,"chainId":1337,"token":"0x...","tokenPrice":"9.99",...}
+//
+// Пустой token снимает цену. Покупатель переводит токены владельцу трека напрямую;
+// индексатор засчитывает перевод сам, если он однозначно подходит одному треку,
+// а иначе покупатель указывает транзакцию подписанным сообщением:
+//
+//	{"action":"token_purchase","musicId":1,"chainId":1337,"txHash":"0x...","logIndex":3,...}
+//
+// chainId можно не указывать, если у трека есть текущая цена: тогда берётся её сеть.
+// Перевод сверяется с ценой, действовавшей в его блоке, а не с текущей: изменение цены
+// после перевода покупку не отменяет и не делает дешёвый старый перевод покупкой.
+// Новая цена действует с блока, следующего за вершиной сети в момент её назначения.
+
+// tokenInfo возвращает метаданные токена, при первом обращении читая их из контракта
+func (s *Service) tokenInfo(ctx context.Context, c *chain.Chain, address common.Address) (*model.ERC20Token, error) {
+	token, err := s.pg.GetERC20Token(ctx, c.ID, address.Hex())
+	if err == nil {
+		return token, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	token = &model.ERC20Token{ChainID: c.ID, Address: address.Hex()}
+	data, err := s.callToken(ctx, c, address, "decimals")
+	if err != nil {
+		return nil, err
+	}
+	if token.Decimals, err = contract.UnpackERC20Decimals(data); err != nil {
+		return nil, &MessageError{Reason: "адрес не является токеном ERC-20: " + err.Error()}
+	}
+	// symbol и name в стандарте необязательны
+	for _, field := range []struct {
+		method string
+		value  *string
+	}{
+		{"symbol", &token.Symbol},
+		{"name", &token.Name},
+	} {
+		data, err := s.callToken(ctx, c, address, field.method)
+		if err != nil {
+			continue
+		}
+		if v, err := contract.UnpackERC20String(field.method, data); err == nil {
+			*field.value = v
+		}
+	}
+
+	if err := s.pg.SaveERC20Token(ctx, *token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (s *Service) callToken(ctx context.Context, c *chain.Chain, address common.Address, method string) ([]byte, error) {
+	input, err := contract.PackERC20Call(method)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.Client.CallContract(ctx, ethereum.CallMsg{To: &address, Data: input}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка вызова %s токена %s: %w", method, address.Hex(), err)
+	}
+	return data, nil
+}
+
+// SetTokenPrice назначает или снимает цену трека в ERC-20 токене по подписанному
+// владельцем сообщению с действием token_price
+func (s *Service) SetTokenPrice(ctx context.Context, id int, message, signature string) (*model.Music, error) {
+	msg, signer, err := s.verifyMusicAction(message, signature, model.AuditActionTokenPrice, id)
+	if err != nil {
+		return nil, err
+	}
+
+	music, err := s.GetMusicByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(music.OwnerAddr, signer) {
+		return nil, ErrNotOwner
+	}
+
+	var price *model.TokenPrice
+	if msg.Token != "" {
+		if !common.IsHexAddress(msg.Token) {
+			return nil, &MessageError{Reason: "некорректный адрес токена"}
+		}
+		c, err := s.chain(msg.ChainID)
+		if err != nil {
+			return nil, err
+		}
+		token, err := s.tokenInfo(ctx, c, common.HexToAddress(msg.Token))
+		if err != nil {
+			return nil, err
+		}
+		amount, err := contract.ParseUnits(msg.TokenPrice, token.Decimals)
+		if err != nil {
+			return nil, &MessageError{Reason: err.Error()}
+		}
+		if amount.Sign() == 0 {
+			return nil, &MessageError{Reason: "цена должна быть больше нуля"}
+		}
+		price = &model.TokenPrice{
+			ChainID:  c.ID,
+			Token:    token.Address,
+			Symbol:   token.Symbol,
+			Decimals: token.Decimals,
+			Amount:   amount.String(),
+		}
+	}
+
+	// Границы действия цен — следующий блок после текущей вершины сети
+	heads := make(map[uint64]uint64)
+	nextBlock := func(chainID uint64) (uint64, error) {
+		if head, ok := heads[chainID]; ok {
+			return head + 1, nil
+		}
+		c, err := s.chain(chainID)
+		if err != nil {
+			return 0, err
+		}
+		head, err := c.Client.BlockNumber(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("ошибка получения номера блока: %w", err)
+		}
+		heads[chainID] = head
+		return head + 1, nil
+	}
+	var untilBlock, fromBlock uint64
+	if music.TokenPrice != nil {
+		if untilBlock, err = nextBlock(music.TokenPrice.ChainID); err != nil {
+			return nil, err
+		}
+	}
+	if price != nil {
+		if fromBlock, err = nextBlock(price.ChainID); err != nil {
+			return nil, err
+		}
+	}
+
+	details, err := json.Marshal(map[string]interface{}{"before": music.TokenPrice, "after": price, "from_block": fromBlock})
+	if err != nil {
+		return nil, err
+	}
+	err = s.pg.SetMusicTokenPriceAudited(ctx, id, price, untilBlock, fromBlock, model.AuditEntry{
+		Action:        model.AuditActionTokenPrice,
+		MusicID:       &id,
+		RecoveredAddr: signer,
+		Message:       message,
+		Signature:     signature,
+		Details:       string(details),
+	})
+	if errors.Is(err, postgres.ErrSignatureReused) {
+		return nil, ErrStaleSignature
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetMusicByID(ctx, id)
+}
+
+// ClaimTokenPurchase засчитывает перевод токенов из указанной транзакции как покупку
+// трека по подписанному покупателем сообщению с действием token_purchase. Перевод должен
+// идти от покупателя владельцу трека в токене цены, действовавшей в блоке перевода,
+// и быть не меньше этой цены.
+func (s *Service) ClaimTokenPurchase(ctx context.Context, id int, message, signature string) (*model.MusicAccess, error) {
+	msg, signer, err := s.verifyMusicAction(message, signature, model.AuditActionTokenPurchase, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(common.FromHex(msg.TxHash)) != common.HashLength {
+		return nil, &MessageError{Reason: "некорректный хеш транзакции"}
+	}
+	txHash := common.HexToHash(msg.TxHash)
+
+	music, err := s.GetMusicByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	chainID := msg.ChainID
+	if chainID == 0 {
+		if music.TokenPrice == nil {
+			return nil, ErrNoTokenPrice
+		}
+		chainID = music.TokenPrice.ChainID
+	}
+	c, err := s.chain(chainID)
+	if err != nil {
+		return nil, err
+	}
+
+	transfers, err := s.pg.GetTokenTransfersByTx(ctx, c.ID, txHash.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if len(transfers) == 0 {
+		// Перевод сделан до назначения цены или индексатор ещё не дошёл до блока
+		if transfers, err = s.fetchTokenTransfers(ctx, c, txHash, common.HexToAddress(music.OwnerAddr)); err != nil {
+			return nil, err
+		}
+		if err := s.pg.SaveTokenTransfers(ctx, transfers); err != nil {
+			return nil, err
+		}
+	}
+
+	var match *model.TokenTransfer
+	var price *model.TokenPrice
+	for n := range transfers {
+		t := &transfers[n]
+		if msg.LogIndex != nil && t.LogIndex != *msg.LogIndex {
+			continue
+		}
+		if !strings.EqualFold(t.FromAddr, signer) || !strings.EqualFold(t.ToAddr, music.OwnerAddr) {
+			continue
+		}
+		p, err := s.pg.GetTokenPriceAt(ctx, id, c.ID, t.BlockNumber)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil || !strings.EqualFold(t.TokenAddr, p.Token) {
+			continue
+		}
+		required, ok := new(big.Int).SetString(p.Amount, 10)
+		if !ok {
+			return nil, fmt.Errorf("некорректная цена трека %d: %s", id, p.Amount)
+		}
+		amount, ok := new(big.Int).SetString(t.Amount, 10)
+		if !ok || amount.Cmp(required) < 0 {
+			continue
+		}
+		if t.MusicID != nil {
+			if *t.MusicID == id {
+				return s.GetMusicAccess(ctx, id, signer)
+			}
+			continue
+		}
+		match, price = t, p
+		break
+	}
+	if match == nil {
+		if music.TokenPrice == nil {
+			return nil, ErrNoTokenPrice
+		}
+		return nil, ErrTokenTransferNotFound
+	}
+
+	details, err := json.Marshal(map[string]interface{}{"transfer": match, "price": price})
+	if err != nil {
+		return nil, err
+	}
+	err = s.pg.LinkTokenPurchaseAudited(ctx, *match, id, model.AuditEntry{
+		Action:        model.AuditActionTokenPurchase,
+		MusicID:       &id,
+		RecoveredAddr: signer,
+		Message:       message,
+		Signature:     signature,
+		Details:       string(details),
+	})
+	if errors.Is(err, postgres.ErrSignatureReused) {
+		return nil, ErrStaleSignature
+	}
+	if errors.Is(err, postgres.ErrTransferAlreadyLinked) {
+		return nil, ErrTransferAlreadyLinked
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetMusicAccess(ctx, id, signer)
+}
+
+// fetchTokenTransfers читает переводы ERC-20 получателю to из квитанции подтверждённой
+// транзакции
+func (s *Service) fetchTokenTransfers(ctx context.Context, c *chain.Chain, txHash common.Hash, to common.Address) ([]model.TokenTransfer, error) {
+	receipt, err := c.Client.TransactionReceipt(ctx, txHash)
+	if errors.Is(err, ethereum.NotFound) {
+		return nil, ErrTokenTransferPending
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения квитанции %s: %w", txHash.Hex(), err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return nil, ErrTokenTransferNotFound
+	}
+
+	head, err := c.Client.BlockNumber(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения номера блока: %w", err)
+	}
+	block := receipt.BlockNumber.Uint64()
+	if block+c.Confirmations > head {
+		return nil, ErrTokenTransferPending
+	}
+	header, err := c.Client.HeaderByNumber(ctx, receipt.BlockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения блока %d: %w", block, err)
+	}
+
+	var transfers []model.TokenTransfer
+	for _, log := range receipt.Logs {
+		event, err := contract.ParseERC20Transfer(*log)
+		if err != nil || event.To != to {
+			continue
+		}
+		transfers = append(transfers, model.TokenTransfer{
+			ChainID:     c.ID,
+			TxHash:      txHash.Hex(),
+			LogIndex:    log.Index,
+			TokenAddr:   log.Address.Hex(),
+			FromAddr:    event.From.Hex(),
+			ToAddr:      event.To.Hex(),
+			Amount:      event.Value.String(),
+			BlockNumber: block,
+			BlockTime:   time.Unix(int64(header.Time), 0),
+		})
+	}
+	if len(transfers) == 0 {
+		return nil, ErrTokenTransferNotFound
+	}
+	return transfers, nil
+}
+
+// GetMusicAccess сообщает, есть ли у кошелька доступ к треку и как он получен:
+// владение, покупка в контракте, покупка через ретранслятор или перевод токенов
+func (s *Service) GetMusicAccess(ctx context.Context, id int, wallet string) (*model.MusicAccess, error) {
+	music, err := s.GetMusicByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	wallet = common.HexToAddress(wallet).Hex()
+	if strings.EqualFold(music.OwnerAddr, wallet) {
+		return &model.MusicAccess{MusicID: id, Wallet: wallet, HasAccess: true, Via: model.AccessViaOwner}, nil
+	}
+
+	access, err := s.pg.GetMusicAccess(ctx, *music, wallet)
+	if err != nil {
+		return nil, err
+	}
+	if access == nil {
+		return &model.MusicAccess{MusicID: id, Wallet: wallet}, nil
+	}
+	return access, nil
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/model"
+	"github.com/polonkoevv/ethcourse/internal/storage/postgres"
+)
+
+// Срок, в течение которого получатель может принять передачу
+const transferOfferTTL = 7 * 24 * time.Hour
+
+var (
+	ErrTransferNotFound   = errors.New("передача не найдена")
+	ErrTransferNotPending = errors.New("передача уже завершена, отменена или истекла")
+	ErrNotRecipient       = errors.New("принять передачу может только получатель")
+	ErrTransferExists     = errors.New("у трека уже есть ожидающая передача, повторите запрос")
+)
+
+// Передача трека выполняется в два шага:
+//  1. владелец подписывает {"action":"transfer_offer","musicId":1,"recipient":"0x...",...};
+//  2. получатель подписывает {"action":"transfer_accept","musicId":1,"transferId":5,...}.
+// Оба сообщения сохраняются в журнале аудита. Владелец контракта AudioChain при этом
+// не меняется: в контракте нет функции передачи, и выплаты за покупки по-прежнему
+// получает адрес, опубликовавший трек.
+
+// OfferTransfer создаёт предложение передать трек получателю, указанному в сообщении
+func (s *Service) OfferTransfer(ctx context.Context, musicID int, message, signature string) (*model.OwnershipTransfer, error) {
+	msg, signer, err := s.verifyMusicAction(message, signature, model.AuditActionTransferOffer, musicID)
+	if err != nil {
+		return nil, err
+	}
+	if !common.IsHexAddress(msg.Recipient) {
+		return nil, &MessageError{Reason: "не указан адрес получателя"}
+	}
+	if strings.EqualFold(msg.Recipient, signer) {
+		return nil, &MessageError{Reason: "нельзя передать трек самому себе"}
+	}
+
+	music, err := s.GetMusicByID(ctx, musicID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(music.OwnerAddr, signer) {
+		return nil, ErrNotOwner
+	}
+
+	recipient := common.HexToAddress(msg.Recipient).Hex()
+	details, err := json.Marshal(map[string]interface{}{"from": music.OwnerAddr, "to": recipient})
+	if err != nil {
+		return nil, err
+	}
+	id, err := s.pg.CreateTransferOffer(ctx, model.OwnershipTransfer{
+		MusicID:        musicID,
+		FromAddr:       music.OwnerAddr,
+		ToAddr:         recipient,
+		OfferMessage:   message,
+		OfferSignature: signature,
+		ExpiresAt:      time.Now().Add(transferOfferTTL),
+	}, model.AuditEntry{
+		Action:        model.AuditActionTransferOffer,
+		MusicID:       &musicID,
+		RecoveredAddr: signer,
+		Message:       message,
+		Signature:     signature,
+		Details:       string(details),
+	})
+	if errors.Is(err, postgres.ErrSignatureReused) {
+		return nil, ErrStaleSignature
+	}
+	if errors.Is(err, postgres.ErrPendingTransferExists) {
+		return nil, ErrTransferExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.pg.GetTransfer(ctx, id)
+}
+
+// AcceptTransfer завершает передачу по подписи получателя
+func (s *Service) AcceptTransfer(ctx context.Context, transferID int, message, signature string) (*model.OwnershipTransfer, error) {
+	transfer, err := s.getTransfer(ctx, transferID)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, signer, err := s.verifyMusicAction(message, signature, model.AuditActionTransferAccept, transfer.MusicID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.TransferID != transferID {
+		return nil, &MessageError{Reason: "сообщение подписано для другой передачи"}
+	}
+	if !strings.EqualFold(transfer.ToAddr, signer) {
+		return nil, ErrNotRecipient
+	}
+
+	details, err := json.Marshal(map[string]interface{}{
+		"transfer_id":     transferID,
+		"from":            transfer.FromAddr,
+		"to":              transfer.ToAddr,
+		"offer_signature": transfer.OfferSignature,
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = s.pg.AcceptTransfer(ctx, transferID, message, signature, model.AuditEntry{
+		Action:        model.AuditActionTransferAccept,
+		MusicID:       &transfer.MusicID,
+		RecoveredAddr: signer,
+		Message:       message,
+		Signature:     signature,
+		Details:       string(details),
+	})
+	if errors.Is(err, postgres.ErrTransferNotPending) {
+		return nil, ErrTransferNotPending
+	}
+	if errors.Is(err, postgres.ErrSignatureReused) {
+		return nil, ErrStaleSignature
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.pg.GetTransfer(ctx, transferID)
+}
+
+// CancelTransfer отменяет передачу по подписи владельца или получателя
+func (s *Service) CancelTransfer(ctx context.Context, transferID int, message, signature string) (*model.OwnershipTransfer, error) {
+	transfer, err := s.getTransfer(ctx, transferID)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, signer, err := s.verifyMusicAction(message, signature, model.AuditActionTransferCancel, transfer.MusicID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.TransferID != transferID {
+		return nil, &MessageError{Reason: "сообщение подписано для другой передачи"}
+	}
+	if !strings.EqualFold(transfer.FromAddr, signer) && !strings.EqualFold(transfer.ToAddr, signer) {
+		return nil, ErrNotOwner
+	}
+
+	details, err := json.Marshal(map[string]interface{}{"transfer_id": transferID})
+	if err != nil {
+		return nil, err
+	}
+	err = s.pg.CancelTransfer(ctx, transferID, model.AuditEntry{
+		Action:        model.AuditActionTransferCancel,
+		MusicID:       &transfer.MusicID,
+		RecoveredAddr: signer,
+		Message:       message,
+		Signature:     signature,
+		Details:       string(details),
+	})
+	if errors.Is(err, postgres.ErrTransferNotPending) {
+		return nil, ErrTransferNotPending
+	}
+	if errors.Is(err, postgres.ErrSignatureReused) {
+		return nil, ErrStaleSignature
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.pg.GetTransfer(ctx, transferID)
+}
+
+func (s *Service) getTransfer(ctx context.Context, id int) (*model.OwnershipTransfer, error) {
+	transfer, err := s.pg.GetTransfer(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrTransferNotFound
+	}
+	return transfer, err
+}
+
+// GetMusicTransfers возвращает историю передач трека
+func (s *Service) GetMusicTransfers(ctx context.Context, musicID int) ([]model.OwnershipTransfer, error) {
+	return s.pg.GetTransfersByMusic(ctx, musicID)
+}
+
+// GetAddressTransfers возвращает передачи, отправленные адресом или адресованные ему
+func (s *Service) GetAddressTransfers(ctx context.Context, address string) ([]model.OwnershipTransfer, error) {
+	return s.pg.GetTransfersByAddress(ctx, address)
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/chain"
+	"github.com/polonkoevv/ethcourse/internal/indexer"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// treasuryNotes поясняют в отчёте, откуда берутся выводы комиссии
+var treasuryNotes = []string{
+	indexer.ArchiveNodeNote,
+	"вывод без атрибуции (attributed = false) — падение баланса контракта в блоке без транзакции withdrawPlatformFees " +
+		"в контракт, например вызов из мультиподписи: известны блок и сумма, но не транзакция и получатель",
+}
+
+// GetTreasuryReport строит отчёт о комиссии платформы: начисления и выводы по периодам
+// и сверку с фактическим балансом контрактов
+func (s *Service) GetTreasuryReport(ctx context.Context, filter model.TreasuryFilter) (*model.TreasuryReport, error) {
+	var chains []*chain.Chain
+	if filter.ChainID != nil {
+		c, err := s.chain(*filter.ChainID)
+		if err != nil {
+			return nil, err
+		}
+		chains = []*chain.Chain{c}
+	} else {
+		chains = s.chains.All()
+	}
+
+	periods, err := s.pg.GetTreasuryPeriods(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	withdrawals, err := s.pg.GetFeeWithdrawals(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.TreasuryReport{
+		GroupBy:        filter.GroupBy,
+		Periods:        periods,
+		Withdrawals:    withdrawals,
+		Reconciliation: []model.TreasuryReconciliation{},
+		Notes:          treasuryNotes,
+	}
+	if report.Periods == nil {
+		report.Periods = []model.TreasuryPeriod{}
+	}
+	if report.Withdrawals == nil {
+		report.Withdrawals = []model.FeeWithdrawal{}
+	}
+
+	var accrued, withdrawn big.Int
+	for _, p := range periods {
+		for _, v := range []struct {
+			value string
+			total *big.Int
+		}{
+			{p.AccruedFeeWei, &accrued},
+			{p.WithdrawnWei, &withdrawn},
+		} {
+			amount, ok := new(big.Int).SetString(v.value, 10)
+			if !ok {
+				return nil, fmt.Errorf("некорректная сумма комиссии за %s: %s", p.Period.Format("2006-01-02"), v.value)
+			}
+			v.total.Add(v.total, amount)
+		}
+	}
+	report.AccruedFeeWei, report.WithdrawnWei = accrued.String(), withdrawn.String()
+	report.NetFeeWei = new(big.Int).Sub(&accrued, &withdrawn).String()
+
+	for _, c := range chains {
+		if !c.HasContract() {
+			continue
+		}
+		rec, err := s.reconcileTreasury(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		report.Reconciliation = append(report.Reconciliation, *rec)
+	}
+	return report, nil
+}
+
+// reconcileTreasury сравнивает баланс, который по начальному балансу и проиндексированным
+// событиям должен быть на контракте, с его балансом на последнем проиндексированном блоке.
+// Недоступность узла не ошибка отчёта: причина возвращается в поле Error.
+func (s *Service) reconcileTreasury(ctx context.Context, c *chain.Chain) (*model.TreasuryReconciliation, error) {
+	totals, err := s.pg.GetTreasuryTotals(ctx, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	accrued, ok1 := new(big.Int).SetString(totals.AccruedFeeWei, 10)
+	withdrawn, ok2 := new(big.Int).SetString(totals.WithdrawnWei, 10)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("некорректные суммы комиссии сети %d", c.ID)
+	}
+
+	rec := &model.TreasuryReconciliation{
+		ChainID:       c.ID,
+		ContractAddr:  c.Contract.Hex(),
+		AccruedFeeWei: accrued.String(),
+		WithdrawnWei:  withdrawn.String(),
+	}
+	opening, err := s.treasuryOpeningBalance(ctx, c)
+	if err != nil {
+		rec.Error = "ошибка получения начального баланса контракта: " + err.Error()
+		return rec, nil
+	}
+	openingWei, ok := new(big.Int).SetString(opening.BalanceWei, 10)
+	if !ok {
+		return nil, fmt.Errorf("некорректный начальный баланс контракта сети %d: %s", c.ID, opening.BalanceWei)
+	}
+	rec.OpeningBlock, rec.OpeningBalanceWei = opening.BlockNumber, opening.BalanceWei
+	expected := new(big.Int).Add(openingWei, accrued)
+	expected.Sub(expected, withdrawn)
+	rec.ExpectedBalanceWei = expected.String()
+
+	last, ok, err := s.pg.GetLastIndexedBlock(ctx, indexer.StateName(c.ID, c.Contract))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		rec.Error = "события сети ещё не проиндексированы"
+		return rec, nil
+	}
+	rec.IndexedBlock = last
+
+	balance, err := c.Client.BalanceAt(ctx, c.Contract, new(big.Int).SetUint64(last))
+	if err != nil {
+		rec.Error = "ошибка получения баланса контракта: " + err.Error()
+		return rec, nil
+	}
+	rec.ContractBalanceWei = balance.String()
+	rec.DiscrepancyWei = new(big.Int).Sub(balance, expected).String()
+	rec.Reconciled = balance.Cmp(expected) == 0
+	return rec, nil
+}
+
+// treasuryOpeningBalance возвращает баланс контракта перед первым индексируемым блоком,
+// при первом обращении читая его из сети. Баланс старого блока отдаёт только архивный узел.
+func (s *Service) treasuryOpeningBalance(ctx context.Context, c *chain.Chain) (*model.TreasuryOpeningBalance, error) {
+	opening, err := s.pg.GetTreasuryOpeningBalance(ctx, c.ID, c.Contract.Hex())
+	if err == nil {
+		return opening, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	opening = &model.TreasuryOpeningBalance{ChainID: c.ID, ContractAddr: c.Contract.Hex(), BalanceWei: "0"}
+	if c.StartBlock > 0 {
+		opening.BlockNumber = c.StartBlock - 1
+		balance, err := c.Client.BalanceAt(ctx, c.Contract, new(big.Int).SetUint64(opening.BlockNumber))
+		if err != nil {
+			return nil, err
+		}
+		opening.BalanceWei = balance.String()
+	}
+	if err := s.pg.SaveTreasuryOpeningBalance(ctx, *opening); err != nil {
+		return nil, err
+	}
+	return opening, nil
+}
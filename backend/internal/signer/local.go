@@ -0,0 +1,52 @@
+package signer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Local подписывает транзакции ключом, загруженным в память процесса
+type Local struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+}
+
+// NewKey создаёт подписанта из закрытого ключа в hex (с префиксом 0x или без)
+func NewKey(hexKey string) (*Local, error) {
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(hexKey, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("некорректный закрытый ключ: %w", err)
+	}
+	return &Local{key: key, address: crypto.PubkeyToAddress(key.PublicKey)}, nil
+}
+
+// NewKeystore расшифровывает keystore-файл go-ethereum (geth account new, clef)
+// паролем password
+func NewKeystore(path, password string) (*Local, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения keystore: %w", err)
+	}
+	key, err := keystore.DecryptKey(data, password)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка расшифровки keystore %s: %w", path, err)
+	}
+	return &Local{key: key.PrivateKey, address: key.Address}, nil
+}
+
+func (l *Local) Address() common.Address {
+	return l.address
+}
+
+func (l *Local) SignTx(_ context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), l.key)
+}
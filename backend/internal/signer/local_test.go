@@ -0,0 +1,92 @@
+package signer
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Ключ и адрес первого аккаунта Hardhat
+const (
+	testPrivateKey = "ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80"
+	testKeyAddress = "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"
+)
+
+func TestLocalRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	key, err := crypto.HexToECDSA(testPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := ks.ImportECDSA(key, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	garbage := filepath.Join(dir, "garbage.json")
+	if err := os.WriteFile(garbage, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		open    func() (*Local, error)
+		wantErr bool
+	}{
+		{name: "закрытый ключ", open: func() (*Local, error) { return NewKey(testPrivateKey) }},
+		{name: "закрытый ключ с 0x", open: func() (*Local, error) { return NewKey("0x" + testPrivateKey) }},
+		{name: "keystore-файл", open: func() (*Local, error) { return NewKeystore(account.URL.Path, "secret") }},
+		{name: "неверный пароль keystore", open: func() (*Local, error) { return NewKeystore(account.URL.Path, "wrong") }, wantErr: true},
+		{name: "нет keystore-файла", open: func() (*Local, error) { return NewKeystore(filepath.Join(dir, "missing"), "secret") }, wantErr: true},
+		{name: "не keystore", open: func() (*Local, error) { return NewKeystore(garbage, "secret") }, wantErr: true},
+		{name: "короткий ключ", open: func() (*Local, error) { return NewKey(testPrivateKey[2:]) }, wantErr: true},
+		{name: "не hex", open: func() (*Local, error) { return NewKey("0xzz" + testPrivateKey[2:]) }, wantErr: true},
+	}
+
+	chainID := big.NewInt(31337)
+	to := common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8")
+	tx := types.NewTx(&types.DynamicFeeTx{ChainID: chainID, Nonce: 1, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2), Gas: 21000, To: &to, Value: big.NewInt(5)})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, err := tt.open()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if local.Address() != common.HexToAddress(testKeyAddress) {
+				t.Fatalf("Address() = %s, want %s", local.Address().Hex(), testKeyAddress)
+			}
+
+			signed, err := local.SignTx(context.Background(), tx, chainID)
+			if err != nil {
+				t.Fatalf("SignTx() error = %v", err)
+			}
+			raw, err := signed.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded := new(types.Transaction)
+			if err := decoded.UnmarshalBinary(raw); err != nil {
+				t.Fatalf("разбор подписанной транзакции %s: %v", hexutil.Encode(raw), err)
+			}
+			sender, err := types.Sender(types.LatestSignerForChainID(chainID), decoded)
+			if err != nil || sender != local.Address() {
+				t.Errorf("подписавший = %s (%v), want %s", sender.Hex(), err, local.Address().Hex())
+			}
+			if decoded.Hash() != signed.Hash() {
+				t.Errorf("хеш после разбора %s, want %s", decoded.Hash().Hex(), signed.Hash().Hex())
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package signer
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// Remote подписывает транзакции во внешнем сервисе по JSON-RPC API clef:
+// account_list и account_signTransaction. Ключ не покидает сервис подписи.
+type Remote struct {
+	client  *rpc.Client
+	address common.Address
+}
+
+// SignTransactionResult — ответ account_signTransaction
+type SignTransactionResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
+}
+
+// NewRemote подключается к сервису подписи url и проверяет, что он управляет
+// аккаунтом account. Нулевой account допустим, если у сервиса ровно один аккаунт.
+func NewRemote(ctx context.Context, url string, account common.Address) (*Remote, error) {
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к сервису подписи: %w", err)
+	}
+
+	var accounts []common.Address
+	if err := client.CallContext(ctx, &accounts, "account_list"); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("ошибка получения аккаунтов сервиса подписи: %w", err)
+	}
+	switch {
+	case account == (common.Address{}) && len(accounts) == 1:
+		account = accounts[0]
+	case account == (common.Address{}):
+		client.Close()
+		return nil, fmt.Errorf("сервис подписи управляет %d аккаунтами, нужен SIGNER_ADDRESS", len(accounts))
+	case !slices.Contains(accounts, account):
+		client.Close()
+		return nil, fmt.Errorf("сервис подписи не управляет аккаунтом %s", account.Hex())
+	}
+	return &Remote{client: client, address: account}, nil
+}
+
+func (r *Remote) Address() common.Address {
+	return r.address
+}
+
+// SignTx отправляет поля транзакции сервису подписи и проверяет, что подписана
+// именно она и именно аккаунтом r
+func (r *Remote) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	from := common.NewMixedcaseAddress(r.address)
+	data := hexutil.Bytes(tx.Data())
+	args := apitypes.SendTxArgs{
+		From:    from,
+		Gas:     hexutil.Uint64(tx.Gas()),
+		Value:   hexutil.Big(*tx.Value()),
+		Nonce:   hexutil.Uint64(tx.Nonce()),
+		Input:   &data,
+		ChainID: (*hexutil.Big)(chainID),
+	}
+	if to := tx.To(); to != nil {
+		mixed := common.NewMixedcaseAddress(*to)
+		args.To = &mixed
+	}
+	switch tx.Type() {
+	case types.LegacyTxType:
+		args.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	case types.DynamicFeeTxType:
+		args.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		args.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+	default:
+		return nil, fmt.Errorf("тип транзакции %d не поддерживается сервисом подписи", tx.Type())
+	}
+
+	var result SignTransactionResult
+	if err := r.client.CallContext(ctx, &result, "account_signTransaction", args); err != nil {
+		return nil, fmt.Errorf("ошибка подписи транзакции сервисом: %w", err)
+	}
+
+	signed := new(types.Transaction)
+	if err := signed.UnmarshalBinary(result.Raw); err != nil {
+		return nil, fmt.Errorf("ошибка разбора подписанной транзакции: %w", err)
+	}
+	txSigner := types.LatestSignerForChainID(chainID)
+	sender, err := types.Sender(txSigner, signed)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка проверки подписи транзакции: %w", err)
+	}
+	if sender != r.address || txSigner.Hash(signed) != txSigner.Hash(tx) {
+		return nil, ErrSignerMismatch
+	}
+	return signed, nil
+}
+
+// Close закрывает соединение с сервисом подписи
+func (r *Remote) Close() {
+	r.client.Close()
+}
@@ -0,0 +1,219 @@
+package signer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// testAccountAPI — сервис подписи с API account_* как у clef. signWith и modify
+// позволяют вернуть транзакцию, подписанную другим ключом или отличную от запрошенной.
+type testAccountAPI struct {
+	accounts []*Local
+	signWith *Local
+	modify   func(tx *types.Transaction) *types.Transaction
+}
+
+func (a *testAccountAPI) List() []common.Address {
+	addrs := make([]common.Address, len(a.accounts))
+	for i, l := range a.accounts {
+		addrs[i] = l.Address()
+	}
+	return addrs
+}
+
+func (a *testAccountAPI) SignTransaction(ctx context.Context, args apitypes.SendTxArgs, methodSelector *string) (*SignTransactionResult, error) {
+	key := a.signWith
+	for _, l := range a.accounts {
+		if key == nil && l.Address() == args.From.Address() {
+			key = l
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("неизвестный аккаунт %s", args.From.Address().Hex())
+	}
+	tx, err := args.ToTransaction()
+	if err != nil {
+		return nil, err
+	}
+	if a.modify != nil {
+		tx = a.modify(tx)
+	}
+	signed, err := key.SignTx(ctx, tx, args.ChainID.ToInt())
+	if err != nil {
+		return nil, err
+	}
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &SignTransactionResult{Raw: raw, Tx: signed}, nil
+}
+
+// startSigner запускает сервис подписи api и возвращает его адрес
+func startSigner(t *testing.T, api *testAccountAPI) string {
+	t.Helper()
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", api); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(server)
+	t.Cleanup(func() {
+		ts.Close()
+		server.Stop()
+	})
+	return ts.URL
+}
+
+func newTestKey(t *testing.T) *Local {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Local{key: key, address: crypto.PubkeyToAddress(key.PublicKey)}
+}
+
+func TestNewRemoteAccountSelection(t *testing.T) {
+	first, second, unknown := newTestKey(t), newTestKey(t), newTestKey(t)
+
+	tests := []struct {
+		name     string
+		accounts []*Local
+		account  common.Address
+		want     common.Address
+		wantErr  bool
+	}{
+		{name: "единственный аккаунт без SIGNER_ADDRESS", accounts: []*Local{first}, want: first.Address()},
+		{name: "единственный аккаунт задан явно", accounts: []*Local{first}, account: first.Address(), want: first.Address()},
+		{name: "второй из нескольких", accounts: []*Local{first, second}, account: second.Address(), want: second.Address()},
+		{name: "несколько аккаунтов без SIGNER_ADDRESS", accounts: []*Local{first, second}, wantErr: true},
+		{name: "аккаунт не управляется сервисом", accounts: []*Local{first, second}, account: unknown.Address(), wantErr: true},
+		{name: "у сервиса нет аккаунтов", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := startSigner(t, &testAccountAPI{accounts: tt.accounts})
+			remote, err := NewRemote(context.Background(), url, tt.account)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewRemote() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer remote.Close()
+			if remote.Address() != tt.want {
+				t.Errorf("NewRemote().Address() = %s, want %s", remote.Address().Hex(), tt.want.Hex())
+			}
+		})
+	}
+}
+
+func TestRemoteSignTx(t *testing.T) {
+	account, other := newTestKey(t), newTestKey(t)
+	chainID := big.NewInt(1337)
+	to := common.HexToAddress("0x5B38Da6a701c568545dCfcB03FcB875f56beddC4")
+
+	legacy := types.NewTx(&types.LegacyTx{Nonce: 3, GasPrice: big.NewInt(20_000_000_000), Gas: 21000, To: &to, Value: big.NewInt(1)})
+	dynamic := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     7,
+		GasTipCap: big.NewInt(1_000_000_000),
+		GasFeeCap: big.NewInt(30_000_000_000),
+		Gas:       90000,
+		To:        &to,
+		Data:      []byte{0xde, 0xad, 0xbe, 0xef},
+	})
+	deploy := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainID,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(2),
+		Gas:       500000,
+		Data:      []byte{0x60, 0x80},
+	})
+
+	tests := []struct {
+		name    string
+		api     *testAccountAPI
+		tx      *types.Transaction
+		wantErr error
+	}{
+		{name: "legacy", api: &testAccountAPI{accounts: []*Local{account}}, tx: legacy},
+		{name: "EIP-1559 с данными", api: &testAccountAPI{accounts: []*Local{account}}, tx: dynamic},
+		{name: "создание контракта", api: &testAccountAPI{accounts: []*Local{account}}, tx: deploy},
+		{
+			name:    "подписано другим ключом",
+			api:     &testAccountAPI{accounts: []*Local{account}, signWith: other},
+			tx:      dynamic,
+			wantErr: ErrSignerMismatch,
+		},
+		{
+			name: "изменён nonce",
+			api: &testAccountAPI{accounts: []*Local{account}, modify: func(tx *types.Transaction) *types.Transaction {
+				return types.NewTx(&types.DynamicFeeTx{
+					ChainID:   tx.ChainId(),
+					Nonce:     tx.Nonce() + 1,
+					GasTipCap: tx.GasTipCap(),
+					GasFeeCap: tx.GasFeeCap(),
+					Gas:       tx.Gas(),
+					To:        tx.To(),
+					Value:     tx.Value(),
+					Data:      tx.Data(),
+				})
+			}},
+			tx:      dynamic,
+			wantErr: ErrSignerMismatch,
+		},
+		{
+			name: "изменён получатель",
+			api: &testAccountAPI{accounts: []*Local{account}, modify: func(tx *types.Transaction) *types.Transaction {
+				return types.NewTx(&types.LegacyTx{Nonce: tx.Nonce(), GasPrice: tx.GasPrice(), Gas: tx.Gas(), To: &common.Address{}, Value: tx.Value()})
+			}},
+			tx:      legacy,
+			wantErr: ErrSignerMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote, err := NewRemote(context.Background(), startSigner(t, tt.api), account.Address())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer remote.Close()
+
+			signed, err := remote.SignTx(context.Background(), tt.tx, chainID)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("SignTx() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SignTx() error = %v", err)
+			}
+
+			txSigner := types.LatestSignerForChainID(chainID)
+			sender, err := types.Sender(txSigner, signed)
+			if err != nil {
+				t.Fatalf("types.Sender() error = %v", err)
+			}
+			if sender != account.Address() {
+				t.Errorf("подписавший = %s, want %s", sender.Hex(), account.Address().Hex())
+			}
+			if txSigner.Hash(signed) != txSigner.Hash(tt.tx) {
+				t.Errorf("подписана другая транзакция")
+			}
+		})
+	}
+}
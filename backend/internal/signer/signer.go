@@ -0,0 +1,71 @@
+// Package signer подписывает транзакции ключом аккаунта платформы. Ключ хранится
+// в зашифрованном keystore-файле go-ethereum, во внешнем сервисе подписи или,
+// для разработки, передаётся в переменной окружения.
+package signer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Signer подписывает транзакции одного аккаунта
+type Signer interface {
+	// Address возвращает адрес аккаунта, которым подписываются транзакции
+	Address() common.Address
+	// SignTx возвращает транзакцию tx, подписанную для сети chainID
+	SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+}
+
+// ErrSignerMismatch возвращается, если сервис подписи вернул транзакцию, которая
+// отличается от запрошенной или подписана другим аккаунтом
+var ErrSignerMismatch = errors.New("сервис подписи вернул другую транзакцию")
+
+// FromEnv создаёт подписанта по переменным окружения:
+//   - SIGNER_URL и SIGNER_ADDRESS — внешний сервис подписи с API account_* (clef);
+//   - SIGNER_KEYSTORE и SIGNER_PASSWORD или SIGNER_PASSWORD_FILE — keystore-файл;
+//   - RELAYER_PRIVATE_KEY — закрытый ключ в hex, только для разработки.
+//
+// Если ничего не задано, возвращается nil без ошибки.
+func FromEnv(ctx context.Context) (Signer, error) {
+	configured := 0
+	for _, name := range []string{"SIGNER_URL", "SIGNER_KEYSTORE", "RELAYER_PRIVATE_KEY"} {
+		if os.Getenv(name) != "" {
+			configured++
+		}
+	}
+	if configured > 1 {
+		return nil, errors.New("задано несколько источников ключа: SIGNER_URL, SIGNER_KEYSTORE и RELAYER_PRIVATE_KEY взаимоисключающие")
+	}
+
+	switch {
+	case os.Getenv("SIGNER_URL") != "":
+		var account common.Address
+		if v := os.Getenv("SIGNER_ADDRESS"); v != "" {
+			if !common.IsHexAddress(v) {
+				return nil, fmt.Errorf("некорректный SIGNER_ADDRESS: %s", v)
+			}
+			account = common.HexToAddress(v)
+		}
+		return NewRemote(ctx, os.Getenv("SIGNER_URL"), account)
+	case os.Getenv("SIGNER_KEYSTORE") != "":
+		password := os.Getenv("SIGNER_PASSWORD")
+		if path := os.Getenv("SIGNER_PASSWORD_FILE"); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("ошибка чтения пароля keystore: %w", err)
+			}
+			password = strings.TrimRight(string(data), "\r\n")
+		}
+		return NewKeystore(os.Getenv("SIGNER_KEYSTORE"), password)
+	case os.Getenv("RELAYER_PRIVATE_KEY") != "":
+		return NewKey(os.Getenv("RELAYER_PRIVATE_KEY"))
+	}
+	return nil, nil
+}
@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/polonkoevv/ethcourse/internal/contract"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// GetTrackEarnings агрегирует проиндексированные покупки по периодам, продавцам и трекам.
+// Комиссия считается для каждой покупки отдельно с округлением вниз, как в контракте.
+func (p *Postgres) GetTrackEarnings(ctx context.Context, filter model.EarningsFilter) ([]model.TrackEarnings, error) {
+	var conds []string
+	args := []interface{}{filter.GroupBy, contract.PlatformFeePercent}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.OwnerAddr != "" {
+		conds = append(conds, "lower(p.seller_addr) = lower("+arg(filter.OwnerAddr)+")")
+	}
+	if filter.ChainID != nil {
+		conds = append(conds, "p.chain_id = "+arg(int64(*filter.ChainID)))
+	}
+	if filter.MusicID != nil {
+		conds = append(conds, "m.music_id = "+arg(*filter.MusicID))
+	}
+	if filter.From != nil {
+		conds = append(conds, "p.block_time >= "+arg(*filter.From))
+	}
+	if filter.To != nil {
+		conds = append(conds, "p.block_time < "+arg(*filter.To))
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	rows, err := p.conn.Query(ctx, `SELECT date_trunc($1, p.block_time AT TIME ZONE 'UTC') AS period,
+			p.seller_addr, p.chain_id, p.audio_id, m.music_id, COALESCE(m.title, ''), COALESCE(m.artist, ''),
+			count(*), sum(p.amount_wei)::text, sum(div(p.amount_wei * $2, 100))::text,
+			(sum(p.amount_wei) - sum(div(p.amount_wei * $2, 100)))::text
+		FROM audio_purchases p LEFT JOIN music m ON m.chain_id = p.chain_id AND m.audio_id = p.audio_id
+		`+where+`
+		GROUP BY 1, 2, 3, 4, 5, 6, 7
+		ORDER BY 1, 2, 3, 4`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []model.TrackEarnings
+	for rows.Next() {
+		var e model.TrackEarnings
+		var chainID, audioID int64
+		if err := rows.Scan(&e.Period, &e.OwnerAddr, &chainID, &audioID, &e.MusicID, &e.Title, &e.Artist,
+			&e.Sales, &e.GrossWei, &e.PlatformFeeWei, &e.NetWei); err != nil {
+			return nil, err
+		}
+		e.ChainID, e.AudioID = uint64(chainID), uint64(audioID)
+		result = append(result, e)
+	}
+	return result, rows.Err()
+}
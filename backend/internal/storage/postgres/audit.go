@@ -0,0 +1,197 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/audit"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// ErrSignatureReused возвращается при повторном использовании подписи из журнала аудита
+var ErrSignatureReused = errors.New("подпись уже использована")
+
+// auditLockID — ключ advisory-блокировки, упорядочивающей добавление записей в цепочку
+const auditLockID = 0x617564697400
+
+const auditColumns = "entry_id, action, music_id, recovered_addr, message, signature, details, created_at, prev_hash, address_prev_hash, music_prev_hash, entry_hash"
+
+// lastAuditHash возвращает хеш последней записи, удовлетворяющей условию, или GenesisHash
+func lastAuditHash(ctx context.Context, tx pgx.Tx, where string, args ...interface{}) (string, error) {
+	var hash string
+	err := tx.QueryRow(ctx, "SELECT entry_hash FROM audit_log"+where+" ORDER BY entry_id DESC LIMIT 1", args...).Scan(&hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return audit.GenesisHash, nil
+	}
+	return hash, err
+}
+
+// appendAuditEntry добавляет запись в журнал в рамках транзакции изменения, связывая её
+// с предыдущими записями общей цепочки, цепочки адреса и цепочки трека
+func appendAuditEntry(ctx context.Context, tx pgx.Tx, entry model.AuditEntry) error {
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", auditLockID); err != nil {
+		return err
+	}
+
+	var err error
+	entry.RecoveredAddr = strings.ToLower(entry.RecoveredAddr)
+	// Точность timestamptz — микросекунды; хешируется то же значение, что будет сохранено
+	entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	if entry.PrevHash, err = lastAuditHash(ctx, tx, ""); err != nil {
+		return err
+	}
+	if entry.AddressPrevHash, err = lastAuditHash(ctx, tx, " WHERE recovered_addr = $1", entry.RecoveredAddr); err != nil {
+		return err
+	}
+	entry.MusicPrevHash = audit.GenesisHash
+	if entry.MusicID != nil {
+		if entry.MusicPrevHash, err = lastAuditHash(ctx, tx, " WHERE music_id = $1", *entry.MusicID); err != nil {
+			return err
+		}
+	}
+	entry.EntryHash = audit.EntryHash(entry)
+
+	_, err = tx.Exec(ctx, `INSERT INTO audit_log (action, music_id, recovered_addr, message, signature, details, created_at, prev_hash, address_prev_hash, music_prev_hash, entry_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		entry.Action, entry.MusicID, entry.RecoveredAddr, entry.Message, entry.Signature, entry.Details, entry.CreatedAt,
+		entry.PrevHash, entry.AddressPrevHash, entry.MusicPrevHash, entry.EntryHash)
+	if isUniqueViolation(err) {
+		return ErrSignatureReused
+	}
+	return err
+}
+
+// mergeAuditDetails добавляет в JSON-объект details поле, значение которого известно
+// только после вставки (например, идентификатор новой записи)
+func mergeAuditDetails(details, key string, value interface{}) string {
+	fields := make(map[string]interface{})
+	if details != "" {
+		if err := json.Unmarshal([]byte(details), &fields); err != nil {
+			return details
+		}
+	}
+	fields[key] = value
+	merged, err := json.Marshal(fields)
+	if err != nil {
+		return details
+	}
+	return string(merged)
+}
+
+// IsSignatureUsed сообщает, есть ли подпись в журнале аудита. Окончательно повтор
+// отклоняет уникальный индекс при записи; проверка нужна, чтобы не выполнять работу
+// по заведомо повторному запросу.
+func (p *Postgres) IsSignatureUsed(ctx context.Context, signature string) (bool, error) {
+	var used bool
+	err := p.conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM audit_log WHERE signature = $1)", signature).Scan(&used)
+	return used, err
+}
+
+// AppendAuditEntry добавляет в журнал запись, не связанную с изменением каталога
+func (p *Postgres) AppendAuditEntry(ctx context.Context, entry model.AuditEntry) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := appendAuditEntry(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// UpdateMusicAudited обновляет трек и записывает изменение в журнал аудита
+func (p *Postgres) UpdateMusicAudited(ctx context.Context, music model.Music, entry model.AuditEntry) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "UPDATE music SET title = $1, artist = $2, genre = $3, album = $4, tags = $5, cover_cid = $6 WHERE music_id = $7", music.Title, music.Artist, music.Genre, music.Album, tagsOrEmpty(music.Tags), music.CoverCID, music.ID)
+	if err != nil {
+		return err
+	}
+	if err := appendAuditEntry(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// DeleteMusicAudited удаляет трек и записывает удаление в журнал аудита. Трек с историей
+// передач, распределениями доходов или выплатами скрывается из каталога (см. deleteMusic).
+func (p *Postgres) DeleteMusicAudited(ctx context.Context, id int, entry model.AuditEntry) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := deleteMusic(ctx, tx, id); err != nil {
+		return err
+	}
+	if err := appendAuditEntry(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (p *Postgres) queryAuditEntries(ctx context.Context, where string, arg interface{}) ([]model.AuditEntry, error) {
+	rows, err := p.conn.Query(ctx, "SELECT "+auditColumns+" FROM audit_log WHERE "+where+" ORDER BY entry_id", arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []model.AuditEntry
+	for rows.Next() {
+		var e model.AuditEntry
+		err := rows.Scan(&e.ID, &e.Action, &e.MusicID, &e.RecoveredAddr, &e.Message, &e.Signature, &e.Details, &e.CreatedAt,
+			&e.PrevHash, &e.AddressPrevHash, &e.MusicPrevHash, &e.EntryHash)
+		if err != nil {
+			return nil, err
+		}
+		e.CreatedAt = e.CreatedAt.UTC()
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// RestoreMusicAudited возвращает в каталог трек, скрытый при удалении, и записывает
+// повторную загрузку в журнал аудита
+func (p *Postgres) RestoreMusicAudited(ctx context.Context, id int, entry model.AuditEntry) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "UPDATE music SET deleted_at = NULL WHERE music_id = $1", id); err != nil {
+		return err
+	}
+	entry.MusicID = &id
+	if err := appendAuditEntry(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// GetAuditLog возвращает весь журнал аудита в порядке записи
+func (p *Postgres) GetAuditLog(ctx context.Context) ([]model.AuditEntry, error) {
+	return p.queryAuditEntries(ctx, "entry_id > $1", 0)
+}
+
+// GetAuditEntries возвращает журнал изменений трека в порядке записи
+func (p *Postgres) GetAuditEntries(ctx context.Context, musicID int) ([]model.AuditEntry, error) {
+	return p.queryAuditEntries(ctx, "music_id = $1", musicID)
+}
+
+// GetAuditEntriesByAddress возвращает записи, подписанные адресом, в порядке записи
+func (p *Postgres) GetAuditEntriesByAddress(ctx context.Context, address string) ([]model.AuditEntry, error) {
+	return p.queryAuditEntries(ctx, "recovered_addr = $1", strings.ToLower(address))
+}
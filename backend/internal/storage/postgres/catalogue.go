@@ -0,0 +1,153 @@
+package postgres
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// ErrInvalidCursor возвращается, если курсор пагинации не удалось разобрать
+var ErrInvalidCursor = errors.New("некорректный курсор")
+
+// musicSort описывает ключ сортировки каталога; music_id добавляется для однозначности
+type musicSort struct {
+	expr string // выражение ключа, совпадает с выражением индекса
+	cast string // тип значения ключа в курсоре
+	desc bool
+}
+
+var musicSorts = map[string]musicSort{
+	model.MusicSortNewest:     {expr: "uploaded_at", cast: "timestamptz", desc: true},
+	model.MusicSortTitle:      {expr: "COALESCE(lower(title), '')", cast: "text"},   // без названия в начале
+	model.MusicSortPrice:      {expr: "COALESCE(price_wei, 1e78)", cast: "numeric"}, // неопубликованные в конце
+	model.MusicSortPopularity: {expr: "purchase_count", cast: "integer", desc: true},
+}
+
+// musicCursor — позиция последней записи страницы
+type musicCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+func encodeMusicCursor(c musicCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeMusicCursor(s string) (*musicCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c musicCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// ListMusic возвращает страницу каталога с фильтрами, сортировкой и курсорной пагинацией
+func (p *Postgres) ListMusic(ctx context.Context, filter model.MusicFilter) (*model.MusicPage, error) {
+	sort, ok := musicSorts[filter.Sort]
+	if !ok {
+		return nil, fmt.Errorf("неизвестная сортировка: %s", filter.Sort)
+	}
+
+	// Удалённые треки с историей скрыты из каталога
+	conds := []string{"deleted_at IS NULL"}
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.OwnerAddr != "" {
+		conds = append(conds, "lower(owner_addr) = lower("+arg(filter.OwnerAddr)+")")
+	}
+	if filter.Artist != "" {
+		conds = append(conds, "lower(artist) = lower("+arg(filter.Artist)+")")
+	}
+	if filter.Genre != "" {
+		conds = append(conds, "lower(genre) = lower("+arg(filter.Genre)+")")
+	}
+	if filter.UploadedFrom != nil {
+		conds = append(conds, "uploaded_at >= "+arg(*filter.UploadedFrom))
+	}
+	if filter.UploadedTo != nil {
+		conds = append(conds, "uploaded_at < "+arg(*filter.UploadedTo))
+	}
+	if filter.ForSale != nil {
+		if *filter.ForSale {
+			conds = append(conds, "audio_id IS NOT NULL")
+		} else {
+			conds = append(conds, "audio_id IS NULL")
+		}
+	}
+	if filter.ChainID != nil {
+		conds = append(conds, "chain_id = "+arg(*filter.ChainID))
+	}
+
+	where := " WHERE " + strings.Join(conds, " AND ")
+
+	var page model.MusicPage
+	if err := p.conn.QueryRow(ctx, "SELECT count(*) FROM music"+where, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	if filter.Cursor != "" {
+		cursor, err := decodeMusicCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != filter.Sort {
+			return nil, ErrInvalidCursor
+		}
+		op := ">"
+		if sort.desc {
+			op = "<"
+		}
+		cond := fmt.Sprintf("(%s, music_id) %s (%s::%s, %s)", sort.expr, op, arg(cursor.Value), sort.cast, arg(cursor.ID))
+		where += " AND " + cond
+	}
+
+	dir := "ASC"
+	if sort.desc {
+		dir = "DESC"
+	}
+	query := fmt.Sprintf("SELECT %s, (%s)::text FROM music%s ORDER BY %s %s, music_id %s LIMIT %s",
+		musicColumns, sort.expr, where, sort.expr, dir, dir, arg(filter.Limit+1))
+
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		// Значение из курсора не приводится к типу ключа сортировки
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && (pgErr.Code == "22P02" || pgErr.Code == "22007" || pgErr.Code == "22008") {
+			return nil, ErrInvalidCursor
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lastKey string
+	for rows.Next() {
+		var key string
+		m, err := scanMusic(rows, &key)
+		if err != nil {
+			return nil, err
+		}
+		if len(page.Music) == filter.Limit {
+			page.NextCursor = encodeMusicCursor(musicCursor{Sort: filter.Sort, Value: lastKey, ID: page.Music[len(page.Music)-1].ID})
+			break
+		}
+		page.Music = append(page.Music, *m)
+		lastKey = key
+	}
+	return &page, rows.Err()
+}
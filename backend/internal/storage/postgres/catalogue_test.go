@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+func TestMusicCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor musicCursor
+	}{
+		{"по дате загрузки", musicCursor{Sort: model.MusicSortNewest, Value: "2024-05-01T10:00:00.123456Z", ID: 42}},
+		{"по цене", musicCursor{Sort: model.MusicSortPrice, Value: "1000000000000000000", ID: 7}},
+		{"по названию с юникодом", musicCursor{Sort: model.MusicSortTitle, Value: "Метель, \"зимняя\"", ID: 1}},
+		{"по названию, трек без названия", musicCursor{Sort: model.MusicSortTitle, Value: "", ID: 3}},
+		{"пустое значение ключа", musicCursor{Sort: model.MusicSortPopularity, Value: "", ID: 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encodeMusicCursor(tt.cursor)
+			got, err := decodeMusicCursor(encoded)
+			if err != nil {
+				t.Fatalf("decodeMusicCursor(%q) error = %v", encoded, err)
+			}
+			if *got != tt.cursor {
+				t.Errorf("decodeMusicCursor(encodeMusicCursor(%+v)) = %+v", tt.cursor, *got)
+			}
+		})
+	}
+}
+
+func TestDecodeMusicCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"не base64", "%%%"},
+		{"стандартный base64 с дополнением", base64.StdEncoding.EncodeToString([]byte(`{"s":"newest"}`))},
+		{"не JSON", base64.RawURLEncoding.EncodeToString([]byte("newest:42"))},
+		{"неверный тип поля", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"newest","v":"x","id":"42"}`))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeMusicCursor(tt.cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("decodeMusicCursor(%q) error = %v, want %v", tt.cursor, err, ErrInvalidCursor)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// linkMusicToChainQuery связывает треки каталога с их публикацией в контракте: трек
+// считается опубликованным, если его владелец вызвал publishAudio с тем же CID.
+// При публикации в нескольких сетях выбирается самая ранняя.
+const linkMusicToChainQuery = `
+	UPDATE music m SET
+		chain_id = p.chain_id,
+		audio_id = p.audio_id,
+		price_wei = p.price_wei,
+		purchase_count = (SELECT count(*) FROM audio_purchases s WHERE s.chain_id = p.chain_id AND s.audio_id = p.audio_id)
+	FROM (
+		SELECT DISTINCT ON (ipfs_hash, lower(owner_addr)) chain_id, audio_id, ipfs_hash, owner_addr, price_wei
+		FROM audio_published
+		ORDER BY ipfs_hash, lower(owner_addr), block_time, chain_id, audio_id
+	) p
+	WHERE p.ipfs_hash = m.cid AND lower(p.owner_addr) = lower(m.owner_addr) AND m.audio_id IS NULL`
+
+// GetLastIndexedBlock возвращает последний обработанный индексатором блок
+func (p *Postgres) GetLastIndexedBlock(ctx context.Context, name string) (uint64, bool, error) {
+	var block int64
+	err := p.conn.QueryRow(ctx, "SELECT last_block FROM indexer_state WHERE name = $1", name).Scan(&block)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return uint64(block), true, nil
+}
+
+// SaveChainEvents атомарно сохраняет события диапазона блоков и сдвигает позицию индексатора
+func (p *Postgres) SaveChainEvents(ctx context.Context, chainID uint64, name string, published []model.AudioPublishedEvent, purchases []model.AudioPurchasedEvent, withdrawals []model.FeeWithdrawal, transfers []model.TokenTransfer, lastBlock uint64) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, e := range published {
+		_, err := tx.Exec(ctx, `INSERT INTO audio_published (chain_id, audio_id, owner_addr, ipfs_hash, price_wei, block_number, block_time, tx_hash, log_index)
+			VALUES ($1, $2, $3, $4, $5::numeric, $6, $7, $8, $9) ON CONFLICT (chain_id, audio_id) DO NOTHING`,
+			int64(chainID), int64(e.AudioID), e.OwnerAddr, e.IPFSHash, e.PriceWei, int64(e.BlockNumber), e.BlockTime, e.TxHash, int64(e.LogIndex))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, e := range purchases {
+		tag, err := tx.Exec(ctx, `INSERT INTO audio_purchases (chain_id, audio_id, buyer_addr, seller_addr, amount_wei, block_number, block_time, tx_hash, log_index)
+			VALUES ($1, $2, $3, $4, $5::numeric, $6, $7, $8, $9) ON CONFLICT (chain_id, tx_hash, log_index) DO NOTHING`,
+			int64(chainID), int64(e.AudioID), e.BuyerAddr, e.SellerAddr, e.AmountWei, int64(e.BlockNumber), e.BlockTime, e.TxHash, int64(e.LogIndex))
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 1 {
+			_, err = tx.Exec(ctx, "UPDATE music SET purchase_count = purchase_count + 1 WHERE chain_id = $1 AND audio_id = $2", int64(chainID), int64(e.AudioID))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, w := range withdrawals {
+		var txIndex *int64
+		if w.TxIndex != nil {
+			v := int64(*w.TxIndex)
+			txIndex = &v
+		}
+		_, err := tx.Exec(ctx, `INSERT INTO fee_withdrawals (chain_id, tx_hash, block_number, tx_index, block_time, caller_addr, recipient_addr, amount_wei)
+			VALUES ($1, NULLIF($2, ''), $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8::numeric) ON CONFLICT DO NOTHING`,
+			int64(chainID), w.TxHash, int64(w.BlockNumber), txIndex, w.BlockTime, w.CallerAddr, w.RecipientAddr, w.AmountWei)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, t := range transfers {
+		tag, err := tx.Exec(ctx, `INSERT INTO token_transfers (chain_id, tx_hash, log_index, token_addr, from_addr, to_addr, amount, block_number, block_time)
+			VALUES ($1, $2, $3, $4, $5, $6, $7::numeric, $8, $9) ON CONFLICT (chain_id, tx_hash, log_index) DO NOTHING`,
+			int64(chainID), t.TxHash, int64(t.LogIndex), t.TokenAddr, t.FromAddr, t.ToAddr, t.Amount, int64(t.BlockNumber), t.BlockTime)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 1 {
+			if _, err := tx.Exec(ctx, linkTokenTransferQuery, int64(chainID), t.TxHash, int64(t.LogIndex)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := tx.Exec(ctx, linkMusicToChainQuery); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, linkRelayedMusicQuery); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO indexer_state (name, last_block, updated_at) VALUES ($1, $2, now())
+		ON CONFLICT (name) DO UPDATE SET last_block = EXCLUDED.last_block, updated_at = now()`, name, int64(lastBlock))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetChainEvents возвращает проиндексированные события сети в блоках [fromBlock, toBlock]
+// вместе с идентификаторами связанных треков
+func (p *Postgres) GetChainEvents(ctx context.Context, chainID, fromBlock, toBlock uint64) ([]model.AudioPublishedEvent, []model.AudioPurchasedEvent, error) {
+	rows, err := p.conn.Query(ctx, `SELECT p.audio_id, p.owner_addr, p.ipfs_hash, p.price_wei::text, p.block_number, p.block_time, p.tx_hash, p.log_index, m.music_id
+		FROM audio_published p LEFT JOIN music m ON m.chain_id = p.chain_id AND m.audio_id = p.audio_id
+		WHERE p.chain_id = $1 AND p.block_number BETWEEN $2 AND $3
+		ORDER BY p.block_number, p.log_index`, int64(chainID), int64(fromBlock), int64(toBlock))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var published []model.AudioPublishedEvent
+	for rows.Next() {
+		var e model.AudioPublishedEvent
+		var audioID, blockNumber, logIndex int64
+		if err := rows.Scan(&audioID, &e.OwnerAddr, &e.IPFSHash, &e.PriceWei, &blockNumber, &e.BlockTime, &e.TxHash, &logIndex, &e.MusicID); err != nil {
+			return nil, nil, err
+		}
+		e.ChainID, e.AudioID, e.BlockNumber, e.LogIndex = chainID, uint64(audioID), uint64(blockNumber), uint(logIndex)
+		published = append(published, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = p.conn.Query(ctx, `SELECT p.audio_id, p.buyer_addr, p.seller_addr, p.amount_wei::text, p.block_number, p.block_time, p.tx_hash, p.log_index, m.music_id
+		FROM audio_purchases p LEFT JOIN music m ON m.chain_id = p.chain_id AND m.audio_id = p.audio_id
+		WHERE p.chain_id = $1 AND p.block_number BETWEEN $2 AND $3
+		ORDER BY p.block_number, p.log_index`, int64(chainID), int64(fromBlock), int64(toBlock))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var purchases []model.AudioPurchasedEvent
+	for rows.Next() {
+		var e model.AudioPurchasedEvent
+		var audioID, blockNumber, logIndex int64
+		if err := rows.Scan(&audioID, &e.BuyerAddr, &e.SellerAddr, &e.AmountWei, &blockNumber, &e.BlockTime, &e.TxHash, &logIndex, &e.MusicID); err != nil {
+			return nil, nil, err
+		}
+		e.ChainID, e.AudioID, e.BlockNumber, e.LogIndex = chainID, uint64(audioID), uint64(blockNumber), uint(logIndex)
+		purchases = append(purchases, e)
+	}
+	return published, purchases, rows.Err()
+}
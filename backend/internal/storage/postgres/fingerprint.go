@@ -0,0 +1,168 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// ErrFlagResolved возвращается при повторном решении по уже рассмотренной пометке
+var ErrFlagResolved = errors.New("пометка уже рассмотрена")
+
+// saveFingerprint сохраняет отпечаток трека и индексирует его суботпечатки для поиска
+func saveFingerprint(ctx context.Context, tx pgx.Tx, musicID int, fingerprint []uint32) error {
+	values := make([]int32, len(fingerprint))
+	for i, h := range fingerprint {
+		values[i] = int32(h)
+	}
+	_, err := tx.Exec(ctx, "INSERT INTO audio_fingerprints (music_id, fingerprint) VALUES ($1, $2) ON CONFLICT (music_id) DO UPDATE SET fingerprint = EXCLUDED.fingerprint", musicID, values)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "DELETE FROM fingerprint_hashes WHERE music_id = $1", musicID)
+	if err != nil {
+		return err
+	}
+
+	// Нулевые и повторяющиеся подряд хеши (тишина, стационарный звук) не индексируем
+	var rows [][]any
+	for i, h := range values {
+		if h == 0 || (i > 0 && h == values[i-1]) {
+			continue
+		}
+		rows = append(rows, []any{h, musicID, i})
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"fingerprint_hashes"}, []string{"hash", "music_id", "position"}, pgx.CopyFromRows(rows))
+	return err
+}
+
+// GetFingerprint возвращает сохранённый отпечаток трека
+func (p *Postgres) GetFingerprint(ctx context.Context, musicID int) ([]uint32, error) {
+	var values []int32
+	err := p.conn.QueryRow(ctx, "SELECT fingerprint FROM audio_fingerprints WHERE music_id = $1", musicID).Scan(&values)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint := make([]uint32, len(values))
+	for i, v := range values {
+		fingerprint[i] = uint32(v)
+	}
+	return fingerprint, nil
+}
+
+// FindFingerprintCandidates ищет треки, у которых больше всего хешей совпадает с отпечатком
+// при одинаковом сдвиге
+func (p *Postgres) FindFingerprintCandidates(ctx context.Context, fingerprint []uint32, limit int) ([]model.FingerprintCandidate, error) {
+	values := make([]int32, len(fingerprint))
+	for i, h := range fingerprint {
+		values[i] = int32(h)
+	}
+
+	rows, err := p.conn.Query(ctx, `
+		SELECT h.music_id, h.position - (q.pos - 1) AS shift, count(*) AS hits
+		FROM unnest($1::integer[]) WITH ORDINALITY AS q(hash, pos)
+		JOIN fingerprint_hashes h ON h.hash = q.hash
+		WHERE q.hash <> 0
+		GROUP BY h.music_id, shift
+		ORDER BY hits DESC
+		LIMIT $2`, values, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []model.FingerprintCandidate
+	for rows.Next() {
+		var c model.FingerprintCandidate
+		if err := rows.Scan(&c.MusicID, &c.Offset, &c.Hits); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+const duplicateFlagColumns = "flag_id, music_id, matched_music_id, uploader_addr, original_owner_addr, bit_error_rate, status, review_note, created_at, reviewed_at"
+
+func scanDuplicateFlag(row pgx.Row) (*model.DuplicateFlag, error) {
+	var flag model.DuplicateFlag
+	err := row.Scan(&flag.ID, &flag.MusicID, &flag.MatchedMusicID, &flag.UploaderAddr, &flag.OriginalOwnerAddr, &flag.BitErrorRate, &flag.Status, &flag.ReviewNote, &flag.CreatedAt, &flag.ReviewedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+// createDuplicateFlag помечает загрузку для проверки администратором
+func createDuplicateFlag(ctx context.Context, tx pgx.Tx, flag model.DuplicateFlag) (int, error) {
+	var id int
+	err := tx.QueryRow(ctx, "INSERT INTO duplicate_flags (music_id, matched_music_id, uploader_addr, original_owner_addr, bit_error_rate) VALUES ($1, $2, $3, $4, $5) RETURNING flag_id", flag.MusicID, flag.MatchedMusicID, flag.UploaderAddr, flag.OriginalOwnerAddr, flag.BitErrorRate).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// GetDuplicateFlags возвращает пометки с заданным статусом (все, если статус пустой)
+func (p *Postgres) GetDuplicateFlags(ctx context.Context, status string) ([]model.DuplicateFlag, error) {
+	rows, err := p.conn.Query(ctx, "SELECT "+duplicateFlagColumns+" FROM duplicate_flags WHERE $1 = '' OR status = $1 ORDER BY created_at", status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flags []model.DuplicateFlag
+	for rows.Next() {
+		flag, err := scanDuplicateFlag(rows)
+		if err != nil {
+			return nil, err
+		}
+		flags = append(flags, *flag)
+	}
+	return flags, rows.Err()
+}
+
+func (p *Postgres) GetDuplicateFlag(ctx context.Context, id int) (*model.DuplicateFlag, error) {
+	return scanDuplicateFlag(p.conn.QueryRow(ctx, "SELECT "+duplicateFlagColumns+" FROM duplicate_flags WHERE flag_id = $1", id))
+}
+
+// ResolveDuplicateFlag записывает решение администратора по ещё не рассмотренной пометке.
+// Если передана запись журнала, в той же транзакции удаляется помеченный трек. Для уже
+// рассмотренной пометки возвращается ErrFlagResolved, и трек не трогается.
+func (p *Postgres) ResolveDuplicateFlag(ctx context.Context, id int, status, note string, reject *model.AuditEntry) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var musicID int
+	err = tx.QueryRow(ctx,
+		`UPDATE duplicate_flags SET status = $1, review_note = $2, reviewed_at = now()
+		 WHERE flag_id = $3 AND status = $4
+		 RETURNING music_id`,
+		status, note, id, model.DuplicateFlagPending).Scan(&musicID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrFlagResolved
+	}
+	if err != nil {
+		return err
+	}
+
+	if reject != nil {
+		deleted, err := deleteMusic(ctx, tx, musicID)
+		if err != nil {
+			return err
+		}
+		// Трек мог быть удалён раньше — тогда в журнал писать нечего
+		if deleted {
+			reject.MusicID = &musicID
+			if err := appendAuditEntry(ctx, tx, *reject); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,18 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// GetMusicByAudioID возвращает трек, опубликованный в контракте сети под audioID
+func (p *Postgres) GetMusicByAudioID(ctx context.Context, chainID, audioID uint64) (*model.Music, error) {
+	return scanMusic(p.conn.QueryRow(ctx, "SELECT "+musicColumns+" FROM music WHERE chain_id = $1 AND audio_id = $2", int64(chainID), int64(audioID)))
+}
+
+// SetMusicMetadataCID сохраняет CID последней закреплённой версии метаданных трека
+func (p *Postgres) SetMusicMetadataCID(ctx context.Context, id int, cid string) error {
+	_, err := p.conn.Exec(ctx, "UPDATE music SET metadata_cid = $1 WHERE music_id = $2", cid, id)
+	return err
+}
@@ -0,0 +1,210 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// ErrNonceTaken возвращается, если nonce уже занят другой исходной транзакцией адреса
+var ErrNonceTaken = errors.New("nonce уже занят другой транзакцией")
+
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+// SaveOutgoingTransaction записывает подписанную транзакцию до её рассылки узлам,
+// чтобы после перезапуска процесса она не потерялась
+func (p *Postgres) SaveOutgoingTransaction(ctx context.Context, tx model.OutgoingTransaction) error {
+	return insertOutgoingTransaction(ctx, p.conn, tx)
+}
+
+func insertOutgoingTransaction(ctx context.Context, db execer, tx model.OutgoingTransaction) error {
+	_, err := db.Exec(ctx, `INSERT INTO outgoing_transactions (tx_hash, chain_id, from_addr, nonce, to_addr, value_wei, gas_limit, gas_fee_cap, gas_tip_cap, raw_tx, purpose, replaces, status)
+		VALUES ($1, $2, $3, $4, $5, $6::numeric, $7, $8::numeric, $9::numeric, $10, $11, $12, $13)`,
+		tx.TxHash, int64(tx.ChainID), tx.FromAddr, int64(tx.Nonce), tx.ToAddr, tx.ValueWei, int64(tx.GasLimit), tx.GasFeeCap, tx.GasTipCap,
+		tx.RawTx, tx.Purpose, tx.Replaces, model.OutgoingTxPending)
+	if isUniqueViolation(err) {
+		return ErrNonceTaken
+	}
+	return err
+}
+
+const outgoingColumns = `tx_hash, chain_id, from_addr, nonce, to_addr, value_wei::text, gas_limit, gas_fee_cap::text, gas_tip_cap::text,
+	raw_tx, purpose, replaces, status, replaced_by, block_number, error, created_at, updated_at`
+
+func scanOutgoingTransaction(row pgx.Row) (*model.OutgoingTransaction, error) {
+	var tx model.OutgoingTransaction
+	var chainID, nonce, gasLimit int64
+	var blockNumber *int64
+	err := row.Scan(&tx.TxHash, &chainID, &tx.FromAddr, &nonce, &tx.ToAddr, &tx.ValueWei, &gasLimit, &tx.GasFeeCap, &tx.GasTipCap,
+		&tx.RawTx, &tx.Purpose, &tx.Replaces, &tx.Status, &tx.ReplacedBy, &blockNumber, &tx.Error, &tx.CreatedAt, &tx.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	tx.ChainID, tx.Nonce, tx.GasLimit = uint64(chainID), uint64(nonce), uint64(gasLimit)
+	if blockNumber != nil {
+		v := uint64(*blockNumber)
+		tx.BlockNumber = &v
+	}
+	return &tx, nil
+}
+
+func (p *Postgres) queryOutgoingTransactions(ctx context.Context, query string, args ...interface{}) ([]model.OutgoingTransaction, error) {
+	rows, err := p.conn.Query(ctx, "SELECT "+outgoingColumns+" FROM outgoing_transactions "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var txs []model.OutgoingTransaction
+	for rows.Next() {
+		tx, err := scanOutgoingTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, *tx)
+	}
+	return txs, rows.Err()
+}
+
+func (p *Postgres) GetOutgoingTransaction(ctx context.Context, hash string) (*model.OutgoingTransaction, error) {
+	return scanOutgoingTransaction(p.conn.QueryRow(ctx, "SELECT "+outgoingColumns+" FROM outgoing_transactions WHERE lower(tx_hash) = lower($1)", hash))
+}
+
+// GetOutgoingNonceGroup возвращает все транзакции адреса с данным nonce: исходную и её замены
+func (p *Postgres) GetOutgoingNonceGroup(ctx context.Context, chainID uint64, from string, nonce uint64) ([]model.OutgoingTransaction, error) {
+	return p.queryOutgoingTransactions(ctx, "WHERE chain_id = $1 AND lower(from_addr) = lower($2) AND nonce = $3 ORDER BY created_at",
+		int64(chainID), from, int64(nonce))
+}
+
+// GetPendingOutgoingTransactions возвращает неподтверждённые транзакции адреса в порядке nonce
+func (p *Postgres) GetPendingOutgoingTransactions(ctx context.Context, chainID uint64, from string) ([]model.OutgoingTransaction, error) {
+	return p.queryOutgoingTransactions(ctx, "WHERE chain_id = $1 AND lower(from_addr) = lower($2) AND status = $3 ORDER BY nonce, created_at",
+		int64(chainID), from, model.OutgoingTxPending)
+}
+
+// NonceLock — транзакция базы, удерживающая блокировку выдачи nonce адреса в сети.
+// Блокировка общая для всех процессов с этой базой, например сервера и команд CLI,
+// и держится от выбора nonce до записи транзакции с ним.
+type NonceLock struct {
+	tx      pgx.Tx
+	chainID uint64
+	from    string
+}
+
+// LockOutgoingNonce ожидает и берёт блокировку выдачи nonce адреса from в сети chainID.
+// Блокировка снимается Save или Release.
+func (p *Postgres) LockOutgoingNonce(ctx context.Context, chainID uint64, from string) (*NonceLock, error) {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('outgoing_nonce:' || $1::text || ':' || lower($2)))", int64(chainID), from)
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+	return &NonceLock{tx: tx, chainID: chainID, from: from}, nil
+}
+
+// NextNonce возвращает nonce, следующий за наибольшим у неподтверждённых
+// транзакций адреса; ok = false, если таких нет
+func (l *NonceLock) NextNonce(ctx context.Context) (uint64, bool, error) {
+	var maxNonce *int64
+	err := l.tx.QueryRow(ctx, "SELECT max(nonce) FROM outgoing_transactions WHERE chain_id = $1 AND lower(from_addr) = lower($2) AND status = $3",
+		int64(l.chainID), l.from, model.OutgoingTxPending).Scan(&maxNonce)
+	if err != nil || maxNonce == nil {
+		return 0, false, err
+	}
+	return uint64(*maxNonce) + 1, true, nil
+}
+
+// Save записывает транзакцию с выбранным nonce и снимает блокировку
+func (l *NonceLock) Save(ctx context.Context, tx model.OutgoingTransaction) error {
+	if err := insertOutgoingTransaction(ctx, l.tx, tx); err != nil {
+		return err
+	}
+	return l.tx.Commit(ctx)
+}
+
+// Release снимает блокировку без записи; после Save ничего не делает
+func (l *NonceLock) Release(ctx context.Context) {
+	l.tx.Rollback(ctx)
+}
+
+// ResolveOutgoingNonce отмечает транзакцию, попавшую в блок, и заменённые ею транзакции
+// с тем же nonce
+func (p *Postgres) ResolveOutgoingNonce(ctx context.Context, chainID uint64, from string, nonce uint64, minedHash, status string, blockNumber uint64) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "UPDATE outgoing_transactions SET status = $1, block_number = $2, updated_at = now() WHERE lower(tx_hash) = lower($3)",
+		status, int64(blockNumber), minedHash)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `UPDATE outgoing_transactions SET status = $1, replaced_by = $2, updated_at = now()
+		WHERE chain_id = $3 AND lower(from_addr) = lower($4) AND nonce = $5 AND lower(tx_hash) <> lower($2) AND status = $6`,
+		model.OutgoingTxReplaced, minedHash, int64(chainID), from, int64(nonce), model.OutgoingTxPending)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// FinishOutgoingNonce переводит все неподтверждённые транзакции с данным nonce в
+// состояние replaced (nonce занят неизвестной транзакцией) или dropped
+func (p *Postgres) FinishOutgoingNonce(ctx context.Context, chainID uint64, from string, nonce uint64, status, reason string) error {
+	_, err := p.conn.Exec(ctx, `UPDATE outgoing_transactions SET status = $1, error = $2, updated_at = now()
+		WHERE chain_id = $3 AND lower(from_addr) = lower($4) AND nonce = $5 AND status = $6`,
+		status, reason, int64(chainID), from, int64(nonce), model.OutgoingTxPending)
+	return err
+}
+
+// DropOutgoingTransaction отмечает транзакцию, которую не удалось разослать
+func (p *Postgres) DropOutgoingTransaction(ctx context.Context, hash, reason string) error {
+	_, err := p.conn.Exec(ctx, "UPDATE outgoing_transactions SET status = $1, error = $2, updated_at = now() WHERE lower(tx_hash) = lower($3)",
+		model.OutgoingTxDropped, reason, hash)
+	return err
+}
+
+// Размер выборки отправленных транзакций, если limit не задан
+const defaultOutgoingLimit = 100
+
+// ListOutgoingTransactions возвращает отправленные транзакции, новые первыми
+func (p *Postgres) ListOutgoingTransactions(ctx context.Context, filter model.OutgoingTxFilter) ([]model.OutgoingTransaction, error) {
+	var conditions []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.ChainID != 0 {
+		conditions = append(conditions, "chain_id = "+arg(int64(filter.ChainID)))
+	}
+	if filter.FromAddr != "" {
+		conditions = append(conditions, "lower(from_addr) = lower("+arg(filter.FromAddr)+")")
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = "+arg(filter.Status))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultOutgoingLimit
+	}
+	return p.queryOutgoingTransactions(ctx, where+" ORDER BY created_at DESC LIMIT "+arg(limit))
+}
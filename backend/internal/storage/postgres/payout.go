@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// queueOwnerPayoutsQuery ставит в очередь пересылку доли продавца по каждой покупке
+// трека, опубликованного ретранслятором $2 в сети $1. Доля считается как в purchaseAudio:
+// комиссия $3 процентов округляется вниз.
+const queueOwnerPayoutsQuery = `
+	INSERT INTO owner_payouts (chain_id, purchase_tx_hash, purchase_log_index, music_id, recipient_addr, amount_wei, status)
+	SELECT p.chain_id, p.tx_hash, p.log_index, m.music_id, m.owner_addr, p.amount_wei - div(p.amount_wei * $3, 100), $4
+	FROM audio_purchases p
+	JOIN music m ON m.chain_id = p.chain_id AND m.audio_id = p.audio_id
+	WHERE p.chain_id = $1 AND lower(p.seller_addr) = lower($2) AND lower(m.publisher_addr) = lower($2)
+		AND lower(m.owner_addr) <> lower($2)
+	ON CONFLICT (chain_id, purchase_tx_hash, purchase_log_index) DO NOTHING`
+
+const ownerPayoutColumns = `payout_id, chain_id, purchase_tx_hash, purchase_log_index, music_id, recipient_addr, amount_wei::text,
+	status, tx_hash, error, created_at, updated_at`
+
+func scanOwnerPayout(row pgx.Row) (*model.OwnerPayout, error) {
+	var p model.OwnerPayout
+	var chainID, logIndex int64
+	err := row.Scan(&p.ID, &chainID, &p.PurchaseTxHash, &logIndex, &p.MusicID, &p.RecipientAddr, &p.AmountWei,
+		&p.Status, &p.TxHash, &p.Error, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.ChainID, p.PurchaseLog = uint64(chainID), uint(logIndex)
+	return &p, nil
+}
+
+func (p *Postgres) queryOwnerPayouts(ctx context.Context, sql string, args ...interface{}) ([]model.OwnerPayout, error) {
+	rows, err := p.conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []model.OwnerPayout
+	for rows.Next() {
+		payout, err := scanOwnerPayout(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *payout)
+	}
+	return result, rows.Err()
+}
+
+// QueueOwnerPayouts создаёт пересылки по новым покупкам треков, опубликованных
+// ретранслятором relayer, и возвращает все пересылки сети в очереди или в пути
+func (p *Postgres) QueueOwnerPayouts(ctx context.Context, chainID uint64, relayer string, feePercent int) ([]model.OwnerPayout, error) {
+	_, err := p.conn.Exec(ctx, queueOwnerPayoutsQuery, int64(chainID), relayer, feePercent, model.OwnerPayoutPending)
+	if err != nil {
+		return nil, err
+	}
+	return p.queryOwnerPayouts(ctx, "SELECT "+ownerPayoutColumns+" FROM owner_payouts WHERE chain_id = $1 AND status IN ($2, $3) ORDER BY payout_id",
+		int64(chainID), model.OwnerPayoutPending, model.OwnerPayoutSent)
+}
+
+// SetOwnerPayoutStatus сохраняет состояние пересылки; txHash nil — транзакции нет
+// (пересылка возвращена в очередь)
+func (p *Postgres) SetOwnerPayoutStatus(ctx context.Context, id int, status string, txHash *string, reason string) error {
+	_, err := p.conn.Exec(ctx, "UPDATE owner_payouts SET status = $1, tx_hash = $2, error = $3, updated_at = now() WHERE payout_id = $4",
+		status, txHash, reason, id)
+	return err
+}
+
+// GetOwnerPayouts возвращает пересылки, полученные адресом
+func (p *Postgres) GetOwnerPayouts(ctx context.Context, recipient string) ([]model.OwnerPayout, error) {
+	return p.queryOwnerPayouts(ctx, "SELECT "+ownerPayoutColumns+" FROM owner_payouts WHERE lower(recipient_addr) = lower($1) ORDER BY payout_id DESC",
+		recipient)
+}
@@ -2,15 +2,19 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/polonkoevv/ethcourse/internal/model"
 )
 
 func NewPostgres(host, port, user, password, dbname string) (*Postgres, error) {
 	link := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", user, password, host, port, dbname)
-	conn, err := pgx.Connect(context.Background(), link)
+	// Пул соединений: запросы идут одновременно из HTTP-обработчиков и фоновых задач
+	conn, err := pgxpool.New(context.Background(), link)
 	if err != nil {
 		return nil, err
 	}
@@ -19,29 +23,75 @@ func NewPostgres(host, port, user, password, dbname string) (*Postgres, error) {
 }
 
 type Postgres struct {
-	conn *pgx.Conn
+	conn *pgxpool.Pool
 }
 
-func (p *Postgres) GetMusicById(ctx context.Context, id int) (*model.Music, error) {
+// ErrDuplicateCID возвращается при попытке сохранить второй трек с тем же CID
+var ErrDuplicateCID = errors.New("трек с таким CID уже существует")
+
+// uniqueViolation — код ошибки PostgreSQL при нарушении ограничения уникальности
+const uniqueViolation = "23505"
+
+// foreignKeyViolation — код ошибки PostgreSQL при нарушении внешнего ключа
+const foreignKeyViolation = "23503"
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation
+}
+
+const musicColumns = "music_id, title, artist, genre, album, tags, cid, owner_addr, signature, uploaded_at, integrated_loudness, loudness_range, true_peak, chain_id, audio_id, price_wei::text, audio_id IS NOT NULL, purchase_count, publish_status, publish_tx_hash, publisher_addr, price_token_chain_id, price_token_addr, price_token_symbol, price_token_decimals, price_token_amount::text, duration_seconds, cover_cid, metadata_cid, deleted_at"
+
+// scanMusic считывает строку таблицы music в порядке musicColumns; extra — столбцы,
+// выбранные после них
+func scanMusic(row pgx.Row, extra ...interface{}) (*model.Music, error) {
 	var music model.Music
-	err := p.conn.QueryRow(ctx, "SELECT * FROM music WHERE music_id = $1", id).Scan(&music.ID, &music.Title, &music.CID, &music.OwnerAddr, &music.Signature, &music.UploadedAt)
-	if err != nil {
+	var integrated, lra, truePeak *float64
+	var tokenChainID, tokenDecimals *int64
+	var tokenAddr, tokenSymbol, tokenAmount *string
+	dest := []interface{}{&music.ID, &music.Title, &music.Artist, &music.Genre, &music.Album, &music.Tags, &music.CID, &music.OwnerAddr, &music.Signature, &music.UploadedAt,
+		&integrated, &lra, &truePeak,
+		&music.ChainID, &music.AudioID, &music.PriceWei, &music.ForSale, &music.PurchaseCount,
+		&music.PublishStatus, &music.PublishTxHash, &music.PublisherAddr,
+		&tokenChainID, &tokenAddr, &tokenSymbol, &tokenDecimals, &tokenAmount,
+		&music.Duration, &music.CoverCID, &music.MetadataCID, &music.DeletedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
 		return nil, err
 	}
+	if integrated != nil && lra != nil && truePeak != nil {
+		music.Loudness = model.NewLoudness(*integrated, *lra, *truePeak)
+	}
+	if tokenAddr != nil && tokenChainID != nil && tokenDecimals != nil && tokenAmount != nil {
+		music.TokenPrice = newTokenPrice(uint64(*tokenChainID), *tokenAddr, *tokenSymbol, uint8(*tokenDecimals), *tokenAmount)
+	}
+	music.Link = fmt.Sprintf("http://localhost:8080/ipfs/%s", music.CID)
 	return &music, nil
 }
 
-func (p *Postgres) GetMusicByCID(ctx context.Context, cid string) (*model.Music, error) {
-	var music model.Music
-	err := p.conn.QueryRow(ctx, "SELECT * FROM music WHERE cid = $1", cid).Scan(&music.ID, &music.Title, &music.CID, &music.OwnerAddr, &music.Signature, &music.UploadedAt)
-	if err != nil {
-		return nil, err
+// tagsOrEmpty заменяет nil на пустой массив: столбец tags объявлен NOT NULL
+func tagsOrEmpty(tags []string) []string {
+	if tags == nil {
+		return []string{}
 	}
-	return &music, nil
+	return tags
+}
+
+// GetMusicById возвращает трек по идентификатору, в том числе удалённый с сохранением истории
+func (p *Postgres) GetMusicById(ctx context.Context, id int) (*model.Music, error) {
+	return scanMusic(p.conn.QueryRow(ctx, "SELECT "+musicColumns+" FROM music WHERE music_id = $1", id))
+}
+
+func (p *Postgres) GetMusicByCID(ctx context.Context, cid string) (*model.Music, error) {
+	return scanMusic(p.conn.QueryRow(ctx, "SELECT "+musicColumns+" FROM music WHERE cid = $1", cid))
 }
 
 func (p *Postgres) GetAllMusic(ctx context.Context) ([]model.Music, error) {
-	rows, err := p.conn.Query(ctx, "SELECT * FROM music")
+	rows, err := p.conn.Query(ctx, "SELECT "+musicColumns+" FROM music WHERE deleted_at IS NULL")
 	if err != nil {
 		return nil, err
 	}
@@ -49,38 +99,120 @@ func (p *Postgres) GetAllMusic(ctx context.Context) ([]model.Music, error) {
 
 	var music []model.Music
 	for rows.Next() {
-		var m model.Music
-		err := rows.Scan(&m.ID, &m.Title, &m.CID, &m.OwnerAddr, &m.Signature, &m.UploadedAt)
+		m, err := scanMusic(rows)
 		if err != nil {
 			return nil, err
 		}
-		m.Link = fmt.Sprintf("http://localhost:8080/ipfs/%s", m.CID)
-		music = append(music, m)
+		music = append(music, *m)
 	}
 	return music, nil
 }
 
-func (p *Postgres) CreateMusic(ctx context.Context, music model.Music) (int, error) {
+// CreateMusic сохраняет трек вместе с его акустическим отпечатком и пометкой о дубликате,
+// если они есть, и записывает загрузку в журнал аудита. MusicID пометки и записи журнала
+// заполняется идентификатором нового трека.
+func (p *Postgres) CreateMusic(ctx context.Context, music model.Music, fingerprint []uint32, flag *model.DuplicateFlag, entry model.AuditEntry) (int, error) {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
 	var id int
-	err := p.conn.QueryRow(ctx, "INSERT INTO music (title, cid, owner_addr, signature, uploaded_at) VALUES ($1, $2, $3, $4, $5) RETURNING music_id", music.Title, music.CID, music.OwnerAddr, music.Signature, music.UploadedAt).Scan(&id)
+	err = tx.QueryRow(ctx, "INSERT INTO music (title, artist, genre, album, tags, cid, owner_addr, signature, uploaded_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING music_id", music.Title, music.Artist, music.Genre, music.Album, tagsOrEmpty(music.Tags), music.CID, music.OwnerAddr, music.Signature, music.UploadedAt).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrDuplicateCID
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Трек мог быть опубликован в контракте раньше, чем попал в каталог
+	_, err = tx.Exec(ctx, linkMusicToChainQuery+" AND m.music_id = $1", id)
 	if err != nil {
 		return 0, err
 	}
-	return id, nil
+
+	if fingerprint != nil {
+		if err := saveFingerprint(ctx, tx, id, fingerprint); err != nil {
+			return 0, fmt.Errorf("ошибка сохранения отпечатка: %w", err)
+		}
+	}
+	if flag != nil {
+		flag.MusicID = id
+		if _, err := createDuplicateFlag(ctx, tx, *flag); err != nil {
+			return 0, fmt.Errorf("ошибка создания пометки о дубликате: %w", err)
+		}
+	}
+
+	entry.MusicID = &id
+	if err := appendAuditEntry(ctx, tx, entry); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit(ctx)
 }
 
 func (p *Postgres) UpdateMusic(ctx context.Context, music model.Music) error {
-	_, err := p.conn.Exec(ctx, "UPDATE music SET title = $1, cid = $2, owner_addr = $3, signature = $4, uploaded_at = $5 WHERE music_id = $6", music.Title, music.CID, music.OwnerAddr, music.Signature, music.UploadedAt, music.ID)
+	_, err := p.conn.Exec(ctx, "UPDATE music SET title = $1, artist = $2, genre = $3, album = $4, tags = $5, cid = $6, owner_addr = $7, signature = $8, uploaded_at = $9 WHERE music_id = $10", music.Title, music.Artist, music.Genre, music.Album, tagsOrEmpty(music.Tags), music.CID, music.OwnerAddr, music.Signature, music.UploadedAt, music.ID)
+	if isUniqueViolation(err) {
+		return ErrDuplicateCID
+	}
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (p *Postgres) DeleteMusic(ctx context.Context, id int) error {
-	_, err := p.conn.Exec(ctx, "DELETE FROM music WHERE music_id = $1", id)
+// UpdateMusicLoudness сохраняет результаты измерения громкости и длительность трека;
+// нулевая длительность не сохраняется
+func (p *Postgres) UpdateMusicLoudness(ctx context.Context, id int, loudness model.Loudness, duration float64) error {
+	_, err := p.conn.Exec(ctx, "UPDATE music SET integrated_loudness = $1, loudness_range = $2, true_peak = $3, duration_seconds = COALESCE(NULLIF($4::double precision, 0), duration_seconds) WHERE music_id = $5", loudness.Integrated, loudness.Range, loudness.TruePeak, duration, id)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+func (p *Postgres) DeleteMusic(ctx context.Context, id int) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := deleteMusic(ctx, tx, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// deleteMusic удаляет трек в транзакции tx. Трек, на который ссылаются передачи владения,
+// распределения доходов или выплаты, не удаляется, а скрывается из каталога: ему
+// проставляется deleted_at, история остаётся. Возвращает false, если трека нет или он
+// уже скрыт.
+func deleteMusic(ctx context.Context, tx pgx.Tx, id int) (bool, error) {
+	// Точка сохранения: после ошибки внешнего ключа транзакция продолжается
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	tag, err := savepoint.Exec(ctx, "DELETE FROM music WHERE music_id = $1", id)
+	if isForeignKeyViolation(err) {
+		if err := savepoint.Rollback(ctx); err != nil {
+			return false, err
+		}
+		tag, err = tx.Exec(ctx, "UPDATE music SET deleted_at = now() WHERE music_id = $1 AND deleted_at IS NULL", id)
+		if err != nil {
+			return false, err
+		}
+		return tag.RowsAffected() > 0, nil
+	}
+	if err != nil {
+		savepoint.Rollback(ctx)
+		return false, err
+	}
+	if err := savepoint.Commit(ctx); err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// linkRelayedMusicQuery завершает публикации бэкенда, квитанцию которых не дождались:
+// трек связывается с событием AudioPublished его транзакции
+const linkRelayedMusicQuery = `
+	UPDATE music m SET
+		chain_id = p.chain_id,
+		audio_id = p.audio_id,
+		price_wei = p.price_wei,
+		publish_status = 'published',
+		purchase_count = (SELECT count(*) FROM audio_purchases s WHERE s.chain_id = p.chain_id AND s.audio_id = p.audio_id)
+	FROM audio_published p
+	WHERE m.publish_tx_hash = p.tx_hash AND m.audio_id IS NULL`
+
+// claimMusicPublishQuery помечает неопубликованный трек как публикуемый
+const claimMusicPublishQuery = `UPDATE music SET publish_status = $1, publisher_addr = $2, publish_tx_hash = NULL
+	WHERE music_id = $3 AND audio_id IS NULL AND publish_status IN ('', $4)`
+
+// ClaimMusicPublish помечает трек как публикуемый аккаунтом publisher. Возвращает false,
+// если трек уже опубликован или публикуется.
+func (p *Postgres) ClaimMusicPublish(ctx context.Context, id int, publisher string) (bool, error) {
+	tag, err := p.conn.Exec(ctx, claimMusicPublishQuery, model.PublishStatusPending, publisher, id, model.PublishStatusFailed)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// SetMusicPublishTx сохраняет хеш отправленной транзакции публикации
+func (p *Postgres) SetMusicPublishTx(ctx context.Context, id int, txHash string) error {
+	_, err := p.conn.Exec(ctx, "UPDATE music SET publish_tx_hash = $1 WHERE music_id = $2", txHash, id)
+	return err
+}
+
+// CompleteMusicPublish связывает трек с аудио, опубликованным в контракте сети chainID
+// транзакцией txHash
+func (p *Postgres) CompleteMusicPublish(ctx context.Context, id int, chainID, audioID uint64, priceWei, txHash string) error {
+	_, err := p.conn.Exec(ctx, `UPDATE music SET chain_id = $1, audio_id = $2, price_wei = $3::numeric, publish_status = $4, publish_tx_hash = $5,
+			purchase_count = (SELECT count(*) FROM audio_purchases s WHERE s.chain_id = $1 AND s.audio_id = $2)
+		WHERE music_id = $6`,
+		int64(chainID), int64(audioID), priceWei, model.PublishStatusPublished, txHash, id)
+	return err
+}
+
+// FailMusicPublish отмечает неудачную публикацию; трек можно опубликовать повторно
+func (p *Postgres) FailMusicPublish(ctx context.Context, id int) error {
+	_, err := p.conn.Exec(ctx, "UPDATE music SET publish_status = $1 WHERE music_id = $2 AND audio_id IS NULL",
+		model.PublishStatusFailed, id)
+	return err
+}
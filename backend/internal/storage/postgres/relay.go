@@ -0,0 +1,281 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+var (
+	// ErrIntentNonceUsed возвращается, если адрес уже подписывал намерение с этим nonce
+	ErrIntentNonceUsed = errors.New("nonce намерения уже использован")
+	// ErrMusicNotPublishable возвращается, если трек уже опубликован или публикуется
+	ErrMusicNotPublishable = errors.New("трек уже опубликован или публикуется")
+	// ErrRelayLimit возвращается, если у адреса слишком много активных или недавних намерений
+	ErrRelayLimit = errors.New("превышен лимит намерений адреса")
+	// ErrInsufficientDeposit возвращается, если депозита покупателя не хватает на покупку
+	ErrInsufficientDeposit = errors.New("депозита покупателя не хватает для оплаты покупки")
+)
+
+// CreateRelayIntent сохраняет принятое намерение. Для публикации трек в той же
+// транзакции помечается как публикуемый аккаунтом publisher. Лимиты адреса и его
+// депозит проверяются под блокировкой адреса, чтобы параллельные намерения не
+// потратили один депозит дважды.
+func (p *Postgres) CreateRelayIntent(ctx context.Context, intent model.RelayIntent, publisher string, limits model.RelayLimits) (int, error) {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('relay_signer:' || $1::text || ':' || lower($2)))",
+		int64(intent.ChainID), intent.SignerAddr)
+	if err != nil {
+		return 0, err
+	}
+
+	var active, recent int
+	err = tx.QueryRow(ctx, `SELECT count(*) FILTER (WHERE status IN ($3, $4)), count(*) FILTER (WHERE created_at > now() - interval '1 hour')
+		FROM relay_intents WHERE chain_id = $1 AND lower(signer_addr) = lower($2)`,
+		int64(intent.ChainID), intent.SignerAddr, model.RelayStatusPending, model.RelayStatusSubmitted).Scan(&active, &recent)
+	if err != nil {
+		return 0, err
+	}
+	if active >= limits.MaxActive || recent >= limits.MaxPerHour {
+		return 0, ErrRelayLimit
+	}
+
+	if intent.Type == model.RelayIntentPurchase {
+		balance, err := relayBalance(ctx, tx, intent.ChainID, intent.SignerAddr)
+		if err != nil {
+			return 0, err
+		}
+		available, _ := new(big.Int).SetString(balance.AvailableWei, 10)
+		value, ok := new(big.Int).SetString(intent.ValueWei, 10)
+		if !ok || available == nil || available.Cmp(value) < 0 {
+			return 0, ErrInsufficientDeposit
+		}
+	}
+
+	if intent.Type == model.RelayIntentPublish && intent.MusicID != nil {
+		tag, err := tx.Exec(ctx, claimMusicPublishQuery, model.PublishStatusPending, publisher, *intent.MusicID, model.PublishStatusFailed)
+		if err != nil {
+			return 0, err
+		}
+		if tag.RowsAffected() == 0 {
+			return 0, ErrMusicNotPublishable
+		}
+	}
+
+	var audioID *int64
+	if intent.AudioID != nil {
+		v := int64(*intent.AudioID)
+		audioID = &v
+	}
+	var id int
+	err = tx.QueryRow(ctx, `INSERT INTO relay_intents (chain_id, intent_type, signer_addr, nonce, deadline, audio_id, music_id, value_wei, message, signature, status)
+		VALUES ($1, $2, $3, $4::numeric, $5, $6, $7, $8::numeric, $9, $10, $11) RETURNING intent_id`,
+		int64(intent.ChainID), intent.Type, intent.SignerAddr, intent.Nonce, intent.Deadline, audioID, intent.MusicID,
+		intent.ValueWei, intent.Message, intent.Signature, model.RelayStatusPending).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrIntentNonceUsed
+	}
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit(ctx)
+}
+
+const relayIntentColumns = `intent_id, chain_id, intent_type, signer_addr, nonce::text, deadline, audio_id, music_id, value_wei::text,
+	message, signature, status, tx_hash, attempts, submitted_at, block_number, error, created_at, updated_at`
+
+func scanRelayIntent(row pgx.Row) (*model.RelayIntent, error) {
+	var intent model.RelayIntent
+	var chainID int64
+	var audioID, blockNumber *int64
+	err := row.Scan(&intent.ID, &chainID, &intent.Type, &intent.SignerAddr, &intent.Nonce, &intent.Deadline, &audioID, &intent.MusicID, &intent.ValueWei,
+		&intent.Message, &intent.Signature, &intent.Status, &intent.TxHash, &intent.Attempts, &intent.SubmittedAt, &blockNumber, &intent.Error,
+		&intent.CreatedAt, &intent.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	intent.ChainID = uint64(chainID)
+	if audioID != nil {
+		v := uint64(*audioID)
+		intent.AudioID = &v
+	}
+	if blockNumber != nil {
+		v := uint64(*blockNumber)
+		intent.BlockNumber = &v
+	}
+	return &intent, nil
+}
+
+func (p *Postgres) queryRelayIntents(ctx context.Context, where string, args ...interface{}) ([]model.RelayIntent, error) {
+	rows, err := p.conn.Query(ctx, "SELECT "+relayIntentColumns+" FROM relay_intents WHERE "+where+" ORDER BY intent_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var intents []model.RelayIntent
+	for rows.Next() {
+		intent, err := scanRelayIntent(rows)
+		if err != nil {
+			return nil, err
+		}
+		intents = append(intents, *intent)
+	}
+	return intents, rows.Err()
+}
+
+func (p *Postgres) GetRelayIntent(ctx context.Context, id int) (*model.RelayIntent, error) {
+	return scanRelayIntent(p.conn.QueryRow(ctx, "SELECT "+relayIntentColumns+" FROM relay_intents WHERE intent_id = $1", id))
+}
+
+// GetRelayIntentsBySigner возвращает намерения, подписанные адресом
+func (p *Postgres) GetRelayIntentsBySigner(ctx context.Context, signer string) ([]model.RelayIntent, error) {
+	return p.queryRelayIntents(ctx, "lower(signer_addr) = lower($1)", signer)
+}
+
+// GetActiveRelayIntents возвращает неотправленные и ожидающие включения в блок намерения
+// в порядке поступления
+func (p *Postgres) GetActiveRelayIntents(ctx context.Context) ([]model.RelayIntent, error) {
+	return p.queryRelayIntents(ctx, "status IN ($1, $2)", model.RelayStatusPending, model.RelayStatusSubmitted)
+}
+
+// SaveRelayIntentTx записывает отправленную (или заменившую прежнюю) транзакцию намерения.
+// Для публикации хеш сохраняется и у трека, чтобы индексатор мог завершить публикацию.
+func (p *Postgres) SaveRelayIntentTx(ctx context.Context, id int, txHash string) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	if _, err := tx.Exec(ctx, "INSERT INTO relay_intent_txs (tx_hash, intent_id, submitted_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", txHash, id, now); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `UPDATE relay_intents SET status = $1, tx_hash = $2, attempts = attempts + 1, submitted_at = $3, error = '', updated_at = now()
+		WHERE intent_id = $4`, model.RelayStatusSubmitted, txHash, now, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `UPDATE music m SET publish_tx_hash = $1 FROM relay_intents i
+		WHERE i.intent_id = $2 AND i.intent_type = $3 AND m.music_id = i.music_id AND m.audio_id IS NULL`,
+		txHash, id, model.RelayIntentPublish)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// RequeueRelayIntent возвращает намерение в очередь на отправку новой транзакцией
+func (p *Postgres) RequeueRelayIntent(ctx context.Context, id int, reason string) error {
+	_, err := p.conn.Exec(ctx, "UPDATE relay_intents SET status = $1, error = $2, updated_at = now() WHERE intent_id = $3",
+		model.RelayStatusPending, reason, id)
+	return err
+}
+
+// SetRelayIntentError сохраняет причину неудачной попытки отправки, не меняя состояния
+func (p *Postgres) SetRelayIntentError(ctx context.Context, id int, reason string) error {
+	_, err := p.conn.Exec(ctx, "UPDATE relay_intents SET error = $1, updated_at = now() WHERE intent_id = $2", reason, id)
+	return err
+}
+
+// ConfirmRelayIntent отмечает намерение исполненным транзакцией txHash в блоке blockNumber.
+// Для публикации трек связывается с опубликованным аудио.
+func (p *Postgres) ConfirmRelayIntent(ctx context.Context, intent model.RelayIntent, txHash string, blockNumber, audioID uint64, priceWei string) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `UPDATE relay_intents SET status = $1, tx_hash = $2, block_number = $3, audio_id = $4, error = '', updated_at = now()
+		WHERE intent_id = $5`, model.RelayStatusConfirmed, txHash, int64(blockNumber), int64(audioID), intent.ID)
+	if err != nil {
+		return err
+	}
+	if intent.Type == model.RelayIntentPublish && intent.MusicID != nil {
+		_, err = tx.Exec(ctx, `UPDATE music SET chain_id = $1, audio_id = $2, price_wei = $3::numeric, publish_status = $4, publish_tx_hash = $5,
+				purchase_count = (SELECT count(*) FROM audio_purchases s WHERE s.chain_id = $1 AND s.audio_id = $2)
+			WHERE music_id = $6 AND audio_id IS NULL`,
+			int64(intent.ChainID), int64(audioID), priceWei, model.PublishStatusPublished, txHash, *intent.MusicID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// FinishRelayIntent переводит намерение в конечное состояние failed или expired.
+// Публикация трека при этом отмечается неудачной, чтобы её можно было повторить.
+func (p *Postgres) FinishRelayIntent(ctx context.Context, intent model.RelayIntent, status, reason string) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "UPDATE relay_intents SET status = $1, error = $2, updated_at = now() WHERE intent_id = $3",
+		status, reason, intent.ID)
+	if err != nil {
+		return err
+	}
+	if intent.Type == model.RelayIntentPublish && intent.MusicID != nil {
+		_, err = tx.Exec(ctx, "UPDATE music SET publish_status = $1 WHERE music_id = $2 AND audio_id IS NULL",
+			model.PublishStatusFailed, *intent.MusicID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// SaveRelayDeposit сохраняет подтверждённый перевод ETH на адрес ретранслятора.
+// Повторная регистрация той же транзакции ничего не меняет.
+func (p *Postgres) SaveRelayDeposit(ctx context.Context, d model.RelayDeposit) error {
+	_, err := p.conn.Exec(ctx, `INSERT INTO relay_deposits (chain_id, tx_hash, depositor_addr, funder_addr, relayer_addr, amount_wei, block_number)
+		VALUES ($1, $2, $3, $4, $5, $6::numeric, $7) ON CONFLICT (chain_id, tx_hash) DO NOTHING`,
+		int64(d.ChainID), d.TxHash, d.DepositorAddr, d.FunderAddr, d.RelayerAddr, d.AmountWei, int64(d.BlockNumber))
+	return err
+}
+
+// GetRelayBalance возвращает депозит адреса в сети и сумму, зарезервированную его покупками
+func (p *Postgres) GetRelayBalance(ctx context.Context, chainID uint64, address string) (*model.RelayBalance, error) {
+	return relayBalance(ctx, p.conn, chainID, address)
+}
+
+// querier — общий метод пула и транзакции
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// relayBalance считает депозит адреса. Покупки, не попавшие в блок или отменённые
+// контрактом, резерв не занимают: отправленное с транзакцией ETH в этом случае не списывается.
+func relayBalance(ctx context.Context, q querier, chainID uint64, address string) (*model.RelayBalance, error) {
+	balance := model.RelayBalance{ChainID: chainID, Address: address}
+	err := q.QueryRow(ctx, `SELECT
+			COALESCE((SELECT sum(amount_wei) FROM relay_deposits WHERE chain_id = $1 AND lower(depositor_addr) = lower($2)), 0)::text,
+			COALESCE((SELECT sum(value_wei) FROM relay_intents WHERE chain_id = $1 AND lower(signer_addr) = lower($2)
+				AND intent_type = $3 AND status NOT IN ($4, $5)), 0)::text`,
+		int64(chainID), address, model.RelayIntentPurchase, model.RelayStatusFailed, model.RelayStatusExpired).
+		Scan(&balance.DepositedWei, &balance.ReservedWei)
+	if err != nil {
+		return nil, err
+	}
+	deposited, _ := new(big.Int).SetString(balance.DepositedWei, 10)
+	reserved, _ := new(big.Int).SetString(balance.ReservedWei, 10)
+	if deposited == nil || reserved == nil {
+		return nil, fmt.Errorf("некорректный депозит адреса %s: %s / %s", address, balance.DepositedWei, balance.ReservedWei)
+	}
+	balance.AvailableWei = new(big.Int).Sub(deposited, reserved).String()
+	return &balance, nil
+}
@@ -0,0 +1,217 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// ErrShareNotPending возвращается, если у распределения нет неподписанной доли этого адреса
+var ErrShareNotPending = errors.New("доля уже подписана или адрес не участвует в распределении")
+
+// CreateSplit сохраняет предложенное распределение. Доля предложившего считается
+// подписанной его подписью предложения; распределение из одной доли сразу вступает в силу.
+func (p *Postgres) CreateSplit(ctx context.Context, split model.RoyaltySplit, entry model.AuditEntry) (int, error) {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	err = tx.QueryRow(ctx, `INSERT INTO royalty_splits (music_id, proposer_addr, status, proposal_message, proposal_signature)
+		VALUES ($1, $2, $3, $4, $5) RETURNING split_id`,
+		split.MusicID, split.ProposerAddr, model.SplitPending, split.ProposalMessage, split.ProposalSignature).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, share := range split.Shares {
+		_, err := tx.Exec(ctx, `INSERT INTO royalty_split_shares (split_id, address, bps, role, approval_message, approval_signature, approved_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			id, share.Address, share.BPS, share.Role, share.ApprovalMessage, share.ApprovalSignature, share.ApprovedAt)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := activateSplitIfApproved(ctx, tx, id); err != nil {
+		return 0, err
+	}
+	entry.Details = mergeAuditDetails(entry.Details, "split_id", id)
+	if err := appendAuditEntry(ctx, tx, entry); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit(ctx)
+}
+
+// ApproveSplitShare записывает подпись участника под своей долей
+func (p *Postgres) ApproveSplitShare(ctx context.Context, splitID int, address, message, signature string, entry model.AuditEntry) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `UPDATE royalty_split_shares sh SET approval_message = $1, approval_signature = $2, approved_at = now()
+		FROM royalty_splits s
+		WHERE sh.split_id = s.split_id AND s.split_id = $3 AND s.status = $4
+			AND lower(sh.address) = lower($5) AND sh.approved_at IS NULL`,
+		message, signature, splitID, model.SplitPending, address)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrShareNotPending
+	}
+
+	if err := activateSplitIfApproved(ctx, tx, splitID); err != nil {
+		return err
+	}
+	if err := appendAuditEntry(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// activateSplitIfApproved вводит распределение в действие, когда подписаны все доли,
+// и помечает предыдущее действующее распределение трека как заменённое
+func activateSplitIfApproved(ctx context.Context, tx pgx.Tx, splitID int) error {
+	var musicID, unsigned int
+	err := tx.QueryRow(ctx, `SELECT s.music_id, count(*) FILTER (WHERE sh.approved_at IS NULL)
+		FROM royalty_splits s JOIN royalty_split_shares sh USING (split_id)
+		WHERE s.split_id = $1 GROUP BY s.music_id`, splitID).Scan(&musicID, &unsigned)
+	if err != nil || unsigned > 0 {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE royalty_splits SET status = $1 WHERE music_id = $2 AND status = $3",
+		model.SplitSuperseded, musicID, model.SplitActive)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "UPDATE royalty_splits SET status = $1, activated_at = now() WHERE split_id = $2",
+		model.SplitActive, splitID)
+	return err
+}
+
+const splitColumns = "split_id, music_id, proposer_addr, status, proposal_message, proposal_signature, created_at, activated_at"
+
+func (p *Postgres) querySplits(ctx context.Context, where string, args ...interface{}) ([]model.RoyaltySplit, error) {
+	rows, err := p.conn.Query(ctx, "SELECT "+splitColumns+" FROM royalty_splits WHERE "+where+" ORDER BY split_id", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var splits []model.RoyaltySplit
+	for rows.Next() {
+		var s model.RoyaltySplit
+		err := rows.Scan(&s.ID, &s.MusicID, &s.ProposerAddr, &s.Status, &s.ProposalMessage, &s.ProposalSignature, &s.CreatedAt, &s.ActivatedAt)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		splits = append(splits, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range splits {
+		if splits[i].Shares, err = p.getSplitShares(ctx, splits[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return splits, nil
+}
+
+func (p *Postgres) getSplitShares(ctx context.Context, splitID int) ([]model.RoyaltyShare, error) {
+	rows, err := p.conn.Query(ctx, `SELECT address, bps, role, approval_message, approval_signature, approved_at
+		FROM royalty_split_shares WHERE split_id = $1 ORDER BY bps DESC, address`, splitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []model.RoyaltyShare
+	for rows.Next() {
+		var sh model.RoyaltyShare
+		if err := rows.Scan(&sh.Address, &sh.BPS, &sh.Role, &sh.ApprovalMessage, &sh.ApprovalSignature, &sh.ApprovedAt); err != nil {
+			return nil, err
+		}
+		shares = append(shares, sh)
+	}
+	return shares, rows.Err()
+}
+
+func (p *Postgres) GetSplit(ctx context.Context, id int) (*model.RoyaltySplit, error) {
+	splits, err := p.querySplits(ctx, "split_id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(splits) == 0 {
+		return nil, pgx.ErrNoRows
+	}
+	return &splits[0], nil
+}
+
+// GetSplitsByMusic возвращает все распределения трека в порядке создания
+func (p *Postgres) GetSplitsByMusic(ctx context.Context, musicID int) ([]model.RoyaltySplit, error) {
+	return p.querySplits(ctx, "music_id = $1", musicID)
+}
+
+// GetPurchasesByMusic возвращает проиндексированные покупки трека в порядке блоков
+func (p *Postgres) GetPurchasesByMusic(ctx context.Context, musicID int) ([]model.AudioPurchasedEvent, error) {
+	rows, err := p.conn.Query(ctx, `SELECT p.chain_id, p.audio_id, p.buyer_addr, p.seller_addr, p.amount_wei::text, p.block_number, p.block_time, p.tx_hash, p.log_index
+		FROM audio_purchases p JOIN music m ON m.chain_id = p.chain_id AND m.audio_id = p.audio_id
+		WHERE m.music_id = $1
+		ORDER BY p.block_number, p.log_index`, musicID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var purchases []model.AudioPurchasedEvent
+	for rows.Next() {
+		var e model.AudioPurchasedEvent
+		var chainID, audioID, blockNumber, logIndex int64
+		if err := rows.Scan(&chainID, &audioID, &e.BuyerAddr, &e.SellerAddr, &e.AmountWei, &blockNumber, &e.BlockTime, &e.TxHash, &logIndex); err != nil {
+			return nil, err
+		}
+		e.ChainID, e.AudioID, e.BlockNumber, e.LogIndex = uint64(chainID), uint64(audioID), uint64(blockNumber), uint(logIndex)
+		purchases = append(purchases, e)
+	}
+	return purchases, rows.Err()
+}
+
+// GetPayeeMusicIDs возвращает треки, доходы от которых причитаются адресу: он продавец
+// в покупках, владелец трека, опубликованного бэкендом, или участник вступившего
+// в силу распределения
+func (p *Postgres) GetPayeeMusicIDs(ctx context.Context, address string) ([]int, error) {
+	rows, err := p.conn.Query(ctx, `
+		SELECT m.music_id FROM music m JOIN audio_purchases p ON p.chain_id = m.chain_id AND p.audio_id = m.audio_id
+		WHERE lower(p.seller_addr) = lower($1)
+		UNION
+		SELECT music_id FROM music WHERE publisher_addr IS NOT NULL AND audio_id IS NOT NULL AND lower(owner_addr) = lower($1)
+		UNION
+		SELECT s.music_id FROM royalty_splits s JOIN royalty_split_shares sh USING (split_id)
+		WHERE s.status <> $2 AND lower(sh.address) = lower($1)
+		ORDER BY 1`, address, model.SplitPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
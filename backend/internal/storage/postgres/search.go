@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"context"
+	"html"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// Минимальное сходство триграмм для нечёткого поиска
+const fuzzyThreshold = 0.3
+
+// ts_headline обрамляет совпадения символами из области частного использования Unicode,
+// а не тегами: поля трека задаёт загрузивший, и в HTML они попадают только после
+// экранирования. Эти символы из полей удаляются, чтобы их нельзя было подделать.
+const (
+	headlineStart   = "\uE000"
+	headlineStop    = "\uE001"
+	headlineOptions = "StartSel=" + headlineStart + ", StopSel=" + headlineStop + ", HighlightAll=true"
+)
+
+// prefixTSQuery строит запрос to_tsquery, в котором каждое слово ищется по префиксу:
+// "мет гал" → "мет:* & гал:*". Пустая строка означает, что слов в запросе нет.
+func prefixTSQuery(q string) string {
+	words := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// SearchMusic ищет треки полнотекстовым поиском с весами title > artist > album > tags.
+// Если точных совпадений нет, выполняется нечёткий поиск по триграммам.
+func (p *Postgres) SearchMusic(ctx context.Context, q string, limit int) ([]model.SearchResult, error) {
+	tsquery := prefixTSQuery(q)
+	if tsquery == "" {
+		return nil, nil
+	}
+
+	rows, err := p.conn.Query(ctx, `
+		SELECT `+musicColumns+`,
+			ts_rank_cd(search_vector, query) AS score,
+			ts_headline('simple', translate(title, $4, ''), query, $3),
+			ts_headline('simple', translate(artist, $4, ''), query, $3),
+			ts_headline('simple', translate(album, $4, ''), query, $3),
+			ts_headline('simple', translate(array_to_string(tags, ', '), $4, ''), query, $3)
+		FROM music, to_tsquery('simple', $1) AS query
+		WHERE search_vector @@ query AND deleted_at IS NULL
+		ORDER BY score DESC, music_id DESC
+		LIMIT $2`, tsquery, limit, headlineOptions, headlineStart+headlineStop)
+	if err != nil {
+		return nil, err
+	}
+	results, err := scanSearchResults(rows, model.SearchMatchFullText)
+	if err != nil || len(results) > 0 {
+		return results, err
+	}
+
+	// Запрос с опечаткой: ищем ближайшие по триграммам. Оператор <% использует
+	// GIN-индекс по search_text, порог задаётся только на время транзакции.
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)", strconv.FormatFloat(fuzzyThreshold, 'f', -1, 64))
+	if err != nil {
+		return nil, err
+	}
+	rows, err = tx.Query(ctx, `
+		SELECT `+musicColumns+`, word_similarity($1, search_text) AS score, title, artist, album, array_to_string(tags, ', ')
+		FROM music
+		WHERE $1 <% search_text AND deleted_at IS NULL
+		ORDER BY score DESC, music_id DESC
+		LIMIT $2`, strings.ToLower(q), limit)
+	if err != nil {
+		return nil, err
+	}
+	results, err = scanSearchResults(rows, model.SearchMatchFuzzy)
+	if err != nil {
+		return nil, err
+	}
+	return results, tx.Commit(ctx)
+}
+
+func scanSearchResults(rows pgx.Rows, matchType string) ([]model.SearchResult, error) {
+	defer rows.Close()
+
+	var results []model.SearchResult
+	for rows.Next() {
+		var score float64
+		var title, artist, album, tags string
+		m, err := scanMusic(rows, &score, &title, &artist, &album, &tags)
+		if err != nil {
+			return nil, err
+		}
+
+		result := model.SearchResult{Music: *m, Score: score, MatchType: matchType}
+		// Подсветка есть только у полнотекстовых совпадений и только в совпавших полях
+		if matchType == model.SearchMatchFullText {
+			result.Highlights = make(map[string]string)
+			for field, text := range map[string]string{"title": title, "artist": artist, "album": album, "tags": tags} {
+				if strings.Contains(text, headlineStart) {
+					result.Highlights[field] = highlightHTML(text)
+				}
+			}
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// highlightMarkup заменяет маркеры ts_headline тегами подсветки
+var highlightMarkup = strings.NewReplacer(headlineStart, "<mark>", headlineStop, "</mark>")
+
+// highlightHTML экранирует фрагмент с маркерами ts_headline и обрамляет совпадения тегами <mark>
+func highlightHTML(text string) string {
+	return highlightMarkup.Replace(html.EscapeString(text))
+}
@@ -0,0 +1,243 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/contract"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// ErrTransferAlreadyLinked возвращается, если перевод токенов уже засчитан как покупка
+var ErrTransferAlreadyLinked = errors.New("перевод уже засчитан как покупка")
+
+func newTokenPrice(chainID uint64, token, symbol string, decimals uint8, amount string) *model.TokenPrice {
+	price := &model.TokenPrice{ChainID: chainID, Token: token, Symbol: symbol, Decimals: decimals, Amount: amount}
+	if value, ok := new(big.Int).SetString(amount, 10); ok {
+		price.Display = contract.FormatUnits(value, decimals)
+		if symbol != "" {
+			price.Display += " " + symbol
+		}
+	}
+	return price
+}
+
+// linkTokenTransferQuery засчитывает перевод как покупку, если он однозначно подходит
+// ровно одному треку: получатель — владелец трека, у которого в блоке перевода
+// действовала цена в этом токене, сумма не меньше той цены, и отправитель этот трек
+// ещё не покупал
+const linkTokenTransferQuery = `
+	UPDATE token_transfers t SET music_id = c.music_id
+	FROM (
+		SELECT min(m.music_id) AS music_id
+		FROM token_transfers t2
+		JOIN token_price_history h ON h.chain_id = t2.chain_id AND lower(h.token_addr) = lower(t2.token_addr)
+			AND h.from_block <= t2.block_number AND (h.until_block IS NULL OR h.until_block > t2.block_number)
+			AND t2.amount >= h.amount
+		JOIN music m ON m.music_id = h.music_id AND lower(m.owner_addr) = lower(t2.to_addr)
+		WHERE t2.chain_id = $1 AND t2.tx_hash = $2 AND t2.log_index = $3 AND t2.music_id IS NULL
+			AND NOT EXISTS (SELECT 1 FROM token_transfers p WHERE p.music_id = m.music_id AND lower(p.from_addr) = lower(t2.from_addr))
+		HAVING count(*) = 1
+	) c
+	WHERE t.chain_id = $1 AND t.tx_hash = $2 AND t.log_index = $3`
+
+// GetERC20Token возвращает сохранённые метаданные токена
+func (p *Postgres) GetERC20Token(ctx context.Context, chainID uint64, address string) (*model.ERC20Token, error) {
+	token := model.ERC20Token{ChainID: chainID}
+	var decimals int16
+	err := p.conn.QueryRow(ctx, "SELECT token_addr, symbol, name, decimals FROM erc20_tokens WHERE chain_id = $1 AND lower(token_addr) = lower($2)",
+		int64(chainID), address).Scan(&token.Address, &token.Symbol, &token.Name, &decimals)
+	if err != nil {
+		return nil, err
+	}
+	token.Decimals = uint8(decimals)
+	return &token, nil
+}
+
+// SaveERC20Token сохраняет метаданные токена
+func (p *Postgres) SaveERC20Token(ctx context.Context, token model.ERC20Token) error {
+	_, err := p.conn.Exec(ctx, `INSERT INTO erc20_tokens (chain_id, token_addr, symbol, name, decimals) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (chain_id, token_addr) DO UPDATE SET symbol = EXCLUDED.symbol, name = EXCLUDED.name, decimals = EXCLUDED.decimals`,
+		int64(token.ChainID), token.Address, token.Symbol, token.Name, int16(token.Decimals))
+	return err
+}
+
+// SetMusicTokenPriceAudited назначает трек цену в токене (nil — снимает её) и записывает
+// изменение в журнал аудита. Прежняя цена в истории действует до блока untilBlock её
+// сети, новая — с блока fromBlock своей.
+func (p *Postgres) SetMusicTokenPriceAudited(ctx context.Context, musicID int, price *model.TokenPrice, untilBlock, fromBlock uint64, entry model.AuditEntry) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "UPDATE token_price_history SET until_block = $1 WHERE music_id = $2 AND until_block IS NULL",
+		int64(untilBlock), musicID)
+	if err != nil {
+		return err
+	}
+	if price != nil {
+		_, err = tx.Exec(ctx, `INSERT INTO token_price_history (music_id, chain_id, token_addr, symbol, decimals, amount, from_block)
+			VALUES ($1, $2, $3, $4, $5, $6::numeric, $7)`,
+			musicID, int64(price.ChainID), price.Token, price.Symbol, int16(price.Decimals), price.Amount, int64(fromBlock))
+		if err != nil {
+			return err
+		}
+	}
+
+	if price == nil {
+		_, err = tx.Exec(ctx, `UPDATE music SET price_token_chain_id = NULL, price_token_addr = NULL, price_token_symbol = NULL,
+			price_token_decimals = NULL, price_token_amount = NULL WHERE music_id = $1`, musicID)
+	} else {
+		_, err = tx.Exec(ctx, `UPDATE music SET price_token_chain_id = $1, price_token_addr = $2, price_token_symbol = $3,
+			price_token_decimals = $4, price_token_amount = $5::numeric WHERE music_id = $6`,
+			int64(price.ChainID), price.Token, price.Symbol, int16(price.Decimals), price.Amount, musicID)
+	}
+	if err != nil {
+		return err
+	}
+	if err := appendAuditEntry(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// GetTokenPriceAt возвращает цену трека в токене, действовавшую в блоке block сети
+// chainID, или nil, если цены в этой сети тогда не было
+func (p *Postgres) GetTokenPriceAt(ctx context.Context, musicID int, chainID, block uint64) (*model.TokenPrice, error) {
+	var token, symbol, amount string
+	var decimals int16
+	err := p.conn.QueryRow(ctx, `SELECT token_addr, symbol, decimals, amount::text FROM token_price_history
+		WHERE music_id = $1 AND chain_id = $2 AND from_block <= $3 AND (until_block IS NULL OR until_block > $3)
+		ORDER BY price_id DESC LIMIT 1`,
+		musicID, int64(chainID), int64(block)).Scan(&token, &symbol, &decimals, &amount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newTokenPrice(chainID, token, symbol, uint8(decimals), amount), nil
+}
+
+// GetTokenWatch возвращает токены, в которых назначены цены треков сети, и владельцев
+// этих треков — получателей переводов, которые отслеживает индексатор
+func (p *Postgres) GetTokenWatch(ctx context.Context, chainID uint64) (tokens, owners []string, err error) {
+	err = p.conn.QueryRow(ctx, `SELECT COALESCE(array_agg(DISTINCT lower(price_token_addr)), '{}'), COALESCE(array_agg(DISTINCT lower(owner_addr)), '{}')
+		FROM music WHERE price_token_chain_id = $1 AND price_token_addr IS NOT NULL`, int64(chainID)).Scan(&tokens, &owners)
+	return tokens, owners, err
+}
+
+const tokenTransferColumns = "tx_hash, log_index, token_addr, from_addr, to_addr, amount::text, block_number, block_time, music_id"
+
+func scanTokenTransfer(row pgx.Row, chainID uint64) (*model.TokenTransfer, error) {
+	t := model.TokenTransfer{ChainID: chainID}
+	var blockNumber, logIndex int64
+	if err := row.Scan(&t.TxHash, &logIndex, &t.TokenAddr, &t.FromAddr, &t.ToAddr, &t.Amount, &blockNumber, &t.BlockTime, &t.MusicID); err != nil {
+		return nil, err
+	}
+	t.LogIndex, t.BlockNumber = uint(logIndex), uint64(blockNumber)
+	return &t, nil
+}
+
+// GetTokenTransfersByTx возвращает проиндексированные переводы транзакции
+func (p *Postgres) GetTokenTransfersByTx(ctx context.Context, chainID uint64, txHash string) ([]model.TokenTransfer, error) {
+	rows, err := p.conn.Query(ctx, "SELECT "+tokenTransferColumns+" FROM token_transfers WHERE chain_id = $1 AND lower(tx_hash) = lower($2) ORDER BY log_index",
+		int64(chainID), txHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []model.TokenTransfer
+	for rows.Next() {
+		t, err := scanTokenTransfer(rows, chainID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *t)
+	}
+	return result, rows.Err()
+}
+
+// SaveTokenTransfers сохраняет переводы, найденные вне индексатора, без автоматической
+// привязки к трекам
+func (p *Postgres) SaveTokenTransfers(ctx context.Context, transfers []model.TokenTransfer) error {
+	for _, t := range transfers {
+		_, err := p.conn.Exec(ctx, `INSERT INTO token_transfers (chain_id, tx_hash, log_index, token_addr, from_addr, to_addr, amount, block_number, block_time)
+			VALUES ($1, $2, $3, $4, $5, $6, $7::numeric, $8, $9) ON CONFLICT (chain_id, tx_hash, log_index) DO NOTHING`,
+			int64(t.ChainID), t.TxHash, int64(t.LogIndex), t.TokenAddr, t.FromAddr, t.ToAddr, t.Amount, int64(t.BlockNumber), t.BlockTime)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LinkTokenPurchaseAudited засчитывает перевод как покупку трека и записывает это
+// в журнал аудита. ErrTransferAlreadyLinked — перевод уже засчитан за другой трек.
+func (p *Postgres) LinkTokenPurchaseAudited(ctx context.Context, t model.TokenTransfer, musicID int, entry model.AuditEntry) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `UPDATE token_transfers SET music_id = $1
+		WHERE chain_id = $2 AND lower(tx_hash) = lower($3) AND log_index = $4 AND music_id IS NULL`,
+		musicID, int64(t.ChainID), t.TxHash, int64(t.LogIndex))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTransferAlreadyLinked
+	}
+	if err := appendAuditEntry(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// GetMusicAccess ищет покупку трека кошельком: в контракте напрямую, через ретранслятор
+// или переводом токенов. Возвращает nil, если покупки нет.
+func (p *Postgres) GetMusicAccess(ctx context.Context, music model.Music, wallet string) (*model.MusicAccess, error) {
+	access := &model.MusicAccess{MusicID: music.ID, Wallet: wallet, HasAccess: true}
+	var chainID int64
+	err := p.conn.QueryRow(ctx, `SELECT via, chain_id, tx_hash FROM (
+			SELECT $3::text AS via, p.chain_id, p.tx_hash, p.block_time
+			FROM audio_purchases p
+			WHERE p.chain_id = $1 AND p.audio_id = $2 AND lower(p.buyer_addr) = lower($6)
+			UNION ALL
+			SELECT $4::text, r.chain_id, r.tx_hash, r.updated_at
+			FROM relay_intents r
+			WHERE r.chain_id = $1 AND r.audio_id = $2 AND r.intent_type = $8 AND r.status = $9 AND lower(r.signer_addr) = lower($6)
+			UNION ALL
+			SELECT $5::text, t.chain_id, t.tx_hash, t.block_time
+			FROM token_transfers t
+			WHERE t.music_id = $7 AND lower(t.from_addr) = lower($6)
+		) a ORDER BY block_time LIMIT 1`,
+		musicChainKey(music.ChainID), musicChainKey(music.AudioID),
+		model.AccessViaPurchase, model.AccessViaRelayPurchase, model.AccessViaTokenPurchase,
+		wallet, music.ID, model.RelayIntentPurchase, model.RelayStatusConfirmed).
+		Scan(&access.Via, &chainID, &access.TxHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	access.ChainID = uint64(chainID)
+	return access, nil
+}
+
+// musicChainKey подставляет -1 вместо отсутствующей публикации: такой ключ не совпадёт
+// ни с одной покупкой в контракте
+func musicChainKey(v *int64) int64 {
+	if v == nil {
+		return -1
+	}
+	return *v
+}
@@ -0,0 +1,152 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// ErrTransferNotPending возвращается, если передача уже завершена, отменена или трек сменил владельца
+var ErrTransferNotPending = errors.New("передача не ожидает подтверждения")
+
+// ErrPendingTransferExists возвращается, если одновременно созданное предложение
+// передачи того же трека уже ожидает подтверждения
+var ErrPendingTransferExists = errors.New("у трека уже есть ожидающая передача")
+
+const transferColumns = "transfer_id, music_id, from_addr, to_addr, status, offer_message, offer_signature, accept_message, accept_signature, created_at, expires_at, completed_at"
+
+func scanTransfer(row pgx.Row) (*model.OwnershipTransfer, error) {
+	var t model.OwnershipTransfer
+	err := row.Scan(&t.ID, &t.MusicID, &t.FromAddr, &t.ToAddr, &t.Status, &t.OfferMessage, &t.OfferSignature,
+		&t.AcceptMessage, &t.AcceptSignature, &t.CreatedAt, &t.ExpiresAt, &t.CompletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (p *Postgres) queryTransfers(ctx context.Context, where string, args ...interface{}) ([]model.OwnershipTransfer, error) {
+	rows, err := p.conn.Query(ctx, "SELECT "+transferColumns+" FROM ownership_transfers WHERE "+where+" ORDER BY transfer_id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []model.OwnershipTransfer
+	for rows.Next() {
+		t, err := scanTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, *t)
+	}
+	return transfers, rows.Err()
+}
+
+func (p *Postgres) GetTransfer(ctx context.Context, id int) (*model.OwnershipTransfer, error) {
+	return scanTransfer(p.conn.QueryRow(ctx, "SELECT "+transferColumns+" FROM ownership_transfers WHERE transfer_id = $1", id))
+}
+
+// GetTransfersByMusic возвращает передачи трека, начиная с последней
+func (p *Postgres) GetTransfersByMusic(ctx context.Context, musicID int) ([]model.OwnershipTransfer, error) {
+	return p.queryTransfers(ctx, "music_id = $1", musicID)
+}
+
+// GetTransfersByAddress возвращает передачи, в которых адрес отправитель или получатель
+func (p *Postgres) GetTransfersByAddress(ctx context.Context, address string) ([]model.OwnershipTransfer, error) {
+	return p.queryTransfers(ctx, "lower(from_addr) = lower($1) OR lower(to_addr) = lower($1)", address)
+}
+
+// CreateTransferOffer сохраняет предложение передачи, отменяя предыдущее незавершённое
+// предложение по тому же треку
+func (p *Postgres) CreateTransferOffer(ctx context.Context, transfer model.OwnershipTransfer, entry model.AuditEntry) (int, error) {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "UPDATE ownership_transfers SET status = $1, completed_at = now() WHERE music_id = $2 AND status = $3",
+		model.TransferCancelled, transfer.MusicID, model.TransferPending)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = tx.QueryRow(ctx, `INSERT INTO ownership_transfers (music_id, from_addr, to_addr, status, offer_message, offer_signature, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING transfer_id`,
+		transfer.MusicID, transfer.FromAddr, transfer.ToAddr, model.TransferPending, transfer.OfferMessage, transfer.OfferSignature, transfer.ExpiresAt).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrPendingTransferExists
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := appendAuditEntry(ctx, tx, entry); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit(ctx)
+}
+
+// AcceptTransfer переводит трек получателю, если передача ожидает подтверждения
+// и отправитель всё ещё владеет треком
+func (p *Postgres) AcceptTransfer(ctx context.Context, id int, acceptMessage, acceptSignature string, entry model.AuditEntry) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var musicID int
+	var toAddr string
+	err = tx.QueryRow(ctx, `UPDATE ownership_transfers SET status = $1, accept_message = $2, accept_signature = $3, completed_at = now()
+		WHERE transfer_id = $4 AND status = $5 AND expires_at > now()
+		RETURNING music_id, to_addr`,
+		model.TransferAccepted, acceptMessage, acceptSignature, id, model.TransferPending).Scan(&musicID, &toAddr)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrTransferNotPending
+	}
+	if err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `UPDATE music SET owner_addr = $1 WHERE music_id = $2
+		AND lower(owner_addr) = (SELECT lower(from_addr) FROM ownership_transfers WHERE transfer_id = $3)`, toAddr, musicID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrTransferNotPending
+	}
+
+	if err := appendAuditEntry(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// CancelTransfer отменяет ожидающую передачу
+func (p *Postgres) CancelTransfer(ctx context.Context, id int, entry model.AuditEntry) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, "UPDATE ownership_transfers SET status = $1, completed_at = now() WHERE transfer_id = $2 AND status = $3",
+		model.TransferCancelled, id, model.TransferPending)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrTransferNotPending
+	}
+
+	if err := appendAuditEntry(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
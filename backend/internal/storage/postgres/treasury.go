@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/polonkoevv/ethcourse/internal/contract"
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// GetTreasuryTotals возвращает начисленную и выведенную комиссию сети за всё время.
+// Комиссия считается для каждой покупки с округлением вниз, как в контракте.
+func (p *Postgres) GetTreasuryTotals(ctx context.Context, chainID uint64) (*model.TreasuryTotals, error) {
+	var totals model.TreasuryTotals
+	err := p.conn.QueryRow(ctx, `SELECT
+			(SELECT count(*) FROM audio_purchases WHERE chain_id = $1),
+			(SELECT COALESCE(sum(div(amount_wei * $2, 100)), 0)::text FROM audio_purchases WHERE chain_id = $1),
+			(SELECT count(*) FROM fee_withdrawals WHERE chain_id = $1),
+			(SELECT COALESCE(sum(amount_wei), 0)::text FROM fee_withdrawals WHERE chain_id = $1)`,
+		int64(chainID), contract.PlatformFeePercent).
+		Scan(&totals.Purchases, &totals.AccruedFeeWei, &totals.Withdrawals, &totals.WithdrawnWei)
+	if err != nil {
+		return nil, err
+	}
+	return &totals, nil
+}
+
+// treasuryConditions строит условие отбора покупок и выводов по сети и времени блока
+func treasuryConditions(filter model.TreasuryFilter, args []interface{}) (string, []interface{}) {
+	var conds []string
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.ChainID != nil {
+		conds = append(conds, "chain_id = "+arg(int64(*filter.ChainID)))
+	}
+	if filter.From != nil {
+		conds = append(conds, "block_time >= "+arg(*filter.From))
+	}
+	if filter.To != nil {
+		conds = append(conds, "block_time < "+arg(*filter.To))
+	}
+	if len(conds) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// GetTreasuryPeriods агрегирует начисленную с покупок и выведенную комиссию по периодам и сетям
+func (p *Postgres) GetTreasuryPeriods(ctx context.Context, filter model.TreasuryFilter) ([]model.TreasuryPeriod, error) {
+	where, args := treasuryConditions(filter, []interface{}{filter.GroupBy, contract.PlatformFeePercent})
+
+	rows, err := p.conn.Query(ctx, `WITH fees AS (
+			SELECT date_trunc($1, block_time AT TIME ZONE 'UTC') AS period, chain_id,
+				count(*) AS purchases, sum(amount_wei) AS gross, sum(div(amount_wei * $2, 100)) AS fee
+			FROM audio_purchases `+where+`
+			GROUP BY 1, 2
+		), withdrawals AS (
+			SELECT date_trunc($1, block_time AT TIME ZONE 'UTC') AS period, chain_id,
+				count(*) AS withdrawals, sum(amount_wei) AS withdrawn
+			FROM fee_withdrawals `+where+`
+			GROUP BY 1, 2
+		)
+		SELECT COALESCE(f.period, w.period), COALESCE(f.chain_id, w.chain_id),
+			COALESCE(f.purchases, 0), COALESCE(f.gross, 0)::text, COALESCE(f.fee, 0)::text,
+			COALESCE(w.withdrawals, 0), COALESCE(w.withdrawn, 0)::text
+		FROM fees f FULL JOIN withdrawals w ON w.period = f.period AND w.chain_id = f.chain_id
+		ORDER BY 1, 2`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []model.TreasuryPeriod
+	for rows.Next() {
+		var t model.TreasuryPeriod
+		var chainID int64
+		if err := rows.Scan(&t.Period, &chainID, &t.Purchases, &t.GrossWei, &t.AccruedFeeWei, &t.Withdrawals, &t.WithdrawnWei); err != nil {
+			return nil, err
+		}
+		t.ChainID = uint64(chainID)
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
+
+// GetFeeWithdrawals возвращает выводы комиссии в порядке цепочки
+func (p *Postgres) GetFeeWithdrawals(ctx context.Context, filter model.TreasuryFilter) ([]model.FeeWithdrawal, error) {
+	where, args := treasuryConditions(filter, nil)
+
+	rows, err := p.conn.Query(ctx, `SELECT chain_id, tx_hash IS NOT NULL, COALESCE(tx_hash, ''), block_number, tx_index, block_time,
+			COALESCE(caller_addr, ''), COALESCE(recipient_addr, ''), amount_wei::text
+		FROM fee_withdrawals `+where+`
+		ORDER BY block_time, chain_id, block_number, tx_index NULLS LAST`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []model.FeeWithdrawal
+	for rows.Next() {
+		var w model.FeeWithdrawal
+		var chainID, blockNumber int64
+		var txIndex *int64
+		if err := rows.Scan(&chainID, &w.Attributed, &w.TxHash, &blockNumber, &txIndex, &w.BlockTime, &w.CallerAddr, &w.RecipientAddr, &w.AmountWei); err != nil {
+			return nil, err
+		}
+		w.ChainID, w.BlockNumber = uint64(chainID), uint64(blockNumber)
+		if txIndex != nil {
+			v := uint(*txIndex)
+			w.TxIndex = &v
+		}
+		result = append(result, w)
+	}
+	return result, rows.Err()
+}
+
+// GetTreasuryOpeningBalance возвращает сохранённый начальный баланс контракта сети
+func (p *Postgres) GetTreasuryOpeningBalance(ctx context.Context, chainID uint64, contractAddr string) (*model.TreasuryOpeningBalance, error) {
+	b := model.TreasuryOpeningBalance{ChainID: chainID}
+	var blockNumber int64
+	err := p.conn.QueryRow(ctx,
+		"SELECT contract_addr, block_number, balance_wei::text FROM treasury_opening_balances WHERE chain_id = $1 AND contract_addr = $2",
+		int64(chainID), strings.ToLower(contractAddr)).
+		Scan(&b.ContractAddr, &blockNumber, &b.BalanceWei)
+	if err != nil {
+		return nil, err
+	}
+	b.BlockNumber = uint64(blockNumber)
+	return &b, nil
+}
+
+// SaveTreasuryOpeningBalance сохраняет начальный баланс контракта, если он ещё не сохранён
+func (p *Postgres) SaveTreasuryOpeningBalance(ctx context.Context, b model.TreasuryOpeningBalance) error {
+	_, err := p.conn.Exec(ctx,
+		`INSERT INTO treasury_opening_balances (chain_id, contract_addr, block_number, balance_wei)
+		 VALUES ($1, $2, $3, $4::numeric) ON CONFLICT (chain_id, contract_addr) DO NOTHING`,
+		int64(b.ChainID), strings.ToLower(b.ContractAddr), int64(b.BlockNumber), b.BalanceWei)
+	return err
+}
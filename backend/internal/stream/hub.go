@@ -0,0 +1,180 @@
+// Package stream рассылает события цепочки подписчикам /events.
+package stream
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/polonkoevv/ethcourse/internal/model"
+)
+
+// Размер буфера подписки; подписчик, не успевающий читать, отключается
+// и продолжает с Last-Event-ID после переподключения
+const subscriptionBuffer = 256
+
+// Порядок событий внутри блока: сначала транзакции, затем логи
+const (
+	kindTransaction = 0
+	kindLog         = 1
+)
+
+// Position — положение события в цепочке
+type Position struct {
+	Block uint64
+	Kind  int
+	Index uint
+}
+
+// TransactionID возвращает ID события транзакции с индексом index в блоке
+func TransactionID(block uint64, index uint) string {
+	return Position{Block: block, Kind: kindTransaction, Index: index}.String()
+}
+
+// LogID возвращает ID события лога
+func LogID(block uint64, logIndex uint) string {
+	return Position{Block: block, Kind: kindLog, Index: logIndex}.String()
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d-%d-%d", p.Block, p.Kind, p.Index)
+}
+
+// Less сообщает, что событие p предшествует q
+func (p Position) Less(q Position) bool {
+	if p.Block != q.Block {
+		return p.Block < q.Block
+	}
+	if p.Kind != q.Kind {
+		return p.Kind < q.Kind
+	}
+	return p.Index < q.Index
+}
+
+// ParseID разбирает ID события
+func ParseID(id string) (Position, error) {
+	var p Position
+	if _, err := fmt.Sscanf(id, "%d-%d-%d", &p.Block, &p.Kind, &p.Index); err != nil {
+		return p, fmt.Errorf("некорректный ID события: %s", id)
+	}
+	return p, nil
+}
+
+// Subscription — подписка на события; канал Events закрывается при отключении
+type Subscription struct {
+	Filter model.StreamFilter
+	Events chan model.StreamEvent
+}
+
+// Hub хранит подписки и рассылает им события
+type Hub struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe регистрирует подписку
+func (h *Hub) Subscribe(filter model.StreamFilter) *Subscription {
+	sub := &Subscription{Filter: filter, Events: make(chan model.StreamEvent, subscriptionBuffer)}
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe удаляет подписку и закрывает её канал
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.Events)
+	}
+}
+
+// Len возвращает число подписок
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// Addresses возвращает адреса подписчиков сети в нижнем регистре: транзакции ищутся
+// только для них
+func (h *Hub) Addresses(chainID uint64) map[string]bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	addresses := make(map[string]bool)
+	for sub := range h.subs {
+		if sub.Filter.ChainID == chainID && sub.Filter.Address != "" {
+			addresses[strings.ToLower(sub.Filter.Address)] = true
+		}
+	}
+	return addresses
+}
+
+// Publish рассылает события подходящим подписчикам без блокировки
+func (h *Hub) Publish(events []model.StreamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		for _, event := range events {
+			if !Match(sub.Filter, event) {
+				continue
+			}
+			select {
+			case sub.Events <- ForSubscriber(sub.Filter, event):
+			default:
+				delete(h.subs, sub)
+				close(sub.Events)
+			}
+			if _, ok := h.subs[sub]; !ok {
+				break
+			}
+		}
+	}
+}
+
+// Match проверяет, что событие относится к подписке
+func Match(filter model.StreamFilter, event model.StreamEvent) bool {
+	if filter.ChainID != event.ChainID {
+		return false
+	}
+	if filter.MusicID != nil {
+		if event.MusicID == nil || *event.MusicID != *filter.MusicID {
+			return false
+		}
+	}
+	if filter.Address != "" {
+		for _, addr := range event.Addresses {
+			if strings.EqualFold(addr, filter.Address) {
+				return true
+			}
+		}
+		return false
+	}
+	return filter.MusicID != nil
+}
+
+// ForSubscriber задаёт направление транзакции относительно адреса подписки
+func ForSubscriber(filter model.StreamFilter, event model.StreamEvent) model.StreamEvent {
+	tx, ok := event.Data.(model.BlockchainTransaction)
+	if !ok || filter.Address == "" {
+		return event
+	}
+	isIncoming := strings.EqualFold(tx.To, filter.Address)
+	isOutgoing := strings.EqualFold(tx.From, filter.Address)
+	switch {
+	case isIncoming && isOutgoing:
+		tx.TransactionType = model.TxDirectionSelf
+	case isIncoming:
+		tx.TransactionType = model.TxDirectionIncoming
+	default:
+		tx.TransactionType = model.TxDirectionOutgoing
+	}
+	event.Data = tx
+	return event
+}
@@ -7,8 +7,499 @@ CREATE SEQUENCE IF NOT EXISTS music_music_id_seq;
 CREATE TABLE IF NOT EXISTS music (
     music_id smallint DEFAULT nextval('music_music_id_seq') PRIMARY KEY,
     title character varying(100),
-    cid character varying(100)
+    cid character varying(100),
+    owner_addr character varying(42),
+    signature character varying(132),
+    uploaded_at timestamp with time zone DEFAULT now()
 );
 
 -- Установка владельца последовательности
-ALTER SEQUENCE music_music_id_seq OWNED BY music.music_id;
\ No newline at end of file
+ALTER SEQUENCE music_music_id_seq OWNED BY music.music_id;
+
+-- Громкость по EBU R128 (заполняется фоновым анализом после загрузки)
+ALTER TABLE music ADD COLUMN IF NOT EXISTS integrated_loudness double precision;
+ALTER TABLE music ADD COLUMN IF NOT EXISTS loudness_range double precision;
+ALTER TABLE music ADD COLUMN IF NOT EXISTS true_peak double precision;
+
+-- Акустические отпечатки треков
+CREATE TABLE IF NOT EXISTS audio_fingerprints (
+    music_id smallint PRIMARY KEY REFERENCES music (music_id) ON DELETE CASCADE,
+    fingerprint integer[] NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now()
+);
+
+-- Инвертированный индекс суботпечатков для поиска совпадений
+CREATE TABLE IF NOT EXISTS fingerprint_hashes (
+    hash integer NOT NULL,
+    music_id smallint NOT NULL REFERENCES music (music_id) ON DELETE CASCADE,
+    position integer NOT NULL
+);
+CREATE INDEX IF NOT EXISTS fingerprint_hashes_hash_idx ON fingerprint_hashes (hash);
+CREATE INDEX IF NOT EXISTS fingerprint_hashes_music_id_idx ON fingerprint_hashes (music_id);
+
+-- Загрузки, совпавшие по звучанию с треком другого владельца.
+-- Внешних ключей нет: пометка сохраняется и после удаления отклонённого трека.
+CREATE TABLE IF NOT EXISTS duplicate_flags (
+    flag_id serial PRIMARY KEY,
+    music_id smallint NOT NULL,
+    matched_music_id smallint NOT NULL,
+    uploader_addr character varying(42) NOT NULL,
+    original_owner_addr character varying(42) NOT NULL,
+    bit_error_rate double precision NOT NULL,
+    status character varying(16) NOT NULL DEFAULT 'pending',
+    review_note text NOT NULL DEFAULT '',
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    reviewed_at timestamp with time zone
+);
+CREATE INDEX IF NOT EXISTS duplicate_flags_status_idx ON duplicate_flags (status);
+
+-- Один CID — один трек: повторная загрузка тех же байт возвращает существующую запись.
+-- Загрузки до появления ограничения могли создать несколько строк с одним CID: остаётся
+-- самая ранняя, пометки о дубликатах переносятся на неё, отпечатки удаляются каскадно.
+UPDATE duplicate_flags f SET music_id = d.keep_id
+FROM (SELECT music_id, min(music_id) OVER (PARTITION BY cid) AS keep_id FROM music) d
+WHERE f.music_id = d.music_id AND d.music_id <> d.keep_id;
+UPDATE duplicate_flags f SET matched_music_id = d.keep_id
+FROM (SELECT music_id, min(music_id) OVER (PARTITION BY cid) AS keep_id FROM music) d
+WHERE f.matched_music_id = d.music_id AND d.music_id <> d.keep_id;
+DELETE FROM music m USING music k WHERE m.cid = k.cid AND m.music_id > k.music_id;
+CREATE UNIQUE INDEX IF NOT EXISTS music_cid_key ON music (cid);
+
+-- Метаданные из формы загрузки
+ALTER TABLE music ADD COLUMN IF NOT EXISTS artist character varying(100) NOT NULL DEFAULT '';
+ALTER TABLE music ADD COLUMN IF NOT EXISTS genre character varying(50) NOT NULL DEFAULT '';
+
+-- Состояние трека в контракте AudioChain (заполняется индексатором)
+ALTER TABLE music ADD COLUMN IF NOT EXISTS audio_id bigint;
+ALTER TABLE music ADD COLUMN IF NOT EXISTS price_wei numeric(78, 0);
+ALTER TABLE music ADD COLUMN IF NOT EXISTS purchase_count integer NOT NULL DEFAULT 0;
+
+-- Индексы для фильтров и сортировок каталога (выражения совпадают с запросами ListMusic)
+CREATE INDEX IF NOT EXISTS music_uploaded_at_idx ON music (uploaded_at DESC, music_id DESC);
+CREATE INDEX IF NOT EXISTS music_title_sort_idx ON music ((COALESCE(lower(title), '')), music_id);
+CREATE INDEX IF NOT EXISTS music_price_idx ON music ((COALESCE(price_wei, 1e78)), music_id);
+CREATE INDEX IF NOT EXISTS music_popularity_idx ON music (purchase_count DESC, music_id DESC);
+CREATE INDEX IF NOT EXISTS music_owner_addr_idx ON music (lower(owner_addr));
+CREATE INDEX IF NOT EXISTS music_artist_idx ON music (lower(artist));
+CREATE INDEX IF NOT EXISTS music_genre_idx ON music (lower(genre));
+CREATE INDEX IF NOT EXISTS music_audio_id_idx ON music (audio_id);
+
+-- События контракта AudioChain
+CREATE TABLE IF NOT EXISTS audio_published (
+    audio_id bigint PRIMARY KEY,
+    owner_addr character varying(42) NOT NULL,
+    ipfs_hash text NOT NULL,
+    price_wei numeric(78, 0) NOT NULL,
+    block_number bigint NOT NULL,
+    block_time timestamp with time zone NOT NULL,
+    tx_hash character varying(66) NOT NULL,
+    log_index integer NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audio_published_ipfs_hash_idx ON audio_published (ipfs_hash, lower(owner_addr));
+
+CREATE TABLE IF NOT EXISTS audio_purchases (
+    tx_hash character varying(66) NOT NULL,
+    log_index integer NOT NULL,
+    audio_id bigint NOT NULL,
+    buyer_addr character varying(42) NOT NULL,
+    seller_addr character varying(42) NOT NULL,
+    amount_wei numeric(78, 0) NOT NULL,
+    block_number bigint NOT NULL,
+    block_time timestamp with time zone NOT NULL,
+    PRIMARY KEY (tx_hash, log_index)
+);
+CREATE INDEX IF NOT EXISTS audio_purchases_audio_id_idx ON audio_purchases (audio_id);
+
+-- Позиция индексатора
+CREATE TABLE IF NOT EXISTS indexer_state (
+    name text PRIMARY KEY,
+    last_block bigint NOT NULL,
+    updated_at timestamp with time zone NOT NULL DEFAULT now()
+);
+
+-- Полнотекстовый поиск
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE music ADD COLUMN IF NOT EXISTS album character varying(100) NOT NULL DEFAULT '';
+ALTER TABLE music ADD COLUMN IF NOT EXISTS tags text[] NOT NULL DEFAULT '{}';
+ALTER TABLE music ADD COLUMN IF NOT EXISTS search_vector tsvector;
+ALTER TABLE music ADD COLUMN IF NOT EXISTS search_text text NOT NULL DEFAULT '';
+
+-- Веса: название (A) > исполнитель (B) > альбом (C) > теги (D).
+-- Конфигурация simple: каталог смешанный (русский и английский), стемминг не нужен.
+CREATE OR REPLACE FUNCTION music_search_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('simple', coalesce(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(NEW.artist, '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce(NEW.album, '')), 'C') ||
+        setweight(to_tsvector('simple', array_to_string(NEW.tags, ' ')), 'D');
+    NEW.search_text := lower(concat_ws(' ', NEW.title, NEW.artist, NEW.album, array_to_string(NEW.tags, ' ')));
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS music_search_update ON music;
+CREATE TRIGGER music_search_update BEFORE INSERT OR UPDATE OF title, artist, album, tags ON music
+    FOR EACH ROW EXECUTE FUNCTION music_search_update();
+
+-- Заполнение для уже существующих строк
+UPDATE music SET title = title WHERE search_vector IS NULL;
+
+CREATE INDEX IF NOT EXISTS music_search_vector_idx ON music USING gin (search_vector);
+CREATE INDEX IF NOT EXISTS music_search_text_trgm_idx ON music USING gin (search_text gin_trgm_ops);
+
+-- Журнал аудита подписанных действий. Внешнего ключа на music нет: записи об удалённых
+-- треках должны сохраняться. Каждая запись ссылается на хеш предыдущей записи общей
+-- цепочки, цепочки адреса и цепочки трека (формат хеша описан в internal/audit).
+CREATE TABLE IF NOT EXISTS audit_log (
+    entry_id serial PRIMARY KEY,
+    action character varying(32) NOT NULL,
+    music_id smallint,
+    recovered_addr character varying(42) NOT NULL,
+    message text NOT NULL DEFAULT '',
+    signature character varying(132) NOT NULL DEFAULT '',
+    details text NOT NULL DEFAULT '',
+    created_at timestamp with time zone NOT NULL,
+    prev_hash character(66) NOT NULL,
+    address_prev_hash character(66) NOT NULL,
+    music_prev_hash character(66) NOT NULL,
+    entry_hash character(66) NOT NULL UNIQUE
+);
+CREATE INDEX IF NOT EXISTS audit_log_music_id_idx ON audit_log (music_id);
+CREATE INDEX IF NOT EXISTS audit_log_recovered_addr_idx ON audit_log (recovered_addr);
+
+-- Одна подпись — одно действие: повтор перехваченного запроса отклоняется
+CREATE UNIQUE INDEX IF NOT EXISTS audit_log_signature_key ON audit_log (signature) WHERE signature <> '';
+
+-- Журнал только дополняется
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log допускает только добавление записей';
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+-- Передача треков между кошельками: предложение владельца и согласие получателя
+CREATE TABLE IF NOT EXISTS ownership_transfers (
+    transfer_id serial PRIMARY KEY,
+    music_id smallint NOT NULL REFERENCES music (music_id) ON DELETE RESTRICT,
+    from_addr character varying(42) NOT NULL,
+    to_addr character varying(42) NOT NULL,
+    status character varying(16) NOT NULL DEFAULT 'pending',
+    offer_message text NOT NULL,
+    offer_signature character varying(132) NOT NULL,
+    accept_message text NOT NULL DEFAULT '',
+    accept_signature character varying(132) NOT NULL DEFAULT '',
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    expires_at timestamp with time zone NOT NULL,
+    completed_at timestamp with time zone
+);
+CREATE INDEX IF NOT EXISTS ownership_transfers_music_id_idx ON ownership_transfers (music_id);
+CREATE INDEX IF NOT EXISTS ownership_transfers_from_addr_idx ON ownership_transfers (lower(from_addr));
+CREATE INDEX IF NOT EXISTS ownership_transfers_to_addr_idx ON ownership_transfers (lower(to_addr));
+-- У трека не больше одного ожидающего предложения
+CREATE UNIQUE INDEX IF NOT EXISTS ownership_transfers_pending_key ON ownership_transfers (music_id) WHERE status = 'pending';
+
+-- Распределение доходов от трека между участниками (доли в базисных пунктах)
+CREATE TABLE IF NOT EXISTS royalty_splits (
+    split_id serial PRIMARY KEY,
+    music_id smallint NOT NULL REFERENCES music (music_id) ON DELETE RESTRICT,
+    proposer_addr character varying(42) NOT NULL,
+    status character varying(16) NOT NULL DEFAULT 'pending',
+    proposal_message text NOT NULL,
+    proposal_signature character varying(132) NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    activated_at timestamp with time zone
+);
+CREATE INDEX IF NOT EXISTS royalty_splits_music_id_idx ON royalty_splits (music_id);
+-- У трека не больше одного действующего распределения
+CREATE UNIQUE INDEX IF NOT EXISTS royalty_splits_active_key ON royalty_splits (music_id) WHERE status = 'active';
+
+CREATE TABLE IF NOT EXISTS royalty_split_shares (
+    split_id integer NOT NULL REFERENCES royalty_splits (split_id) ON DELETE CASCADE,
+    address character varying(42) NOT NULL,
+    bps integer NOT NULL CHECK (bps > 0 AND bps <= 10000),
+    role character varying(64) NOT NULL DEFAULT '',
+    approval_message text NOT NULL DEFAULT '',
+    approval_signature character varying(132) NOT NULL DEFAULT '',
+    approved_at timestamp with time zone,
+    PRIMARY KEY (split_id, address)
+);
+CREATE INDEX IF NOT EXISTS royalty_split_shares_address_idx ON royalty_split_shares (lower(address));
+
+-- Аналитика продаж по продавцам и периодам
+CREATE INDEX IF NOT EXISTS audio_purchases_seller_addr_idx ON audio_purchases (lower(seller_addr), block_time);
+CREATE INDEX IF NOT EXISTS audio_purchases_block_time_idx ON audio_purchases (block_time);
+
+-- Несколько сетей: события и связь треков с контрактом различаются по chain_id.
+-- Ранее проиндексированные события относятся к Ganache (1337).
+ALTER TABLE audio_published ADD COLUMN IF NOT EXISTS chain_id bigint NOT NULL DEFAULT 1337;
+ALTER TABLE audio_published ALTER COLUMN chain_id DROP DEFAULT;
+ALTER TABLE audio_published DROP CONSTRAINT IF EXISTS audio_published_pkey;
+ALTER TABLE audio_published ADD PRIMARY KEY (chain_id, audio_id);
+
+ALTER TABLE audio_purchases ADD COLUMN IF NOT EXISTS chain_id bigint NOT NULL DEFAULT 1337;
+ALTER TABLE audio_purchases ALTER COLUMN chain_id DROP DEFAULT;
+ALTER TABLE audio_purchases DROP CONSTRAINT IF EXISTS audio_purchases_pkey;
+ALTER TABLE audio_purchases ADD PRIMARY KEY (chain_id, tx_hash, log_index);
+DROP INDEX IF EXISTS audio_purchases_audio_id_idx;
+CREATE INDEX IF NOT EXISTS audio_purchases_chain_audio_id_idx ON audio_purchases (chain_id, audio_id);
+CREATE INDEX IF NOT EXISTS audio_purchases_chain_block_idx ON audio_purchases (chain_id, block_number);
+CREATE INDEX IF NOT EXISTS audio_published_chain_block_idx ON audio_published (chain_id, block_number);
+
+ALTER TABLE music ADD COLUMN IF NOT EXISTS chain_id bigint;
+UPDATE music SET chain_id = 1337 WHERE audio_id IS NOT NULL AND chain_id IS NULL;
+DROP INDEX IF EXISTS music_audio_id_idx;
+CREATE INDEX IF NOT EXISTS music_chain_audio_id_idx ON music (chain_id, audio_id);
+
+-- Позиции индексаторов теперь включают chain ID: audiochain:<chain_id>:<адрес контракта>
+UPDATE indexer_state SET name = 'audiochain:1337:' || substr(name, length('audiochain:') + 1)
+    WHERE name ~ '^audiochain:0x';
+
+-- Публикация треков в контракт бэкендом через аккаунт ретранслятора
+ALTER TABLE music ADD COLUMN IF NOT EXISTS publish_status character varying(16) NOT NULL DEFAULT '';
+ALTER TABLE music ADD COLUMN IF NOT EXISTS publish_tx_hash character varying(66);
+ALTER TABLE music ADD COLUMN IF NOT EXISTS publisher_addr character varying(42);
+CREATE INDEX IF NOT EXISTS music_publish_tx_hash_idx ON music (publish_tx_hash) WHERE publish_tx_hash IS NOT NULL;
+
+-- Подписанные пользователями (EIP-712) намерения, которые исполняет ретранслятор
+CREATE TABLE IF NOT EXISTS relay_intents (
+    intent_id serial PRIMARY KEY,
+    chain_id bigint NOT NULL,
+    intent_type character varying(16) NOT NULL,
+    signer_addr character varying(42) NOT NULL,
+    nonce numeric(78, 0) NOT NULL,
+    deadline timestamp with time zone NOT NULL,
+    audio_id bigint,
+    music_id integer REFERENCES music (music_id) ON DELETE SET NULL,
+    value_wei numeric(78, 0) NOT NULL DEFAULT 0,
+    message text NOT NULL,
+    signature character varying(132) NOT NULL,
+    status character varying(16) NOT NULL DEFAULT 'pending',
+    tx_hash character varying(66),
+    raw_tx text NOT NULL DEFAULT '',
+    attempts integer NOT NULL DEFAULT 0,
+    submitted_at timestamp with time zone,
+    block_number bigint,
+    error text NOT NULL DEFAULT '',
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    updated_at timestamp with time zone NOT NULL DEFAULT now()
+);
+-- Nonce намерения используется адресом в сети один раз
+CREATE UNIQUE INDEX IF NOT EXISTS relay_intents_nonce_key ON relay_intents (chain_id, lower(signer_addr), nonce);
+CREATE INDEX IF NOT EXISTS relay_intents_signer_addr_idx ON relay_intents (lower(signer_addr), intent_id);
+CREATE INDEX IF NOT EXISTS relay_intents_active_idx ON relay_intents (intent_id) WHERE status IN ('pending', 'submitted');
+
+-- Все отправленные транзакции намерения: включена в блок может оказаться любая из замен
+CREATE TABLE IF NOT EXISTS relay_intent_txs (
+    tx_hash character varying(66) PRIMARY KEY,
+    intent_id integer NOT NULL REFERENCES relay_intents (intent_id) ON DELETE CASCADE,
+    submitted_at timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS relay_intent_txs_intent_id_idx ON relay_intent_txs (intent_id);
+
+-- Транзакции, отправленные с ключей бэкенда. Замены (ускорение, отмена) имеют тот же
+-- nonce; в блок попадает не больше одной транзакции с данным nonce.
+CREATE TABLE IF NOT EXISTS outgoing_transactions (
+    tx_hash character varying(66) PRIMARY KEY,
+    chain_id bigint NOT NULL,
+    from_addr character varying(42) NOT NULL,
+    nonce bigint NOT NULL,
+    to_addr character varying(42) NOT NULL,
+    value_wei numeric(78, 0) NOT NULL DEFAULT 0,
+    gas_limit bigint NOT NULL,
+    gas_fee_cap numeric(78, 0) NOT NULL, -- gasPrice для legacy-транзакций
+    gas_tip_cap numeric(78, 0),
+    raw_tx text NOT NULL,
+    purpose character varying(32) NOT NULL,
+    replaces character varying(66),
+    status character varying(16) NOT NULL DEFAULT 'pending',
+    replaced_by character varying(66),
+    block_number bigint,
+    error text NOT NULL DEFAULT '',
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    updated_at timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS outgoing_transactions_nonce_idx ON outgoing_transactions (chain_id, lower(from_addr), nonce);
+CREATE INDEX IF NOT EXISTS outgoing_transactions_pending_idx ON outgoing_transactions (chain_id, lower(from_addr), nonce) WHERE status = 'pending';
+-- Исходная транзакция на каждый nonce адреса одна: при гонке процессов вторая запись
+-- не пройдёт. Замены ссылаются на исходную, а у отклонённой узлами nonce свободен.
+-- Дубликаты, записанные до появления индекса, кроме попавшей в блок или первой,
+-- отмечаются заменёнными.
+WITH ranked AS (
+    SELECT tx_hash, row_number() OVER (
+        PARTITION BY chain_id, lower(from_addr), nonce
+        ORDER BY status IN ('confirmed', 'failed') DESC, created_at, tx_hash) AS n
+    FROM outgoing_transactions
+    WHERE replaces IS NULL AND status <> 'dropped'
+)
+UPDATE outgoing_transactions o SET status = 'replaced', error = 'повторный nonce', updated_at = now()
+FROM ranked r WHERE o.tx_hash = r.tx_hash AND r.n > 1;
+CREATE UNIQUE INDEX IF NOT EXISTS outgoing_transactions_nonce_key ON outgoing_transactions (chain_id, lower(from_addr), nonce)
+    WHERE replaces IS NULL AND status <> 'dropped';
+-- Подписанные транзакции намерений хранятся в outgoing_transactions
+ALTER TABLE relay_intents DROP COLUMN IF EXISTS raw_tx;
+
+-- Выводы комиссии платформы вызовом withdrawPlatformFees. Событий у вызова нет, поэтому
+-- индексатор находит блоки, в которых упал баланс контракта, и ищет в них вызов по
+-- селектору. Вывод, вызванный из другого контракта, записывается без транзакции
+-- (tx_hash пуст): известны только блок и сумма.
+CREATE TABLE IF NOT EXISTS fee_withdrawals (
+    chain_id bigint NOT NULL,
+    tx_hash character varying(66),
+    block_number bigint NOT NULL,
+    tx_index integer,
+    block_time timestamp with time zone NOT NULL,
+    caller_addr character varying(42),
+    recipient_addr character varying(42),
+    amount_wei numeric(78, 0) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS fee_withdrawals_block_time_idx ON fee_withdrawals (block_time);
+
+-- Цены в ERC-20 токенах. Метаданные токена читаются из его контракта один раз;
+-- символ и decimals копируются в трек, чтобы показывать цену без запроса к сети.
+CREATE TABLE IF NOT EXISTS erc20_tokens (
+    chain_id bigint NOT NULL,
+    token_addr character varying(42) NOT NULL,
+    symbol character varying(32) NOT NULL DEFAULT '',
+    name text NOT NULL DEFAULT '',
+    decimals smallint NOT NULL,
+    PRIMARY KEY (chain_id, token_addr)
+);
+
+ALTER TABLE music ADD COLUMN IF NOT EXISTS price_token_chain_id bigint;
+ALTER TABLE music ADD COLUMN IF NOT EXISTS price_token_addr character varying(42);
+ALTER TABLE music ADD COLUMN IF NOT EXISTS price_token_symbol character varying(32);
+ALTER TABLE music ADD COLUMN IF NOT EXISTS price_token_decimals smallint;
+ALTER TABLE music ADD COLUMN IF NOT EXISTS price_token_amount numeric(78, 0);
+CREATE INDEX IF NOT EXISTS music_price_token_idx ON music (price_token_chain_id, lower(price_token_addr)) WHERE price_token_addr IS NOT NULL;
+
+-- Переводы ERC-20 владельцам треков с ценой в токене. Перевод с music_id — покупка трека.
+CREATE TABLE IF NOT EXISTS token_transfers (
+    chain_id bigint NOT NULL,
+    tx_hash character varying(66) NOT NULL,
+    log_index integer NOT NULL,
+    token_addr character varying(42) NOT NULL,
+    from_addr character varying(42) NOT NULL,
+    to_addr character varying(42) NOT NULL,
+    amount numeric(78, 0) NOT NULL,
+    block_number bigint NOT NULL,
+    block_time timestamp with time zone NOT NULL,
+    music_id integer REFERENCES music (music_id) ON DELETE SET NULL,
+    PRIMARY KEY (chain_id, tx_hash, log_index)
+);
+CREATE INDEX IF NOT EXISTS token_transfers_music_idx ON token_transfers (music_id, lower(from_addr)) WHERE music_id IS NOT NULL;
+
+-- Метаданные NFT: длительность измеряется вместе с громкостью, обложку назначает владелец,
+-- metadata_cid — последняя закреплённая в IPFS версия JSON метаданных
+ALTER TABLE music ADD COLUMN IF NOT EXISTS duration_seconds double precision;
+ALTER TABLE music ADD COLUMN IF NOT EXISTS cover_cid text NOT NULL DEFAULT '';
+ALTER TABLE music ADD COLUMN IF NOT EXISTS metadata_cid text NOT NULL DEFAULT '';
+
+-- Депозиты покупателей у ретранслятора: покупку по намерению ретранслятор оплачивает
+-- только из ETH, заранее переведённого подписавшим на его адрес
+CREATE TABLE IF NOT EXISTS relay_deposits (
+    chain_id bigint NOT NULL,
+    tx_hash character varying(66) NOT NULL,
+    depositor_addr character varying(42) NOT NULL,
+    relayer_addr character varying(42) NOT NULL,
+    amount_wei numeric(78, 0) NOT NULL,
+    block_number bigint NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (chain_id, tx_hash)
+);
+CREATE INDEX IF NOT EXISTS relay_deposits_depositor_idx ON relay_deposits (chain_id, lower(depositor_addr));
+CREATE INDEX IF NOT EXISTS relay_intents_signer_chain_idx ON relay_intents (chain_id, lower(signer_addr), created_at);
+
+-- Пересылка владельцам долей продаж треков, опубликованных бэкендом: в контракте их
+-- владелец — ретранслятор, и выплату продавцу получает он. Одна пересылка на покупку.
+CREATE TABLE IF NOT EXISTS owner_payouts (
+    payout_id serial PRIMARY KEY,
+    chain_id bigint NOT NULL,
+    purchase_tx_hash character varying(66) NOT NULL,
+    purchase_log_index integer NOT NULL,
+    music_id integer NOT NULL REFERENCES music (music_id) ON DELETE RESTRICT,
+    recipient_addr character varying(42) NOT NULL,
+    amount_wei numeric(78, 0) NOT NULL,
+    status character varying(16) NOT NULL DEFAULT 'pending',
+    tx_hash character varying(66),
+    error text NOT NULL DEFAULT '',
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    updated_at timestamp with time zone NOT NULL DEFAULT now(),
+    UNIQUE (chain_id, purchase_tx_hash, purchase_log_index)
+);
+CREATE INDEX IF NOT EXISTS owner_payouts_recipient_idx ON owner_payouts (lower(recipient_addr), payout_id);
+CREATE INDEX IF NOT EXISTS owner_payouts_active_idx ON owner_payouts (payout_id) WHERE status IN ('pending', 'sent');
+
+-- Баланс контракта перед первым индексируемым блоком: средства, поступившие до начала
+-- индексации, в сверке комиссии показываются отдельно от начисленной с покупок
+CREATE TABLE IF NOT EXISTS treasury_opening_balances (
+    chain_id bigint NOT NULL,
+    contract_addr character varying(42) NOT NULL,
+    block_number bigint NOT NULL,
+    balance_wei numeric(78, 0) NOT NULL,
+    PRIMARY KEY (chain_id, contract_addr)
+);
+
+-- История передач владения и распределения доходов, по которым считаются выплаты,
+-- не удаляется вместе с треком: трек с ними удалить нельзя
+ALTER TABLE ownership_transfers DROP CONSTRAINT IF EXISTS ownership_transfers_music_id_fkey;
+ALTER TABLE ownership_transfers ADD CONSTRAINT ownership_transfers_music_id_fkey
+    FOREIGN KEY (music_id) REFERENCES music (music_id) ON DELETE RESTRICT;
+ALTER TABLE royalty_splits DROP CONSTRAINT IF EXISTS royalty_splits_music_id_fkey;
+ALTER TABLE royalty_splits ADD CONSTRAINT royalty_splits_music_id_fkey
+    FOREIGN KEY (music_id) REFERENCES music (music_id) ON DELETE RESTRICT;
+
+-- История цен треков в токенах: покупка переводом проверяется по цене, действовавшей
+-- в блоке перевода. Цена действует в блоках [from_block, until_block) сети chain_id;
+-- until_block пуст у текущей цены. Цены, назначенные до появления истории, считаются
+-- действующими с начала сети.
+CREATE TABLE IF NOT EXISTS token_price_history (
+    price_id serial PRIMARY KEY,
+    music_id integer NOT NULL REFERENCES music (music_id) ON DELETE CASCADE,
+    chain_id bigint NOT NULL,
+    token_addr character varying(42) NOT NULL,
+    symbol character varying(32) NOT NULL DEFAULT '',
+    decimals smallint NOT NULL,
+    amount numeric(78, 0) NOT NULL,
+    from_block bigint NOT NULL,
+    until_block bigint,
+    created_at timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS token_price_history_music_idx ON token_price_history (music_id, chain_id, from_block);
+CREATE UNIQUE INDEX IF NOT EXISTS token_price_history_current_key ON token_price_history (music_id) WHERE until_block IS NULL;
+INSERT INTO token_price_history (music_id, chain_id, token_addr, symbol, decimals, amount, from_block)
+SELECT music_id, price_token_chain_id, price_token_addr, COALESCE(price_token_symbol, ''), price_token_decimals, price_token_amount, 0
+FROM music m
+WHERE price_token_addr IS NOT NULL
+    AND NOT EXISTS (SELECT 1 FROM token_price_history h WHERE h.music_id = m.music_id);
+
+-- Депозит ретранслятора может перевести любой аккаунт в пользу адреса из данных
+-- перевода; funder_addr — отправитель перевода
+ALTER TABLE relay_deposits ADD COLUMN IF NOT EXISTS funder_addr character varying(42);
+UPDATE relay_deposits SET funder_addr = depositor_addr WHERE funder_addr IS NULL;
+ALTER TABLE relay_deposits ALTER COLUMN funder_addr SET NOT NULL;
+
+-- Выводы без найденной транзакции: ключ по хешу только у найденных, у остальных — один
+-- вывод на блок
+ALTER TABLE fee_withdrawals DROP CONSTRAINT IF EXISTS fee_withdrawals_pkey;
+ALTER TABLE fee_withdrawals ALTER COLUMN tx_hash DROP NOT NULL;
+ALTER TABLE fee_withdrawals ALTER COLUMN tx_index DROP NOT NULL;
+ALTER TABLE fee_withdrawals ALTER COLUMN caller_addr DROP NOT NULL;
+ALTER TABLE fee_withdrawals ALTER COLUMN recipient_addr DROP NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS fee_withdrawals_tx_key ON fee_withdrawals (chain_id, tx_hash) WHERE tx_hash IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS fee_withdrawals_unattributed_key ON fee_withdrawals (chain_id, block_number) WHERE tx_hash IS NULL;
+
+-- Название может быть пустым: ключ сортировки по названию — COALESCE(lower(title), '')
+DROP INDEX IF EXISTS music_title_idx;
+
+-- Трек с историей передач, распределений доходов или выплат при удалении скрывается
+-- из каталога и поиска, строка остаётся для истории
+ALTER TABLE music ADD COLUMN IF NOT EXISTS deleted_at timestamp with time zone;